@@ -11,7 +11,9 @@ import (
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/miloszbo/meals-finder/internal/auth"
 	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
 )
 
 func gracefulShutdown(apiServer *http.Server, done chan bool) {
@@ -34,9 +36,37 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 }
 
 func main() {
+	if err := server.CheckSecurity(server.CurrentSecuritySettings()); err != nil {
+		log.Fatal(err)
+	}
+
 	conn := server.NewConnection()
 	defer conn.Close(context.Background())
 
+	jobConn := server.NewJobConnection()
+	defer jobConn.Close(context.Background())
+
+	alertConn := server.NewJobConnection()
+	defer alertConn.Close(context.Background())
+
+	retentionConn := server.NewJobConnection()
+	defer retentionConn.Close(context.Background())
+
+	imageConn := server.NewJobConnection()
+	defer imageConn.Close(context.Background())
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	purgeJob := services.NewUserPurgeJob(jobConn)
+	go purgeJob.Run(jobCtx, services.UserPurgeInterval)
+	alertJob := services.NewSearchAlertJob(alertConn)
+	go alertJob.Run(jobCtx, services.SearchAlertInterval)
+	retentionJob := services.NewAuditRetentionJob(retentionConn)
+	go retentionJob.Run(jobCtx, services.AuditRetentionInterval)
+	imageJob := services.NewImagePlaceholderJob(imageConn)
+	go imageJob.Run(jobCtx, services.ImageBackfillInterval)
+	go auth.WatchKeys(jobCtx, auth.Keys(), auth.KeysReloadInterval)
+
 	server := server.NewServer()
 
 	done := make(chan bool, 1)
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// File the JWT keys are read from, one "<id> <secret>" per line with the
+// signing key first; the rest only verify tokens signed before a rotation.
+// Without it APP_JWT_KEY is the only key. The file is read again on SIGHUP and
+// every reload interval, when set.
+var (
+	KeysFile           = config.String("JWT_KEYS_FILE", "")
+	KeysReloadInterval = config.Duration("JWT_KEYS_RELOAD_INTERVAL", 0)
+)
+
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// KeySet is the key tokens are signed with and the older ones still
+// accepted. It isn't changed once made; a rotation swaps in a new set.
+type KeySet struct {
+	Signing   Key
+	Verifying []Key
+}
+
+// lookup returns the secret of the key with id. Tokens without a key id
+// predate rotation and are checked with the signing key.
+func (s KeySet) lookup(id string) ([]byte, bool) {
+	if id == "" || id == s.Signing.ID {
+		return s.Signing.Secret, true
+	}
+	for _, key := range s.Verifying {
+		if key.ID == id {
+			return key.Secret, true
+		}
+	}
+	return nil, false
+}
+
+// KeyStore holds the current KeySet. Each Sign and Verify reads the set once,
+// so a reload never mixes keys of two sets in one call.
+type KeyStore struct {
+	mu  sync.RWMutex
+	set KeySet
+}
+
+func NewKeyStore(set KeySet) *KeyStore {
+	return &KeyStore{set: set}
+}
+
+var (
+	defaultKeys     *KeyStore
+	defaultKeysOnce sync.Once
+)
+
+// Keys returns the process wide KeyStore, loaded by LoadKeySet on first use.
+// A key file that can't be read then falls back to APP_JWT_KEY.
+func Keys() *KeyStore {
+	defaultKeysOnce.Do(func() {
+		set, err := LoadKeySet()
+		if err != nil {
+			log.Println("jwt keys not loaded, using APP_JWT_KEY:", err)
+			set = envKeySet()
+		}
+		defaultKeys = NewKeyStore(set)
+	})
+	return defaultKeys
+}
+
+func (s *KeyStore) Current() KeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set
+}
+
+func (s *KeyStore) Set(set KeySet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = set
+}
+
+// Reload swaps in the set load returns. On error the current set stays.
+func (s *KeyStore) Reload(load func() (KeySet, error)) error {
+	set, err := load()
+	if err != nil {
+		return err
+	}
+	s.Set(set)
+	return nil
+}
+
+// Sign signs claims with HS256 and the signing key, naming it in the kid
+// header.
+func (s *KeyStore) Sign(claims jwt.Claims) (string, error) {
+	key := s.Current().Signing
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if key.ID != "" {
+		t.Header["kid"] = key.ID
+	}
+	return t.SignedString(key.Secret)
+}
+
+// Verify checks the signature of an HMAC signed token against the key its
+// kid names, and whatever else opts ask for.
+func (s *KeyStore) Verify(token string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	set := s.Current()
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		id, _ := t.Header["kid"].(string)
+		secret, ok := set.lookup(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", id)
+		}
+		return secret, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// LoadKeySet reads KeysFile, or makes a set of APP_JWT_KEY alone without one.
+func LoadKeySet() (KeySet, error) {
+	if KeysFile == "" {
+		return envKeySet(), nil
+	}
+	f, err := os.Open(KeysFile)
+	if err != nil {
+		return KeySet{}, err
+	}
+	defer f.Close()
+	return ParseKeySet(f)
+}
+
+func envKeySet() KeySet {
+	return KeySet{Signing: Key{Secret: []byte(os.Getenv("APP_JWT_KEY"))}}
+}
+
+// ParseKeySet reads "<id> <secret>" lines, the first being the signing key.
+// Blank lines and lines starting with # are skipped.
+func ParseKeySet(r io.Reader) (KeySet, error) {
+	var keys []Key
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, secret, ok := strings.Cut(line, " ")
+		secret = strings.TrimSpace(secret)
+		if !ok || secret == "" {
+			return KeySet{}, fmt.Errorf("key %q has no secret", id)
+		}
+		if seen[id] {
+			return KeySet{}, fmt.Errorf("key %q is listed twice", id)
+		}
+		seen[id] = true
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	if err := scanner.Err(); err != nil {
+		return KeySet{}, err
+	}
+	if len(keys) == 0 {
+		return KeySet{}, errors.New("no keys")
+	}
+	return KeySet{Signing: keys[0], Verifying: keys[1:]}, nil
+}
+
+// WatchKeys reloads store with LoadKeySet on SIGHUP, and every interval when
+// it's positive, until ctx is done. Failed reloads are logged and keep the
+// keys in use.
+func WatchKeys(ctx context.Context, store *KeyStore, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		case <-tick:
+		}
+		if err := store.Reload(LoadKeySet); err != nil {
+			log.Println("jwt keys reload failed:", err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// String returns the value of the environment variable or fallback when it is unset.
+func String(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Int returns the environment variable parsed as int or fallback when it is unset or invalid.
+func Int(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Bool returns the environment variable parsed as bool or fallback when it is unset or invalid.
+func Bool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Duration returns the environment variable parsed as time.Duration (e.g. "15m")
+// or fallback when it is unset or invalid.
+func Duration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Float returns the environment variable parsed as float64 or fallback when it is unset or invalid.
+func Float(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
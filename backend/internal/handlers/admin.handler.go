@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type AdminHandler struct {
+	AdminService services.AdminService
+}
+
+func (a *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.AdminService.SetUserRole(ctx, claims["sub"].(string), r.PathValue("username"), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *AdminHandler) SetUserEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.AdminService.SetUserEmail(ctx, claims["sub"].(string), r.PathValue("username"), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *AdminHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.AdminService.RestoreUser(ctx, claims["sub"].(string), r.PathValue("username")); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *AdminHandler) MergeAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.MergeIntoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.AdminService.MergeAccounts(ctx, claims["sub"].(string), r.PathValue("username"), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListUsers lists users filtered and sorted as models.UserListSpec allows.
+func (a *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := models.UserListSpec.Parse(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := a.AdminService.ListUsers(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonUsers, _ := json.Marshal(users)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonUsers)
+}
+
+func (a *AdminHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+
+	limit64, err := strconv.ParseInt(queries.Get("limit"), 10, 32)
+	if err != nil || limit64 < 1 {
+		limit64 = 100
+	}
+	offset64, err := strconv.ParseInt(queries.Get("offset"), 10, 32)
+	if err != nil || offset64 < 0 {
+		offset64 = 0
+	}
+
+	entries, err := a.AdminService.ListAudit(r.Context(), models.AuditFilter{
+		Actor:  queries.Get("actor"),
+		Action: queries.Get("action"),
+		Target: queries.Get("target"),
+		Limit:  int32(limit64),
+		Offset: int32(offset64),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonEntries, _ := json.Marshal(entries)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonEntries)
+}
+
+// ExportMealsCSV streams the recipe catalog as a CSV download. Errors after
+// the first rows went out can only cut the download short.
+func (a *AdminHandler) ExportMealsCSV(w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="meals.csv"`)
+
+	if err := a.AdminService.ExportMealsCSV(r.Context(), w, models.MealFilter{
+		Author: queries.Get("author"),
+		Tag:    queries.Get("tag"),
+	}); err != nil {
+		log.Println("meals export failed:", err)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type APIKeyHandler struct {
+	APIKeyService services.APIKeyService
+}
+
+// CreateAPIKey responds with the raw key. It can't be shown again.
+func (a *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rawKey, err := a.APIKeyService.CreateAPIKey(ctx, claims["sub"].(string), req.Name, req.Scopes...)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonKey, _ := json.Marshal(map[string]string{"key": rawKey})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonKey)
+}
+
+func (a *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := a.APIKeyService.ListAPIKeys(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonKeys, _ := json.Marshal(keys)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonKeys)
+}
+
+func (a *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.APIKeyService.RevokeAPIKey(ctx, claims["sub"].(string), id); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
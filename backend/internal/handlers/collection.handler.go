@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type CollectionHandler struct {
+	CollectionService services.CollectionService
+}
+
+func (c *CollectionHandler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Validate() != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := c.CollectionService.CreateCollection(ctx, claims["sub"].(string), &req)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonId, _ := json.Marshal(map[string]int32{"id": id})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonId)
+}
+
+func (c *CollectionHandler) AddRecipeToCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id64, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req models.AddCollectionRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.CollectionService.AddRecipeToCollection(ctx, claims["sub"].(string), int32(id64), req.RecipeID); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *CollectionHandler) GenerateShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id64, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := c.CollectionService.GenerateCollectionShareLink(ctx, claims["sub"].(string), int32(id64))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonToken, _ := json.Marshal(map[string]string{"token": token})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonToken)
+}
+
+func (c *CollectionHandler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.CollectionService.RevokeShareLink(ctx, claims["sub"].(string), r.PathValue("token")); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *CollectionHandler) GetSharedCollection(w http.ResponseWriter, r *http.Request) {
+	collection, err := c.CollectionService.GetSharedCollection(r.Context(), r.PathValue("token"))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	collectionJson, err := json.Marshal(collection)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(collectionJson)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type FavoriteHandler struct {
+	FavoriteService services.FavoriteService
+}
+
+func (f *FavoriteHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FavoriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := f.FavoriteService.AddFavorite(ctx, claims["sub"].(string), req.RecipeID); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FavoriteHandler) DeleteFavorite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id64, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := f.FavoriteService.DeleteFavorite(ctx, claims["sub"].(string), int32(id64)); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FavoriteHandler) ListFavorites(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	favorites, err := f.FavoriteService.ListFavorites(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonFavorites, _ := json.Marshal(favorites)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonFavorites)
+}
+
+func (f *FavoriteHandler) ArchiveFavorite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id64, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := f.FavoriteService.ArchiveFavorite(ctx, claims["sub"].(string), int32(id64)); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FavoriteHandler) ListArchivedFavorites(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	favorites, err := f.FavoriteService.ListArchivedFavorites(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonFavorites, _ := json.Marshal(favorites)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonFavorites)
+}
+
+func (f *FavoriteHandler) MarkRecipeMade(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	id64, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := f.FavoriteService.MarkRecipeMade(ctx, claims["sub"].(string), int32(id64)); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -3,12 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
@@ -21,6 +27,7 @@ func (f *FinderHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 	var recipe models.RecipeAdd
 
@@ -31,13 +38,46 @@ func (f *FinderHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := f.FinderService.CreateRecipe(r.Context(), &recipe, claims["sub"].(string)); err != nil {
-		log.Println(err.Error())
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		var duplicate *services.DuplicateRecipeError
+		if errors.As(err, &duplicate) {
+			body, _ := json.Marshal(map[string]any{
+				"error":      duplicate.Error(),
+				"duplicates": duplicate.Duplicates,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write(body)
+			return
+		}
+		var nutrition *services.NutritionError
+		if errors.As(err, &nutrition) {
+			body, _ := json.Marshal(map[string]any{
+				"error":    nutrition.Error(),
+				"warnings": nutrition.Warnings,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(body)
+			return
+		}
+
+		http.Error(w, err.Error(), StatusFromError(err))
 		return
 	}
 
+	warnings := recipe.NutritionWarnings()
+	if len(warnings) == 0 {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"message":"user created"}`))
+		return
+	}
+	body, _ := json.Marshal(map[string]any{
+		"message":  "user created",
+		"warnings": warnings,
+	})
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(`{"message":"user created"}`))
+	w.Write(body)
 }
 
 func (f *FinderHandler) GetTags(w http.ResponseWriter, r *http.Request) {
@@ -84,8 +124,177 @@ func (f *FinderHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Println(err.Error())
 		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var username string
+	if claims, ok := r.Context().Value("claims").(jwt.MapClaims); ok {
+		username, _ = claims["sub"].(string)
+	}
+	servings, err := strconv.ParseInt(r.URL.Query().Get("servings"), 10, 32)
+	if err != nil {
+		servings = 0
+	}
+
+	recipe, err := f.FinderService.GetRecipe(ctx, id, username, int32(servings))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	recipeJson, err := json.Marshal(recipe)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(recipeJson)
+}
+
+// BatchCook scales the recipe to cover ?days= of one meal slot, with the
+// shopping list for it.
+func (f *FinderHandler) BatchCook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := f.FinderService.BatchCook(r.Context(), id, days)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	planJson, _ := json.Marshal(plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(planJson)
+}
+
+// SetRecipeImage confirms an uploaded image for the user's recipe, answering
+// with its placeholder.
+func (f *FinderHandler) SetRecipeImage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req models.RecipeImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	image, err := f.FinderService.SetRecipeImage(ctx, int32(id), claims["sub"].(string), &req)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	imageJson, _ := json.Marshal(image)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(imageJson)
+}
+
+// TransformMealForDiet shows the recipe made fit for ?diet= (vegan or
+// vegetarian) by swapping ingredients. It's a 422 listing the ingredients
+// when some can't be swapped.
+func (f *FinderHandler) TransformMealForDiet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meal, err := f.FinderService.TransformMealForDiet(r.Context(), id, r.URL.Query().Get("diet"))
+	var substitution *services.SubstitutionError
+	if errors.As(err, &substitution) {
+		body, _ := json.Marshal(map[string]any{
+			"error":       substitution.Error(),
+			"ingredients": substitution.Ingredients,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write(body)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	mealJson, _ := json.Marshal(meal)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(mealJson)
+}
+
+func (f *FinderHandler) RecipeOfTheDay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	recipe, err := f.FinderService.RecipeOfTheDay(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	recipeJson, err := json.Marshal(recipe)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
 	}
-	recipe, err := f.FinderService.GetRecipe(ctx, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(recipeJson)
+}
+
+func (f *FinderHandler) SurpriseRecipe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+	queries := r.URL.Query()
+
+	filters := models.RecipesFinderParams{
+		RecipeType: queries["Rodzaj"],
+		Allergies:  queries["Alergeny"],
+	}
+	if maxTime, err := strconv.ParseInt(queries.Get("maxTime"), 10, 32); err == nil {
+		filters.MaxTime = int32(maxTime)
+	}
+	if maxDifficulty, err := strconv.ParseInt(queries.Get("maxDifficulty"), 10, 32); err == nil {
+		filters.MaxDifficulty = int32(maxDifficulty)
+	}
+
+	recipe, err := f.FinderService.SurpriseRecipe(ctx, claims["sub"].(string), &filters)
 	if err != nil {
 		http.Error(w, err.Error(), StatusFromError(err))
 		return
@@ -95,6 +304,7 @@ func (f *FinderHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Println(err.Error())
 		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -102,21 +312,207 @@ func (f *FinderHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
 	w.Write(recipeJson)
 }
 
+func (f *FinderHandler) RecommendRecipes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 32)
+	if err != nil {
+		limit = 0
+	}
+
+	recipes, err := f.FinderService.RecommendRecipes(ctx, claims["sub"].(string), int32(limit))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	recipesJson, _ := json.Marshal(recipes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(recipesJson)
+}
+
+// TrendingMeals lists the most active recipes of the last days (7 by default).
+func (f *FinderHandler) TrendingMeals(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var window time.Duration
+	if days := r.URL.Query().Get("days"); days != "" {
+		n, err := strconv.ParseInt(days, 10, 32)
+		if err != nil {
+			http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	}
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 32)
+	if err != nil {
+		limit = 0
+	}
+
+	meals, err := f.FinderService.TrendingMeals(ctx, claims["sub"].(string), window, int32(limit))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	mealsJson, _ := json.Marshal(meals)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(mealsJson)
+}
+
+// parseIDList parses a comma separated list of ids, e.g. "3,8,12".
+func parseIDList(list string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(list, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CompareMeals compares the recipes listed in ids, e.g. ?ids=3,8,12.
+func (f *FinderHandler) CompareMeals(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comparison, err := f.FinderService.CompareMeals(r.Context(), ids)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	comparisonJson, _ := json.Marshal(comparison)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(comparisonJson)
+}
+
+// ListRecipes lists recipes filtered and sorted as models.RecipeListSpec
+// allows, e.g. ?time[lt]=30&name[like]=soup&sort=-created_at.
+func (f *FinderHandler) ListRecipes(w http.ResponseWriter, r *http.Request) {
+	query, err := models.RecipeListSpec.Parse(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipes, err := f.FinderService.ListRecipes(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonRecipes, _ := json.Marshal(recipes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonRecipes)
+}
+
 func (f *FinderHandler) FindRecipes(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 	queries := r.URL.Query()
+	recipeParams, err := searchParams(queries, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	relax64, err := strconv.ParseInt(queries.Get("relax"), 10, 32)
+	if err == nil && relax64 > 0 {
+		recipeParams.RelaxToMinimum = int32(relax64)
+		f.findRecipesRelaxed(w, r, recipeParams)
+		return
+	}
 
-	page64, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 32)
+	if flusher, canStream := w.(http.Flusher); canStream && strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		f.streamRecipes(w, r, flusher, recipeParams)
+		return
+	}
+
+	recipes, err := f.FinderService.FindRecipe(ctx, recipeParams)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	results, err := f.explainRecipes(r, recipeParams, recipes)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	recipesJson, err := json.Marshal(results)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(recipesJson)
+}
+
+// ExplainSearch answers with the query plan of the search the query
+// describes, as /browser would run it for the caller. Only admins may see it.
+func (f *FinderHandler) ExplainSearch(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	recipeParams, err := searchParams(r.URL.Query(), claims["sub"].(string))
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := f.FinderService.ExplainSearch(r.Context(), recipeParams)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	planJson, _ := json.Marshal(plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(planJson)
+}
+
+// searchParams reads a search from the query of /browser.
+func searchParams(queries url.Values, username string) (models.RecipesFinderParams, error) {
+	page64, err := strconv.ParseInt(queries.Get("page"), 10, 32)
 	page := int32(page64)
 	if err != nil && page < 1 {
 		page = 1
 	}
-	limit64, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 32)
+	limit64, err := strconv.ParseInt(queries.Get("limit"), 10, 32)
 	limit := int32(limit64)
 	if err != nil && limit < 2 {
 		limit = 100
@@ -147,18 +543,137 @@ func (f *FinderHandler) FindRecipes(w http.ResponseWriter, r *http.Request) {
 		MaxDifficulty: int32(maxDifficulty),
 		Limit:         limit,
 		Offset:        offset,
-		Username:      claims["sub"].(string),
+		Username:      username,
+	}
+	recipeParams.ExcludeFavorited, _ = strconv.ParseBool(queries.Get("excludeFavorited"))
+	recipeParams.ExcludeMade, _ = strconv.ParseBool(queries.Get("excludeMade"))
+	recipeParams.Explain, _ = strconv.ParseBool(queries.Get("explain"))
+	recipeParams.ExcludeIngredients = queries["excludeIngredient"]
+	recipeParams.IgnoreSavedExclusions, _ = strconv.ParseBool(queries.Get("ignoreSavedExclusions"))
+	recipeParams.SourceKind = queries.Get("source")
+	recipeParams.NameQuery = queries.Get("q")
+	recipeParams.AvailableEquipment = queries["equipment"]
+	recipeParams.SortBy = queries.Get("sort")
+	if maxTotalTime := queries.Get("maxTotalTime"); maxTotalTime != "" {
+		total, err := strconv.ParseInt(maxTotalTime, 10, 32)
+		if err != nil {
+			return recipeParams, err
+		}
+		recipeParams.MaxTotalTime = int32(total)
+	}
+	if recipeParams.Flags, err = flagFilters(queries); err != nil {
+		return recipeParams, err
+	}
+	recipeParams.RankByAvailability, _ = strconv.ParseBool(queries.Get("availability"))
+	if minAvailability := queries.Get("minAvailability"); minAvailability != "" {
+		if recipeParams.MinAvailability, err = strconv.ParseFloat(minAvailability, 64); err != nil {
+			return recipeParams, err
+		}
 	}
+	return recipeParams, nil
+}
 
-	recipes, err := f.FinderService.FindRecipe(ctx, recipeParams)
+// streamRecipes answers a search as NDJSON, flushing each meal as it's
+// found. Errors before the first meal get the usual error response; after it
+// the stream just ends early.
+func (f *FinderHandler) streamRecipes(w http.ResponseWriter, r *http.Request, flusher http.Flusher, recipeParams models.RecipesFinderParams) {
+	stream := &ndjsonWriter{w: w, flusher: flusher}
+	written, err := f.FinderService.SearchMealsStream(r.Context(), recipeParams, stream)
+	if err != nil && !stream.started {
+		WriteError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("search stream ended after %d meals: %v", written, err)
+	}
+	stream.start()
+}
+
+// ndjsonWriter sends the NDJSON headers with the first line and flushes
+// every line.
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+func (s *ndjsonWriter) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/x-ndjson")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *ndjsonWriter) Write(p []byte) (int, error) {
+	s.start()
+	n, err := s.w.Write(p)
+	s.flusher.Flush()
+	return n, err
+}
+
+// flagFilters reads the recipe flag filters, one query parameter per flag
+// named after it, e.g. kid_friendly=false. Flags not in the query don't
+// filter.
+func flagFilters(queries url.Values) (map[string]bool, error) {
+	var flags map[string]bool
+	for _, flag := range models.RecipeFlags {
+		if !queries.Has(flag) {
+			continue
+		}
+		want, err := strconv.ParseBool(queries.Get(flag))
+		if err != nil {
+			return nil, err
+		}
+		if flags == nil {
+			flags = make(map[string]bool)
+		}
+		flags[flag] = want
+	}
+	return flags, nil
+}
+
+func (f *FinderHandler) findRecipesRelaxed(w http.ResponseWriter, r *http.Request, recipeParams models.RecipesFinderParams) {
+	recipes, relaxed, err := f.FinderService.FindRecipeRelaxed(r.Context(), recipeParams)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+	if slices.Contains(relaxed, "saved_exclusions") {
+		recipeParams.IgnoreSavedExclusions = true
+	}
+
+	results, err := f.explainRecipes(r, recipeParams, recipes)
 	if err != nil {
 		http.Error(w, err.Error(), StatusFromError(err))
 		return
 	}
 
-	recipesJson, err := json.Marshal(recipes)
+	recipesJson, err := json.Marshal(struct {
+		Recipes any      `json:"recipes"`
+		Relaxed []string `json:"relaxed"`
+	}{
+		Recipes: results,
+		Relaxed: relaxed,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(recipesJson)
 }
+
+// explainRecipes returns the recipes with match reasons when the search asked
+// for them and the plain recipes otherwise.
+func (f *FinderHandler) explainRecipes(r *http.Request, recipeParams models.RecipesFinderParams, recipes []repository.FilterRecipesByTagNamesAndParamsRow) (any, error) {
+	if !recipeParams.Explain {
+		return recipes, nil
+	}
+	return f.FinderService.ExplainRecipes(r.Context(), recipeParams, recipes)
+}
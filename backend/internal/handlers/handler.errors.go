@@ -3,7 +3,9 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/miloszbo/meals-finder/internal/middlewares"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
@@ -12,12 +14,52 @@ var ErrBadRequest = errors.New("bad request")
 func StatusFromError(err error) int {
 	status := http.StatusInternalServerError
 
+	if errors.Is(err, services.ErrUnauthorizedUser) {
+		return http.StatusUnauthorized
+	}
+	if errors.Is(err, services.ErrChangeTooSoon) || errors.Is(err, services.ErrLoginThrottled) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, services.ErrDuplicateRecipe) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, services.ErrNoSubstitute) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, services.ErrServiceBusy) || errors.Is(err, services.ErrInventoryUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, services.ErrSearchTimeout) {
+		return http.StatusGatewayTimeout
+	}
+
 	switch err {
 	case services.ErrUnauthorizedUser:
 		status = http.StatusUnauthorized
 	case services.ErrInternalFailure:
 		status = http.StatusInternalServerError
+	case services.ErrValidation, services.ErrPasswordReused:
+		status = http.StatusBadRequest
+	case services.ErrFavoriteLimitReached:
+		status = http.StatusConflict
+	case services.ErrCaptchaRequired:
+		status = http.StatusPreconditionRequired
+	case services.ErrForbidden, services.ErrCaptchaFailed:
+		status = http.StatusForbidden
+	case services.ErrIncompleteProfile, services.ErrInvalidImage, services.ErrImageNotAllowed:
+		status = http.StatusUnprocessableEntity
+	case services.ErrUserNotFound, services.ErrCollectionNotFound, services.ErrShareNotFound, services.ErrNoRecipesFound, services.ErrTagNotFound, services.ErrImportJobNotFound, services.ErrFavoriteNotFound, services.ErrIngredientNotFound, services.ErrReviewNotFound, services.ErrAPIKeyNotFound, services.ErrSessionNotFound:
+		status = http.StatusNotFound
 	}
 
 	return status
 }
+
+// WriteError answers with err and its status. Busy errors also get
+// Retry-After, like requests shed by the concurrency limiter.
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrServiceBusy) {
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(middlewares.ShedRetryAfter.Seconds()), 1)))
+	}
+	http.Error(w, err.Error(), StatusFromError(err))
+}
@@ -0,0 +1,10 @@
+package handlers
+
+import "net/http"
+
+// Health tells load balancers the process is up. It's exempt from load
+// shedding, so it keeps answering while the API is saturated.
+func Health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type MealPlanHandler struct {
+	MealPlanService services.MealPlanService
+}
+
+func (p *MealPlanHandler) GenerateMealPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.MealPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := p.MealPlanService.GenerateMealPlan(ctx, claims["sub"].(string), req)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonPlan, _ := json.Marshal(plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonPlan)
+}
+
+// RecommendCalorieTarget returns the daily calorie target estimated from the
+// user's profile for the goal query parameter.
+func (p *MealPlanHandler) RecommendCalorieTarget(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	target, err := p.MealPlanService.RecommendCalorieTarget(ctx, claims["sub"].(string), r.URL.Query().Get("goal"))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonTarget, _ := json.Marshal(map[string]int{"calories": target})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonTarget)
+}
+
+// GenerateWeeklyPlan streams a progress event per built day as server-sent
+// events when the client accepts text/event-stream, and answers with the plain
+// JSON plan otherwise. A client disconnect cancels the generation.
+func (p *MealPlanHandler) GenerateWeeklyPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.WeeklyPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	username := claims["sub"].(string)
+
+	flusher, canStream := w.(http.Flusher)
+	if !canStream || !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		plan, err := p.MealPlanService.GenerateWeeklyPlan(ctx, username, req, nil)
+		if err != nil {
+			http.Error(w, err.Error(), StatusFromError(err))
+			return
+		}
+
+		jsonPlan, _ := json.Marshal(plan)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonPlan)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	progress := make(chan models.PlanProgress)
+	type result struct {
+		plan models.WeeklyPlan
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		plan, err := p.MealPlanService.GenerateWeeklyPlan(ctx, username, req, progress)
+		done <- result{plan, err}
+	}()
+
+	for {
+		select {
+		case event := <-progress:
+			writeEvent(w, "progress", event)
+			flusher.Flush()
+		case res := <-done:
+			if res.err != nil {
+				if ctx.Err() == nil {
+					writeEvent(w, "error", map[string]string{"error": res.err.Error()})
+				}
+			} else {
+				writeEvent(w, "plan", res.plan)
+			}
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+}
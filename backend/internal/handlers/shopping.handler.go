@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type ShoppingListHandler struct {
+	ShoppingListService services.ShoppingListService
+}
+
+// ShoppingList returns the combined ingredients of the recipes listed in ids,
+// e.g. ?ids=3,8,8 for recipe 8 cooked twice.
+func (s *ShoppingListHandler) ShoppingList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.ShoppingListService.ShoppingList(ctx, claims["sub"].(string), ids)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	itemsJson, _ := json.Marshal(items)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(itemsJson)
+}
+
+// WeeklyShoppingList returns what to buy for a weekly plan, by aisle. The
+// body is the plan as POST /plan/weekly returns it; only the meal ids and
+// servings are read.
+func (s *ShoppingListHandler) WeeklyShoppingList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var plan models.WeeklyPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := s.ShoppingListService.GenerateWeeklyShoppingList(ctx, claims["sub"].(string), plan)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	listJson, _ := json.Marshal(list)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(listJson)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+type TokenHandler struct {
+	TokenService services.TokenService
+	ClientID     string
+	ClientSecret string
+}
+
+// Introspect answers whether the token form value is currently valid. Callers
+// authenticate with the client credentials over HTTP basic auth.
+func (t *TokenHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if !t.clientAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	introspection, err := t.TokenService.Introspect(r.Context(), token)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonIntrospection, _ := json.Marshal(introspection)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonIntrospection)
+}
+
+func (t *TokenHandler) clientAuthorized(r *http.Request) bool {
+	id, secret, ok := r.BasicAuth()
+	if !ok || t.ClientSecret == "" {
+		return false
+	}
+	idMatch := subtle.ConstantTimeCompare([]byte(id), []byte(t.ClientID))
+	secretMatch := subtle.ConstantTimeCompare([]byte(secret), []byte(t.ClientSecret))
+	return idMatch&secretMatch == 1
+}
@@ -3,16 +3,25 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
 	"github.com/miloszbo/meals-finder/internal/models"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
+// Header naming the client a login is for: web, mobile or api.
+const ClientHeader = "X-Client"
+
 type UserHandler struct {
 	UserService services.UserService
+	// TokenService, when set, revokes the token on logout.
+	TokenService services.TokenService
 }
 
 func (u *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
@@ -26,11 +35,23 @@ func (u *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loginData.Client = r.Header.Get(ClientHeader)
+	if loginData.Client == "" {
+		loginData.Client = models.ClientWeb
+	}
+	loginData.RemoteIP = remoteIP(r)
+	loginData.UserAgent = r.UserAgent()
+
 	if err := loginData.Validate(); err != nil {
 		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
 	}
 
 	token, err := u.UserService.LoginUser(ctx, &loginData)
+	if errors.Is(err, services.ErrUnauthorizedUser) {
+		http.Error(w, services.ErrUnauthorizedUser.Error(), http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), StatusFromError(err))
 		return
@@ -39,7 +60,7 @@ func (u *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	cookie := &http.Cookie{
 		Name:     "auth_token",
 		Value:    token,
-		MaxAge:   24 * 3600,
+		MaxAge:   int(services.SessionTTL(loginData.Client).Seconds()),
 		HttpOnly: true,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
@@ -52,6 +73,14 @@ func (u *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (uh *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if uh.TokenService != nil {
+		if token := middlewares.TokenFromRequest(r); token != "" {
+			if err := uh.TokenService.RevokeToken(r.Context(), token); err != nil {
+				log.Println("revoke token on logout failed:", err)
+			}
+		}
+	}
+
 	cookie := &http.Cookie{
 		Name:     "auth_token",
 		MaxAge:   0,
@@ -72,6 +101,7 @@ func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.RemoteIP = remoteIP(r)
 	if err := uh.UserService.CreateUser(r.Context(), &req); err != nil {
 		log.Println(err.Error())
 		http.Error(w, err.Error(), StatusFromError(err))
@@ -82,6 +112,32 @@ func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message":"user created"}`))
 }
 
+// ValidateSignup checks a signup form without registering and reports every
+// invalid field. An invalid form is still a 200; see the "valid" field.
+func (uh *UserHandler) ValidateSignup(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := uh.UserService.ValidateSignup(r.Context(), &req)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, services.ErrInternalFailure.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultJson)
+}
+
 func (uh *UserHandler) IsLogged(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -91,6 +147,7 @@ func (uh *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 
 	user, err := uh.UserService.GetUser(ctx, claims["sub"].(string))
@@ -115,14 +172,24 @@ func (uh *UserHandler) UpdateUserSettings(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 
 	// Call service
 	if err := uh.UserService.UpdateUserSettings(ctx, &req, claims["sub"].(string)); err != nil {
 		log.Println(err.Error())
+		var tooSoon *services.ChangeTooSoonError
+		if errors.As(err, &tooSoon) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(tooSoon.Remaining.Seconds())))
+		}
 		http.Error(w, err.Error(), StatusFromError(err))
 		return
 	}
@@ -137,6 +204,7 @@ func (u *UserHandler) AddUserTag(w http.ResponseWriter, r *http.Request) {
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 
 	var userTag models.UserTag
@@ -162,6 +230,7 @@ func (u *UserHandler) DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 
 	err := u.UserService.DeleteUserTag(ctx, claims["sub"].(string), tagName)
@@ -173,11 +242,78 @@ func (u *UserHandler) DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (u *UserHandler) SetUserTagWeight(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TagWeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.UserService.SetUserTagWeight(ctx, claims["sub"].(string), r.PathValue("tagName"), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (u *UserHandler) SetUserTagStrictness(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TagStrictnessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.UserService.SetUserTagStrictness(ctx, claims["sub"].(string), r.PathValue("tagName"), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (u *UserHandler) ReorderUserTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TagOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.UserService.ReorderUserTags(ctx, claims["sub"].(string), req.Tags); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (u *UserHandler) DisplayUserTags(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claims, ok := ctx.Value("claims").(jwt.MapClaims)
 	if !ok {
 		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
 	}
 
 	data, err := u.UserService.DisplayUserTag(ctx, claims["sub"].(string))
@@ -191,3 +327,393 @@ func (u *UserHandler) DisplayUserTags(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 	w.WriteHeader(http.StatusOK)
 }
+
+// DetectTagConflicts lists pairs of the user's tags that contradict each other.
+func (u *UserHandler) DetectTagConflicts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	conflicts, err := u.UserService.DetectTagConflicts(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonConflicts, _ := json.Marshal(conflicts)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonConflicts)
+}
+
+func (uh *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangePasswordRequest
+	ctx := r.Context()
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Validate() != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := uh.UserService.ChangePassword(ctx, claims["sub"].(string), &req); err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"password changed"}`))
+}
+
+// MergeAccount merges the account the body logs in to into the signed-in one.
+func (uh *UserHandler) MergeAccount(w http.ResponseWriter, r *http.Request) {
+	var req models.MergeAccountRequest
+	ctx := r.Context()
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Validate() != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	req.RemoteIP = remoteIP(r)
+	if err := uh.UserService.MergeGuestAccount(ctx, claims["sub"].(string), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"accounts merged"}`))
+}
+
+// RevokeSessions signs the user out everywhere, or with ?client= only on that
+// client.
+func (uh *UserHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+	if uh.TokenService == nil {
+		http.Error(w, services.ErrInternalFailure.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	client := r.URL.Query().Get("client")
+	if client != "" && !models.ValidClient(client) {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := uh.TokenService.RevokeAllSessions(ctx, claims["sub"].(string), client); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"sessions revoked"}`))
+}
+
+// ListSessions lists the user's active sessions, flagging the one making the
+// request.
+func (uh *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+	if uh.TokenService == nil {
+		http.Error(w, services.ErrInternalFailure.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := uh.TokenService.ListSessions(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+	current, _ := claims["jti"].(string)
+	for i := range sessions {
+		sessions[i].Current = current != "" && sessions[i].ID == current
+	}
+
+	jsonSessions, _ := json.Marshal(sessions)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonSessions)
+}
+
+// RevokeSession signs out one of the user's sessions, e.g. a lost phone.
+func (uh *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+	if uh.TokenService == nil {
+		http.Error(w, services.ErrInternalFailure.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := uh.TokenService.RevokeSession(ctx, claims["sub"].(string), r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := uh.UserService.DeleteAccount(ctx, claims["sub"].(string)); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTermsStatus tells the user which terms version is current and whether
+// they've accepted it.
+func (uh *UserHandler) GetTermsStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := uh.UserService.GetTermsStatus(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	statusJson, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, services.ErrInternalFailure.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(statusJson)
+}
+
+// ExportArchive sends the user a ZIP of their data and recipe images.
+func (uh *UserHandler) ExportArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	archive := &archiveWriter{w: w}
+	err := uh.UserService.ExportUserArchive(ctx, claims["sub"].(string), archive)
+	if err != nil && !archive.started {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+	if err != nil {
+		log.Println("user archive export failed:", err)
+	}
+}
+
+// archiveWriter sends the ZIP headers with the first bytes, so errors before
+// any can still get a status.
+type archiveWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	if !a.started {
+		a.started = true
+		a.w.Header().Set("Content-Type", "application/zip")
+		a.w.Header().Set("Content-Disposition", `attachment; filename="meals-finder-export.zip"`)
+		a.w.WriteHeader(http.StatusOK)
+	}
+	return a.w.Write(p)
+}
+
+func (uh *UserHandler) AcceptTerms(w http.ResponseWriter, r *http.Request) {
+	var req models.TermsConsentRequest
+	ctx := r.Context()
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Validate() != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := uh.UserService.RecordConsent(ctx, claims["sub"].(string), req.Version); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Maximum number of usernames accepted by batch user lookups.
+const maxUsersBatch = 100
+
+func usernamesFromQuery(r *http.Request) ([]string, error) {
+	usernames := r.URL.Query()["username"]
+	if len(usernames) == 0 || len(usernames) > maxUsersBatch {
+		return nil, ErrBadRequest
+	}
+	return usernames, nil
+}
+
+func (uh *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	usernames, err := usernamesFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := uh.UserService.GetUsers(r.Context(), usernames)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonUsers, _ := json.Marshal(users)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonUsers)
+}
+
+func (uh *UserHandler) GetUsersDetailed(w http.ResponseWriter, r *http.Request) {
+	usernames, err := usernamesFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := uh.UserService.GetUsersDetailed(r.Context(), usernames)
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonUsers, _ := json.Marshal(users)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonUsers)
+}
+
+func (uh *UserHandler) GetSettingsChangeLog(w http.ResponseWriter, r *http.Request) {
+	changes, err := uh.UserService.GetSettingsChangeLog(r.Context(), r.PathValue("username"))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonChanges, _ := json.Marshal(changes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonChanges)
+}
+
+func (uh *UserHandler) ListExcludedIngredients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	names, err := uh.UserService.ListExcludedIngredients(ctx, claims["sub"].(string))
+	if err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	jsonNames, _ := json.Marshal(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonNames)
+}
+
+func (uh *UserHandler) AddExcludedIngredient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ExcludedIngredientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := uh.UserService.AddExcludedIngredient(ctx, claims["sub"].(string), &req); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (uh *UserHandler) DeleteExcludedIngredient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value("claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "token was empty", http.StatusUnauthorized)
+		return
+	}
+
+	if err := uh.UserService.DeleteExcludedIngredient(ctx, claims["sub"].(string), r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), StatusFromError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// remoteIP is the address the request came from, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
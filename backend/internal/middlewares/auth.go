@@ -2,59 +2,89 @@ package middlewares
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"slices"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/models"
 )
 
-var key []byte = []byte(os.Getenv("APP_JWT_KEY"))
-
 func writeUnauthed(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusUnauthorized)
 }
 
+// TokenFromRequest reads the JWT from the auth_token cookie, falling back to
+// the "Authorization: Bearer <token>" header for non-browser clients.
+func TokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie("auth_token"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
 func Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		jwtToken, err := r.Cookie("auth_token")
-		if err != nil {
+		tokenString := TokenFromRequest(r)
+		if tokenString == "" {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if jwtToken == nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		claims, err := auth.Keys().Verify(tokenString)
+		if err != nil {
+			log.Println("Parse error: " + err.Error())
+			writeUnauthed(w)
 			return
 		}
-		token, err := jwt.Parse(jwtToken.Value, func(t *jwt.Token) (any, error) {
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// APIKeyPrefix starts the Authorization header of requests made with an API
+// key.
+const APIKeyPrefix = "ApiKey "
 
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+// APIKeyAuthentication lets requests with an "Authorization: ApiKey <key>"
+// header through as the key's user, within the key's scopes; every other
+// request goes through Authentication. Keys are resolved on each request, so a
+// revoked key stops working at once.
+func APIKeyAuthentication(resolve func(ctx context.Context, rawKey string) (models.APIKeyIdentity, error)) Middleware {
+	return func(next http.Handler) http.Handler {
+		withToken := Authentication(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rawKey, ok := strings.CutPrefix(r.Header.Get("Authorization"), APIKeyPrefix)
+			if !ok {
+				withToken.ServeHTTP(w, r)
+				return
 			}
-			return key, nil
-		})
-		if token == nil {
-			writeUnauthed(w)
-			return
-		}
-		if err != nil && !token.Valid {
-			log.Println("Parse error: " + err.Error())
-			if !token.Valid {
-				log.Println("Token is not valid")
+
+			identity, err := resolve(r.Context(), rawKey)
+			if err != nil {
+				writeUnauthed(w)
+				return
+			}
+			if !models.APIKeyAllows(identity.Scopes, r.Method, r.URL.Path) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			claims := jwt.MapClaims{
+				"sub":     identity.UserID,
+				"role":    identity.Role,
+				"client":  models.ClientAPI,
+				"api_key": identity.KeyID,
 			}
-			writeUnauthed(w)
-			return
-		}
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
 			ctx := context.WithValue(r.Context(), "claims", claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-	})
+		})
+	}
 }
 
 func Authorization(next http.Handler) http.Handler {
@@ -71,3 +101,174 @@ func Authorization(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireRole allows only requests whose role claim matches the given role.
+// It must be used after Authentication.
+func RequireRole(role string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "token was empty", http.StatusUnauthorized)
+				return
+			}
+			if claimRole, _ := claims["role"].(string); claimRole != role {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectRevoked answers 401 to tokens isRevoked reports as revoked, so signing
+// a session out applies to the next request rather than at expiry. API keys
+// are checked when they're resolved. It must be used after ResolveSubject,
+// which makes the sub claim a username.
+func RejectRevoked(isRevoked func(ctx context.Context, username string, claims jwt.MapClaims) (bool, error)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "token was empty", http.StatusUnauthorized)
+				return
+			}
+			if _, apiKey := claims["api_key"]; apiKey {
+				next.ServeHTTP(w, r)
+				return
+			}
+			username, _ := claims["sub"].(string)
+			revoked, err := isRevoked(r.Context(), username, claims)
+			if err != nil {
+				log.Println("revocation lookup failed:", err)
+				writeUnauthed(w)
+				return
+			}
+			if revoked {
+				writeUnauthed(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TrackSession tells touch the session of each token was used. Failures are
+// only logged; API key requests have no session. It must be used after
+// Authentication.
+func TrackSession(touch func(ctx context.Context, sessionID string) error) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := r.Context().Value("claims").(jwt.MapClaims)
+			if jti, _ := claims["jti"].(string); jti != "" {
+				if err := touch(r.Context(), jti); err != nil {
+					log.Println("touch session failed:", err)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResolveRole replaces the role claim with the one returned by resolve, so a
+// role change applies without waiting for the token to expire. It must be
+// used after Authentication.
+func ResolveRole(resolve func(ctx context.Context, username string) (string, error)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "token was empty", http.StatusUnauthorized)
+				return
+			}
+			username, _ := claims["sub"].(string)
+			role, err := resolve(r.Context(), username)
+			if err != nil {
+				log.Println("role lookup failed:", err)
+				writeUnauthed(w)
+				return
+			}
+
+			resolved := make(jwt.MapClaims, len(claims)+1)
+			for k, v := range claims {
+				resolved[k] = v
+			}
+			resolved["role"] = role
+			ctx := context.WithValue(r.Context(), "claims", resolved)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ResolveSubject maps a user id subject to the user's current username, so the
+// sub claim seen by handlers is always a username and renaming a user doesn't
+// invalidate their tokens. The id is kept in the uid claim. Username subjects
+// from older tokens pass through unchanged when acceptUsernames is set. It
+// must be used after Authentication.
+func ResolveSubject(resolve func(ctx context.Context, userID string) (string, error), acceptUsernames bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "token was empty", http.StatusUnauthorized)
+				return
+			}
+			subject, _ := claims["sub"].(string)
+			if !models.LooksLikeUUID(subject) {
+				if !acceptUsernames {
+					writeUnauthed(w)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			username, err := resolve(r.Context(), subject)
+			if err != nil {
+				log.Println("subject lookup failed:", err)
+				writeUnauthed(w)
+				return
+			}
+
+			resolved := make(jwt.MapClaims, len(claims)+1)
+			for k, v := range claims {
+				resolved[k] = v
+			}
+			resolved["uid"] = subject
+			resolved["sub"] = username
+			ctx := context.WithValue(r.Context(), "claims", resolved)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireCurrentTerms turns away users who haven't accepted the current terms
+// with a 403, except on the exempt paths, which must include somewhere to
+// accept them. It must be used after ResolveSubject.
+func RequireCurrentTerms(accepted func(ctx context.Context, username string) (bool, error), exempt ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "token was empty", http.StatusUnauthorized)
+				return
+			}
+			username, _ := claims["sub"].(string)
+			ok, err := accepted(r.Context(), username)
+			if err != nil {
+				log.Println("terms lookup failed:", err)
+				writeUnauthed(w)
+				return
+			}
+			if !ok {
+				http.Error(w, "current terms not accepted", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,13 +1,26 @@
 package middlewares
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Origin the frontend is served from, and whether it may send the auth
+// cookie along.
+var (
+	CorsAllowedOrigin    = config.String("CORS_ALLOWED_ORIGIN", "http://localhost:5173")
+	CorsAllowCredentials = config.Bool("CORS_ALLOW_CREDENTIALS", true)
+)
 
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
+		w.Header().Set("Access-Control-Allow-Origin", CorsAllowedOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if CorsAllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Most requests handled at once; the rest get 503 straight away instead of
+// queueing on the database. 0 disables the limit.
+var MaxInflightRequests = config.Int("MAX_INFLIGHT_REQUESTS", 100)
+
+// Sent as Retry-After with shed requests.
+var ShedRetryAfter = config.Duration("SHED_RETRY_AFTER", time.Second)
+
+// ConcurrencyLimiter caps in-flight requests, answering 503 once the cap is
+// reached. Paths in bypass, like health checks, are never limited.
+type ConcurrencyLimiter struct {
+	slots      chan struct{}
+	bypass     map[string]bool
+	retryAfter time.Duration
+	inflight   atomic.Int64
+	shed       atomic.Int64
+}
+
+func NewConcurrencyLimiter(limit int, retryAfter time.Duration, bypass ...string) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		bypass:     make(map[string]bool, len(bypass)),
+		retryAfter: retryAfter,
+	}
+	if limit > 0 {
+		l.slots = make(chan struct{}, limit)
+	}
+	for _, path := range bypass {
+		l.bypass[path] = true
+	}
+	return l
+}
+
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.slots == nil || l.bypass[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.shed.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(l.retryAfter.Seconds()), 1)))
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+			return
+		}
+		l.inflight.Add(1)
+		defer func() {
+			l.inflight.Add(-1)
+			<-l.slots
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimiterMetrics is a snapshot of the limiter's counters.
+type LimiterMetrics struct {
+	Limit    int   `json:"limit"`
+	Inflight int64 `json:"inflight"`
+	Shed     int64 `json:"shed"`
+}
+
+func (l *ConcurrencyLimiter) Metrics() LimiterMetrics {
+	return LimiterMetrics{
+		Limit:    cap(l.slots),
+		Inflight: l.inflight.Load(),
+		Shed:     l.shed.Load(),
+	}
+}
+
+// MetricsHandler serves Metrics as JSON.
+func (l *ConcurrencyLimiter) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, _ := json.Marshal(l.Metrics())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(metrics)
+	})
+}
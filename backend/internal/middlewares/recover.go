@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+)
+
+// Header carrying the id a request is logged under. Ids sent by the client
+// or a proxy are kept when they look sane.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// RequestID returns the request's correlation id, making one up when the
+// request has none.
+func RequestID(r *http.Request) string {
+	if id := RequestIDFrom(r.Context()); id != "" {
+		return id
+	}
+	if id := r.Header.Get(RequestIDHeader); validRequestID.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFrom returns the correlation id CorrelationID put in ctx, or ""
+// outside a request.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// CorrelationID settles the request's id up front so everything logged while
+// serving it, down to slow queries, carries the same one.
+func CorrelationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestIDKey{}, RequestID(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Recover turns a panicking handler into a 500 instead of a crashed process.
+// The panic and its stack are logged under the request id, which is also the
+// only detail the client gets back.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			id := RequestID(r)
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, id, err, debug.Stack())
+			if rw.wroteHeader {
+				return
+			}
+
+			body, _ := json.Marshal(map[string]string{"error": "internal failure", "request_id": id})
+			w.Header().Set(RequestIDHeader, id)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(body)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoverWriter remembers whether the response was started, after which a
+// 500 can no longer be sent.
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming handlers working behind Recover.
+func (w *recoverWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *recoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Security headers sent with every response. An empty value leaves the header
+// out. HSTS is only sent over HTTPS and the CSP only with HTML.
+var (
+	ContentTypeOptions    = config.String("SECURITY_CONTENT_TYPE_OPTIONS", "nosniff")
+	FrameOptions          = config.String("SECURITY_FRAME_OPTIONS", "DENY")
+	ReferrerPolicy        = config.String("SECURITY_REFERRER_POLICY", "strict-origin-when-cross-origin")
+	StrictTransport       = config.String("SECURITY_HSTS", "max-age=31536000; includeSubDomains")
+	ContentSecurityPolicy = config.String("SECURITY_CSP", "default-src 'none'; style-src 'self'; img-src 'self'; frame-ancestors 'none'; base-uri 'none'; form-action 'self'")
+)
+
+type SecurityHeaders struct {
+	ContentTypeOptions    string
+	FrameOptions          string
+	ReferrerPolicy        string
+	StrictTransport       string
+	ContentSecurityPolicy string
+}
+
+func NewSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		ContentTypeOptions:    ContentTypeOptions,
+		FrameOptions:          FrameOptions,
+		ReferrerPolicy:        ReferrerPolicy,
+		StrictTransport:       StrictTransport,
+		ContentSecurityPolicy: ContentSecurityPolicy,
+	}
+}
+
+func (s SecurityHeaders) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		setIfConfigured(header, "X-Content-Type-Options", s.ContentTypeOptions)
+		setIfConfigured(header, "X-Frame-Options", s.FrameOptions)
+		setIfConfigured(header, "Referrer-Policy", s.ReferrerPolicy)
+		if isHTTPS(r) {
+			setIfConfigured(header, "Strict-Transport-Security", s.StrictTransport)
+		}
+
+		if s.ContentSecurityPolicy != "" {
+			w = &htmlPolicyWriter{ResponseWriter: w, policy: s.ContentSecurityPolicy}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setIfConfigured(header http.Header, name string, value string) {
+	if value != "" {
+		header.Set(name, value)
+	}
+}
+
+// isHTTPS reports whether the client connected over TLS, here or at a proxy
+// in front that says so in X-Forwarded-Proto.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// htmlPolicyWriter adds the Content-Security-Policy once the handler has
+// settled on an HTML response.
+type htmlPolicyWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *htmlPolicyWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			w.Header().Set("Content-Security-Policy", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *htmlPolicyWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming handlers working behind SecurityHeaders.
+func (w *htmlPolicyWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *htmlPolicyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,69 @@
+package models
+
+import "errors"
+
+var Roles = []string{"user", "admin"}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (srr *SetRoleRequest) Validate() error {
+	for _, role := range Roles {
+		if srr.Role == role {
+			return nil
+		}
+	}
+	return errors.New("unknown role")
+}
+
+type SetEmailRequest struct {
+	Email string `json:"email"`
+}
+
+func (ser *SetEmailRequest) Validate() error {
+	if ser.Email == "" {
+		return errors.New("missing email")
+	}
+	return nil
+}
+
+// MergeIntoRequest names the account another is merged into.
+type MergeIntoRequest struct {
+	Into string `json:"into"`
+}
+
+func (mir *MergeIntoRequest) Validate() error {
+	if mir.Into == "" {
+		return errors.New("missing target account")
+	}
+	return nil
+}
+
+// UserListSpec is what GET /admin/users/search filters and sorts by.
+var UserListSpec = ListSpec{
+	Fields: map[string]ListField{
+		"username":   {Type: FieldText, Sortable: true},
+		"email":      {Type: FieldText},
+		"role":       {Type: FieldText, Ops: []string{OpEq, OpIn}},
+		"age":        {Type: FieldInt, Sortable: true},
+		"sex":        {Type: FieldText, Ops: []string{OpEq, OpIn}},
+		"created_at": {Type: FieldTime, Sortable: true},
+	},
+	DefaultLimit: 100,
+	MaxLimit:     500,
+}
+
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Limit  int32
+	Offset int32
+}
+
+// MealFilter narrows the recipe export; empty fields don't filter.
+type MealFilter struct {
+	Author string
+	Tag    string
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	MaxAPIKeyNameLength = 60
+	// Suffix of a scope that only allows GET requests, e.g. "recipes:read".
+	APIKeyReadSuffix = ":read"
+)
+
+// APIKeyScopes are the endpoint groups API keys can be limited to, by path
+// prefix. A key without scopes reaches every endpoint a session does, apart
+// from the session-only ones.
+var APIKeyScopes = map[string][]string{
+	"recipes":   {"/browser", "/re/", "/recipe/", "/recipes/", "/recommendations", "/reviews/"},
+	"plans":     {"/plan/", "/shopping-list"},
+	"pantry":    {"/user/pantry"},
+	"favorites": {"/user/favorites", "/collections"},
+	"profile":   {"/profile", "/verify", "/user/settings", "/user/tags", "/user/exclusions", "/user/searches"},
+}
+
+// Endpoints an API key can never reach: managing keys, credentials and
+// sessions, merging or deleting the account, and the admin panel.
+var apiKeySessionOnly = []string{"/user/api-keys", "/user/password", "/user/sessions", "/user/merge", "/admin/"}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	if name := strings.TrimSpace(r.Name); name == "" || len(name) > MaxAPIKeyNameLength {
+		return errors.New("api key name must be 1 to 60 characters")
+	}
+	for _, scope := range r.Scopes {
+		if !ValidAPIKeyScope(scope) {
+			return errors.New("unknown api key scope")
+		}
+	}
+	return nil
+}
+
+func ValidAPIKeyScope(scope string) bool {
+	_, ok := APIKeyScopes[strings.TrimSuffix(scope, APIKeyReadSuffix)]
+	return ok
+}
+
+// APIKeyIdentity is who a valid API key acts for.
+type APIKeyIdentity struct {
+	KeyID  int32
+	UserID string
+	Role   string
+	Scopes []string
+}
+
+// APIKeyAllows reports whether a key with these scopes may make the request.
+func APIKeyAllows(scopes []string, method string, path string) bool {
+	if slices.ContainsFunc(apiKeySessionOnly, func(prefix string) bool { return pathUnder(path, prefix) }) ||
+		(method == http.MethodDelete && path == "/user") {
+		return false
+	}
+	if len(scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range scopes {
+		group, readOnly := strings.CutSuffix(scope, APIKeyReadSuffix)
+		if readOnly && method != http.MethodGet && method != http.MethodHead {
+			continue
+		}
+		if slices.ContainsFunc(APIKeyScopes[group], func(prefix string) bool { return pathUnder(path, prefix) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathUnder reports whether path is prefix or below it.
+func pathUnder(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
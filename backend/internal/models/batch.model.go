@@ -0,0 +1,29 @@
+package models
+
+// Longest batch BatchCook plans for.
+const MaxBatchDays = 14
+
+// BatchCookPlan is a meal scaled to cover Days of one meal slot. Ingredients
+// are the scaled recipe and ShoppingList the same added up for buying.
+// Nutrition is per serving as on the recipe, Total* for the whole batch; nil
+// values are unknown. Warnings say why the batch may not work out, e.g. it
+// won't keep for all the days.
+type BatchCookPlan struct {
+	MealID        int32          `json:"meal_id"`
+	Name          string         `json:"name"`
+	Days          int            `json:"days"`
+	Servings      int32          `json:"servings"`
+	BatchFriendly bool           `json:"batch_friendly"`
+	StorageDays   int32          `json:"storage_days"`
+	Ingredients   []Ingredient   `json:"ingredients"`
+	ShoppingList  []ShoppingItem `json:"shopping_list"`
+	Calories      *int32         `json:"calories"`
+	Protein       *int32         `json:"protein"`
+	Carbs         *int32         `json:"carbs"`
+	Fat           *int32         `json:"fat"`
+	TotalCalories *int32         `json:"total_calories"`
+	TotalProtein  *int32         `json:"total_protein"`
+	TotalCarbs    *int32         `json:"total_carbs"`
+	TotalFat      *int32         `json:"total_fat"`
+	Warnings      []string       `json:"warnings,omitempty"`
+}
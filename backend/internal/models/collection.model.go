@@ -0,0 +1,32 @@
+package models
+
+import "errors"
+
+type CreateCollectionRequest struct {
+	Name string `json:"name"`
+}
+
+func (ccr *CreateCollectionRequest) Validate() error {
+	if ccr.Name == "" || len(ccr.Name) > 100 {
+		return errors.New("invalid collection name")
+	}
+	return nil
+}
+
+type AddCollectionRecipeRequest struct {
+	RecipeID int32 `json:"recipe_id"`
+}
+
+type CollectionRecipe struct {
+	ID         int32  `json:"id"`
+	Name       string `json:"name"`
+	Time       int32  `json:"time"`
+	Difficulty int32  `json:"difficulty"`
+}
+
+type Collection struct {
+	ID       int32              `json:"id"`
+	Name     string             `json:"name"`
+	Username string             `json:"username"`
+	Recipes  []CollectionRecipe `json:"recipes"`
+}
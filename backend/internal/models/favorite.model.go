@@ -0,0 +1,5 @@
+package models
+
+type FavoriteRequest struct {
+	RecipeID int32 `json:"recipe_id"`
+}
@@ -1,5 +1,13 @@
 package models
 
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
 type RecipesFinderParams struct {
 	Diet          []string
 	Region        []string
@@ -9,11 +17,235 @@ type RecipesFinderParams struct {
 	Others        []string
 	MinTime       int32
 	MaxTime       int32
+	MaxTotalTime  int32 // preparation and cooking together
 	MinDifficulty int32
 	MaxDifficulty int32
 	Limit         int32
 	Offset        int32
 	Username      string
+	// Minimum number of results; when not reached soft filters are dropped
+	// one by one. 0 disables relaxation.
+	RelaxToMinimum int32
+	// Hide recipes the user has favorited or already made. Require a user.
+	ExcludeFavorited bool
+	ExcludeMade      bool
+	// Explain adds the reasons each recipe matched to the results.
+	Explain bool
+	// Ingredients to leave out for this search only.
+	ExcludeIngredients []string
+	// The user's saved "always exclude" ingredients, filled in by the finder
+	// unless IgnoreSavedExclusions is set. Unlike allergies they're soft and
+	// can be relaxed.
+	SavedExclusions       []string
+	IgnoreSavedExclusions bool
+	// Only recipes of this source kind, SourceUser or SourceImport. Empty
+	// means any.
+	SourceKind string
+	// Only recipes whose name contains this, matched literally.
+	NameQuery string
+	// Only recipes cookable with this equipment. nil means the user's saved
+	// equipment; an empty list, or just EquipmentNone, means none at all.
+	AvailableEquipment []string
+	// Flag filters by name from RecipeFlags: true keeps only recipes with the
+	// flag, false hides them. Flags left out don't filter.
+	Flags map[string]bool
+	// One of SortOrders; empty sorts by id.
+	SortBy string
+	// Rank recipes by the share of their ingredients the grocery provider
+	// delivers, best first. MinAvailability, a share from 0 to 1, also drops
+	// recipes below it. Either applies within the page of results.
+	RankByAvailability bool
+	MinAvailability    float64
+}
+
+const maxNameQueryLength = 100
+
+// RecipeListSpec is what GET /recipes filters and sorts by.
+var RecipeListSpec = ListSpec{
+	Fields: map[string]ListField{
+		"id":             {Type: FieldInt, Sortable: true},
+		"name":           {Type: FieldText, Sortable: true},
+		"time":           {Type: FieldInt, Sortable: true},
+		"cook_time":      {Type: FieldInt, Sortable: true},
+		"difficulty":     {Type: FieldInt, Sortable: true},
+		"calories":       {Type: FieldInt, Sortable: true},
+		"servings":       {Type: FieldInt},
+		"source":         {Type: FieldText, Ops: []string{OpEq, OpIn}},
+		"author":         {Type: FieldText, Ops: []string{OpEq, OpIn}},
+		"created_at":     {Type: FieldTime, Sortable: true},
+		"batch_friendly": {Type: FieldBool},
+		"storage_days":   {Type: FieldInt, Sortable: true},
+	},
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// ByAvailability reports whether results are ranked or filtered by
+// ingredient availability.
+func (rfp *RecipesFinderParams) ByAvailability() bool {
+	return rfp.RankByAvailability || rfp.MinAvailability > 0
+}
+
+// Orders search results can be sorted in. Time sorts by preparation time and
+// quickest by preparation and cooking together. Rating puts the best rated
+// first, recent rating the best rated lately, and newest the latest added.
+// Relevance blends tag matches, ratings, popularity, recency and pantry
+// overlap by the configured relevance weights. Recipes that tie are ordered
+// by id.
+const (
+	SortTime         = "time"
+	SortQuickest     = "quickest"
+	SortCalories     = "calories"
+	SortRating       = "rating"
+	SortRecentRating = "recent_rating"
+	SortNewest       = "newest"
+	SortRelevance    = "relevance"
+)
+
+var SortOrders = []string{SortTime, SortQuickest, SortCalories, SortRating, SortRecentRating, SortNewest, SortRelevance}
+
+func (rfp *RecipesFinderParams) Validate() error {
+	if rfp.MinTime < 0 || rfp.MaxTime < 0 || rfp.MaxTotalTime < 0 {
+		return errors.New("times can't be negative")
+	}
+	if (rfp.ExcludeFavorited || rfp.ExcludeMade) && rfp.Username == "" {
+		return errors.New("excluding favorited or made recipes requires a user")
+	}
+	if rfp.SourceKind != "" && rfp.SourceKind != SourceUser && rfp.SourceKind != SourceImport {
+		return errors.New("unknown recipe source kind")
+	}
+	if len(rfp.NameQuery) > maxNameQueryLength {
+		return errors.New("name query too long")
+	}
+	if !ValidEquipment(rfp.AvailableEquipment) {
+		return errors.New("unknown equipment")
+	}
+	for flag := range rfp.Flags {
+		if !slices.Contains(RecipeFlags, flag) {
+			return errors.New("unknown recipe flag")
+		}
+	}
+	if rfp.SortBy != "" && !slices.Contains(SortOrders, rfp.SortBy) {
+		return errors.New("unknown sort order")
+	}
+	if !(rfp.MinAvailability >= 0 && rfp.MinAvailability <= 1) {
+		return errors.New("minimum availability must be between 0 and 1")
+	}
+	return nil
+}
+
+// Kitchen equipment a recipe can need. EquipmentNone stands for an empty
+// list: a recipe that needs nothing, or a user that has nothing.
+const (
+	EquipmentOven      = "oven"
+	EquipmentStovetop  = "stovetop"
+	EquipmentMicrowave = "microwave"
+	EquipmentNone      = "none"
+)
+
+var Equipment = []string{EquipmentOven, EquipmentStovetop, EquipmentMicrowave}
+
+// ValidEquipment reports whether every item is known equipment or
+// EquipmentNone, which can't be combined with anything else.
+func ValidEquipment(items []string) bool {
+	for _, item := range items {
+		if (item == EquipmentNone && len(items) > 1) || (item != EquipmentNone && !slices.Contains(Equipment, item)) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeEquipment returns a sorted list without duplicates or
+// EquipmentNone. It's never nil, so it's stored as an empty array rather than
+// NULL.
+func NormalizeEquipment(items []string) []string {
+	normalized := []string{}
+	for _, item := range items {
+		if item != EquipmentNone && !slices.Contains(normalized, item) {
+			normalized = append(normalized, item)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+// Yes/no attributes a recipe can be flagged with.
+const (
+	FlagKidFriendly     = "kid_friendly"
+	FlagSpicy           = "spicy"
+	FlagFreezerFriendly = "freezer_friendly"
+)
+
+var RecipeFlags = []string{FlagKidFriendly, FlagSpicy, FlagFreezerFriendly}
+
+// ValidFlags reports whether every item is one of RecipeFlags.
+func ValidFlags(items []string) bool {
+	for _, item := range items {
+		if !slices.Contains(RecipeFlags, item) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeFlags returns a sorted list without duplicates. Like
+// NormalizeEquipment it's never nil.
+func NormalizeFlags(items []string) []string {
+	normalized := []string{}
+	for _, item := range items {
+		if !slices.Contains(normalized, item) {
+			normalized = append(normalized, item)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+// FlagFilters splits the flag filters into the flags a recipe must have and
+// the ones it mustn't, each sorted and nil when empty.
+func (rfp *RecipesFinderParams) FlagFilters() (required []string, excluded []string) {
+	for flag, want := range rfp.Flags {
+		if want {
+			required = append(required, flag)
+		} else {
+			excluded = append(excluded, flag)
+		}
+	}
+	slices.Sort(required)
+	slices.Sort(excluded)
+	return required, excluded
+}
+
+// Recipe source kinds. A recipe's source is "<kind>:<name>", e.g.
+// "user:karol" for community recipes or "import:allrecipes".
+const (
+	SourceUser   = "user"
+	SourceImport = "import"
+)
+
+const maxSourceURLLength = 500
+
+var importProviderPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,39}$`)
+
+// ValidImportProvider reports whether name can follow "import:" in a source:
+// lowercase letters, digits, dots, dashes and underscores.
+func ValidImportProvider(name string) bool {
+	return importProviderPattern.MatchString(name)
+}
+
+// ValidSourceURL reports whether raw is an absolute http or https URL short
+// enough to store.
+func ValidSourceURL(raw string) bool {
+	if len(raw) > maxSourceURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
 }
 
 type Ingredient struct {
@@ -40,7 +272,78 @@ type RecipeAdd struct {
 	Name        string          `json:"name"`
 	Recipe      string          `json:"recipe"`
 	Ingredients IngredientsJson `json:"ingredients"`
-	Time        int32           `json:"time"`
+	Time        int32           `json:"time"`      // preparation
+	CookTime    int32           `json:"cook_time"` // unattended cooking
 	Difficulty  int32           `json:"difficulty"`
 	Tags        []RecipeTags    `json:"tags"`
+	Calories    *int32          `json:"calories,omitempty"`
+	Protein     *int32          `json:"protein,omitempty"`
+	Carbs       *int32          `json:"carbs,omitempty"`
+	Fat         *int32          `json:"fat,omitempty"`
+	Servings    int32           `json:"servings"` // 0 = 1 serving
+	Force       bool            `json:"force"`    // create even if likely duplicates exist
+	SourceURL   *string         `json:"source_url,omitempty"`
+	Equipment   []string        `json:"equipment"` // empty or ["none"] = needs none
+	Flags       []string        `json:"flags"`     // from RecipeFlags
+	// Scales up well for batch cooking, and keeps in the fridge this many
+	// days; 0 = not known.
+	BatchFriendly bool  `json:"batch_friendly"`
+	StorageDays   int32 `json:"storage_days"`
+}
+
+// DuplicateRecipe is an existing recipe that looks like the one being added.
+type DuplicateRecipe struct {
+	ID         int32   `json:"id"`
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+}
+
+type RecommendedRecipe struct {
+	ID         int32  `json:"id"`
+	Name       string `json:"name"`
+	Time       int32  `json:"time"`
+	Difficulty int32  `json:"difficulty"`
+	Score      int32  `json:"score"`
+}
+
+// Meal is a recipe ranked by recent activity; see TrendingMeals.
+type Meal struct {
+	ID         int32  `json:"id"`
+	Name       string `json:"name"`
+	Time       int32  `json:"time"`
+	Difficulty int32  `json:"difficulty"`
+	Activity   int32  `json:"activity"`
+}
+
+// ComparedMeal holds one column of a meal comparison. Nil values are unknown.
+type ComparedMeal struct {
+	ID       int32    `json:"id"`
+	Name     string   `json:"name"`
+	Time     int32    `json:"time"`
+	Calories *int32   `json:"calories"`
+	Protein  *int32   `json:"protein"`
+	Carbs    *int32   `json:"carbs"`
+	Fat      *int32   `json:"fat"`
+	Rating   *float64 `json:"rating"`
+}
+
+// MealComparison lists meals in the requested order. Winners maps each metric
+// to the ids of the best meals for it; ties share the win and metrics no meal
+// has are left out.
+type MealComparison struct {
+	Meals   []ComparedMeal     `json:"meals"`
+	Winners map[string][]int32 `json:"winners"`
+}
+
+// SearchPlan is the Postgres plan of a search, with the time each node took.
+type SearchPlan struct {
+	Plan string `json:"plan"`
+}
+
+type ExplainedRecipe struct {
+	ID           int32    `json:"id"`
+	Name         string   `json:"name"`
+	Time         int32    `json:"time"`
+	Difficulty   int32    `json:"difficulty"`
+	MatchReasons []string `json:"match_reasons"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import "errors"
+
+// RecipeImageRequest confirms an uploaded meal image by the URL it's served
+// from.
+type RecipeImageRequest struct {
+	URL string `json:"url"`
+}
+
+func (rir *RecipeImageRequest) Validate() error {
+	if !ValidSourceURL(rir.URL) {
+		return errors.New("invalid image url")
+	}
+	return nil
+}
+
+// ImagePlaceholder stands in for a meal image while it loads: a blurhash and
+// the image's dominant color as #rrggbb.
+type ImagePlaceholder struct {
+	BlurHash string `json:"blurhash"`
+	Color    string `json:"dominant_color"`
+}
+
+// RecipeImage is a confirmed meal image. Placeholder is nil when the image
+// couldn't be fetched yet; the backfill job computes it later.
+type RecipeImage struct {
+	URL         string            `json:"image_url"`
+	Placeholder *ImagePlaceholder `json:"placeholder"`
+}
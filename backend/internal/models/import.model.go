@@ -0,0 +1,92 @@
+package models
+
+import "errors"
+
+const MaxImportRecipes = 5000
+
+// Import job statuses.
+const (
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+)
+
+// ImportRecipe is a recipe with the stable id it has in the source it's
+// imported from. Records whose source id was already imported are skipped.
+type ImportRecipe struct {
+	SourceID string `json:"source_id"`
+	RecipeAdd
+}
+
+type ImportRequest struct {
+	// JobID resumes an earlier job, 0 starts a new one.
+	JobID int32 `json:"job_id"`
+	// Source is the provider the recipes come from, stored as
+	// "import:<source>". Empty means "unknown".
+	Source  string         `json:"source"`
+	Recipes []ImportRecipe `json:"recipes"`
+}
+
+// Provider recorded for imports that don't name one.
+const UnknownImportSource = "unknown"
+
+func (ir *ImportRequest) Validate() error {
+	if len(ir.Recipes) == 0 {
+		return errors.New("no recipes to import")
+	}
+	if len(ir.Recipes) > MaxImportRecipes {
+		return errors.New("too many recipes in one import")
+	}
+	if ir.Source != "" && !ValidImportProvider(ir.Source) {
+		return errors.New("invalid import source")
+	}
+	for _, recipe := range ir.Recipes {
+		if recipe.SourceID == "" || recipe.Name == "" {
+			return errors.New("every recipe needs a source_id and a name")
+		}
+		if recipe.SourceURL != nil && !ValidSourceURL(*recipe.SourceURL) {
+			return errors.New("invalid source url")
+		}
+		if !ValidEquipment(recipe.Equipment) {
+			return errors.New("unknown equipment")
+		}
+		if !ValidFlags(recipe.Flags) {
+			return errors.New("unknown recipe flag")
+		}
+		if recipe.Time < 0 || recipe.CookTime < 0 {
+			return errors.New("times can't be negative")
+		}
+	}
+	return nil
+}
+
+type ImportProgress struct {
+	JobID    int32  `json:"job_id"`
+	Status   string `json:"status"`
+	Total    int32  `json:"total"`
+	Imported int32  `json:"imported"`
+	Skipped  int32  `json:"skipped"`
+	Failed   int32  `json:"failed"`
+}
+
+// Most ingredients one allergen map may list, and the longest ingredient name.
+const (
+	MaxAllergenMappings      = 10000
+	MaxAllergenIngredientLen = 100
+)
+
+// AllergenMapping lists the allergens of one ingredient, by allergen tag name.
+// An empty list means the ingredient has none.
+type AllergenMapping struct {
+	Ingredient string   `json:"ingredient"`
+	Allergens  []string `json:"allergens"`
+}
+
+// ImportResult reports an allergen map import. Unknown ingredients aren't
+// used by any recipe; ingredients mapped to an unknown allergen are left
+// unchanged so a typo can't drop an allergen.
+type ImportResult struct {
+	Updated            int32    `json:"updated"`
+	UnknownIngredients []string `json:"unknown_ingredients"`
+	UnknownAllergens   []string `json:"unknown_allergens"`
+	DirtyRecipes       int64    `json:"dirty_recipes"`
+}
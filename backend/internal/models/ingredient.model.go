@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Units ingredient amounts may be given in; "z" counts garlic cloves.
+var IngredientUnits = []string{"g", "gr", "dag", "kg", "ml", "l", "szt", "z"}
+
+const MaxIngredientNameLength = 100
+
+// Normalize checks every ingredient and merges the ones listed more than once
+// in the same unit, names compared case insensitively. At most limit
+// ingredients may be given; 0 or less means no limit. Names and units are
+// trimmed and units lowercased.
+func (ij IngredientsJson) Normalize(limit int) (IngredientsJson, error) {
+	if limit > 0 && len(ij.Ingredients) > limit {
+		return ij, fmt.Errorf("at most %d ingredients per meal", limit)
+	}
+
+	merged := IngredientsJson{Ingredients: make([]Ingredient, 0, len(ij.Ingredients))}
+	seen := make(map[string]int, len(ij.Ingredients))
+	for _, ingredient := range ij.Ingredients {
+		ingredient.Name = strings.TrimSpace(ingredient.Name)
+		ingredient.Unit = strings.ToLower(strings.TrimSpace(ingredient.Unit))
+		switch {
+		case ingredient.Name == "":
+			return ij, errors.New("every ingredient needs a name")
+		case len(ingredient.Name) > MaxIngredientNameLength:
+			return ij, fmt.Errorf("ingredient names can't be over %d characters", MaxIngredientNameLength)
+		case ingredient.Amount <= 0:
+			return ij, fmt.Errorf("%s needs a positive amount", ingredient.Name)
+		case !slices.Contains(IngredientUnits, ingredient.Unit):
+			return ij, fmt.Errorf("%s has an unknown unit %q", ingredient.Name, ingredient.Unit)
+		}
+
+		key := strings.ToLower(ingredient.Name)
+		at, ok := seen[key]
+		if !ok {
+			seen[key] = len(merged.Ingredients)
+			merged.Ingredients = append(merged.Ingredients, ingredient)
+			continue
+		}
+		if merged.Ingredients[at].Unit != ingredient.Unit {
+			return ij, fmt.Errorf("%s is listed twice in different units", ingredient.Name)
+		}
+		merged.Ingredients[at].Amount += ingredient.Amount
+	}
+	return merged, nil
+}
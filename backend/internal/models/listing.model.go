@@ -0,0 +1,247 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter operators listing queries take as field[op]=value; a bare
+// field=value is OpEq. OpIn takes comma-separated values and OpLike matches
+// text containing the value, case insensitively.
+const (
+	OpEq   = "eq"
+	OpGt   = "gt"
+	OpLt   = "lt"
+	OpIn   = "in"
+	OpLike = "like"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the LIKE wildcards % and _, and the escape character
+// itself, so s matches literally in a pattern with ESCAPE '\'.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Types of listing fields, which decide how values parse and which operators
+// apply.
+type FieldType int
+
+const (
+	FieldInt FieldType = iota
+	FieldFloat
+	FieldText
+	FieldBool
+	FieldTime // RFC 3339
+)
+
+// Operators each field type allows unless the field narrows them.
+var fieldTypeOps = map[FieldType][]string{
+	FieldInt:   {OpEq, OpGt, OpLt, OpIn},
+	FieldFloat: {OpEq, OpGt, OpLt},
+	FieldText:  {OpEq, OpIn, OpLike},
+	FieldBool:  {OpEq},
+	FieldTime:  {OpEq, OpGt, OpLt},
+}
+
+// Query parameters every listing takes besides its filters.
+const (
+	ListSortParam   = "sort"
+	ListLimitParam  = "limit"
+	ListOffsetParam = "offset"
+)
+
+const maxInValues = 50
+
+// ListField is a field a listing can be filtered or sorted by.
+type ListField struct {
+	Type FieldType
+	// Operators allowed on it; nil allows all its type does.
+	Ops      []string
+	Sortable bool
+}
+
+// ListSpec is the allowlist of fields a listing endpoint takes. Anything
+// else in the query is rejected.
+type ListSpec struct {
+	Fields map[string]ListField
+	// Limit when none is asked for, and the most that may be.
+	DefaultLimit int32
+	MaxLimit     int32
+}
+
+// Condition is one parsed filter; Values hold one value, or several for OpIn,
+// typed by the field.
+type Condition struct {
+	Field  string
+	Op     string
+	Values []any
+}
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery is a listing's parsed filters, sort order and page.
+type ListQuery struct {
+	Conditions []Condition
+	Sort       []SortKey
+	Limit      int32
+	Offset     int32
+}
+
+// ListQueryError is a query parameter a listing can't take.
+type ListQueryError struct {
+	Param  string
+	Reason string
+}
+
+func (e *ListQueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Param, e.Reason)
+}
+
+// Parse reads listing parameters: field[op]=value filters, sort as
+// comma-separated fields with - for descending, limit and offset. Filters on
+// the same field and operator can repeat and must all hold.
+func (s ListSpec) Parse(values url.Values) (ListQuery, error) {
+	query := ListQuery{Limit: s.DefaultLimit}
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	// Sorted so conditions, and the SQL built from them, come out the same
+	// every time.
+	slices.Sort(params)
+
+	for _, param := range params {
+		switch param {
+		case ListSortParam:
+			sort, err := s.parseSort(values.Get(param))
+			if err != nil {
+				return ListQuery{}, err
+			}
+			query.Sort = sort
+			continue
+		case ListLimitParam:
+			limit, err := strconv.ParseInt(values.Get(param), 10, 32)
+			if err != nil || limit < 1 || (s.MaxLimit > 0 && limit > int64(s.MaxLimit)) {
+				return ListQuery{}, &ListQueryError{param, fmt.Sprintf("must be between 1 and %d", s.MaxLimit)}
+			}
+			query.Limit = int32(limit)
+			continue
+		case ListOffsetParam:
+			offset, err := strconv.ParseInt(values.Get(param), 10, 32)
+			if err != nil || offset < 0 {
+				return ListQuery{}, &ListQueryError{param, "must be a non-negative integer"}
+			}
+			query.Offset = int32(offset)
+			continue
+		}
+
+		name, op := param, OpEq
+		if open := strings.IndexByte(param, '['); open >= 0 && strings.HasSuffix(param, "]") {
+			name, op = param[:open], param[open+1:len(param)-1]
+		}
+		field, ok := s.Fields[name]
+		if !ok {
+			return ListQuery{}, &ListQueryError{param, "unknown field"}
+		}
+		ops := field.Ops
+		if ops == nil {
+			ops = fieldTypeOps[field.Type]
+		}
+		if !slices.Contains(ops, op) {
+			return ListQuery{}, &ListQueryError{param, fmt.Sprintf("operator %q not allowed", op)}
+		}
+
+		for _, raw := range values[param] {
+			condition, err := parseCondition(name, op, field.Type, raw)
+			if err != nil {
+				return ListQuery{}, &ListQueryError{param, err.Error()}
+			}
+			query.Conditions = append(query.Conditions, condition)
+		}
+	}
+	return query, nil
+}
+
+func (s ListSpec) parseSort(raw string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, name := range strings.Split(raw, ",") {
+		key := SortKey{Field: name}
+		if strings.HasPrefix(name, "-") {
+			key = SortKey{Field: name[1:], Desc: true}
+		}
+		if field, ok := s.Fields[key.Field]; !ok || !field.Sortable {
+			return nil, &ListQueryError{ListSortParam, fmt.Sprintf("can't sort by %q", key.Field)}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parseCondition(name string, op string, fieldType FieldType, raw string) (Condition, error) {
+	condition := Condition{Field: name, Op: op}
+	if op != OpIn {
+		value, err := parseFieldValue(fieldType, raw)
+		if err != nil {
+			return Condition{}, err
+		}
+		condition.Values = []any{value}
+		return condition, nil
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxInValues {
+		return Condition{}, fmt.Errorf("at most %d values", maxInValues)
+	}
+	for _, part := range parts {
+		value, err := parseFieldValue(fieldType, part)
+		if err != nil {
+			return Condition{}, err
+		}
+		condition.Values = append(condition.Values, value)
+	}
+	return condition, nil
+}
+
+func parseFieldValue(fieldType FieldType, raw string) (any, error) {
+	switch fieldType {
+	case FieldInt:
+		value, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return int32(value), nil
+	case FieldFloat:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return value, nil
+	case FieldBool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return value, nil
+	case FieldTime:
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC 3339 time", raw)
+		}
+		return value, nil
+	}
+	if raw == "" || len(raw) > maxNameQueryLength {
+		return nil, fmt.Errorf("text must be 1 to %d characters", maxNameQueryLength)
+	}
+	return raw, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Plausible per-serving nutrition; values outside are flagged on create.
+const (
+	MaxPlausibleCalories = 3000
+	MaxPlausibleProtein  = 300
+	MaxPlausibleCarbs    = 500
+	MaxPlausibleFat      = 300
+)
+
+// How far stated calories may be off the 4/4/9 estimate from macros before
+// it's flagged: the larger of a share of the stated calories and a fixed
+// margin, so small meals aren't flagged for rounding.
+const (
+	calorieReconcileTolerance = 0.25
+	calorieReconcileMargin    = 50
+)
+
+// NutritionWarning flags a nutrition value that looks wrong. Field is the
+// JSON field it's about, or "macros" when the values don't add up.
+type NutritionWarning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NutritionWarnings checks the recipe's per-serving nutrition. Missing values
+// aren't checked, and calories are only reconciled with macros when all four
+// are given.
+func (ra *RecipeAdd) NutritionWarnings() []NutritionWarning {
+	var warnings []NutritionWarning
+	check := func(field string, value *int32, max int32) {
+		switch {
+		case value == nil:
+		case *value < 0:
+			warnings = append(warnings, NutritionWarning{field, fmt.Sprintf("%s can't be negative", field)})
+		case *value > max:
+			warnings = append(warnings, NutritionWarning{field, fmt.Sprintf("%s over %d per serving is implausible", field, max)})
+		}
+	}
+	check("calories", ra.Calories, MaxPlausibleCalories)
+	check("protein", ra.Protein, MaxPlausibleProtein)
+	check("carbs", ra.Carbs, MaxPlausibleCarbs)
+	check("fat", ra.Fat, MaxPlausibleFat)
+
+	if ra.Calories == nil || ra.Protein == nil || ra.Carbs == nil || ra.Fat == nil || len(warnings) > 0 {
+		return warnings
+	}
+
+	stated := float64(*ra.Calories)
+	estimated := 4*float64(*ra.Protein) + 4*float64(*ra.Carbs) + 9*float64(*ra.Fat)
+	if math.Abs(stated-estimated) > max(stated*calorieReconcileTolerance, calorieReconcileMargin) {
+		warnings = append(warnings, NutritionWarning{"macros", fmt.Sprintf(
+			"macros add up to about %.0f kcal, not %d", estimated, *ra.Calories)})
+	}
+	return warnings
+}
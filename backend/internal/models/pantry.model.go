@@ -0,0 +1,30 @@
+package models
+
+import "errors"
+
+type PantryItemRequest struct {
+	Name   string `json:"name"`
+	Amount int32  `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+func (pir *PantryItemRequest) Validate() error {
+	if pir.Name == "" || len(pir.Name) > 60 {
+		return errors.New("invalid ingredient name")
+	}
+	if pir.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+	if len(pir.Unit) > 10 {
+		return errors.New("invalid unit")
+	}
+	return nil
+}
+
+// MissingIngredient is what's left to buy of one recipe ingredient. Amount is
+// in Unit, which is the base unit (g, ml) when the recipe's unit converts to one.
+type MissingIngredient struct {
+	Name   string `json:"name"`
+	Amount int32  `json:"amount"`
+	Unit   string `json:"unit"`
+}
@@ -0,0 +1,143 @@
+package models
+
+import "errors"
+
+const (
+	DefaultPlanMeals = 3
+	DefaultPlanDays  = 7
+)
+
+// MealPlanRequest describes a daily target. Macro grams take precedence over
+// percentages; a macro left at zero is not scored. Without calories the
+// target is estimated from the user's profile for Goal.
+type MealPlanRequest struct {
+	Calories       int32  `json:"calories"`
+	Goal           string `json:"goal"`
+	Meals          int32  `json:"meals"`
+	Protein        int32  `json:"protein"`
+	Carbs          int32  `json:"carbs"`
+	Fat            int32  `json:"fat"`
+	ProteinPercent int32  `json:"protein_percent"`
+	CarbsPercent   int32  `json:"carbs_percent"`
+	FatPercent     int32  `json:"fat_percent"`
+}
+
+func (r *MealPlanRequest) Validate() error {
+	if r.Calories <= 0 {
+		return errors.New("calories must be positive")
+	}
+	if r.Meals == 0 {
+		r.Meals = DefaultPlanMeals
+	}
+	if r.Meals < 1 || r.Meals > 10 {
+		return errors.New("meals must be between 1 and 10")
+	}
+	if r.Protein < 0 || r.Carbs < 0 || r.Fat < 0 {
+		return errors.New("macro targets can't be negative")
+	}
+	if r.ProteinPercent < 0 || r.CarbsPercent < 0 || r.FatPercent < 0 {
+		return errors.New("macro percentages can't be negative")
+	}
+	if r.ProteinPercent+r.CarbsPercent+r.FatPercent > 100 {
+		return errors.New("macro percentages can't exceed 100")
+	}
+	return nil
+}
+
+// MacroTargets returns the gram targets, converting percentages of the
+// calorie target with 4 kcal/g for protein and carbs and 9 kcal/g for fat.
+func (r *MealPlanRequest) MacroTargets() (protein, carbs, fat float64) {
+	protein, carbs, fat = float64(r.Protein), float64(r.Carbs), float64(r.Fat)
+	kcal := float64(r.Calories)
+	if protein == 0 && r.ProteinPercent > 0 {
+		protein = kcal * float64(r.ProteinPercent) / 100 / 4
+	}
+	if carbs == 0 && r.CarbsPercent > 0 {
+		carbs = kcal * float64(r.CarbsPercent) / 100 / 4
+	}
+	if fat == 0 && r.FatPercent > 0 {
+		fat = kcal * float64(r.FatPercent) / 100 / 9
+	}
+	return protein, carbs, fat
+}
+
+// PlanMeal holds per-serving nutrition. Servings is how many are planned, 0
+// meaning one; NutritionUnknown meals count as zero and mark the plan as
+// partially estimated.
+type PlanMeal struct {
+	ID               int32  `json:"id"`
+	Name             string `json:"name"`
+	Calories         int32  `json:"calories"`
+	Protein          int32  `json:"protein"`
+	Carbs            int32  `json:"carbs"`
+	Fat              int32  `json:"fat"`
+	Servings         int32  `json:"servings,omitempty"`
+	NutritionUnknown bool   `json:"nutrition_unknown,omitempty"`
+}
+
+// NutritionSummary totals the nutrition of planned meals. PartiallyEstimated
+// is set when some of them have unknown nutrition, so the totals are too low.
+type NutritionSummary struct {
+	Calories           int32 `json:"calories"`
+	Protein            int32 `json:"protein"`
+	Carbs              int32 `json:"carbs"`
+	Fat                int32 `json:"fat"`
+	PartiallyEstimated bool  `json:"partially_estimated"`
+}
+
+type MacroSplit struct {
+	ProteinPercent float64 `json:"protein_percent"`
+	CarbsPercent   float64 `json:"carbs_percent"`
+	FatPercent     float64 `json:"fat_percent"`
+}
+
+type MealPlan struct {
+	Meals              []PlanMeal `json:"meals"`
+	Calories           int32      `json:"calories"`
+	Protein            int32      `json:"protein"`
+	Carbs              int32      `json:"carbs"`
+	Fat                int32      `json:"fat"`
+	PartiallyEstimated bool       `json:"partially_estimated"`
+	Split              MacroSplit `json:"split"`
+}
+
+// Summary is the day's nutrition in the form WeeklyPlan reports it.
+func (p *MealPlan) Summary() NutritionSummary {
+	return NutritionSummary{
+		Calories:           p.Calories,
+		Protein:            p.Protein,
+		Carbs:              p.Carbs,
+		Fat:                p.Fat,
+		PartiallyEstimated: p.PartiallyEstimated,
+	}
+}
+
+// WeeklyPlanRequest applies the same daily targets to every day of the plan.
+type WeeklyPlanRequest struct {
+	MealPlanRequest
+	Days int32 `json:"days"`
+}
+
+func (r *WeeklyPlanRequest) Validate() error {
+	if r.Days == 0 {
+		r.Days = DefaultPlanDays
+	}
+	if r.Days < 1 || r.Days > 14 {
+		return errors.New("days must be between 1 and 14")
+	}
+	return r.MealPlanRequest.Validate()
+}
+
+// WeeklyPlan has the nutrition of the whole plan in Total and of each day, in
+// the order of Days, in Daily.
+type WeeklyPlan struct {
+	Days  []MealPlan         `json:"days"`
+	Total NutritionSummary   `json:"total"`
+	Daily []NutritionSummary `json:"daily"`
+}
+
+// PlanProgress is reported after each day of a weekly plan is built.
+type PlanProgress struct {
+	Day   int32 `json:"day"`
+	Total int32 `json:"total"`
+}
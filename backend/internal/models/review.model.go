@@ -0,0 +1,29 @@
+package models
+
+import "errors"
+
+// Longest review text accepted, in bytes.
+const MaxReviewCommentLength = 2000
+
+type ReviewRequest struct {
+	Score   int32  `json:"score"`
+	Comment string `json:"comment"`
+}
+
+func (rr *ReviewRequest) Validate() error {
+	if rr.Score < 1 || rr.Score > 5 {
+		return errors.New("score must be between 1 and 5")
+	}
+	if len(rr.Comment) > MaxReviewCommentLength {
+		return errors.New("comment too long")
+	}
+	return nil
+}
+
+type ReviewEditRequest struct {
+	Comment string `json:"comment"`
+}
+
+type ReviewVoteRequest struct {
+	Up bool `json:"up"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Most tag names a single filter of a saved search can list.
+const maxSearchTags = 30
+
+// MealSearchRequest is a search kept for later. Tag lists match like the
+// finder's: any of the listed tags within a type, every type that has a list,
+// and none of the allergies. Zero bounds are unset.
+type MealSearchRequest struct {
+	Diet          []string `json:"diet,omitempty"`
+	Region        []string `json:"region,omitempty"`
+	RecipeType    []string `json:"recipe_type,omitempty"`
+	Allergies     []string `json:"allergies,omitempty"`
+	Nutrients     []string `json:"nutrients,omitempty"`
+	Others        []string `json:"others,omitempty"`
+	MinTime       int32    `json:"min_time,omitempty"`
+	MaxTime       int32    `json:"max_time,omitempty"`
+	MinDifficulty int32    `json:"min_difficulty,omitempty"`
+	MaxDifficulty int32    `json:"max_difficulty,omitempty"`
+}
+
+func (msr *MealSearchRequest) Validate() error {
+	for _, tags := range [][]string{msr.Diet, msr.Region, msr.RecipeType, msr.Allergies, msr.Nutrients, msr.Others} {
+		if len(tags) > maxSearchTags {
+			return errors.New("too many tags in search")
+		}
+	}
+	if msr.MinTime < 0 || msr.MaxTime < 0 || msr.MinDifficulty < 0 || msr.MaxDifficulty < 0 {
+		return errors.New("search bounds can't be negative")
+	}
+	if msr.MaxTime > 0 && msr.MinTime > msr.MaxTime {
+		return errors.New("min time above max time")
+	}
+	if msr.MaxDifficulty > 0 && msr.MinDifficulty > msr.MaxDifficulty {
+		return errors.New("min difficulty above max difficulty")
+	}
+	return nil
+}
+
+type SaveSearchRequest struct {
+	Name   string            `json:"name"`
+	Search MealSearchRequest `json:"search"`
+}
+
+func (ssr *SaveSearchRequest) Validate() error {
+	name := strings.TrimSpace(ssr.Name)
+	if name == "" || utf8.RuneCountInString(name) > 60 {
+		return errors.New("invalid search name")
+	}
+	return ssr.Search.Validate()
+}
@@ -0,0 +1,50 @@
+package models
+
+// ShoppingItem is one ingredient of a shopping list. Amount and Unit are the
+// exact total in the base unit (g, ml, szt), for nutrition and pantry maths;
+// DisplayAmount and DisplayUnit are rounded for people.
+type ShoppingItem struct {
+	Name          string `json:"name"`
+	Amount        int64  `json:"amount"`
+	Unit          string `json:"unit"`
+	DisplayAmount string `json:"display_amount"`
+	DisplayUnit   string `json:"display_unit"`
+}
+
+// Store aisles shopping lists are grouped by, in the order they're listed.
+// Ingredients of no known aisle go to ShoppingCategoryOther, listed last.
+const (
+	ShoppingCategoryProduce = "produce"
+	ShoppingCategoryMeat    = "meat"
+	ShoppingCategoryFish    = "fish"
+	ShoppingCategoryDairy   = "dairy"
+	ShoppingCategoryBakery  = "bakery"
+	ShoppingCategoryPantry  = "pantry"
+	ShoppingCategorySpices  = "spices"
+	ShoppingCategoryFrozen  = "frozen"
+	ShoppingCategoryOther   = "other"
+)
+
+var ShoppingCategories = []string{
+	ShoppingCategoryProduce,
+	ShoppingCategoryMeat,
+	ShoppingCategoryFish,
+	ShoppingCategoryDairy,
+	ShoppingCategoryBakery,
+	ShoppingCategoryPantry,
+	ShoppingCategorySpices,
+	ShoppingCategoryFrozen,
+	ShoppingCategoryOther,
+}
+
+// ShoppingAisle is the part of a shopping list found in one aisle.
+type ShoppingAisle struct {
+	Category string         `json:"category"`
+	Items    []ShoppingItem `json:"items"`
+}
+
+// WeeklyShoppingList is what to buy for a weekly plan, by aisle. Aisles
+// without items are left out.
+type WeeklyShoppingList struct {
+	Aisles []ShoppingAisle `json:"aisles"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "slices"
+
+// Diets a meal can be transformed for.
+const (
+	DietVegan      = "vegan"
+	DietVegetarian = "vegetarian"
+)
+
+var Diets = []string{DietVegan, DietVegetarian}
+
+func ValidDiet(diet string) bool {
+	return slices.Contains(Diets, diet)
+}
+
+// IngredientSwap is one ingredient replaced in a transformed meal.
+type IngredientSwap struct {
+	Original   Ingredient `json:"original"`
+	Substitute Ingredient `json:"substitute"`
+}
+
+// MealDetail is a meal as shown to the user. A transformed meal is derived on
+// the fly and isn't stored; Diet and Swaps say how it differs from the
+// original. Nil nutrition values are unknown.
+type MealDetail struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	Recipe      string           `json:"recipe"`
+	Ingredients IngredientsJson  `json:"ingredients"`
+	Time        int32            `json:"time"`
+	CookTime    int32            `json:"cook_time"`
+	Difficulty  int32            `json:"difficulty"`
+	Servings    int32            `json:"servings"`
+	Calories    *int32           `json:"calories"`
+	Protein     *int32           `json:"protein"`
+	Carbs       *int32           `json:"carbs"`
+	Fat         *int32           `json:"fat"`
+	Diet        string           `json:"diet,omitempty"`
+	Swaps       []IngredientSwap `json:"swaps"`
+}
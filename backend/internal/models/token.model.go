@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Session is one login of a user, told apart by the device it came from.
+// Current marks the session of the token asking.
+type Session struct {
+	ID         string    `json:"id"`
+	Client     string    `json:"client"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Introspection is the RFC 7662 style answer about a token. Inactive tokens
+// carry no other fields.
+type Introspection struct {
+	Active bool   `json:"active"`
+	Sub    string `json:"sub,omitempty"`
+	Exp    int64  `json:"exp,omitempty"`
+	Role   string `json:"role,omitempty"`
+	Typ    string `json:"typ,omitempty"`
+	Client string `json:"client,omitempty"`
+}
@@ -1,14 +1,48 @@
 package models
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Clients a token can be issued to, sent at login in the X-Client header.
+// Sessions of each client can be revoked on their own.
+const (
+	ClientWeb    = "web"
+	ClientMobile = "mobile"
+	ClientAPI    = "api"
+)
+
+var Clients = []string{ClientWeb, ClientMobile, ClientAPI}
+
+func ValidClient(client string) bool {
+	return slices.Contains(Clients, client)
+}
 
 type LoginUserRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// Client the token is for, from the X-Client header. Empty means web.
+	Client string `json:"-"`
+	// Solved CAPTCHA, required after repeated failed logins.
+	CaptchaToken string `json:"captcha_token"`
+	RemoteIP     string `json:"-"`
+	// User-Agent of the login, shown in the session list.
+	UserAgent string `json:"-"`
 }
 
 func (lur *LoginUserRequest) Validate() error {
-	if lur.Login == "" || lur.Password == "" {
+	if lur.Login == "" || lur.Password == "" || (lur.Client != "" && !ValidClient(lur.Client)) {
 		return errors.New("bad request")
 	}
 	return nil
@@ -21,15 +55,122 @@ type CreateUserRequest struct {
 	PhoneNumber string `json:"phone_number"`
 	Age         int32  `json:"age"`
 	Sex         string `json:"sex"`
+	// Version of the terms and privacy policy the user accepted, which
+	// must be the current one.
+	TermsVersion string `json:"terms_version"`
+	// Solved CAPTCHA, required when CAPTCHA is enabled.
+	CaptchaToken string `json:"captcha_token"`
+	RemoteIP     string `json:"-"`
 }
 
 func (cur *CreateUserRequest) Validate() error {
 	if cur.Username == "" || cur.Passwdhash == "" || cur.Email == "" || cur.PhoneNumber == "" || cur.Sex == "" || cur.Age <= 0 {
 		return errors.New("missing required user fields")
 	}
+	if cur.TermsVersion == "" {
+		return errors.New("terms not accepted")
+	}
+	// Token subjects are told apart from legacy username subjects by format.
+	if LooksLikeUUID(cur.Username) {
+		return errors.New("username can't be a uuid")
+	}
 	return nil
 }
 
+// Signup limits. The maximums are those of the users table columns.
+const (
+	maxUsernameLength = 40
+	maxEmailLength    = 50
+	maxPhoneLength    = 12
+	minUsernameLength = 3
+	minPasswordLength = 8
+)
+
+var usernamePattern = regexp.MustCompile(`^[\p{L}0-9._-]+$`)
+
+// ValidationResult is the outcome of checking a whole form. Fields maps the
+// JSON name of every invalid field to what's wrong with it.
+type ValidationResult struct {
+	Valid  bool              `json:"valid"`
+	Fields map[string]string `json:"fields"`
+}
+
+// CheckFormat checks the signup form field by field, without looking at the
+// database, and returns the problems by JSON field name.
+func (cur *CreateUserRequest) CheckFormat() map[string]string {
+	fields := make(map[string]string)
+
+	switch username := []rune(cur.Username); {
+	case len(username) < minUsernameLength || len(username) > maxUsernameLength:
+		fields["username"] = fmt.Sprintf("must be %d to %d characters long", minUsernameLength, maxUsernameLength)
+	case !usernamePattern.MatchString(cur.Username):
+		fields["username"] = "may only contain letters, digits, dots, dashes and underscores"
+	case LooksLikeUUID(cur.Username):
+		fields["username"] = "can't be a uuid"
+	}
+
+	if address, err := mail.ParseAddress(cur.Email); err != nil || address.Address != cur.Email || len(cur.Email) > maxEmailLength {
+		fields["email"] = "must be a valid email address"
+	}
+
+	if problem := PasswordProblem(cur.Passwdhash); problem != "" {
+		fields["passwd"] = problem
+	}
+
+	if cur.PhoneNumber == "" || len(cur.PhoneNumber) > maxPhoneLength {
+		fields["phone_number"] = fmt.Sprintf("must be 1 to %d characters long", maxPhoneLength)
+	}
+	if cur.Age <= 0 {
+		fields["age"] = "must be positive"
+	}
+	if cur.Sex == "" {
+		fields["sex"] = "is required"
+	}
+	if cur.TermsVersion == "" {
+		fields["terms_version"] = "terms must be accepted"
+	}
+	return fields
+}
+
+// PasswordProblem describes why a password is too weak, or returns "" when
+// it's strong enough: at least 8 characters with a lowercase letter, an
+// uppercase letter and a digit.
+func PasswordProblem(password string) string {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Sprintf("must be at least %d characters long", minPasswordLength)
+	}
+	var lower, upper, digit bool
+	for _, c := range password {
+		lower = lower || unicode.IsLower(c)
+		upper = upper || unicode.IsUpper(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+	if !lower || !upper || !digit {
+		return "must contain a lowercase letter, an uppercase letter and a digit"
+	}
+	return ""
+}
+
+// LooksLikeUUID reports whether s has the canonical 8-4-4-4-12 hex uuid form.
+func LooksLikeUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 type UpdateUserSettingsRequest struct {
 	Email       string `json:"email"`        // "" = no update
 	Name        string `json:"name"`         // "" = no update
@@ -40,9 +181,189 @@ type UpdateUserSettingsRequest struct {
 	Weight      int32  `json:"weight"`       // -1 = no update
 	Height      int32  `json:"height"`       // -1 = no update
 	Bmi         int32  `json:"bmi"`          // -1 = no update
+	Timezone    string `json:"timezone"`     // "" = no update, IANA name e.g. "Europe/Warsaw"
+	Locale      string `json:"locale"`       // "" = no update, BCP-47 tag e.g. "pl-PL"
+	// nil = no update, 0 = use each recipe's own servings
+	DefaultServings *int32 `json:"default_servings"`
+	// nil = no update, ["none"] = no equipment at all
+	Equipment *[]string `json:"equipment"`
+
+	// Immutable fields the request tried to set; see ImmutableSettingsFields.
+	immutable []string
+}
+
+// ImmutableSettingsFields are account fields settings can't change. A request
+// naming any of them, in any case, fails validation rather than having them
+// silently dropped.
+var ImmutableSettingsFields = []string{"username", "role", "verified", "email_verified"}
+
+func (usr *UpdateUserSettingsRequest) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	type settings UpdateUserSettingsRequest
+	if err := json.Unmarshal(data, (*settings)(usr)); err != nil {
+		return err
+	}
+	usr.immutable = nil
+	for key := range fields {
+		if slices.Contains(ImmutableSettingsFields, strings.ToLower(key)) {
+			usr.immutable = append(usr.immutable, strings.ToLower(key))
+		}
+	}
+	slices.Sort(usr.immutable)
+	return nil
+}
+
+func (usr *UpdateUserSettingsRequest) Validate() error {
+	if len(usr.immutable) > 0 {
+		return fmt.Errorf("%s can't be changed in settings", strings.Join(usr.immutable, ", "))
+	}
+	if usr.Timezone != "" {
+		if _, err := time.LoadLocation(usr.Timezone); err != nil || usr.Timezone == "Local" {
+			return errors.New("invalid timezone")
+		}
+	}
+	if usr.Locale != "" {
+		if _, err := language.Parse(usr.Locale); err != nil {
+			return errors.New("invalid locale")
+		}
+	}
+	if usr.DefaultServings != nil && *usr.DefaultServings < 0 {
+		return errors.New("default servings must be a positive integer")
+	}
+	if usr.Equipment != nil && !ValidEquipment(*usr.Equipment) {
+		return errors.New("unknown equipment")
+	}
+	return nil
 }
 
 type UserTag struct {
 	Name    string `json:"name"`
 	TagType string `json:"type"`
 }
+
+type ExcludedIngredientRequest struct {
+	Name string `json:"name"`
+}
+
+func (eir *ExcludedIngredientRequest) Validate() error {
+	if eir.Name == "" || len(eir.Name) > 60 {
+		return errors.New("invalid ingredient name")
+	}
+	return nil
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (cpr *ChangePasswordRequest) Validate() error {
+	if cpr.OldPassword == "" || cpr.NewPassword == "" {
+		return errors.New("missing password fields")
+	}
+	return nil
+}
+
+// TermsConsentRequest accepts a version of the terms and privacy policy.
+type TermsConsentRequest struct {
+	Version string `json:"version"`
+}
+
+func (tcr *TermsConsentRequest) Validate() error {
+	if tcr.Version == "" {
+		return errors.New("missing terms version")
+	}
+	return nil
+}
+
+// MergeAccountRequest names another account of the user's, and proves it's
+// theirs, to merge into the signed-in one.
+type MergeAccountRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Solved CAPTCHA, required after repeated failed logins.
+	CaptchaToken string `json:"captcha_token"`
+	RemoteIP     string `json:"-"`
+}
+
+func (mar *MergeAccountRequest) Validate() error {
+	if mar.Login == "" || mar.Password == "" {
+		return errors.New("missing login or password")
+	}
+	return nil
+}
+
+// TermsStatus is the terms version the user has to accept and the one they
+// last accepted, if any.
+type TermsStatus struct {
+	CurrentVersion  string     `json:"current_version"`
+	AcceptedVersion string     `json:"accepted_version,omitempty"`
+	AcceptedAt      *time.Time `json:"accepted_at,omitempty"`
+	Accepted        bool       `json:"accepted"`
+}
+
+type TagWeightRequest struct {
+	Weight int32 `json:"weight"`
+}
+
+func (twr *TagWeightRequest) Validate() error {
+	if twr.Weight < 1 || twr.Weight > 100 {
+		return errors.New("weight must be between 1 and 100")
+	}
+	return nil
+}
+
+// How strictly a user keeps a diet tag. Strict leaves out recipes without
+// it; moderate and flexible only rank them lower, moderate twice as much.
+// Allergens have no strictness, they're always left out.
+const (
+	StrictnessStrict   = "strict"
+	StrictnessModerate = "moderate"
+	StrictnessFlexible = "flexible"
+)
+
+// DietPenalty is how much missing a diet tag kept this strictly lowers a
+// recipe's rank; 0 for strict tags, which exclude it instead.
+func DietPenalty(strictness string) int32 {
+	switch strictness {
+	case StrictnessModerate:
+		return 2
+	case StrictnessFlexible:
+		return 1
+	}
+	return 0
+}
+
+type TagStrictnessRequest struct {
+	Strictness string `json:"strictness"`
+}
+
+func (tsr *TagStrictnessRequest) Validate() error {
+	switch tsr.Strictness {
+	case StrictnessStrict, StrictnessModerate, StrictnessFlexible:
+		return nil
+	}
+	return errors.New("strictness must be strict, moderate or flexible")
+}
+
+// TagOrderRequest lists every user tag by name in the new display order.
+type TagOrderRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// TagConflict is a pair of the user's tags that contradict each other, so
+// few or no recipes can satisfy both.
+type TagConflict struct {
+	Tags [2]string `json:"tags"`
+}
+
+// FieldChange is one settings field changed by one update.
+type FieldChange struct {
+	Field     string    `json:"field"`
+	Old       string    `json:"old"`
+	New       string    `json:"new"`
+	ChangedAt time.Time `json:"changed_at"`
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+)
+
+// Columns listing fields filter and sort on, by the field names in
+// models.RecipeListSpec and models.UserListSpec. Only these ever reach SQL;
+// values always go as parameters.
+var (
+	RecipeListColumns = map[string]string{
+		"id":             "r.id",
+		"name":           "r.name",
+		"time":           "r.time",
+		"cook_time":      "r.cook_time",
+		"difficulty":     "r.difficulty",
+		"calories":       "r.calories",
+		"servings":       "r.servings",
+		"source":         "r.source",
+		"author":         "r.username",
+		"created_at":     "r.created_at",
+		"batch_friendly": "r.batch_friendly",
+		"storage_days":   "r.storage_days",
+	}
+	UserListColumns = map[string]string{
+		"username":   "u.username",
+		"email":      "u.email",
+		"role":       "u.role",
+		"age":        "u.age",
+		"sex":        "u.sex",
+		"created_at": "u.created_at",
+	}
+)
+
+// BuildListing appends query's conditions, order and page to base, which
+// ends in a WHERE clause the conditions are ANDed onto. Rows that tie on the
+// sort are ordered by tiebreak so pages don't overlap.
+func BuildListing(base string, columns map[string]string, tiebreak string, query models.ListQuery) (string, []any, error) {
+	var sql strings.Builder
+	var args []any
+	param := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	sql.WriteString(base)
+	for _, condition := range query.Conditions {
+		column, ok := columns[condition.Field]
+		if !ok || len(condition.Values) == 0 {
+			return "", nil, fmt.Errorf("listing: can't filter on %q", condition.Field)
+		}
+		sql.WriteString("\n  AND ")
+		switch condition.Op {
+		case models.OpEq:
+			fmt.Fprintf(&sql, "%s = %s", column, param(condition.Values[0]))
+		case models.OpGt:
+			fmt.Fprintf(&sql, "%s > %s", column, param(condition.Values[0]))
+		case models.OpLt:
+			fmt.Fprintf(&sql, "%s < %s", column, param(condition.Values[0]))
+		case models.OpIn:
+			placeholders := make([]string, len(condition.Values))
+			for i, value := range condition.Values {
+				placeholders[i] = param(value)
+			}
+			fmt.Fprintf(&sql, "%s IN (%s)", column, strings.Join(placeholders, ", "))
+		case models.OpLike:
+			text, _ := condition.Values[0].(string)
+			fmt.Fprintf(&sql, `%s ILIKE '%%' || %s || '%%' ESCAPE '\'`, column, param(models.EscapeLike(text)))
+		default:
+			return "", nil, fmt.Errorf("listing: unknown operator %q", condition.Op)
+		}
+	}
+
+	order := make([]string, 0, len(query.Sort)+1)
+	for _, key := range query.Sort {
+		column, ok := columns[key.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("listing: can't sort by %q", key.Field)
+		}
+		direction := "ASC"
+		if key.Desc {
+			direction = "DESC"
+		}
+		order = append(order, column+" "+direction)
+	}
+	order = append(order, tiebreak)
+	fmt.Fprintf(&sql, "\nORDER BY %s", strings.Join(order, ", "))
+	fmt.Fprintf(&sql, "\nLIMIT %s OFFSET %s", param(query.Limit), param(query.Offset))
+	return sql.String(), args, nil
+}
+
+const listRecipes = `SELECT r.id, r.name, r.time, r.cook_time, r.difficulty, r.calories, r.servings, r.source, r.username, r.created_at, r.batch_friendly, r.storage_days, r.image_url, r.image_blurhash, r.image_color
+FROM recipes r
+WHERE TRUE`
+
+type ListRecipesRow struct {
+	ID            int32     `json:"id"`
+	Name          string    `json:"name"`
+	Time          int32     `json:"time"`
+	CookTime      int32     `json:"cook_time"`
+	Difficulty    int32     `json:"difficulty"`
+	Calories      *int32    `json:"calories"`
+	Servings      int32     `json:"servings"`
+	Source        string    `json:"source"`
+	Author        string    `json:"author"`
+	CreatedAt     time.Time `json:"created_at"`
+	BatchFriendly bool      `json:"batch_friendly"`
+	StorageDays   int32     `json:"storage_days"`
+	ImageUrl      *string   `json:"image_url"`
+	ImageBlurhash *string   `json:"image_blurhash"`
+	ImageColor    *string   `json:"image_color"`
+}
+
+func (q *Queries) ListRecipes(ctx context.Context, query models.ListQuery) ([]ListRecipesRow, error) {
+	sql, args, err := BuildListing(listRecipes, RecipeListColumns, "r.id", query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRecipesRow
+	for rows.Next() {
+		var i ListRecipesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Time,
+			&i.CookTime,
+			&i.Difficulty,
+			&i.Calories,
+			&i.Servings,
+			&i.Source,
+			&i.Author,
+			&i.CreatedAt,
+			&i.BatchFriendly,
+			&i.StorageDays,
+			&i.ImageUrl,
+			&i.ImageBlurhash,
+			&i.ImageColor,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `SELECT u.username, u.email, u.role, u.age, u.sex, u.created_at
+FROM users u
+WHERE u.deleted_at IS NULL`
+
+type ListUsersRow struct {
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Age       int32     `json:"age"`
+	Sex       string    `json:"sex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) ListUsers(ctx context.Context, query models.ListQuery) ([]ListUsersRow, error) {
+	sql, args, err := BuildListing(listUsers, UserListColumns, "u.username", query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.Username,
+			&i.Email,
+			&i.Role,
+			&i.Age,
+			&i.Sex,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
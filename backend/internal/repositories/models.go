@@ -7,22 +7,133 @@ package repository
 import (
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/miloszbo/meals-finder/internal/models"
 )
 
+type AdminAudit struct {
+	ID          int32     `json:"id"`
+	Actor       string    `json:"actor"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	BeforeValue string    `json:"before_value"`
+	AfterValue  string    `json:"after_value"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ApiKey struct {
+	ID         int32            `json:"id"`
+	Username   string           `json:"username"`
+	Name       string           `json:"name"`
+	Prefix     string           `json:"prefix"`
+	KeyHash    string           `json:"key_hash"`
+	Scopes     []string         `json:"scopes"`
+	CreatedAt  time.Time        `json:"created_at"`
+	LastUsedAt pgtype.Timestamp `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamp `json:"revoked_at"`
+}
+
+type ClientRevocation struct {
+	Username  string    `json:"username"`
+	Client    string    `json:"client"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type Collection struct {
+	ID        int32     `json:"id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CollectionShare struct {
+	Token        string           `json:"token"`
+	CollectionID int32            `json:"collection_id"`
+	CreatedAt    time.Time        `json:"created_at"`
+	RevokedAt    pgtype.Timestamp `json:"revoked_at"`
+}
+
+type CollectionsRecipe struct {
+	CollectionID int32 `json:"collection_id"`
+	RecipeID     int32 `json:"recipe_id"`
+}
+
+type Favorite struct {
+	Username  string    `json:"username"`
+	RecipeID  int32     `json:"recipe_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FavoritesArchive struct {
+	Username   string    `json:"username"`
+	RecipeID   int32     `json:"recipe_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+type ImportJob struct {
+	ID        int32     `json:"id"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	Total     int32     `json:"total"`
+	Imported  int32     `json:"imported"`
+	Skipped   int32     `json:"skipped"`
+	Failed    int32     `json:"failed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type Ingredient struct {
 	ID   int32  `json:"id"`
 	Name string `json:"name"`
 }
 
+type IngredientAllergen struct {
+	Ingredient string `json:"ingredient"`
+	TagID      int32  `json:"tag_id"`
+}
+
+type PantryItem struct {
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Amount    int32     `json:"amount"`
+	Unit      string    `json:"unit"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PasswordHistory struct {
+	ID         int32     `json:"id"`
+	Username   string    `json:"username"`
+	Passwdhash string    `json:"passwdhash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Recipe struct {
-	ID          int32                  `json:"id"`
-	Name        string                 `json:"name"`
-	Recipe      string                 `json:"recipe"`
-	Ingredients models.IngredientsJson `json:"ingredients"`
-	Time        int32                  `json:"time"`
-	Difficulty  int32                  `json:"difficulty"`
-	Username    string                 `json:"username"`
+	ID             int32                  `json:"id"`
+	Name           string                 `json:"name"`
+	Recipe         string                 `json:"recipe"`
+	Ingredients    models.IngredientsJson `json:"ingredients"`
+	Time           int32                  `json:"time"`
+	Difficulty     int32                  `json:"difficulty"`
+	Username       string                 `json:"username"`
+	Calories       *int32                 `json:"calories"`
+	Protein        *int32                 `json:"protein"`
+	Carbs          *int32                 `json:"carbs"`
+	Fat            *int32                 `json:"fat"`
+	Servings       int32                  `json:"servings"`
+	SourceID       *string                `json:"source_id"`
+	CreatedAt      time.Time              `json:"created_at"`
+	Source         string                 `json:"source"`
+	SourceUrl      *string                `json:"source_url"`
+	Equipment      []string               `json:"equipment"`
+	AllergensDirty bool                   `json:"allergens_dirty"`
+	Flags          []string               `json:"flags"`
+	CookTime       int32                  `json:"cook_time"`
+	BatchFriendly  bool                   `json:"batch_friendly"`
+	StorageDays    int32                  `json:"storage_days"`
+	ImageUrl       *string                `json:"image_url"`
+	ImageBlurhash  *string                `json:"image_blurhash"`
+	ImageColor     *string                `json:"image_color"`
 }
 
 type RecipesIngredient struct {
@@ -32,16 +143,76 @@ type RecipesIngredient struct {
 	Unit         int32 `json:"unit"`
 }
 
+type RecipesMade struct {
+	ID       int32     `json:"id"`
+	Username string    `json:"username"`
+	RecipeID int32     `json:"recipe_id"`
+	MadeAt   time.Time `json:"made_at"`
+}
+
 type RecipesTag struct {
 	RecipeID int32 `json:"recipe_id"`
 	TagID    int32 `json:"tag_id"`
 }
 
+type RecommendationHistory struct {
+	Username string    `json:"username"`
+	RecipeID int32     `json:"recipe_id"`
+	ShownAt  time.Time `json:"shown_at"`
+}
+
 type Review struct {
-	ID          int32 `json:"id"`
-	RecipeID    int32 `json:"recipe_id"`
-	UserID      int32 `json:"user_id"`
-	ReviewScore int32 `json:"review_score"`
+	ID          int32            `json:"id"`
+	RecipeID    int32            `json:"recipe_id"`
+	Username    string           `json:"username"`
+	ReviewScore int32            `json:"review_score"`
+	Comment     string           `json:"comment"`
+	CreatedAt   time.Time        `json:"created_at"`
+	EditedAt    pgtype.Timestamp `json:"edited_at"`
+}
+
+type ReviewEdit struct {
+	ID         int32     `json:"id"`
+	ReviewID   int32     `json:"review_id"`
+	Comment    string    `json:"comment"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type ReviewVote struct {
+	ReviewID  int32     `json:"review_id"`
+	Username  string    `json:"username"`
+	Up        bool      `json:"up"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RevokedToken struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type SavedSearch struct {
+	ID            int64                    `json:"id"`
+	Username      string                   `json:"username"`
+	Name          string                   `json:"name"`
+	Params        models.MealSearchRequest `json:"params"`
+	CreatedAt     time.Time                `json:"created_at"`
+	LastCheckedAt time.Time                `json:"last_checked_at"`
+}
+
+type SearchAlert struct {
+	ID            int64            `json:"id"`
+	SavedSearchID int64            `json:"saved_search_id"`
+	RecipeID      int32            `json:"recipe_id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	SentAt        pgtype.Timestamp `json:"sent_at"`
+}
+
+type SettingsHistory struct {
+	ID        int32     `json:"id"`
+	Username  string    `json:"username"`
+	Snapshot  []byte    `json:"snapshot"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Tag struct {
@@ -56,22 +227,53 @@ type TagsType struct {
 }
 
 type User struct {
-	ID          int32     `json:"id"`
-	Username    string    `json:"username"`
-	CreatedAt   time.Time `json:"created_at"`
-	Passwdhash  string    `json:"passwdhash"`
-	Email       string    `json:"email"`
-	Name        string    `json:"name"`
-	Surname     string    `json:"surname"`
-	PhoneNumber string    `json:"phone_number"`
-	Age         int32     `json:"age"`
-	Sex         string    `json:"sex"`
-	Weight      int32     `json:"weight"`
-	Height      int32     `json:"height"`
-	Bmi         int32     `json:"bmi"`
+	ID              int32            `json:"id"`
+	Username        string           `json:"username"`
+	CreatedAt       time.Time        `json:"created_at"`
+	Passwdhash      string           `json:"passwdhash"`
+	Email           string           `json:"email"`
+	Name            string           `json:"name"`
+	Surname         string           `json:"surname"`
+	PhoneNumber     string           `json:"phone_number"`
+	Age             int32            `json:"age"`
+	Sex             string           `json:"sex"`
+	Weight          int32            `json:"weight"`
+	Height          int32            `json:"height"`
+	Bmi             int32            `json:"bmi"`
+	Timezone        string           `json:"timezone"`
+	Locale          string           `json:"locale"`
+	Role            string           `json:"role"`
+	DefaultServings *int32           `json:"default_servings"`
+	EmailChangedAt  pgtype.Timestamp `json:"email_changed_at"`
+	DeletedAt       pgtype.Timestamp `json:"deleted_at"`
+	Uuid            pgtype.UUID      `json:"uuid"`
+	TokensRevokedAt pgtype.Timestamp `json:"tokens_revoked_at"`
+	Equipment       []string         `json:"equipment"`
+	TermsVersion    string           `json:"terms_version"`
+	TermsAcceptedAt pgtype.Timestamp `json:"terms_accepted_at"`
+}
+
+type UserSession struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	Client     string    `json:"client"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type UsersExcludedIngredient struct {
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type UsersTag struct {
-	Username string `json:"username"`
-	TagID    int32  `json:"tag_id"`
+	Username   string `json:"username"`
+	TagID      int32  `json:"tag_id"`
+	Weight     int32  `json:"weight"`
+	SortOrder  int32  `json:"sort_order"`
+	Strictness string `json:"strictness"`
 }
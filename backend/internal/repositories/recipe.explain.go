@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+// ExplainFilterRecipesByTagNamesAndParams runs FilterRecipesByTagNamesAndParams
+// under EXPLAIN (ANALYZE, BUFFERS) with the same parameters and returns the
+// plan as text, one node per line. ANALYZE executes the query, so this costs
+// as much as the search itself.
+func (q *Queries) ExplainFilterRecipesByTagNamesAndParams(ctx context.Context, arg FilterRecipesByTagNamesAndParamsParams) (string, error) {
+	rows, err := q.db.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT TEXT) "+filterRecipesByTagNamesAndParams, filterRecipesArgs(arg)...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		plan = append(plan, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(plan, "\n"), nil
+}
@@ -26,25 +26,111 @@ func (q *Queries) AddTagsForRecipe(ctx context.Context, arg AddTagsForRecipePara
 	return err
 }
 
+const compareRecipes = `-- name: CompareRecipes :many
+SELECT r.id, r.name, r.time, r.calories, r.protein, r.carbs, r.fat,
+  COALESCE(AVG(rv.review_score), 0)::float8 AS rating,
+  COUNT(rv.id)::int AS review_count
+FROM recipes r
+LEFT JOIN reviews rv ON rv.recipe_id = r.id
+WHERE r.id = ANY($1::int[])
+GROUP BY r.id;
+`
+
+type CompareRecipesRow struct {
+	ID          int32   `json:"id"`
+	Name        string  `json:"name"`
+	Time        int32   `json:"time"`
+	Calories    *int32  `json:"calories"`
+	Protein     *int32  `json:"protein"`
+	Carbs       *int32  `json:"carbs"`
+	Fat         *int32  `json:"fat"`
+	Rating      float64 `json:"rating"`
+	ReviewCount int32   `json:"review_count"`
+}
+
+func (q *Queries) CompareRecipes(ctx context.Context, recipeIds []int32) ([]CompareRecipesRow, error) {
+	rows, err := q.db.Query(ctx, compareRecipes, recipeIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CompareRecipesRow
+	for rows.Next() {
+		var i CompareRecipesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Time,
+			&i.Calories,
+			&i.Protein,
+			&i.Carbs,
+			&i.Fat,
+			&i.Rating,
+			&i.ReviewCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countRecipes = `-- name: CountRecipes :one
+SELECT COUNT(*) FROM recipes
+`
+
+func (q *Queries) CountRecipes(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, countRecipes)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createRecipe = `-- name: CreateRecipe :one
-INSERT INTO recipes (name,recipe,ingredients,time,difficulty,username) VALUES 
+INSERT INTO recipes (name,recipe,ingredients,time,difficulty,username,calories,protein,carbs,fat,servings,source,source_url,equipment,flags,cook_time,batch_friendly,storage_days) VALUES 
 (
   $1::text,
   $2::text,
   $3,
   $4::int,
   $5::int,
-  $6::text
+  $6::text,
+  $7::int,
+  $8::int,
+  $9::int,
+  $10::int,
+  $11::int,
+  'user:' || $6::text,
+  $12::text,
+  $13::text[],
+  $14::text[],
+  $15::int,
+  $16::bool,
+  $17::int
 ) RETURNING id
 `
 
 type CreateRecipeParams struct {
-	Name        string                 `json:"name"`
-	Recipe      string                 `json:"recipe"`
-	Ingredients models.IngredientsJson `json:"ingredients"`
-	Time        int32                  `json:"time"`
-	Difficulty  int32                  `json:"difficulty"`
-	Username    string                 `json:"username"`
+	Name          string                 `json:"name"`
+	Recipe        string                 `json:"recipe"`
+	Ingredients   models.IngredientsJson `json:"ingredients"`
+	Time          int32                  `json:"time"`
+	Difficulty    int32                  `json:"difficulty"`
+	Username      string                 `json:"username"`
+	Calories      *int32                 `json:"calories"`
+	Protein       *int32                 `json:"protein"`
+	Carbs         *int32                 `json:"carbs"`
+	Fat           *int32                 `json:"fat"`
+	Servings      int32                  `json:"servings"`
+	SourceUrl     *string                `json:"source_url"`
+	Equipment     []string               `json:"equipment"`
+	Flags         []string               `json:"flags"`
+	CookTime      int32                  `json:"cook_time"`
+	BatchFriendly bool                   `json:"batch_friendly"`
+	StorageDays   int32                  `json:"storage_days"`
 }
 
 func (q *Queries) CreateRecipe(ctx context.Context, arg CreateRecipeParams) (int32, error) {
@@ -55,6 +141,17 @@ func (q *Queries) CreateRecipe(ctx context.Context, arg CreateRecipeParams) (int
 		arg.Time,
 		arg.Difficulty,
 		arg.Username,
+		arg.Calories,
+		arg.Protein,
+		arg.Carbs,
+		arg.Fat,
+		arg.Servings,
+		arg.SourceUrl,
+		arg.Equipment,
+		arg.Flags,
+		arg.CookTime,
+		arg.BatchFriendly,
+		arg.StorageDays,
 	)
 	var id int32
 	err := row.Scan(&id)
@@ -62,112 +159,223 @@ func (q *Queries) CreateRecipe(ctx context.Context, arg CreateRecipeParams) (int
 }
 
 const filterRecipesByTagNamesAndParams = `-- name: FilterRecipesByTagNamesAndParams :many
-SELECT r.id, r.name, r.time, r.difficulty
+SELECT r.id, r.name, r.time, r.cook_time, (r.time + r.cook_time)::int AS total_time, r.difficulty, rr.recent_rating
 FROM recipes r
+-- Average rating with each review's weight halving every half-life (in
+-- seconds), pulled towards a neutral 3 as if a fresh 3 were added, so high
+-- but old ratings fade. NULL without reviews
+LEFT JOIN LATERAL (
+  SELECT ((SUM(rv.review_score * w.weight) + 3) / (SUM(w.weight) + 1))::float8 AS recent_rating
+  FROM reviews rv
+  CROSS JOIN LATERAL (
+    SELECT power(0.5, EXTRACT(EPOCH FROM LOCALTIMESTAMP - rv.created_at) / $1::float8) AS weight
+  ) w
+  WHERE rv.recipe_id = r.id
+) rr ON TRUE
 WHERE
-  -- User tags
-  (NOT EXISTS (SELECT 1 FROM users_tags ut WHERE ut.username = $1::text) OR
+  -- User tags. Diet tags that aren't strict only rank recipes, see ORDER BY
+  (NOT EXISTS (SELECT 1 FROM users_tags ut WHERE ut.username = $2::text AND ut.strictness = 'strict') OR
 
   EXISTS (SELECT 1 FROM recipes_tags rt JOIN users_tags ut ON rt.tag_id = ut.tag_id WHERE
-  ut.username = $1::text AND rt.recipe_id = r.id AND rt.tag_id IN (SELECT tag_id FROM users_tags ut WHERE ut.username = $1::text)))
+  ut.username = $2::text AND rt.recipe_id = r.id AND rt.tag_id IN (SELECT tag_id FROM users_tags ut WHERE ut.username = $2::text AND ut.strictness = 'strict')))
+
+  -- Every strict diet tag of the user is on the recipe
+  AND NOT EXISTS (
+    SELECT 1 FROM users_tags ut
+    JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = $2::text AND t.type_id = 1 AND ut.strictness = 'strict'
+      AND NOT EXISTS (SELECT 1 FROM recipes_tags rt WHERE rt.recipe_id = r.id AND rt.tag_id = ut.tag_id)
+  )
 
   -- Min preparation time (optional)
-  AND ($2::int = 0 OR r.time >= $2::int)
+  AND ($3::int = 0 OR r.time >= $3::int)
 
   -- Max preparation time (optional)
-  AND ($3::int = 0 OR r.time <= $3::int)
+  AND ($4::int = 0 OR r.time <= $4::int)
+
+  -- Max total time, preparation and cooking (optional)
+  AND ($5::int = 0 OR r.time + r.cook_time <= $5::int)
 
   -- Min difficulty (optional)
-  AND ($4::int = 0 OR r.difficulty >= $4::int)
+  AND ($6::int = 0 OR r.difficulty >= $6::int)
 
   -- Max difficulty (optional)
-  AND ($5::int = 0 OR r.difficulty <= $5::int)
+  AND ($7::int = 0 OR r.difficulty <= $7::int)
 
   -- Type 1 (Dieta): OR within, AND across types
-  AND ($6::text[] IS NULL OR EXISTS (
+  AND ($8::text[] IS NULL OR EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 1
-      AND t.name = ANY($6::text[])
+      AND t.name = ANY($8::text[])
   ))
 
   -- Type 2 (Region)
-  AND ($7::text[] IS NULL OR EXISTS (
+  AND ($9::text[] IS NULL OR EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 2
-      AND t.name = ANY($7::text[])
+      AND t.name = ANY($9::text[])
   ))
 
   -- Type 3 (Rodzaj)
-  AND ($8::text[] IS NULL OR EXISTS (
+  AND ($10::text[] IS NULL OR EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 3
-      AND t.name = ANY($8::text[])
+      AND t.name = ANY($10::text[])
   ))
 
   -- Type 4 (Alergie): must NOT include any of these
-  AND ($9::text[] IS NULL OR NOT EXISTS (
+  AND ($11::text[] IS NULL OR NOT EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 4
-      AND t.name = ANY($9::text[])
+      AND t.name = ANY($11::text[])
   ))
 
   -- Type 5 (Składniki odżywcze)
-  AND ($10::text[] IS NULL OR EXISTS (
+  AND ($12::text[] IS NULL OR EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 5
-      AND t.name = ANY($10::text[])
+      AND t.name = ANY($12::text[])
   ))
 
   -- Type 6 (Inne)
-  AND ($11::text[] IS NULL OR EXISTS (
+  AND ($13::text[] IS NULL OR EXISTS (
     SELECT 1 FROM recipes_tags rt
     JOIN tags t ON t.id = rt.tag_id
     WHERE rt.recipe_id = r.id
       AND t.type_id = 6
-      AND t.name = ANY($11::text[])
+      AND t.name = ANY($13::text[])
+  ))
+
+  -- Hide favorited recipes (optional)
+  AND (NOT $14::bool OR NOT EXISTS (
+    SELECT 1 FROM favorites f WHERE f.recipe_id = r.id AND f.username = $2::text
   ))
 
-ORDER BY r.id LIMIT $13::int OFFSET $12::int
+  -- Hide recipes already made (optional)
+  AND (NOT $15::bool OR NOT EXISTS (
+    SELECT 1 FROM recipes_made rm WHERE rm.recipe_id = r.id AND rm.username = $2::text
+  ))
+
+  -- Leave out recipes using any of these ingredients, matched by lowercase name (optional)
+  AND ($16::text[] IS NULL OR NOT EXISTS (
+    SELECT 1 FROM json_array_elements(r.ingredients->'ingredients') i
+    WHERE lower(i->>'name') = ANY($16::text[])
+  ))
+
+  -- Only recipes of one source kind, e.g. "user" or "import" (optional)
+  AND ($17::text = '' OR r.source LIKE $17::text || ':%')
+
+  -- Name contains the query, case insensitively. Wildcards in it are escaped
+  -- by the finder, so they match literally (optional)
+  AND ($18::text = '' OR r.name ILIKE '%' || $18::text || '%' ESCAPE '\')
+
+  -- Only recipes that need nothing beyond this equipment (optional)
+  AND ($19::text[] IS NULL OR r.equipment <@ $19::text[])
+
+  -- Only recipes with all of these flags, and none of the excluded ones (optional)
+  AND ($20::text[] IS NULL OR r.flags @> $20::text[])
+  AND ($21::text[] IS NULL OR NOT r.flags && $21::text[])
+
+ORDER BY
+  -- Recipes missing fewer of the user's moderate (2 points each) and flexible
+  -- (1 point) diet tags come first, whatever the sort
+  (
+    SELECT COALESCE(SUM(CASE ut.strictness WHEN 'moderate' THEN 2 ELSE 1 END), 0)
+    FROM users_tags ut
+    JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = $2::text AND t.type_id = 1 AND ut.strictness <> 'strict'
+      AND NOT EXISTS (SELECT 1 FROM recipes_tags rt WHERE rt.recipe_id = r.id AND rt.tag_id = ut.tag_id)
+  ),
+  -- Sort order (optional). Every order ends with the id, so recipes that tie
+  -- keep their place between pages
+  CASE WHEN $22::text = 'time' THEN r.time END,
+  CASE WHEN $22::text = 'quickest' THEN r.time + r.cook_time END,
+  CASE WHEN $22::text = 'calories' THEN r.calories END NULLS LAST,
+  CASE WHEN $22::text = 'rating' THEN (
+    SELECT AVG(rv.review_score) FROM reviews rv WHERE rv.recipe_id = r.id
+  ) END DESC NULLS LAST,
+  CASE WHEN $22::text = 'recent_rating' THEN rr.recent_rating END DESC NULLS LAST,
+  CASE WHEN $22::text = 'newest' THEN r.created_at END DESC,
+  -- Relevance weighs the same signals as recommendations, in the order of
+  -- RelevanceWeights.Array
+  CASE WHEN $22::text = 'relevance' THEN
+    ($23::float8[])[1] * (
+      SELECT COALESCE(SUM(ut.weight), 0) FROM recipes_tags rt
+      JOIN users_tags ut ON ut.tag_id = rt.tag_id
+      WHERE rt.recipe_id = r.id AND ut.username = $2::text
+    )
+    + ($23::float8[])[2] * COALESCE((
+      SELECT AVG(rv.review_score) FROM reviews rv WHERE rv.recipe_id = r.id
+    ), 0)
+    + ($23::float8[])[3] * ln(1 + (SELECT COUNT(*) FROM favorites f WHERE f.recipe_id = r.id))
+    + ($23::float8[])[4] / (1 + EXTRACT(EPOCH FROM now() - r.created_at) / 2592000)
+    + ($23::float8[])[5] * COALESCE((
+      SELECT AVG(CASE WHEN EXISTS (
+        SELECT 1 FROM pantry_items p
+        WHERE p.username = $2::text AND lower(trim(p.name)) = lower(trim(i->>'name'))
+      ) THEN 1 ELSE 0 END)
+      FROM json_array_elements(r.ingredients->'ingredients') i
+    ), 0)
+  END DESC NULLS LAST,
+  r.id
+LIMIT $25::int OFFSET $24::int
 `
 
 type FilterRecipesByTagNamesAndParamsParams struct {
-	Username      string   `json:"username"`
-	MinTime       int32    `json:"min_time"`
-	MaxTime       int32    `json:"max_time"`
-	MinDifficulty int32    `json:"min_difficulty"`
-	MaxDifficulty int32    `json:"max_difficulty"`
-	Diet          []string `json:"diet"`
-	Region        []string `json:"region"`
-	RecipeType    []string `json:"recipe_type"`
-	Allergies     []string `json:"allergies"`
-	Nutrients     []string `json:"nutrients"`
-	Others        []string `json:"others"`
-	RecipesOffset int32    `json:"recipes_offset"`
-	RecipesLimit  int32    `json:"recipes_limit"`
+	RatingHalfLife     float64   `json:"rating_half_life"`
+	Username           string    `json:"username"`
+	MinTime            int32     `json:"min_time"`
+	MaxTime            int32     `json:"max_time"`
+	MaxTotalTime       int32     `json:"max_total_time"`
+	MinDifficulty      int32     `json:"min_difficulty"`
+	MaxDifficulty      int32     `json:"max_difficulty"`
+	Diet               []string  `json:"diet"`
+	Region             []string  `json:"region"`
+	RecipeType         []string  `json:"recipe_type"`
+	Allergies          []string  `json:"allergies"`
+	Nutrients          []string  `json:"nutrients"`
+	Others             []string  `json:"others"`
+	ExcludeFavorited   bool      `json:"exclude_favorited"`
+	ExcludeMade        bool      `json:"exclude_made"`
+	ExcludeIngredients []string  `json:"exclude_ingredients"`
+	SourceKind         string    `json:"source_kind"`
+	NameQuery          string    `json:"name_query"`
+	AvailableEquipment []string  `json:"available_equipment"`
+	RequiredFlags      []string  `json:"required_flags"`
+	ExcludedFlags      []string  `json:"excluded_flags"`
+	SortBy             string    `json:"sort_by"`
+	RelevanceWeights   []float64 `json:"relevance_weights"`
+	RecipesOffset      int32     `json:"recipes_offset"`
+	RecipesLimit       int32     `json:"recipes_limit"`
 }
 
 type FilterRecipesByTagNamesAndParamsRow struct {
-	ID         int32  `json:"id"`
-	Name       string `json:"name"`
-	Time       int32  `json:"time"`
-	Difficulty int32  `json:"difficulty"`
+	ID           int32    `json:"id"`
+	Name         string   `json:"name"`
+	Time         int32    `json:"time"`
+	CookTime     int32    `json:"cook_time"`
+	TotalTime    int32    `json:"total_time"`
+	Difficulty   int32    `json:"difficulty"`
+	RecentRating *float64 `json:"recent_rating"`
 }
 
 func (q *Queries) FilterRecipesByTagNamesAndParams(ctx context.Context, arg FilterRecipesByTagNamesAndParamsParams) ([]FilterRecipesByTagNamesAndParamsRow, error) {
 	rows, err := q.db.Query(ctx, filterRecipesByTagNamesAndParams,
+		arg.RatingHalfLife,
 		arg.Username,
 		arg.MinTime,
 		arg.MaxTime,
+		arg.MaxTotalTime,
 		arg.MinDifficulty,
 		arg.MaxDifficulty,
 		arg.Diet,
@@ -176,6 +384,16 @@ func (q *Queries) FilterRecipesByTagNamesAndParams(ctx context.Context, arg Filt
 		arg.Allergies,
 		arg.Nutrients,
 		arg.Others,
+		arg.ExcludeFavorited,
+		arg.ExcludeMade,
+		arg.ExcludeIngredients,
+		arg.SourceKind,
+		arg.NameQuery,
+		arg.AvailableEquipment,
+		arg.RequiredFlags,
+		arg.ExcludedFlags,
+		arg.SortBy,
+		arg.RelevanceWeights,
 		arg.RecipesOffset,
 		arg.RecipesLimit,
 	)
@@ -190,7 +408,57 @@ func (q *Queries) FilterRecipesByTagNamesAndParams(ctx context.Context, arg Filt
 			&i.ID,
 			&i.Name,
 			&i.Time,
+			&i.CookTime,
+			&i.TotalTime,
 			&i.Difficulty,
+			&i.RecentRating,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findSimilarRecipes = `-- name: FindSimilarRecipes :many
+-- % uses the trigram index, so only recipes past pg_trgm's similarity
+-- threshold are considered.
+SELECT r.id, r.name, similarity(lower(r.name), lower($1::text))::float8 AS name_similarity, r.ingredients
+FROM recipes r
+WHERE lower(r.name) % lower($1::text)
+ORDER BY name_similarity DESC, r.id
+LIMIT $2::int;
+`
+
+type FindSimilarRecipesParams struct {
+	Name           string `json:"name"`
+	CandidateLimit int32  `json:"candidate_limit"`
+}
+
+type FindSimilarRecipesRow struct {
+	ID             int32                  `json:"id"`
+	Name           string                 `json:"name"`
+	NameSimilarity float64                `json:"name_similarity"`
+	Ingredients    models.IngredientsJson `json:"ingredients"`
+}
+
+func (q *Queries) FindSimilarRecipes(ctx context.Context, arg FindSimilarRecipesParams) ([]FindSimilarRecipesRow, error) {
+	rows, err := q.db.Query(ctx, findSimilarRecipes, arg.Name, arg.CandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindSimilarRecipesRow
+	for rows.Next() {
+		var i FindSimilarRecipesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.NameSimilarity,
+			&i.Ingredients,
 		); err != nil {
 			return nil, err
 		}
@@ -234,8 +502,126 @@ func (q *Queries) GetAllTags(ctx context.Context) ([]GetAllTagsRow, error) {
 	return items, nil
 }
 
+const getIngredientsForRecipes = `-- name: GetIngredientsForRecipes :many
+SELECT r.id, r.ingredients
+FROM recipes r
+WHERE r.id = ANY($1::int[])
+`
+
+type GetIngredientsForRecipesRow struct {
+	ID          int32                  `json:"id"`
+	Ingredients models.IngredientsJson `json:"ingredients"`
+}
+
+func (q *Queries) GetIngredientsForRecipes(ctx context.Context, recipeIds []int32) ([]GetIngredientsForRecipesRow, error) {
+	rows, err := q.db.Query(ctx, getIngredientsForRecipes, recipeIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetIngredientsForRecipesRow
+	for rows.Next() {
+		var i GetIngredientsForRecipesRow
+		if err := rows.Scan(&i.ID, &i.Ingredients); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPlanCandidates = `-- name: GetPlanCandidates :many
+SELECT r.id, r.name, r.calories, r.protein, r.carbs, r.fat
+FROM recipes r
+WHERE r.calories IS NOT NULL AND r.protein IS NOT NULL AND r.carbs IS NOT NULL AND r.fat IS NOT NULL
+  -- Never plan recipes containing the user's allergens
+  AND NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4 AND ut.username = $1::text
+  )
+ORDER BY r.id
+`
+
+type GetPlanCandidatesRow struct {
+	ID       int32  `json:"id"`
+	Name     string `json:"name"`
+	Calories *int32 `json:"calories"`
+	Protein  *int32 `json:"protein"`
+	Carbs    *int32 `json:"carbs"`
+	Fat      *int32 `json:"fat"`
+}
+
+func (q *Queries) GetPlanCandidates(ctx context.Context, username string) ([]GetPlanCandidatesRow, error) {
+	rows, err := q.db.Query(ctx, getPlanCandidates, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPlanCandidatesRow
+	for rows.Next() {
+		var i GetPlanCandidatesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Calories,
+			&i.Protein,
+			&i.Carbs,
+			&i.Fat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecipeAtOffset = `-- name: GetRecipeAtOffset :one
+SELECT id, name, recipe, ingredients, time, difficulty, username, calories, protein, carbs, fat, servings, source_id, created_at, source, source_url, equipment, allergens_dirty, flags, cook_time, batch_friendly, storage_days, image_url, image_blurhash, image_color FROM recipes ORDER BY id LIMIT 1 OFFSET $1::int
+`
+
+func (q *Queries) GetRecipeAtOffset(ctx context.Context, recipeOffset int32) (Recipe, error) {
+	row := q.db.QueryRow(ctx, getRecipeAtOffset, recipeOffset)
+	var i Recipe
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Recipe,
+		&i.Ingredients,
+		&i.Time,
+		&i.Difficulty,
+		&i.Username,
+		&i.Calories,
+		&i.Protein,
+		&i.Carbs,
+		&i.Fat,
+		&i.Servings,
+		&i.SourceID,
+		&i.CreatedAt,
+		&i.Source,
+		&i.SourceUrl,
+		&i.Equipment,
+		&i.AllergensDirty,
+		&i.Flags,
+		&i.CookTime,
+		&i.BatchFriendly,
+		&i.StorageDays,
+		&i.ImageUrl,
+		&i.ImageBlurhash,
+		&i.ImageColor,
+	)
+	return i, err
+}
+
 const getRecipeWithId = `-- name: GetRecipeWithId :one
-SELECT id, name, recipe, ingredients, time, difficulty, username FROM recipes WHERE id = $1
+SELECT id, name, recipe, ingredients, time, difficulty, username, calories, protein, carbs, fat, servings, source_id, created_at, source, source_url, equipment, allergens_dirty, flags, cook_time, batch_friendly, storage_days, image_url, image_blurhash, image_color FROM recipes WHERE id = $1
 `
 
 func (q *Queries) GetRecipeWithId(ctx context.Context, id int32) (Recipe, error) {
@@ -249,10 +635,93 @@ func (q *Queries) GetRecipeWithId(ctx context.Context, id int32) (Recipe, error)
 		&i.Time,
 		&i.Difficulty,
 		&i.Username,
+		&i.Calories,
+		&i.Protein,
+		&i.Carbs,
+		&i.Fat,
+		&i.Servings,
+		&i.SourceID,
+		&i.CreatedAt,
+		&i.Source,
+		&i.SourceUrl,
+		&i.Equipment,
+		&i.AllergensDirty,
+		&i.Flags,
+		&i.CookTime,
+		&i.BatchFriendly,
+		&i.StorageDays,
+		&i.ImageUrl,
+		&i.ImageBlurhash,
+		&i.ImageColor,
 	)
 	return i, err
 }
 
+const getRecommendationCandidates = `-- name: GetRecommendationCandidates :many
+SELECT r.id, r.name, r.time, r.difficulty, array_agg(rt.tag_id)::int[] AS tag_ids,
+  -- Relevance signals besides tags and ratings, as in the relevance sort
+  ln(1 + (SELECT COUNT(*) FROM favorites f WHERE f.recipe_id = r.id))::float8 AS popularity,
+  (1 / (1 + EXTRACT(EPOCH FROM now() - r.created_at) / 2592000))::float8 AS recency,
+  COALESCE((
+    SELECT AVG(CASE WHEN EXISTS (
+      SELECT 1 FROM pantry_items p
+      WHERE p.username = $1::text AND lower(trim(p.name)) = lower(trim(i->>'name'))
+    ) THEN 1 ELSE 0 END)
+    FROM json_array_elements(r.ingredients->'ingredients') i
+  ), 0)::float8 AS pantry_share
+FROM recipes r
+JOIN recipes_tags rt ON rt.recipe_id = r.id
+JOIN users_tags ut ON ut.tag_id = rt.tag_id AND ut.username = $1::text
+WHERE NOT EXISTS (
+  -- Allergens are a hard filter, whatever their weight
+  SELECT 1 FROM recipes_tags art
+  JOIN tags t ON t.id = art.tag_id
+  JOIN users_tags aut ON aut.tag_id = t.id
+  WHERE art.recipe_id = r.id AND t.type_id = 4 AND aut.username = $1::text
+)
+GROUP BY r.id
+`
+
+type GetRecommendationCandidatesRow struct {
+	ID          int32   `json:"id"`
+	Name        string  `json:"name"`
+	Time        int32   `json:"time"`
+	Difficulty  int32   `json:"difficulty"`
+	TagIds      []int32 `json:"tag_ids"`
+	Popularity  float64 `json:"popularity"`
+	Recency     float64 `json:"recency"`
+	PantryShare float64 `json:"pantry_share"`
+}
+
+func (q *Queries) GetRecommendationCandidates(ctx context.Context, username string) ([]GetRecommendationCandidatesRow, error) {
+	rows, err := q.db.Query(ctx, getRecommendationCandidates, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecommendationCandidatesRow
+	for rows.Next() {
+		var i GetRecommendationCandidatesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Time,
+			&i.Difficulty,
+			&i.TagIds,
+			&i.Popularity,
+			&i.Recency,
+			&i.PantryShare,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getTagId = `-- name: GetTagId :one
 SELECT t.id AS tag_id
 FROM tags t
@@ -271,3 +740,343 @@ func (q *Queries) GetTagId(ctx context.Context, arg GetTagIdParams) (int32, erro
 	err := row.Scan(&tag_id)
 	return tag_id, err
 }
+
+const getTagsForRecipes = `-- name: GetTagsForRecipes :many
+SELECT rt.recipe_id, t.type_id, t.name
+FROM recipes_tags rt
+JOIN tags t ON t.id = rt.tag_id
+WHERE rt.recipe_id = ANY($1::int[])
+ORDER BY rt.recipe_id, t.type_id, t.name
+`
+
+type GetTagsForRecipesRow struct {
+	RecipeID int32  `json:"recipe_id"`
+	TypeID   int32  `json:"type_id"`
+	Name     string `json:"name"`
+}
+
+func (q *Queries) GetTagsForRecipes(ctx context.Context, recipeIds []int32) ([]GetTagsForRecipesRow, error) {
+	rows, err := q.db.Query(ctx, getTagsForRecipes, recipeIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTagsForRecipesRow
+	for rows.Next() {
+		var i GetTagsForRecipesRow
+		if err := rows.Scan(&i.RecipeID, &i.TypeID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrendingRecipes = `-- name: GetTrendingRecipes :many
+-- Activity inside the window only: a favorite counts 3, a review 2 and a
+-- cooked log 1. Recipes without activity in the window are left out.
+WITH activity AS (
+  SELECT recipe_id, 3 AS points FROM favorites
+  WHERE created_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => $1::int)
+  UNION ALL
+  SELECT recipe_id, 2 FROM reviews
+  WHERE created_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => $1::int)
+  UNION ALL
+  SELECT recipe_id, 1 FROM recipes_made
+  WHERE made_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => $1::int)
+)
+SELECT r.id, r.name, r.time, r.difficulty, SUM(a.points)::int AS activity,
+  COALESCE((
+    SELECT array_agg(t.id) FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4
+  ), '{}')::int[] AS allergen_tag_ids
+FROM activity a
+JOIN recipes r ON r.id = a.recipe_id
+GROUP BY r.id
+ORDER BY activity DESC, r.id
+LIMIT $2::int;
+`
+
+type GetTrendingRecipesParams struct {
+	WindowSeconds int32 `json:"window_seconds"`
+	PoolSize      int32 `json:"pool_size"`
+}
+
+type GetTrendingRecipesRow struct {
+	ID             int32   `json:"id"`
+	Name           string  `json:"name"`
+	Time           int32   `json:"time"`
+	Difficulty     int32   `json:"difficulty"`
+	Activity       int32   `json:"activity"`
+	AllergenTagIds []int32 `json:"allergen_tag_ids"`
+}
+
+func (q *Queries) GetTrendingRecipes(ctx context.Context, arg GetTrendingRecipesParams) ([]GetTrendingRecipesRow, error) {
+	rows, err := q.db.Query(ctx, getTrendingRecipes, arg.WindowSeconds, arg.PoolSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTrendingRecipesRow
+	for rows.Next() {
+		var i GetTrendingRecipesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Time,
+			&i.Difficulty,
+			&i.Activity,
+			&i.AllergenTagIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecipesMissingImagePlaceholder = `-- name: ListRecipesMissingImagePlaceholder :many
+-- Recipes with an image but no placeholder yet, in id order after after_id.
+SELECT id, image_url::text AS image_url FROM recipes
+WHERE image_url IS NOT NULL AND image_blurhash IS NULL AND id > $1::int
+ORDER BY id
+LIMIT $2::int
+`
+
+type ListRecipesMissingImagePlaceholderParams struct {
+	AfterID   int32 `json:"after_id"`
+	BatchSize int32 `json:"batch_size"`
+}
+
+type ListRecipesMissingImagePlaceholderRow struct {
+	ID       int32  `json:"id"`
+	ImageUrl string `json:"image_url"`
+}
+
+func (q *Queries) ListRecipesMissingImagePlaceholder(ctx context.Context, arg ListRecipesMissingImagePlaceholderParams) ([]ListRecipesMissingImagePlaceholderRow, error) {
+	rows, err := q.db.Query(ctx, listRecipesMissingImagePlaceholder, arg.AfterID, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRecipesMissingImagePlaceholderRow
+	for rows.Next() {
+		var i ListRecipesMissingImagePlaceholderRow
+		if err := rows.Scan(&i.ID, &i.ImageUrl); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSurpriseCandidates = `-- name: ListSurpriseCandidates :many
+-- Recipes a random pick may return, with the user tags each matches.
+SELECT r.id, ARRAY(
+  SELECT rt.tag_id FROM recipes_tags rt
+  JOIN users_tags ut ON ut.tag_id = rt.tag_id AND ut.username = $1::text
+  WHERE rt.recipe_id = r.id
+)::int[] AS tag_ids
+FROM recipes r
+WHERE
+  -- Never return a recipe with one of the user's allergens
+  NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4 AND ut.username = $1::text
+  )
+
+  -- Respect the user's strict diet tags when there are any
+  AND (NOT EXISTS (
+    SELECT 1 FROM users_tags ut JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = $1::text AND t.type_id = 1 AND ut.strictness = 'strict'
+  ) OR EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 1 AND ut.username = $1::text AND ut.strictness = 'strict'
+  ))
+
+  AND ($2::int = 0 OR r.time <= $2::int)
+  AND ($3::int = 0 OR r.difficulty <= $3::int)
+
+  AND ($4::text[] IS NULL OR EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id
+      AND t.type_id = 3
+      AND t.name = ANY($4::text[])
+  ))
+
+  AND ($5::text[] IS NULL OR NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id
+      AND t.type_id = 4
+      AND t.name = ANY($5::text[])
+  ))
+
+ORDER BY r.id
+`
+
+type ListSurpriseCandidatesParams struct {
+	Username      string   `json:"username"`
+	MaxTime       int32    `json:"max_time"`
+	MaxDifficulty int32    `json:"max_difficulty"`
+	RecipeType    []string `json:"recipe_type"`
+	Allergies     []string `json:"allergies"`
+}
+
+type ListSurpriseCandidatesRow struct {
+	ID     int32   `json:"id"`
+	TagIds []int32 `json:"tag_ids"`
+}
+
+func (q *Queries) ListSurpriseCandidates(ctx context.Context, arg ListSurpriseCandidatesParams) ([]ListSurpriseCandidatesRow, error) {
+	rows, err := q.db.Query(ctx, listSurpriseCandidates,
+		arg.Username,
+		arg.MaxTime,
+		arg.MaxDifficulty,
+		arg.RecipeType,
+		arg.Allergies,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSurpriseCandidatesRow
+	for rows.Next() {
+		var i ListSurpriseCandidatesRow
+		if err := rows.Scan(&i.ID, &i.TagIds); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserRecipes = `-- name: ListUserRecipes :many
+SELECT id, name, recipe, ingredients, time, difficulty, username, calories, protein, carbs, fat, servings, source_id, created_at, source, source_url, equipment, allergens_dirty, flags, cook_time, batch_friendly, storage_days, image_url, image_blurhash, image_color FROM recipes WHERE username = $1 ORDER BY id
+`
+
+func (q *Queries) ListUserRecipes(ctx context.Context, username string) ([]Recipe, error) {
+	rows, err := q.db.Query(ctx, listUserRecipes, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Recipe
+	for rows.Next() {
+		var i Recipe
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Recipe,
+			&i.Ingredients,
+			&i.Time,
+			&i.Difficulty,
+			&i.Username,
+			&i.Calories,
+			&i.Protein,
+			&i.Carbs,
+			&i.Fat,
+			&i.Servings,
+			&i.SourceID,
+			&i.CreatedAt,
+			&i.Source,
+			&i.SourceUrl,
+			&i.Equipment,
+			&i.AllergensDirty,
+			&i.Flags,
+			&i.CookTime,
+			&i.BatchFriendly,
+			&i.StorageDays,
+			&i.ImageUrl,
+			&i.ImageBlurhash,
+			&i.ImageColor,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const notifyRecipeChanged = `-- name: NotifyRecipeChanged :exec
+SELECT pg_notify('recipe_invalidation', $1::text)
+`
+
+func (q *Queries) NotifyRecipeChanged(ctx context.Context, recipeID string) error {
+	_, err := q.db.Exec(ctx, notifyRecipeChanged, recipeID)
+	return err
+}
+
+const setRecipeImage = `-- name: SetRecipeImage :execrows
+UPDATE recipes SET image_url = $1::text,
+  image_blurhash = $2::text,
+  image_color = $3::text
+WHERE id = $4::int
+`
+
+type SetRecipeImageParams struct {
+	ImageUrl      string  `json:"image_url"`
+	ImageBlurhash *string `json:"image_blurhash"`
+	ImageColor    *string `json:"image_color"`
+	ID            int32   `json:"id"`
+}
+
+func (q *Queries) SetRecipeImage(ctx context.Context, arg SetRecipeImageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setRecipeImage,
+		arg.ImageUrl,
+		arg.ImageBlurhash,
+		arg.ImageColor,
+		arg.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setRecipeImagePlaceholder = `-- name: SetRecipeImagePlaceholder :execrows
+-- Only while the image is still the one the placeholder was made from.
+UPDATE recipes SET image_blurhash = $1::text, image_color = $2::text
+WHERE id = $3::int AND image_url = $4::text
+`
+
+type SetRecipeImagePlaceholderParams struct {
+	ImageBlurhash string `json:"image_blurhash"`
+	ImageColor    string `json:"image_color"`
+	ID            int32  `json:"id"`
+	ImageUrl      string `json:"image_url"`
+}
+
+func (q *Queries) SetRecipeImagePlaceholder(ctx context.Context, arg SetRecipeImagePlaceholderParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setRecipeImagePlaceholder,
+		arg.ImageBlurhash,
+		arg.ImageColor,
+		arg.ID,
+		arg.ImageUrl,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import "context"
+
+// StreamFilterRecipesByTagNamesAndParams runs FilterRecipesByTagNamesAndParams
+// and hands each row to yield as it's read rather than collecting them. It
+// stops at the first error yield returns, and returns it.
+func (q *Queries) StreamFilterRecipesByTagNamesAndParams(ctx context.Context, arg FilterRecipesByTagNamesAndParamsParams, yield func(FilterRecipesByTagNamesAndParamsRow) error) error {
+	rows, err := q.db.Query(ctx, filterRecipesByTagNamesAndParams, filterRecipesArgs(arg)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i FilterRecipesByTagNamesAndParamsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Time,
+			&i.CookTime,
+			&i.TotalTime,
+			&i.Difficulty,
+			&i.RecentRating,
+		); err != nil {
+			return err
+		}
+		if err := yield(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// filterRecipesArgs lists the arguments of FilterRecipesByTagNamesAndParams
+// in placeholder order.
+func filterRecipesArgs(arg FilterRecipesByTagNamesAndParamsParams) []any {
+	return []any{
+		arg.RatingHalfLife,
+		arg.Username,
+		arg.MinTime,
+		arg.MaxTime,
+		arg.MaxTotalTime,
+		arg.MinDifficulty,
+		arg.MaxDifficulty,
+		arg.Diet,
+		arg.Region,
+		arg.RecipeType,
+		arg.Allergies,
+		arg.Nutrients,
+		arg.Others,
+		arg.ExcludeFavorited,
+		arg.ExcludeMade,
+		arg.ExcludeIngredients,
+		arg.SourceKind,
+		arg.NameQuery,
+		arg.AvailableEquipment,
+		arg.RequiredFlags,
+		arg.ExcludedFlags,
+		arg.SortBy,
+		arg.RelevanceWeights,
+		arg.RecipesOffset,
+		arg.RecipesLimit,
+	}
+}
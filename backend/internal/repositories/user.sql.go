@@ -8,8 +8,25 @@ package repository
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addExcludedIngredient = `-- name: AddExcludedIngredient :exec
+INSERT INTO users_excluded_ingredients (username, name) VALUES ($1::text, $2::text)
+ON CONFLICT (username, name) DO NOTHING
+`
+
+type AddExcludedIngredientParams struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+func (q *Queries) AddExcludedIngredient(ctx context.Context, arg AddExcludedIngredientParams) error {
+	_, err := q.db.Exec(ctx, addExcludedIngredient, arg.Username, arg.Name)
+	return err
+}
+
 const createUser = `-- name: CreateUser :exec
 INSERT INTO users (
     username,
@@ -17,19 +34,22 @@ INSERT INTO users (
     email,
     phone_number,
     age,
-    sex
+    sex,
+    terms_version,
+    terms_accepted_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP(0)
 )
 `
 
 type CreateUserParams struct {
-	Username    string `json:"username"`
-	Passwdhash  string `json:"passwdhash"`
-	Email       string `json:"email"`
-	PhoneNumber string `json:"phone_number"`
-	Age         int32  `json:"age"`
-	Sex         string `json:"sex"`
+	Username     string `json:"username"`
+	Passwdhash   string `json:"passwdhash"`
+	Email        string `json:"email"`
+	PhoneNumber  string `json:"phone_number"`
+	Age          int32  `json:"age"`
+	Sex          string `json:"sex"`
+	TermsVersion string `json:"terms_version"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
@@ -40,10 +60,40 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
 		arg.PhoneNumber,
 		arg.Age,
 		arg.Sex,
+		arg.TermsVersion,
 	)
 	return err
 }
 
+const deleteExcludedIngredient = `-- name: DeleteExcludedIngredient :execrows
+DELETE FROM users_excluded_ingredients WHERE username = $1::text AND name = $2::text
+`
+
+type DeleteExcludedIngredientParams struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+func (q *Queries) DeleteExcludedIngredient(ctx context.Context, arg DeleteExcludedIngredientParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExcludedIngredient, arg.Username, arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSettingsHistoryByIDs = `-- name: DeleteSettingsHistoryByIDs :execrows
+DELETE FROM settings_history WHERE id = ANY($1::int[])
+`
+
+func (q *Queries) DeleteSettingsHistoryByIDs(ctx context.Context, ids []int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSettingsHistoryByIDs, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteUserTag = `-- name: DeleteUserTag :exec
 DELETE FROM users_tags USING tags WHERE users_tags.tag_id = tags.id AND users_tags.username = $1::text AND tags.name = $2::text
 `
@@ -59,14 +109,17 @@ func (q *Queries) DeleteUserTag(ctx context.Context, arg DeleteUserTagParams) er
 }
 
 const displayUserTag = `-- name: DisplayUserTag :many
-SELECT t.name AS value, tt.name AS category FROM tags t 
+SELECT t.name AS value, tt.name AS category, ut.weight, ut.strictness FROM tags t 
 JOIN tags_types tt ON tt.id = t.type_id
 JOIN users_tags ut ON ut.tag_id = t.id WHERE ut.username = $1::text
+ORDER BY ut.sort_order, t.name
 `
 
 type DisplayUserTagRow struct {
-	Value    string `json:"value"`
-	Category string `json:"category"`
+	Value      string `json:"value"`
+	Category   string `json:"category"`
+	Weight     int32  `json:"weight"`
+	Strictness string `json:"strictness"`
 }
 
 func (q *Queries) DisplayUserTag(ctx context.Context, username string) ([]DisplayUserTagRow, error) {
@@ -78,7 +131,12 @@ func (q *Queries) DisplayUserTag(ctx context.Context, username string) ([]Displa
 	var items []DisplayUserTagRow
 	for rows.Next() {
 		var i DisplayUserTagRow
-		if err := rows.Scan(&i.Value, &i.Category); err != nil {
+		if err := rows.Scan(
+			&i.Value,
+			&i.Category,
+			&i.Weight,
+			&i.Strictness,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -89,22 +147,125 @@ func (q *Queries) DisplayUserTag(ctx context.Context, username string) ([]Displa
 	return items, nil
 }
 
+const getPasswordHistory = `-- name: GetPasswordHistory :many
+SELECT passwdhash FROM password_history
+WHERE username = $1::text
+ORDER BY created_at DESC, id DESC
+LIMIT $2::int
+`
+
+type GetPasswordHistoryParams struct {
+	Username     string `json:"username"`
+	HistoryLimit int32  `json:"history_limit"`
+}
+
+func (q *Queries) GetPasswordHistory(ctx context.Context, arg GetPasswordHistoryParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, getPasswordHistory, arg.Username, arg.HistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var passwdhash string
+		if err := rows.Scan(&passwdhash); err != nil {
+			return nil, err
+		}
+		items = append(items, passwdhash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSignupAvailability = `-- name: GetSignupAvailability :one
+-- Usernames of soft-deleted accounts stay taken until they're purged.
+SELECT
+  EXISTS (SELECT 1 FROM users WHERE username = $1::text)::bool AS username_taken,
+  EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($2::text) AND deleted_at IS NULL)::bool AS email_taken
+`
+
+type GetSignupAvailabilityParams struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type GetSignupAvailabilityRow struct {
+	UsernameTaken bool `json:"username_taken"`
+	EmailTaken    bool `json:"email_taken"`
+}
+
+func (q *Queries) GetSignupAvailability(ctx context.Context, arg GetSignupAvailabilityParams) (GetSignupAvailabilityRow, error) {
+	row := q.db.QueryRow(ctx, getSignupAvailability, arg.Username, arg.Email)
+	var i GetSignupAvailabilityRow
+	err := row.Scan(&i.UsernameTaken, &i.EmailTaken)
+	return i, err
+}
+
+const getTermsConsent = `-- name: GetTermsConsent :one
+SELECT terms_version, terms_accepted_at FROM users WHERE username = $1
+`
+
+type GetTermsConsentRow struct {
+	TermsVersion    string           `json:"terms_version"`
+	TermsAcceptedAt pgtype.Timestamp `json:"terms_accepted_at"`
+}
+
+func (q *Queries) GetTermsConsent(ctx context.Context, username string) (GetTermsConsentRow, error) {
+	row := q.db.QueryRow(ctx, getTermsConsent, username)
+	var i GetTermsConsentRow
+	err := row.Scan(&i.TermsVersion, &i.TermsAcceptedAt)
+	return i, err
+}
+
+const getUserAllergenTagIds = `-- name: GetUserAllergenTagIds :many
+SELECT ut.tag_id FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1 AND t.type_id = 4
+ORDER BY ut.tag_id
+`
+
+func (q *Queries) GetUserAllergenTagIds(ctx context.Context, username string) ([]int32, error) {
+	rows, err := q.db.Query(ctx, getUserAllergenTagIds, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var tag_id int32
+		if err := rows.Scan(&tag_id); err != nil {
+			return nil, err
+		}
+		items = append(items, tag_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserData = `-- name: GetUserData :one
-SELECT username, created_at, email, name, surname, phone_number, age, sex, weight, height, BMI FROM users WHERE users.username = $1
+SELECT username, created_at, email, name, surname, phone_number, age, sex, weight, height, BMI, timezone, locale, default_servings, equipment FROM users WHERE users.username = $1
 `
 
 type GetUserDataRow struct {
-	Username    string    `json:"username"`
-	CreatedAt   time.Time `json:"created_at"`
-	Email       string    `json:"email"`
-	Name        string    `json:"name"`
-	Surname     string    `json:"surname"`
-	PhoneNumber string    `json:"phone_number"`
-	Age         int32     `json:"age"`
-	Sex         string    `json:"sex"`
-	Weight      int32     `json:"weight"`
-	Height      int32     `json:"height"`
-	Bmi         int32     `json:"bmi"`
+	Username        string    `json:"username"`
+	CreatedAt       time.Time `json:"created_at"`
+	Email           string    `json:"email"`
+	Name            string    `json:"name"`
+	Surname         string    `json:"surname"`
+	PhoneNumber     string    `json:"phone_number"`
+	Age             int32     `json:"age"`
+	Sex             string    `json:"sex"`
+	Weight          int32     `json:"weight"`
+	Height          int32     `json:"height"`
+	Bmi             int32     `json:"bmi"`
+	Timezone        string    `json:"timezone"`
+	Locale          string    `json:"locale"`
+	DefaultServings *int32    `json:"default_servings"`
+	Equipment       []string  `json:"equipment"`
 }
 
 func (q *Queries) GetUserData(ctx context.Context, username string) (GetUserDataRow, error) {
@@ -122,10 +283,140 @@ func (q *Queries) GetUserData(ctx context.Context, username string) (GetUserData
 		&i.Weight,
 		&i.Height,
 		&i.Bmi,
+		&i.Timezone,
+		&i.Locale,
+		&i.DefaultServings,
+		&i.Equipment,
 	)
 	return i, err
 }
 
+const getUserDefaultServings = `-- name: GetUserDefaultServings :one
+SELECT default_servings FROM users WHERE username = $1
+`
+
+func (q *Queries) GetUserDefaultServings(ctx context.Context, username string) (*int32, error) {
+	row := q.db.QueryRow(ctx, getUserDefaultServings, username)
+	var default_servings *int32
+	err := row.Scan(&default_servings)
+	return default_servings, err
+}
+
+const getUserDietStrictness = `-- name: GetUserDietStrictness :many
+SELECT ut.tag_id, ut.strictness FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1 AND t.type_id = 1
+ORDER BY ut.tag_id
+`
+
+type GetUserDietStrictnessRow struct {
+	TagID      int32  `json:"tag_id"`
+	Strictness string `json:"strictness"`
+}
+
+func (q *Queries) GetUserDietStrictness(ctx context.Context, username string) ([]GetUserDietStrictnessRow, error) {
+	rows, err := q.db.Query(ctx, getUserDietStrictness, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserDietStrictnessRow
+	for rows.Next() {
+		var i GetUserDietStrictnessRow
+		if err := rows.Scan(&i.TagID, &i.Strictness); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserEmailChange = `-- name: GetUserEmailChange :one
+SELECT email, email_changed_at FROM users WHERE username = $1
+`
+
+type GetUserEmailChangeRow struct {
+	Email          string           `json:"email"`
+	EmailChangedAt pgtype.Timestamp `json:"email_changed_at"`
+}
+
+func (q *Queries) GetUserEmailChange(ctx context.Context, username string) (GetUserEmailChangeRow, error) {
+	row := q.db.QueryRow(ctx, getUserEmailChange, username)
+	var i GetUserEmailChangeRow
+	err := row.Scan(&i.Email, &i.EmailChangedAt)
+	return i, err
+}
+
+const getUserEquipment = `-- name: GetUserEquipment :one
+SELECT equipment FROM users WHERE username = $1
+`
+
+func (q *Queries) GetUserEquipment(ctx context.Context, username string) ([]string, error) {
+	row := q.db.QueryRow(ctx, getUserEquipment, username)
+	var equipment []string
+	err := row.Scan(&equipment)
+	return equipment, err
+}
+
+const getUserMeasurementsForUpdate = `-- name: GetUserMeasurementsForUpdate :one
+SELECT weight, height FROM users WHERE username = $1 FOR UPDATE
+`
+
+type GetUserMeasurementsForUpdateRow struct {
+	Weight int32 `json:"weight"`
+	Height int32 `json:"height"`
+}
+
+func (q *Queries) GetUserMeasurementsForUpdate(ctx context.Context, username string) (GetUserMeasurementsForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getUserMeasurementsForUpdate, username)
+	var i GetUserMeasurementsForUpdateRow
+	err := row.Scan(&i.Weight, &i.Height)
+	return i, err
+}
+
+const getUserRole = `-- name: GetUserRole :one
+SELECT role FROM users WHERE username = $1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, username string) (string, error) {
+	row := q.db.QueryRow(ctx, getUserRole, username)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getUserTagWeights = `-- name: GetUserTagWeights :many
+SELECT tag_id, weight FROM users_tags WHERE username = $1
+`
+
+type GetUserTagWeightsRow struct {
+	TagID  int32 `json:"tag_id"`
+	Weight int32 `json:"weight"`
+}
+
+func (q *Queries) GetUserTagWeights(ctx context.Context, username string) ([]GetUserTagWeightsRow, error) {
+	rows, err := q.db.Query(ctx, getUserTagWeights, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserTagWeightsRow
+	for rows.Next() {
+		var i GetUserTagWeightsRow
+		if err := rows.Scan(&i.TagID, &i.Weight); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserTags = `-- name: GetUserTags :many
 SELECT tag_id FROM users_tags WHERE username = $1
 `
@@ -150,9 +441,165 @@ func (q *Queries) GetUserTags(ctx context.Context, username string) ([]int32, er
 	return items, nil
 }
 
+const getUserTimezone = `-- name: GetUserTimezone :one
+SELECT timezone FROM users WHERE username = $1
+`
+
+func (q *Queries) GetUserTimezone(ctx context.Context, username string) (string, error) {
+	row := q.db.QueryRow(ctx, getUserTimezone, username)
+	var timezone string
+	err := row.Scan(&timezone)
+	return timezone, err
+}
+
+const getUsernameByUserID = `-- name: GetUsernameByUserID :one
+SELECT username FROM users WHERE uuid = ($1::text)::uuid AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUsernameByUserID(ctx context.Context, userID string) (string, error) {
+	row := q.db.QueryRow(ctx, getUsernameByUserID, userID)
+	var username string
+	err := row.Scan(&username)
+	return username, err
+}
+
+const getUsers = `-- name: GetUsers :many
+SELECT username, name, surname, created_at FROM users
+WHERE username = ANY($1::text[])
+ORDER BY username
+`
+
+type GetUsersRow struct {
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Surname   string    `json:"surname"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) GetUsers(ctx context.Context, usernames []string) ([]GetUsersRow, error) {
+	rows, err := q.db.Query(ctx, getUsers, usernames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersRow
+	for rows.Next() {
+		var i GetUsersRow
+		if err := rows.Scan(
+			&i.Username,
+			&i.Name,
+			&i.Surname,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersDetailed = `-- name: GetUsersDetailed :many
+SELECT username, name, surname, created_at, email, phone_number, role FROM users
+WHERE username = ANY($1::text[])
+ORDER BY username
+`
+
+type GetUsersDetailedRow struct {
+	Username    string    `json:"username"`
+	Name        string    `json:"name"`
+	Surname     string    `json:"surname"`
+	CreatedAt   time.Time `json:"created_at"`
+	Email       string    `json:"email"`
+	PhoneNumber string    `json:"phone_number"`
+	Role        string    `json:"role"`
+}
+
+func (q *Queries) GetUsersDetailed(ctx context.Context, usernames []string) ([]GetUsersDetailedRow, error) {
+	rows, err := q.db.Query(ctx, getUsersDetailed, usernames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersDetailedRow
+	for rows.Next() {
+		var i GetUsersDetailedRow
+		if err := rows.Scan(
+			&i.Username,
+			&i.Name,
+			&i.Surname,
+			&i.CreatedAt,
+			&i.Email,
+			&i.PhoneNumber,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertPasswordHistory = `-- name: InsertPasswordHistory :exec
+INSERT INTO password_history (username, passwdhash) VALUES ($1::text, $2::text)
+`
+
+type InsertPasswordHistoryParams struct {
+	Username   string `json:"username"`
+	Passwdhash string `json:"passwdhash"`
+}
+
+func (q *Queries) InsertPasswordHistory(ctx context.Context, arg InsertPasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, insertPasswordHistory, arg.Username, arg.Passwdhash)
+	return err
+}
+
+const insertSettingsSnapshot = `-- name: InsertSettingsSnapshot :exec
+-- With only_if_missing set it only records a baseline for users without history.
+INSERT INTO settings_history (username, snapshot)
+SELECT username, jsonb_build_object(
+  'email', email,
+  'name', name,
+  'surname', surname,
+  'phone_number', phone_number,
+  'age', age::text,
+  'sex', sex,
+  'weight', weight::text,
+  'height', height::text,
+  'bmi', bmi::text,
+  'timezone', timezone,
+  'locale', locale,
+  'default_servings', COALESCE(default_servings::text, ''),
+  'equipment', array_to_string(equipment, ',')
+)
+FROM users
+WHERE users.username = $1::text
+  AND NOT ($2::boolean AND EXISTS (
+    SELECT 1 FROM settings_history h WHERE h.username = $1::text
+  ))
+`
+
+type InsertSettingsSnapshotParams struct {
+	Username      string `json:"username"`
+	OnlyIfMissing bool   `json:"only_if_missing"`
+}
+
+func (q *Queries) InsertSettingsSnapshot(ctx context.Context, arg InsertSettingsSnapshotParams) error {
+	_, err := q.db.Exec(ctx, insertSettingsSnapshot, arg.Username, arg.OnlyIfMissing)
+	return err
+}
+
 const insertUserTag = `-- name: InsertUserTag :exec
-INSERT INTO users_tags (username, tag_id)
-SELECT $1::text AS username, t.id AS tag_id FROM tags t
+-- New tags go to the end of the user's ordering.
+INSERT INTO users_tags (username, tag_id, sort_order)
+SELECT $1::text AS username, t.id AS tag_id,
+  (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM users_tags WHERE username = $1::text)
+FROM tags t
 JOIN tags_types tt ON tt.id = t.type_id
 WHERE t.name = $2::text AND tt.name = $3::text
 ON CONFLICT (username, tag_id) DO NOTHING
@@ -169,25 +616,365 @@ func (q *Queries) InsertUserTag(ctx context.Context, arg InsertUserTagParams) er
 	return err
 }
 
+const listExcludedIngredients = `-- name: ListExcludedIngredients :many
+SELECT name FROM users_excluded_ingredients WHERE username = $1 ORDER BY name
+`
+
+func (q *Queries) ListExcludedIngredients(ctx context.Context, username string) ([]string, error) {
+	rows, err := q.db.Query(ctx, listExcludedIngredients, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpiredSettingsHistory = `-- name: ListExpiredSettingsHistory :many
+-- Oldest first, one batch at a time, for the retention job.
+SELECT id, username, snapshot, created_at FROM settings_history
+WHERE created_at < CURRENT_TIMESTAMP(0) - make_interval(secs => $1::int)
+ORDER BY id
+LIMIT $2::int
+`
+
+type ListExpiredSettingsHistoryParams struct {
+	WindowSeconds int32 `json:"window_seconds"`
+	BatchSize     int32 `json:"batch_size"`
+}
+
+func (q *Queries) ListExpiredSettingsHistory(ctx context.Context, arg ListExpiredSettingsHistoryParams) ([]SettingsHistory, error) {
+	rows, err := q.db.Query(ctx, listExpiredSettingsHistory, arg.WindowSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SettingsHistory
+	for rows.Next() {
+		var i SettingsHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Snapshot,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSettingsSnapshots = `-- name: ListSettingsSnapshots :many
+SELECT snapshot, created_at FROM settings_history
+WHERE username = $1
+ORDER BY created_at, id
+`
+
+type ListSettingsSnapshotsRow struct {
+	Snapshot  []byte    `json:"snapshot"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) ListSettingsSnapshots(ctx context.Context, username string) ([]ListSettingsSnapshotsRow, error) {
+	rows, err := q.db.Query(ctx, listSettingsSnapshots, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSettingsSnapshotsRow
+	for rows.Next() {
+		var i ListSettingsSnapshotsRow
+		if err := rows.Scan(&i.Snapshot, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUserTagNames = `-- name: LockUserTagNames :many
+SELECT t.name FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1
+FOR UPDATE OF ut
+`
+
+func (q *Queries) LockUserTagNames(ctx context.Context, username string) ([]string, error) {
+	rows, err := q.db.Query(ctx, lockUserTagNames, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const loginUserWithUsername = `-- name: LoginUserWithUsername :one
-SELECT username, passwdhash FROM users WHERE username = $1
+SELECT username, passwdhash, role, uuid::text AS user_id FROM users WHERE username = $1 AND deleted_at IS NULL
 `
 
 type LoginUserWithUsernameRow struct {
 	Username   string `json:"username"`
 	Passwdhash string `json:"passwdhash"`
+	Role       string `json:"role"`
+	UserID     string `json:"user_id"`
 }
 
 func (q *Queries) LoginUserWithUsername(ctx context.Context, username string) (LoginUserWithUsernameRow, error) {
 	row := q.db.QueryRow(ctx, loginUserWithUsername, username)
 	var i LoginUserWithUsernameRow
-	err := row.Scan(&i.Username, &i.Passwdhash)
+	err := row.Scan(
+		&i.Username,
+		&i.Passwdhash,
+		&i.Role,
+		&i.UserID,
+	)
 	return i, err
 }
 
+const prunePasswordHistory = `-- name: PrunePasswordHistory :exec
+DELETE FROM password_history
+WHERE username = $1::text AND id NOT IN (
+  SELECT id FROM password_history
+  WHERE username = $1::text
+  ORDER BY created_at DESC, id DESC
+  LIMIT $2::int
+)
+`
+
+type PrunePasswordHistoryParams struct {
+	Username     string `json:"username"`
+	HistoryLimit int32  `json:"history_limit"`
+}
+
+func (q *Queries) PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, prunePasswordHistory, arg.Username, arg.HistoryLimit)
+	return err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :many
+-- users_tags and reviews have no foreign key to users, so they're cleared here;
+-- everything else goes with ON DELETE CASCADE.
+WITH purged AS (
+  SELECT username FROM users
+  WHERE deleted_at IS NOT NULL
+    AND deleted_at < CURRENT_TIMESTAMP(0) - make_interval(secs => $1::int)
+  ORDER BY deleted_at
+  LIMIT $2::int
+  FOR UPDATE SKIP LOCKED
+), purged_tags AS (
+  DELETE FROM users_tags WHERE username IN (SELECT username FROM purged)
+), purged_reviews AS (
+  DELETE FROM reviews WHERE username IN (SELECT username FROM purged)
+)
+DELETE FROM users WHERE username IN (SELECT username FROM purged)
+RETURNING username
+`
+
+type PurgeDeletedUsersParams struct {
+	RetentionSeconds int32 `json:"retention_seconds"`
+	BatchSize        int32 `json:"batch_size"`
+}
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, arg PurgeDeletedUsersParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, purgeDeletedUsers, arg.RetentionSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		items = append(items, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordTermsConsent = `-- name: RecordTermsConsent :execrows
+UPDATE users SET terms_version = $1::text, terms_accepted_at = CURRENT_TIMESTAMP(0)
+WHERE username = $2::text AND deleted_at IS NULL
+`
+
+type RecordTermsConsentParams struct {
+	TermsVersion string `json:"terms_version"`
+	Username     string `json:"username"`
+}
+
+func (q *Queries) RecordTermsConsent(ctx context.Context, arg RecordTermsConsentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, recordTermsConsent, arg.TermsVersion, arg.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreUser = `-- name: RestoreUser :execrows
+UPDATE users SET deleted_at = NULL WHERE username = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, username string) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreUser, username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setUserTagOrder = `-- name: SetUserTagOrder :exec
+UPDATE users_tags ut SET sort_order = o.position
+FROM unnest($1::text[]) WITH ORDINALITY AS o(name, position)
+JOIN tags t ON t.name = o.name
+WHERE ut.tag_id = t.id AND ut.username = $2::text
+`
+
+type SetUserTagOrderParams struct {
+	TagNames []string `json:"tag_names"`
+	Username string   `json:"username"`
+}
+
+func (q *Queries) SetUserTagOrder(ctx context.Context, arg SetUserTagOrderParams) error {
+	_, err := q.db.Exec(ctx, setUserTagOrder, arg.TagNames, arg.Username)
+	return err
+}
+
+const setUserTagStrictness = `-- name: SetUserTagStrictness :execrows
+-- Only diet tags have a strictness; other tags aren't matched.
+UPDATE users_tags SET strictness = $1::text
+FROM tags
+WHERE users_tags.tag_id = tags.id AND users_tags.username = $2::text AND tags.name = $3::text AND tags.type_id = 1
+`
+
+type SetUserTagStrictnessParams struct {
+	Strictness string `json:"strictness"`
+	Username   string `json:"username"`
+	TagName    string `json:"tag_name"`
+}
+
+func (q *Queries) SetUserTagStrictness(ctx context.Context, arg SetUserTagStrictnessParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserTagStrictness, arg.Strictness, arg.Username, arg.TagName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setUserTagWeight = `-- name: SetUserTagWeight :execrows
+UPDATE users_tags SET weight = $1::int
+FROM tags
+WHERE users_tags.tag_id = tags.id AND users_tags.username = $2::text AND tags.name = $3::text
+`
+
+type SetUserTagWeightParams struct {
+	Weight   int32  `json:"weight"`
+	Username string `json:"username"`
+	TagName  string `json:"tag_name"`
+}
+
+func (q *Queries) SetUserTagWeight(ctx context.Context, arg SetUserTagWeightParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserTagWeight, arg.Weight, arg.Username, arg.TagName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :execrows
+UPDATE users SET deleted_at = CURRENT_TIMESTAMP(0) WHERE username = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, username string) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteUser, username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :execrows
+UPDATE users SET email = $1::text WHERE username = $2::text
+`
+
+type UpdateUserEmailParams struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserEmail, arg.Email, arg.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET passwdhash = $1::text WHERE username = $2::text
+`
+
+type UpdateUserPasswordParams struct {
+	Passwdhash string `json:"passwdhash"`
+	Username   string `json:"username"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.Passwdhash, arg.Username)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :execrows
+UPDATE users SET role = $1::text WHERE username = $2::text
+`
+
+type UpdateUserRoleParams struct {
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserRole, arg.Role, arg.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateUserSettings = `-- name: UpdateUserSettings :exec
 UPDATE users
 SET
+email_changed_at = CASE WHEN $1::text IN ('', email) THEN email_changed_at ELSE CURRENT_TIMESTAMP(0) END,
 email = CASE WHEN $1::text = ''  THEN email        ELSE $1::text        END,
 name = CASE WHEN $2::text = ''  THEN name         ELSE $2::text         END,
 surname = CASE WHEN $3::text = ''  THEN surname      ELSE $3::text      END,
@@ -196,21 +983,30 @@ age = CASE WHEN $5::int = -1  THEN age          ELSE $5::int          END,
 sex = CASE WHEN $6::text = ''  THEN sex          ELSE $6::text          END,
 weight = CASE WHEN $7::int = -1  THEN weight       ELSE $7::int       END,
 height = CASE WHEN $8::int = -1  THEN height       ELSE $8::int       END,
-bmi = CASE WHEN $9::int = -1  THEN bmi          ELSE $9::int          END
-WHERE username = $10::text
+bmi = CASE WHEN $9::int = -1  THEN bmi          ELSE $9::int          END,
+timezone = CASE WHEN $10::text = ''  THEN timezone     ELSE $10::text     END,
+locale = CASE WHEN $11::text = ''  THEN locale       ELSE $11::text       END,
+default_servings = CASE $12::int WHEN -1 THEN default_servings WHEN 0 THEN NULL ELSE $12::int END,
+equipment = CASE WHEN $13::bool THEN $14::text[] ELSE equipment END
+WHERE username = $15::text
 `
 
 type UpdateUserSettingsParams struct {
-	Email       string `json:"email"`
-	Name        string `json:"name"`
-	Surname     string `json:"surname"`
-	PhoneNumber string `json:"phone_number"`
-	Age         int32  `json:"age"`
-	Sex         string `json:"sex"`
-	Weight      int32  `json:"weight"`
-	Height      int32  `json:"height"`
-	Bmi         int32  `json:"bmi"`
-	Username    string `json:"username"`
+	Email           string   `json:"email"`
+	Name            string   `json:"name"`
+	Surname         string   `json:"surname"`
+	PhoneNumber     string   `json:"phone_number"`
+	Age             int32    `json:"age"`
+	Sex             string   `json:"sex"`
+	Weight          int32    `json:"weight"`
+	Height          int32    `json:"height"`
+	Bmi             int32    `json:"bmi"`
+	Timezone        string   `json:"timezone"`
+	Locale          string   `json:"locale"`
+	DefaultServings int32    `json:"default_servings"`
+	EquipmentSet    bool     `json:"equipment_set"`
+	Equipment       []string `json:"equipment"`
+	Username        string   `json:"username"`
 }
 
 func (q *Queries) UpdateUserSettings(ctx context.Context, arg UpdateUserSettingsParams) error {
@@ -224,6 +1020,11 @@ func (q *Queries) UpdateUserSettings(ctx context.Context, arg UpdateUserSettings
 		arg.Weight,
 		arg.Height,
 		arg.Bmi,
+		arg.Timezone,
+		arg.Locale,
+		arg.DefaultServings,
+		arg.EquipmentSet,
+		arg.Equipment,
 		arg.Username,
 	)
 	return err
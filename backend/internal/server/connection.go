@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 
 	"github.com/jackc/pgx/v5"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/miloszbo/meals-finder/internal/config"
 )
 
 var dbConnInstance *pgx.Conn
@@ -16,6 +18,34 @@ func NewConnection() *pgx.Conn {
 	if dbConnInstance != nil {
 		return dbConnInstance
 	}
+	dbConnInstance = NewJobConnection()
+
+	return dbConnInstance
+}
+
+// NewJobConnection opens a separate connection for background jobs, which
+// can't share the request connection.
+func NewJobConnection() *pgx.Conn {
+	conn, err := ConnectJob(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return conn
+}
+
+// ConnectJob is NewJobConnection returning the error, for replacing a
+// connection that was lost without stopping the app.
+func ConnectJob(ctx context.Context) (*pgx.Conn, error) {
+	return connect(ctx, DatabaseURL())
+}
+
+// Postgres sslmode of the app's connections; empty leaves pgx's default
+// (prefer).
+var DatabaseSSLMode = config.String("DB_SSLMODE", "")
+
+// DatabaseURL is the DSN the app connects with, built from the DB_ variables.
+func DatabaseURL() string {
 	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
 		os.Getenv("DB_USERNAME"),
 		os.Getenv("DB_PASSWORD"),
@@ -23,31 +53,32 @@ func NewConnection() *pgx.Conn {
 		os.Getenv("DB_PORT"),
 		os.Getenv("DB_DATABASE"),
 	)
-	conn, err := pgx.Connect(context.Background(), connString)
-	if err != nil {
-		log.Fatal(err)
+	if DatabaseSSLMode != "" {
+		connString += "?sslmode=" + url.QueryEscape(DatabaseSSLMode)
 	}
-	dbConnInstance = conn
-
-	return dbConnInstance
+	return connString
 }
 
 var dbConnInstanceTest *pgx.Conn
 
-func NewConnectionTest() *pgx.Conn {
-	if dbConnInstance != nil {
-		return dbConnInstance
-	}
-
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
+// TestDatabaseURL is the DSN of the test database, from the TEST_DB_
+// variables.
+func TestDatabaseURL() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
 		os.Getenv("TEST_DB_USERNAME"),
 		os.Getenv("TEST_DB_PASSWORD"),
 		os.Getenv("TEST_DB_HOST"),
 		os.Getenv("TEST_DB_PORT"),
 		os.Getenv("TEST_DB_DATABASE"),
 	)
+}
 
-	conn, err := pgx.Connect(context.Background(), connString)
+func NewConnectionTest() *pgx.Conn {
+	if dbConnInstance != nil {
+		return dbConnInstance
+	}
+
+	conn, err := connect(context.Background(), TestDatabaseURL())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -55,3 +86,13 @@ func NewConnectionTest() *pgx.Conn {
 
 	return dbConnInstance
 }
+
+// connect opens a connection that logs slow queries.
+func connect(ctx context.Context, connString string) (*pgx.Conn, error) {
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	config.Tracer = NewSlowQueryTracer()
+	return pgx.ConnectConfig(ctx, config)
+}
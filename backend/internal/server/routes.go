@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/miloszbo/meals-finder/internal/handlers"
 	"github.com/miloszbo/meals-finder/internal/middlewares"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
@@ -12,25 +15,123 @@ func SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	conn := NewConnection()
+	// Shared by every feature, each in its own named store.
+	cache := services.NewCache()
+
+	tokenService := services.NewBaseTokenService(conn)
+	tokenHandler := handlers.TokenHandler{
+		TokenService: &tokenService,
+		ClientID:     services.IntrospectionClientID,
+		ClientSecret: services.IntrospectionClientSecret,
+	}
 
 	userService := services.NewBaseUserService(conn)
 	userHandler := handlers.UserHandler{
-		UserService: &userService,
+		UserService:  &userService,
+		TokenService: &tokenService,
 	}
 
 	finderService := services.NewBaseFinderService(conn)
+	finderService.Cache = services.NewRecipeCache(services.RecipeCacheTTL)
+	finderService.Cache.Store = cache.Store("recipes")
+	finderService.Invalidator = &services.LocalInvalidator{Cache: finderService.Cache}
+	if services.RecipeCacheBroadcast {
+		finderService.Invalidator = &services.NotifyInvalidator{Repo: finderService.Repo}
+		go services.ListenRecipeInvalidations(context.Background(), ConnectJob, finderService.Cache)
+	}
+	finderService.Trending = services.NewTrendingCache(services.TrendingRefreshInterval)
+	finderService.Trending.Store = cache.Store("trending")
+	if services.SearchStreamConns > 0 {
+		streamConns := make([]*pgx.Conn, services.SearchStreamConns)
+		for i := range streamConns {
+			streamConns[i] = NewJobConnection()
+		}
+		finderService.StreamPool = services.NewQueriesPool(streamConns)
+		finderService.StreamPool.Connect = ConnectJob
+	}
+	if services.RecommendationFetchConns > 0 {
+		fetchConns := make([]*pgx.Conn, services.RecommendationFetchConns)
+		for i := range fetchConns {
+			fetchConns[i] = NewJobConnection()
+		}
+		finderService.FetchPool = services.NewQueriesPool(fetchConns)
+		finderService.FetchPool.Connect = ConnectJob
+	}
 	finderHandler := handlers.FinderHandler{
 		FinderService: &finderService,
 	}
 
+	collectionService := services.NewBaseCollectionService(conn)
+	collectionHandler := handlers.CollectionHandler{
+		CollectionService: &collectionService,
+	}
+
+	favoriteService := services.NewBaseFavoriteService(conn)
+	favoriteHandler := handlers.FavoriteHandler{
+		FavoriteService: &favoriteService,
+	}
+
+	roleRepo := repository.New(conn)
+	roleCache := services.NewRoleCache(roleRepo.GetUserRole, services.RoleCacheTTL)
+	roleCache.Store = cache.Store("roles")
+
+	adminService := services.NewBaseAdminService(conn)
+	adminService.Roles = roleCache
+	adminHandler := handlers.AdminHandler{
+		AdminService: &adminService,
+	}
+
+	importService := services.NewBaseImportService(conn)
+	importHandler := handlers.ImportHandler{
+		ImportService: &importService,
+	}
+
+	mealPlanService := services.NewBaseMealPlanService(conn)
+	mealPlanHandler := handlers.MealPlanHandler{
+		MealPlanService: &mealPlanService,
+	}
+
+	reviewService := services.NewBaseReviewService(conn)
+	reviewHandler := handlers.ReviewHandler{
+		ReviewService: &reviewService,
+	}
+
+	pantryService := services.NewBasePantryService(conn)
+	pantryHandler := handlers.PantryHandler{
+		PantryService: &pantryService,
+	}
+
+	shoppingListService := services.NewBaseShoppingListService(conn)
+	shoppingListHandler := handlers.ShoppingListHandler{
+		ShoppingListService: &shoppingListService,
+	}
+
+	apiKeyService := services.NewBaseAPIKeyService(conn)
+	apiKeyHandler := handlers.APIKeyHandler{
+		APIKeyService: &apiKeyService,
+	}
+
+	savedSearchService := services.NewBaseSavedSearchService(conn)
+	savedSearchHandler := handlers.SavedSearchHandler{
+		SavedSearchService: &savedSearchService,
+	}
+
+	mux.HandleFunc("GET /health", handlers.Health)
 	mux.HandleFunc("POST /user/login", userHandler.LoginUser)
 	mux.HandleFunc("POST /user/register", userHandler.CreateUser)
+	mux.HandleFunc("POST /user/register/validate", userHandler.ValidateSignup)
 	mux.HandleFunc("GET /logout", userHandler.Logout)
+	mux.HandleFunc("POST /introspect", tokenHandler.Introspect)
 	mux.HandleFunc("GET /tags", finderHandler.GetTags)
-	mux.HandleFunc("POST /recipe", finderHandler.CreateRecipe)
+	mux.HandleFunc("GET /shared/collections/{token}", collectionHandler.GetSharedCollection)
 
+	limiter := middlewares.NewConcurrencyLimiter(middlewares.MaxInflightRequests, middlewares.ShedRetryAfter, "/health")
 	stack := middlewares.CreateStack(
+		middlewares.CorrelationID,
 		middlewares.Logging,
+		middlewares.Recover,
+		limiter.Middleware,
+		middlewares.NewSecurityHeaders().Middleware,
 		middlewares.CorsMiddleware,
 	)
 
@@ -38,13 +139,98 @@ func SetupRoutes() http.Handler {
 	authMux.HandleFunc("GET /profile", userHandler.GetProfile)
 	authMux.HandleFunc("GET /verify", userHandler.IsLogged)
 	authMux.HandleFunc("GET /browser", finderHandler.FindRecipes)
+	authMux.HandleFunc("GET /recipes", finderHandler.ListRecipes)
 	authMux.HandleFunc("GET /re/{id}", finderHandler.GetRecipe)
+	authMux.HandleFunc("GET /re/{id}/transform", finderHandler.TransformMealForDiet)
+	authMux.HandleFunc("GET /re/{id}/batch", finderHandler.BatchCook)
+	authMux.HandleFunc("POST /re/{id}/image", finderHandler.SetRecipeImage)
+	authMux.HandleFunc("POST /recipe", finderHandler.CreateRecipe)
+	authMux.HandleFunc("GET /recipe/today", finderHandler.RecipeOfTheDay)
+	authMux.HandleFunc("GET /recipe/surprise", finderHandler.SurpriseRecipe)
+	authMux.HandleFunc("GET /recommendations", finderHandler.RecommendRecipes)
+	authMux.HandleFunc("GET /recipes/trending", finderHandler.TrendingMeals)
+	authMux.HandleFunc("GET /recipes/compare", finderHandler.CompareMeals)
 	authMux.HandleFunc("PATCH /user/settings", userHandler.UpdateUserSettings)
+	authMux.HandleFunc("PATCH /user/password", userHandler.ChangePassword)
+	authMux.HandleFunc("POST /user/merge", userHandler.MergeAccount)
+	authMux.HandleFunc("DELETE /user", userHandler.DeleteAccount)
+	authMux.HandleFunc("GET /user/terms", userHandler.GetTermsStatus)
+	authMux.HandleFunc("POST /user/terms", userHandler.AcceptTerms)
+	authMux.HandleFunc("GET /export/me", userHandler.ExportArchive)
+	authMux.HandleFunc("POST /user/sessions/revoke", userHandler.RevokeSessions)
+	authMux.HandleFunc("GET /user/sessions", userHandler.ListSessions)
+	authMux.HandleFunc("DELETE /user/sessions/{id}", userHandler.RevokeSession)
+	authMux.HandleFunc("GET /user/api-keys", apiKeyHandler.ListAPIKeys)
+	authMux.HandleFunc("POST /user/api-keys", apiKeyHandler.CreateAPIKey)
+	authMux.HandleFunc("DELETE /user/api-keys/{id}", apiKeyHandler.RevokeAPIKey)
 	authMux.HandleFunc("POST /user/tags", userHandler.AddUserTag)
 	authMux.HandleFunc("DELETE /user/tags/{tagName}", userHandler.DeleteUserTag)
 	authMux.HandleFunc("GET /user/tags", userHandler.DisplayUserTags)
+	authMux.HandleFunc("PATCH /user/tags/{tagName}/weight", userHandler.SetUserTagWeight)
+	authMux.HandleFunc("PATCH /user/tags/{tagName}/strictness", userHandler.SetUserTagStrictness)
+	authMux.HandleFunc("PATCH /user/tags/order", userHandler.ReorderUserTags)
+	authMux.HandleFunc("GET /user/tags/conflicts", userHandler.DetectTagConflicts)
+	authMux.HandleFunc("GET /user/exclusions", userHandler.ListExcludedIngredients)
+	authMux.HandleFunc("POST /user/exclusions", userHandler.AddExcludedIngredient)
+	authMux.HandleFunc("DELETE /user/exclusions/{name}", userHandler.DeleteExcludedIngredient)
+	authMux.HandleFunc("GET /users", userHandler.GetUsers)
+	authMux.HandleFunc("GET /user/favorites", favoriteHandler.ListFavorites)
+	authMux.HandleFunc("POST /user/favorites", favoriteHandler.AddFavorite)
+	authMux.HandleFunc("DELETE /user/favorites/{id}", favoriteHandler.DeleteFavorite)
+	authMux.HandleFunc("GET /user/favorites/archive", favoriteHandler.ListArchivedFavorites)
+	authMux.HandleFunc("POST /user/favorites/{id}/archive", favoriteHandler.ArchiveFavorite)
+	authMux.HandleFunc("POST /re/{id}/made", favoriteHandler.MarkRecipeMade)
+	authMux.HandleFunc("GET /re/{id}/gap", pantryHandler.GapToCookable)
+	authMux.HandleFunc("GET /re/{id}/reviews", reviewHandler.ListMealReviews)
+	authMux.HandleFunc("POST /re/{id}/reviews", reviewHandler.AddReview)
+	authMux.HandleFunc("PUT /reviews/{id}/vote", reviewHandler.VoteReview)
+	authMux.HandleFunc("PATCH /reviews/{id}", reviewHandler.EditMealReview)
+	authMux.HandleFunc("GET /user/pantry", pantryHandler.ListPantry)
+	authMux.HandleFunc("PUT /user/pantry", pantryHandler.SetPantryItem)
+	authMux.HandleFunc("DELETE /user/pantry/{name}", pantryHandler.DeletePantryItem)
+	authMux.HandleFunc("GET /shopping-list", shoppingListHandler.ShoppingList)
+	authMux.HandleFunc("POST /shopping-list/weekly", shoppingListHandler.WeeklyShoppingList)
+	authMux.HandleFunc("GET /user/searches", savedSearchHandler.ListSavedSearches)
+	authMux.HandleFunc("POST /user/searches", savedSearchHandler.SaveSearch)
+	authMux.HandleFunc("POST /plan/generate", mealPlanHandler.GenerateMealPlan)
+	authMux.HandleFunc("POST /plan/weekly", mealPlanHandler.GenerateWeeklyPlan)
+	authMux.HandleFunc("GET /plan/calorie-target", mealPlanHandler.RecommendCalorieTarget)
+	authMux.HandleFunc("POST /recipes/import", importHandler.ImportRecipes)
+	authMux.HandleFunc("GET /recipes/import/{id}", importHandler.GetImportProgress)
+	authMux.HandleFunc("POST /collections", collectionHandler.CreateCollection)
+	authMux.HandleFunc("POST /collections/{id}/recipes", collectionHandler.AddRecipeToCollection)
+	authMux.HandleFunc("POST /collections/{id}/share", collectionHandler.GenerateShareLink)
+	authMux.HandleFunc("DELETE /collections/share/{token}", collectionHandler.RevokeShareLink)
 
-	mux.Handle("/", middlewares.Authentication(authMux))
+	requireAdmin := middlewares.RequireRole("admin")
+	authMux.Handle("GET /admin/users", requireAdmin(http.HandlerFunc(userHandler.GetUsersDetailed)))
+	authMux.Handle("PATCH /admin/users/{username}/role", requireAdmin(http.HandlerFunc(adminHandler.SetUserRole)))
+	authMux.Handle("PATCH /admin/users/{username}/email", requireAdmin(http.HandlerFunc(adminHandler.SetUserEmail)))
+	authMux.Handle("GET /admin/users/{username}/settings-log", requireAdmin(http.HandlerFunc(userHandler.GetSettingsChangeLog)))
+	authMux.Handle("GET /admin/users/search", requireAdmin(http.HandlerFunc(adminHandler.ListUsers)))
+	authMux.Handle("POST /admin/users/{username}/restore", requireAdmin(http.HandlerFunc(adminHandler.RestoreUser)))
+	authMux.Handle("POST /admin/users/{username}/merge", requireAdmin(http.HandlerFunc(adminHandler.MergeAccounts)))
+	authMux.Handle("GET /admin/reviews/{id}/edits", requireAdmin(http.HandlerFunc(reviewHandler.ListReviewEdits)))
+	authMux.Handle("GET /admin/audit", requireAdmin(http.HandlerFunc(adminHandler.ListAudit)))
+	authMux.Handle("GET /admin/metrics", requireAdmin(limiter.MetricsHandler()))
+	authMux.Handle("GET /admin/recipes/export", requireAdmin(http.HandlerFunc(adminHandler.ExportMealsCSV)))
+	authMux.Handle("GET /admin/search/plan", requireAdmin(http.HandlerFunc(finderHandler.ExplainSearch)))
+	authMux.Handle("POST /admin/allergens/import", requireAdmin(http.HandlerFunc(importHandler.ImportAllergenMap)))
+
+	var authHandler http.Handler = authMux
+	if services.TermsRequireReconsent {
+		// Users can still read and accept the terms, or leave.
+		authHandler = middlewares.RequireCurrentTerms(userService.HasAcceptedCurrentTerms, "/user/terms", "/user")(authHandler)
+	}
+	if services.MinimalClaims {
+		authHandler = middlewares.ResolveRole(roleCache.Role)(authHandler)
+	}
+	authHandler = middlewares.TrackSession(tokenService.TouchSession)(authHandler)
+	// Runs after ResolveSubject, so revocations are looked up by username.
+	authHandler = middlewares.RejectRevoked(tokenService.IsRevoked)(authHandler)
+	// Runs before ResolveRole, which looks the role up by username.
+	authHandler = middlewares.ResolveSubject(roleRepo.GetUsernameByUserID, services.AcceptUsernameSubject)(authHandler)
+	mux.Handle("/", middlewares.APIKeyAuthentication(apiKeyService.ResolveAPIKey)(authHandler))
 
 	return stack(mux)
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// AppEnv is where the app runs. In "production" an insecure setup stops it
+// from starting; anywhere else it's only warned about.
+var AppEnv = config.String("APP_ENV", "local")
+
+// Weakest JWT key, in bytes, and bcrypt cost the security check accepts.
+var (
+	MinJWTKeyLength = config.Int("SECURITY_MIN_JWT_KEY_LENGTH", 32)
+	MinBcryptCost   = config.Int("SECURITY_MIN_BCRYPT_COST", 10)
+)
+
+// SecuritySettings are the parts of the configuration CheckSecurity looks at.
+type SecuritySettings struct {
+	Production      bool
+	JWTKeys         auth.KeySet
+	MinJWTKeyLength int
+	BcryptCost      int
+	MinBcryptCost   int
+	DatabaseURL     string
+	CORSOrigin      string
+	CORSCredentials bool
+	CaptchaEnabled  bool
+	CaptchaProvider string
+	CaptchaSecret   string
+}
+
+// CurrentSecuritySettings reads the settings the app starts with.
+func CurrentSecuritySettings() SecuritySettings {
+	return SecuritySettings{
+		Production:      AppEnv == "production",
+		JWTKeys:         auth.Keys().Current(),
+		MinJWTKeyLength: MinJWTKeyLength,
+		BcryptCost:      services.BcryptCost,
+		MinBcryptCost:   MinBcryptCost,
+		DatabaseURL:     DatabaseURL(),
+		CORSOrigin:      middlewares.CorsAllowedOrigin,
+		CORSCredentials: middlewares.CorsAllowCredentials,
+		CaptchaEnabled:  services.CaptchaEnabled,
+		CaptchaProvider: services.CaptchaProvider,
+		CaptchaSecret:   services.CaptchaSecret,
+	}
+}
+
+// SecurityProblems lists what's insecure about s: JWT keys shorter than the
+// minimum, a bcrypt cost below it, a database connection without TLS,
+// credentialed CORS for any origin and CAPTCHA enabled without a provider it
+// can verify with.
+func SecurityProblems(s SecuritySettings) []string {
+	var problems []string
+
+	keys := append([]auth.Key{s.JWTKeys.Signing}, s.JWTKeys.Verifying...)
+	for _, key := range keys {
+		if len(key.Secret) < s.MinJWTKeyLength {
+			name := "APP_JWT_KEY"
+			if key.ID != "" {
+				name = fmt.Sprintf("JWT key %q", key.ID)
+			}
+			problems = append(problems, fmt.Sprintf("%s is %d bytes, under %d", name, len(key.Secret), s.MinJWTKeyLength))
+		}
+	}
+
+	if s.BcryptCost < s.MinBcryptCost {
+		problems = append(problems, fmt.Sprintf("BCRYPT_COST is %d, under %d", s.BcryptCost, s.MinBcryptCost))
+	}
+
+	if u, err := url.Parse(s.DatabaseURL); err != nil {
+		problems = append(problems, "database URL can't be parsed")
+	} else if strings.EqualFold(u.Query().Get("sslmode"), "disable") {
+		problems = append(problems, "database connection has sslmode=disable")
+	}
+
+	if strings.TrimSpace(s.CORSOrigin) == "*" && s.CORSCredentials {
+		problems = append(problems, "CORS allows credentials from any origin")
+	}
+
+	if s.CaptchaEnabled {
+		if !services.CaptchaProviderKnown(s.CaptchaProvider) {
+			problems = append(problems, fmt.Sprintf("CAPTCHA_PROVIDER %q is unknown, CAPTCHA isn't checked", s.CaptchaProvider))
+		}
+		if s.CaptchaSecret == "" {
+			problems = append(problems, "CAPTCHA_SECRET is empty, CAPTCHA isn't checked")
+		}
+	}
+
+	return problems
+}
+
+// CheckSecurity refuses s in production when it has any SecurityProblems.
+// Elsewhere they're logged as warnings and nil is returned.
+func CheckSecurity(s SecuritySettings) error {
+	problems := SecurityProblems(s)
+	if len(problems) == 0 {
+		return nil
+	}
+	if s.Production {
+		return errors.New("insecure configuration: " + strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Println("security warning:", problem)
+	}
+	return nil
+}
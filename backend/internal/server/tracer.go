@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
+)
+
+// Queries taking longer are logged as slow; 0 turns it off.
+var SlowQueryThreshold = config.Duration("SLOW_QUERY_THRESHOLD", 200*time.Millisecond)
+
+// queryName finds the sqlc query name in the comment generated SQL starts with.
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	name string
+	at   time.Time
+}
+
+// SlowQueryTracer logs queries over Threshold with their sqlc name, duration
+// and request id. The SQL and its arguments are never logged, as they can
+// hold personal data.
+type SlowQueryTracer struct {
+	Threshold time.Duration
+	Logger    *log.Logger
+	// Now is the clock queries are timed with.
+	Now func() time.Time
+}
+
+func NewSlowQueryTracer() *SlowQueryTracer {
+	return &SlowQueryTracer{
+		Threshold: SlowQueryThreshold,
+		Logger:    log.Default(),
+		Now:       time.Now,
+	}
+}
+
+func (t *SlowQueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.Threshold <= 0 {
+		return ctx
+	}
+	name := "unnamed"
+	if match := queryName.FindStringSubmatch(data.SQL); match != nil {
+		name = match[1]
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{name: name, at: t.Now()})
+}
+
+func (t *SlowQueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	took := t.Now().Sub(start.at)
+	if took <= t.Threshold {
+		return
+	}
+
+	requestID := middlewares.RequestIDFrom(ctx)
+	if requestID == "" {
+		requestID = "-"
+	}
+	t.Logger.Printf("WARN slow query %s took %s (request %s)", start.name, took, requestID)
+}
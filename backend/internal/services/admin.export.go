@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Recipes fetched and written per round trip of the CSV export.
+const exportPageSize = 500
+
+var mealsCSVHeader = []string{
+	"id", "name", "author", "time", "difficulty", "servings",
+	"calories", "protein", "carbs", "fat", "tags",
+}
+
+// MealPageFetcher returns up to one page of recipes with ids above afterID,
+// in id order. An empty page ends the export.
+type MealPageFetcher func(ctx context.Context, afterID int32) ([]repository.ExportRecipesPageRow, error)
+
+// ExportMealsCSV writes every recipe matching filter to w as CSV, one page at
+// a time, so memory use doesn't grow with the catalog.
+func (a *BaseAdminService) ExportMealsCSV(ctx context.Context, w io.Writer, filter models.MealFilter) error {
+	return StreamMealsCSV(ctx, w, func(ctx context.Context, afterID int32) ([]repository.ExportRecipesPageRow, error) {
+		return a.Repo.ExportRecipesPage(ctx, repository.ExportRecipesPageParams{
+			AfterID:  afterID,
+			Author:   filter.Author,
+			Tag:      filter.Tag,
+			PageSize: exportPageSize,
+		})
+	})
+}
+
+// StreamMealsCSV writes the header and then each page as soon as it's
+// fetched, flushing after every page.
+func StreamMealsCSV(ctx context.Context, w io.Writer, fetch MealPageFetcher) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(mealsCSVHeader); err != nil {
+		return err
+	}
+
+	var afterID int32
+	for {
+		page, err := fetch(ctx, afterID)
+		if err != nil {
+			log.Println("export recipes page failed:", err)
+			return ErrInternalFailure
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, row := range page {
+			if err := out.Write(mealCSVRecord(row)); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+		afterID = page[len(page)-1].ID
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func mealCSVRecord(row repository.ExportRecipesPageRow) []string {
+	return []string{
+		strconv.Itoa(int(row.ID)),
+		csvText(row.Name),
+		csvText(row.Username),
+		strconv.Itoa(int(row.Time)),
+		strconv.Itoa(int(row.Difficulty)),
+		strconv.Itoa(int(row.Servings)),
+		optionalInt(row.Calories),
+		optionalInt(row.Protein),
+		optionalInt(row.Carbs),
+		optionalInt(row.Fat),
+		csvText(row.Tags),
+	}
+}
+
+// csvText keeps a spreadsheet from running user text as a formula: a value
+// starting with =, +, -, @, a tab or a carriage return gets a ' in front.
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// optionalInt leaves missing nutrition values empty rather than writing 0.
+func optionalInt(v *int32) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*v))
+}
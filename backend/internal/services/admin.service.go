@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Audited admin actions.
+const (
+	AuditActionSetRole  = "set_role"
+	AuditActionSetEmail = "set_email"
+	AuditActionRestore  = "restore_user"
+	AuditActionMerge    = "merge_accounts"
+)
+
+type AdminService interface {
+	SetUserRole(ctx context.Context, actor string, username string, req *models.SetRoleRequest) error
+	SetUserEmail(ctx context.Context, actor string, username string, req *models.SetEmailRequest) error
+	RestoreUser(ctx context.Context, actor string, username string) error
+	MergeAccounts(ctx context.Context, actor string, username string, req *models.MergeIntoRequest) error
+	ListAudit(ctx context.Context, filter models.AuditFilter) ([]repository.AdminAudit, error)
+	ListUsers(ctx context.Context, query models.ListQuery) ([]repository.ListUsersRow, error)
+	ExportMealsCSV(ctx context.Context, w io.Writer, filter models.MealFilter) error
+}
+
+type BaseAdminService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+	// Roles, when set, is invalidated on role changes so they apply immediately.
+	Roles *RoleCache
+}
+
+func NewBaseAdminService(conn *pgx.Conn) BaseAdminService {
+	return BaseAdminService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+func (a *BaseAdminService) SetUserRole(ctx context.Context, actor string, username string, req *models.SetRoleRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	tx, err := a.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	before, err := qtx.GetUserRole(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if _, err := qtx.UpdateUserRole(ctx, repository.UpdateUserRoleParams{
+		Role:     req.Role,
+		Username: username,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := recordAudit(ctx, qtx, repository.InsertAdminAuditParams{
+		Actor:       actor,
+		Action:      AuditActionSetRole,
+		Target:      username,
+		BeforeValue: before,
+		AfterValue:  req.Role,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	if a.Roles != nil {
+		a.Roles.Invalidate(username)
+	}
+
+	return nil
+}
+
+// SetUserEmail changes a user's email on their behalf. Unlike the user's own
+// settings change it isn't subject to the email change cooldown.
+func (a *BaseAdminService) SetUserEmail(ctx context.Context, actor string, username string, req *models.SetEmailRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	tx, err := a.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	before, err := qtx.GetUserEmailChange(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if _, err := qtx.UpdateUserEmail(ctx, repository.UpdateUserEmailParams{
+		Email:    req.Email,
+		Username: username,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := recordAudit(ctx, qtx, repository.InsertAdminAuditParams{
+		Actor:       actor,
+		Action:      AuditActionSetEmail,
+		Target:      username,
+		BeforeValue: before.Email,
+		AfterValue:  req.Email,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+// RestoreUser undoes a soft delete. Users already purged can't be restored.
+func (a *BaseAdminService) RestoreUser(ctx context.Context, actor string, username string) error {
+	tx, err := a.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	affected, err := qtx.RestoreUser(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := recordAudit(ctx, qtx, repository.InsertAdminAuditParams{
+		Actor:       actor,
+		Action:      AuditActionRestore,
+		Target:      username,
+		BeforeValue: "deleted",
+		AfterValue:  "active",
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+// MergeAccounts merges username into req.Into, as the user's own merge does,
+// and audits it in the same transaction.
+func (a *BaseAdminService) MergeAccounts(ctx context.Context, actor string, username string, req *models.MergeIntoRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+	if err := validateMerge(username, req.Into); err != nil {
+		return err
+	}
+
+	tx, err := a.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	if err := mergeAccounts(ctx, qtx, username, req.Into, int64(favoritesLimit)); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, qtx, repository.InsertAdminAuditParams{
+		Actor:       actor,
+		Action:      AuditActionMerge,
+		Target:      username,
+		BeforeValue: "active",
+		AfterValue:  "merged into " + req.Into,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+// ListUsers lists active users by the filters of UserListSpec.
+func (a *BaseAdminService) ListUsers(ctx context.Context, query models.ListQuery) ([]repository.ListUsersRow, error) {
+	users, err := a.Repo.ListUsers(ctx, query)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	return users, nil
+}
+
+func (a *BaseAdminService) ListAudit(ctx context.Context, filter models.AuditFilter) ([]repository.AdminAudit, error) {
+	entries, err := a.Repo.ListAdminAudit(ctx, repository.ListAdminAuditParams{
+		Actor:       filter.Actor,
+		Action:      filter.Action,
+		Target:      filter.Target,
+		AuditOffset: filter.Offset,
+		AuditLimit:  filter.Limit,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return entries, nil
+}
+
+// recordAudit writes an audit entry using the queries of the action's transaction,
+// so the entry is only stored when the action itself is committed.
+func recordAudit(ctx context.Context, qtx *repository.Queries, entry repository.InsertAdminAuditParams) error {
+	if err := qtx.InsertAdminAudit(ctx, entry); err != nil {
+		log.Println("insert audit entry failed:", err)
+		return ErrInternalFailure
+	}
+	return nil
+}
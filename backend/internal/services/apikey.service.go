@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Raw keys start with this, so they're easy to spot in code and logs.
+const apiKeyPrefix = "mf_"
+
+// Characters of the key after apiKeyPrefix that are kept in clear, to tell
+// keys apart in the list.
+const apiKeyVisibleChars = 8
+
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, username string, name string, scopes ...string) (string, error)
+	ListAPIKeys(ctx context.Context, username string) ([]repository.ListAPIKeysRow, error)
+	RevokeAPIKey(ctx context.Context, username string, keyID int64) error
+	ResolveAPIKey(ctx context.Context, rawKey string) (models.APIKeyIdentity, error)
+}
+
+type BaseAPIKeyService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBaseAPIKeyService(conn *pgx.Conn) BaseAPIKeyService {
+	return BaseAPIKeyService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+// HashAPIKey is how keys are stored. They're long and random, so a plain
+// SHA-256 is enough and lets them be looked up by hash.
+func HashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey issues a key limited to scopes, or unlimited without any. The
+// raw key is returned only here; just its hash is stored.
+func (s *BaseAPIKeyService) CreateAPIKey(ctx context.Context, username string, name string, scopes ...string) (string, error) {
+	req := models.CreateAPIKeyRequest{Name: name, Scopes: scopes}
+	if err := req.Validate(); err != nil {
+		return "", ErrValidation
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Println(err.Error())
+		return "", ErrInternalFailure
+	}
+	rawKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if _, err := s.Repo.CreateAPIKey(ctx, repository.CreateAPIKeyParams{
+		Username: username,
+		Name:     strings.TrimSpace(name),
+		Prefix:   rawKey[:len(apiKeyPrefix)+apiKeyVisibleChars],
+		KeyHash:  HashAPIKey(rawKey),
+		Scopes:   scopes,
+	}); err != nil {
+		log.Println(err.Error())
+		return "", ErrInternalFailure
+	}
+	return rawKey, nil
+}
+
+// ListAPIKeys returns the user's live keys, without the keys themselves.
+func (s *BaseAPIKeyService) ListAPIKeys(ctx context.Context, username string) ([]repository.ListAPIKeysRow, error) {
+	keys, err := s.Repo.ListAPIKeys(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	if keys == nil {
+		keys = []repository.ListAPIKeysRow{}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey stops the key from working on the next request. Keys of other
+// users are reported as missing.
+func (s *BaseAPIKeyService) RevokeAPIKey(ctx context.Context, username string, keyID int64) error {
+	if keyID <= 0 || keyID > math.MaxInt32 {
+		return ErrValidation
+	}
+
+	revoked, err := s.Repo.RevokeAPIKey(ctx, repository.RevokeAPIKeyParams{
+		ID:       int32(keyID),
+		Username: username,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if revoked == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ResolveAPIKey returns who a live key acts for. Unknown and revoked keys,
+// and keys of deleted users, give ErrUnauthorizedUser.
+func (s *BaseAPIKeyService) ResolveAPIKey(ctx context.Context, rawKey string) (models.APIKeyIdentity, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return models.APIKeyIdentity{}, ErrUnauthorizedUser
+	}
+
+	key, err := s.Repo.UseAPIKey(ctx, HashAPIKey(rawKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.APIKeyIdentity{}, ErrUnauthorizedUser
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.APIKeyIdentity{}, ErrInternalFailure
+	}
+
+	return models.APIKeyIdentity{
+		KeyID:  key.ID,
+		UserID: key.UserID,
+		Role:   key.Role,
+		Scopes: key.Scopes,
+	}, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How long rows are kept in each history table. 0 keeps them forever; users
+// see their settings history, so it's kept by default.
+var (
+	AuditRetention           = config.Duration("AUDIT_RETENTION", 365*24*time.Hour)
+	SettingsHistoryRetention = config.Duration("SETTINGS_HISTORY_RETENTION", 0)
+)
+
+// How often the retention job runs.
+var AuditRetentionInterval = config.Duration("AUDIT_RETENTION_INTERVAL", 24*time.Hour)
+
+// Rows archived and deleted per round trip.
+var auditRetentionBatchSize = config.Int("AUDIT_RETENTION_BATCH_SIZE", 500)
+
+// Directory purged rows are written to as CSV before they're deleted. Empty
+// deletes them without an archive.
+var AuditArchiveDir = config.String("AUDIT_ARCHIVE_DIR", "")
+
+// Archive stores the CSV files of purged rows, e.g. in a directory or an
+// object store.
+type Archive interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// DirArchive writes archives as files in Dir.
+type DirArchive struct {
+	Dir string
+}
+
+func (d DirArchive) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Join(d.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+}
+
+// RetentionTable is a table the retention job trims.
+type RetentionTable struct {
+	Name   string
+	Window time.Duration
+	Header []string
+	// Expired returns up to limit rows older than the window, oldest first,
+	// as their ids and CSV records.
+	Expired func(ctx context.Context, windowSeconds int32, limit int32) ([]int32, [][]string, error)
+	Delete  func(ctx context.Context, ids []int32) (int64, error)
+}
+
+type AuditRetentionJob struct {
+	Tables    []RetentionTable
+	BatchSize int32
+	// Archive, when set, gets every row before it's deleted.
+	Archive Archive
+}
+
+// NewAuditRetentionJob expects a connection of its own, like NewUserPurgeJob.
+func NewAuditRetentionJob(conn *pgx.Conn) AuditRetentionJob {
+	repo := repository.New(conn)
+	job := AuditRetentionJob{
+		Tables: []RetentionTable{
+			adminAuditRetention(repo, AuditRetention),
+			settingsHistoryRetention(repo, SettingsHistoryRetention),
+		},
+		BatchSize: int32(auditRetentionBatchSize),
+	}
+	if AuditArchiveDir != "" {
+		job.Archive = DirArchive{Dir: AuditArchiveDir}
+	}
+	return job
+}
+
+func adminAuditRetention(repo *repository.Queries, window time.Duration) RetentionTable {
+	return RetentionTable{
+		Name:   "admin_audit",
+		Window: window,
+		Header: []string{"id", "actor", "action", "target", "before_value", "after_value", "created_at"},
+		Expired: func(ctx context.Context, windowSeconds int32, limit int32) ([]int32, [][]string, error) {
+			rows, err := repo.ListExpiredAdminAudit(ctx, repository.ListExpiredAdminAuditParams{
+				WindowSeconds: windowSeconds,
+				BatchSize:     limit,
+			})
+			ids := make([]int32, len(rows))
+			records := make([][]string, len(rows))
+			for i, row := range rows {
+				ids[i] = row.ID
+				records[i] = []string{
+					strconv.Itoa(int(row.ID)), row.Actor, row.Action, row.Target,
+					row.BeforeValue, row.AfterValue, row.CreatedAt.Format(time.RFC3339),
+				}
+			}
+			return ids, records, err
+		},
+		Delete: repo.DeleteAdminAuditByIDs,
+	}
+}
+
+func settingsHistoryRetention(repo *repository.Queries, window time.Duration) RetentionTable {
+	return RetentionTable{
+		Name:   "settings_history",
+		Window: window,
+		Header: []string{"id", "username", "snapshot", "created_at"},
+		Expired: func(ctx context.Context, windowSeconds int32, limit int32) ([]int32, [][]string, error) {
+			rows, err := repo.ListExpiredSettingsHistory(ctx, repository.ListExpiredSettingsHistoryParams{
+				WindowSeconds: windowSeconds,
+				BatchSize:     limit,
+			})
+			ids := make([]int32, len(rows))
+			records := make([][]string, len(rows))
+			for i, row := range rows {
+				ids[i] = row.ID
+				records[i] = []string{
+					strconv.Itoa(int(row.ID)), row.Username, string(row.Snapshot), row.CreatedAt.Format(time.RFC3339),
+				}
+			}
+			return ids, records, err
+		},
+		Delete: repo.DeleteSettingsHistoryByIDs,
+	}
+}
+
+// PurgeExpired trims every table with a window, one batch at a time. With an
+// Archive each batch is written and flushed before it's deleted, so a failed
+// write leaves the rows in place. It returns the rows purged per table.
+func (j *AuditRetentionJob) PurgeExpired(ctx context.Context, now time.Time) (map[string]int, error) {
+	purged := make(map[string]int, len(j.Tables))
+	for _, table := range j.Tables {
+		if table.Window <= 0 {
+			continue
+		}
+		n, err := j.purgeTable(ctx, table, now)
+		purged[table.Name] = n
+		if err != nil {
+			log.Printf("purge %s failed: %v", table.Name, err)
+			return purged, ErrInternalFailure
+		}
+	}
+
+	log.Printf("purged expired history rows: %v", purged)
+	return purged, nil
+}
+
+func (j *AuditRetentionJob) purgeTable(ctx context.Context, table RetentionTable, now time.Time) (purged int, err error) {
+	windowSeconds := int32(min(table.Window/time.Second, math.MaxInt32))
+
+	var archive io.WriteCloser
+	var out *csv.Writer
+	defer func() {
+		if archive == nil {
+			return
+		}
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for ctx.Err() == nil {
+		ids, records, err := table.Expired(ctx, windowSeconds, j.BatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		if j.Archive != nil {
+			if archive == nil {
+				name := fmt.Sprintf("%s-%s.csv", table.Name, now.UTC().Format("20060102T150405Z"))
+				if archive, err = j.Archive.Create(name); err != nil {
+					return purged, err
+				}
+				out = csv.NewWriter(archive)
+				if err := out.Write(table.Header); err != nil {
+					return purged, err
+				}
+			}
+			if err := out.WriteAll(records); err != nil {
+				return purged, err
+			}
+		}
+
+		deleted, err := table.Delete(ctx, ids)
+		if err != nil {
+			return purged, err
+		}
+		purged += int(deleted)
+
+		if len(ids) < int(j.BatchSize) {
+			break
+		}
+	}
+	return purged, nil
+}
+
+// Run purges once immediately and then every interval until ctx is done.
+func (j *AuditRetentionJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.PurgeExpired(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
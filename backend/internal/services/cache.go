@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Where shared caches live: "memory" for this instance only, or "redis" to
+// share them between instances at REDIS_ADDR.
+var CacheBackend = config.String("CACHE_BACKEND", "memory")
+
+// How long a cache load may run. Loads outlive the caller that started them,
+// so this is what bounds them.
+var CacheLoadTimeout = config.Duration("CACHE_LOAD_TIMEOUT", 30*time.Second)
+
+// Cache holds byte values by key, each for its own TTL; a TTL of 0 or less
+// keeps the value until it's deleted. Named stores split one cache by domain:
+// keys in different stores never clash and Clear only drops its own store's.
+type Cache interface {
+	// Get returns the value for key and whether there was one.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// GetOrLoad returns the cached value for key, or loads and caches it.
+	// Concurrent loads of the same key on this instance share one call to load.
+	GetOrLoad(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error)
+	// Store returns the sub-store called name.
+	Store(name string) Cache
+	// Clear drops every key in this store, sub-stores included.
+	Clear(ctx context.Context) error
+}
+
+// NewCache returns the cache CacheBackend names, falling back to memory when
+// it's unknown.
+func NewCache() Cache {
+	switch CacheBackend {
+	case "redis":
+		return NewRedisCache(RedisAddr, RedisKeyPrefix)
+	case "memory":
+	default:
+		log.Println("unknown cache backend, using memory:", CacheBackend)
+	}
+	return NewMemoryCache()
+}
+
+// GetOrLoadJSON is GetOrLoad for values stored as JSON.
+func GetOrLoadJSON[T any](ctx context.Context, cache Cache, key string, ttl time.Duration, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	raw, err := cache.GetOrLoad(ctx, key, ttl, func(ctx context.Context) ([]byte, error) {
+		loaded, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(loaded)
+	})
+	if err != nil {
+		return value, err
+	}
+	err = json.Unmarshal(raw, &value)
+	return value, err
+}
+
+// loadCall is a load in flight; waiters read value and err once done is
+// closed.
+type loadCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// loadGroup runs one load per key at a time and hands its result to every
+// caller that asked meanwhile.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+// do runs load for key unless it's already running, then waits for the
+// result or for ctx. The load runs on its own, detached from the caller that
+// started it, so that caller giving up doesn't fail everyone else waiting; it
+// gets CacheLoadTimeout instead. A panicking load fails its callers.
+func (g *loadGroup) do(ctx context.Context, key string, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(context.WithoutCancel(ctx), key, call, load)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *loadGroup) run(ctx context.Context, key string, call *loadCall, load func(ctx context.Context) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(ctx, CacheLoadTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("cache load of %q panicked: %v", key, r)
+			call.value, call.err = nil, fmt.Errorf("cache load panicked: %v", r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = load(ctx)
+}
+
+// getOrLoad implements GetOrLoad on top of Get and Set. Loads are grouped by
+// prefix and key, prefix being the store's. A cache that can't be read or
+// written is logged and bypassed, so it never fails the caller.
+func getOrLoad(ctx context.Context, cache Cache, group *loadGroup, prefix string, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if value, ok, err := cache.Get(ctx, key); err != nil {
+		log.Println("cache get failed:", err)
+	} else if ok {
+		return value, nil
+	}
+
+	return group.do(ctx, prefix+key, func(ctx context.Context) ([]byte, error) {
+		// Another caller may have just loaded it.
+		if value, ok, err := cache.Get(ctx, key); err == nil && ok {
+			return value, nil
+		}
+		value, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := cache.Set(ctx, key, value, ttl); err != nil {
+			log.Println("cache set failed:", err)
+		}
+		return value, nil
+	})
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time // zero for no expiry
+}
+
+// memoryShared is what every store of one MemoryCache shares.
+type memoryShared struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	loads   loadGroup
+}
+
+// MemoryCache is a Cache in this instance's memory. Expired entries are
+// dropped when they're next read.
+type MemoryCache struct {
+	shared *memoryShared
+	prefix string
+	// Now is the clock TTLs are measured with.
+	Now func() time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		shared: &memoryShared{entries: make(map[string]memoryEntry)},
+		Now:    time.Now,
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	key = c.prefix + key
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+
+	entry, ok := c.shared.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && !c.Now().Before(entry.expires) {
+		delete(c.shared.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = c.Now().Add(ttl)
+	}
+
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	c.shared.entries[c.prefix+key] = entry
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	delete(c.shared.entries, c.prefix+key)
+	return nil
+}
+
+func (c *MemoryCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	return getOrLoad(ctx, c, &c.shared.loads, c.prefix, key, ttl, load)
+}
+
+func (c *MemoryCache) Store(name string) Cache {
+	return &MemoryCache{shared: c.shared, prefix: c.prefix + name + ":", Now: c.Now}
+}
+
+func (c *MemoryCache) Clear(ctx context.Context) error {
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	for key := range c.shared.entries {
+		if strings.HasPrefix(key, c.prefix) {
+			delete(c.shared.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Redis server shared caches are kept on with CACHE_BACKEND=redis, and the
+// prefix all their keys start with.
+var (
+	RedisAddr      = config.String("REDIS_ADDR", "localhost:6379")
+	RedisKeyPrefix = config.String("REDIS_KEY_PREFIX", "meals-finder:")
+)
+
+// Credentials sent with AUTH on every new connection, the database selected
+// on it and whether it's made over TLS. Without a username the password is
+// for the default user.
+var (
+	RedisUsername = config.String("REDIS_USERNAME", "")
+	RedisPassword = config.String("REDIS_PASSWORD", "")
+	RedisDB       = config.Int("REDIS_DB", 0)
+	RedisTLS      = config.Bool("REDIS_TLS", false)
+)
+
+// Connections kept open to Redis, and how long a command may take.
+var (
+	RedisMaxIdleConns = config.Int("REDIS_MAX_IDLE_CONNS", 4)
+	RedisTimeout      = config.Duration("REDIS_TIMEOUT", time.Second)
+)
+
+// redisConn is one connection speaking RESP.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisClient sends commands over a few reused connections.
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	// tls is the configuration connections are made with, nil for plain TCP.
+	tls     *tls.Config
+	timeout time.Duration
+	idle    chan *redisConn
+}
+
+func (c *redisClient) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.send(ctx, conn, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection may be mid-reply; don't reuse it.
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// send writes one command on conn and reads its reply.
+func (c *redisClient) send(ctx context.Context, conn *redisConn, args ...string) (any, error) {
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.conn.SetDeadline(deadline)
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.conn.Write([]byte(command.String())); err != nil {
+		return nil, err
+	}
+	return readRedisReply(conn.reader)
+}
+
+func (c *redisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: c.timeout}
+	if c.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redis := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.handshake(ctx, redis); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return redis, nil
+}
+
+// handshake authenticates a new connection and selects the database.
+func (c *redisClient) handshake(ctx context.Context, conn *redisConn) error {
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := c.send(ctx, conn, args...); err != nil {
+			return fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.send(ctx, conn, "SELECT", strconv.Itoa(c.db)); err != nil {
+			return fmt.Errorf("redis select %d: %w", c.db, err)
+		}
+	}
+	return nil
+}
+
+func (c *redisClient) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readRedisReply reads one RESP reply: a string, an int64, nil, an []any of
+// those, or a redisError.
+func readRedisReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readRedisReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// RedisCache is a Cache on a Redis server, shared by every instance using
+// the same server and prefix. Loads are only collapsed within an instance.
+type RedisCache struct {
+	client *redisClient
+	prefix string
+	loads  *loadGroup
+}
+
+func NewRedisCache(addr string, prefix string) *RedisCache {
+	return &RedisCache{
+		client: &redisClient{
+			addr:     addr,
+			username: RedisUsername,
+			password: RedisPassword,
+			db:       RedisDB,
+			tls:      redisTLSConfig(addr),
+			timeout:  RedisTimeout,
+			idle:     make(chan *redisConn, max(RedisMaxIdleConns, 0)),
+		},
+		prefix: prefix,
+		loads:  &loadGroup{},
+	}
+}
+
+// redisTLSConfig verifies the server as addr's host when RedisTLS is on.
+func redisTLSConfig(addr string) *tls.Config {
+	if !RedisTLS {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.client.do(ctx, "GET", c.prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return []byte(value), true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", c.prefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.client.do(ctx, args...)
+	return err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.client.do(ctx, "DEL", c.prefix+key)
+	return err
+}
+
+func (c *RedisCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	return getOrLoad(ctx, c, c.loads, c.prefix, key, ttl, load)
+}
+
+func (c *RedisCache) Store(name string) Cache {
+	return &RedisCache{client: c.client, prefix: c.prefix + name + ":", loads: c.loads}
+}
+
+// Clear scans for the store's keys and deletes them in batches.
+func (c *RedisCache) Clear(ctx context.Context) error {
+	pattern := redisGlobEscaper.Replace(c.prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := c.client.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = page[0].(string)
+		keys, _ := page[1].([]any)
+
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, key := range keys {
+				if key, ok := key.(string); ok {
+					args = append(args, key)
+				}
+			}
+			if _, err := c.client.do(ctx, args...); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// redisGlobEscaper escapes the characters SCAN MATCH treats specially.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// CAPTCHA checks on signup and on logins after repeated failures. Needs
+// CAPTCHA_SECRET; the provider is "hcaptcha" or "recaptcha".
+var (
+	CaptchaEnabled  = config.Bool("CAPTCHA_ENABLED", false)
+	CaptchaProvider = config.String("CAPTCHA_PROVIDER", "hcaptcha")
+	CaptchaSecret   = config.String("CAPTCHA_SECRET", "")
+)
+
+// Failed logins for the same login from one IP within the window after which
+// a CAPTCHA is required.
+var (
+	CaptchaLoginFailures      = config.Int("CAPTCHA_LOGIN_FAILURES", 3)
+	CaptchaLoginFailureWindow = config.Duration("CAPTCHA_LOGIN_FAILURE_WINDOW", 15*time.Minute)
+)
+
+// Endpoints the providers verify tokens at. Both take the same form and
+// answer with the same "success" field.
+var captchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// CaptchaVerifier checks a CAPTCHA token solved by the client.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token string, remoteIP string) (bool, error)
+}
+
+// SiteVerifier verifies tokens against an hCaptcha or reCAPTCHA style
+// siteverify endpoint.
+type SiteVerifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// CaptchaProviderKnown reports whether provider is one CAPTCHA_PROVIDER can
+// name.
+func CaptchaProviderKnown(provider string) bool {
+	_, ok := captchaVerifyURLs[provider]
+	return ok
+}
+
+// NewCaptchaVerifier returns the configured verifier, or nil when CAPTCHA is
+// off or can't be verified: an unknown provider or no secret. That leaves
+// CAPTCHA unchecked, so the security check at startup reports it.
+func NewCaptchaVerifier() CaptchaVerifier {
+	if !CaptchaEnabled {
+		return nil
+	}
+	verifyURL, ok := captchaVerifyURLs[CaptchaProvider]
+	if !ok || CaptchaSecret == "" {
+		log.Println("CAPTCHA enabled but not configured, not checking it")
+		return nil
+	}
+	return &SiteVerifier{
+		URL:    verifyURL,
+		Secret: CaptchaSecret,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *SiteVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// LoginFailures counts recent failed logins per login name. Logins whose
+// failures have all left the window are swept out as new failures come in, at
+// most once per window, so names tried once don't pile up.
+type LoginFailures struct {
+	window    time.Duration
+	mu        sync.Mutex
+	failed    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewLoginFailures(window time.Duration) *LoginFailures {
+	return &LoginFailures{
+		window: window,
+		failed: make(map[string][]time.Time),
+	}
+}
+
+// Count returns the failures for login within the window.
+func (f *LoginFailures) Count(login string, now time.Time) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.recent(strings.ToLower(login), now))
+}
+
+func (f *LoginFailures) Fail(login string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	login = strings.ToLower(login)
+	f.failed[login] = append(f.recent(login, now), now)
+	if now.Sub(f.lastSweep) >= f.window {
+		f.sweep(now)
+	}
+}
+
+// Sweep drops every login without failures in the window.
+func (f *LoginFailures) Sweep(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sweep(now)
+}
+
+// Len returns how many logins have failures kept.
+func (f *LoginFailures) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.failed)
+}
+
+// sweep is Sweep for a caller holding mu.
+func (f *LoginFailures) sweep(now time.Time) {
+	for login, times := range f.failed {
+		if now.Sub(times[len(times)-1]) > f.window {
+			delete(f.failed, login)
+		}
+	}
+	f.lastSweep = now
+}
+
+func (f *LoginFailures) Reset(login string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.failed, strings.ToLower(login))
+}
+
+// recent drops failures older than the window. The caller holds mu.
+func (f *LoginFailures) recent(login string, now time.Time) []time.Time {
+	times := f.failed[login]
+	for len(times) > 0 && now.Sub(times[0]) > f.window {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(f.failed, login)
+		return nil
+	}
+	f.failed[login] = times
+	return times
+}
+
+// checkCaptcha verifies token with verifier. An empty token is
+// ErrCaptchaRequired; a rejected one, or one that can't be checked,
+// ErrCaptchaFailed.
+func checkCaptcha(ctx context.Context, verifier CaptchaVerifier, token string, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+	ok, err := verifier.Verify(ctx, token, remoteIP)
+	if err != nil {
+		log.Println("captcha verification failed:", err)
+		return ErrCaptchaFailed
+	}
+	if !ok {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
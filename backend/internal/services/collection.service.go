@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+type CollectionService interface {
+	CreateCollection(ctx context.Context, username string, req *models.CreateCollectionRequest) (int32, error)
+	AddRecipeToCollection(ctx context.Context, username string, collectionID int32, recipeID int32) error
+	GenerateCollectionShareLink(ctx context.Context, username string, collectionID int32) (string, error)
+	RevokeShareLink(ctx context.Context, username string, token string) error
+	GetSharedCollection(ctx context.Context, token string) (models.Collection, error)
+}
+
+type BaseCollectionService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBaseCollectionService(conn *pgx.Conn) BaseCollectionService {
+	return BaseCollectionService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+func (c *BaseCollectionService) CreateCollection(ctx context.Context, username string, req *models.CreateCollectionRequest) (int32, error) {
+	if req == nil {
+		return 0, ErrValidation
+	}
+
+	id, err := c.Repo.CreateCollection(ctx, repository.CreateCollectionParams{
+		Username: username,
+		Name:     req.Name,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrInternalFailure
+	}
+
+	return id, nil
+}
+
+func (c *BaseCollectionService) AddRecipeToCollection(ctx context.Context, username string, collectionID int32, recipeID int32) error {
+	if err := c.checkOwner(ctx, username, collectionID); err != nil {
+		return err
+	}
+
+	err := c.Repo.AddRecipeToCollection(ctx, repository.AddRecipeToCollectionParams{
+		CollectionID: collectionID,
+		RecipeID:     recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+func (c *BaseCollectionService) GenerateCollectionShareLink(ctx context.Context, username string, collectionID int32) (string, error) {
+	if err := c.checkOwner(ctx, username, collectionID); err != nil {
+		return "", err
+	}
+
+	token, err := NewShareToken()
+	if err != nil {
+		log.Println(err.Error())
+		return "", ErrInternalFailure
+	}
+
+	err = c.Repo.CreateCollectionShare(ctx, repository.CreateCollectionShareParams{
+		Token:        token,
+		CollectionID: collectionID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return "", ErrInternalFailure
+	}
+
+	return token, nil
+}
+
+func (c *BaseCollectionService) RevokeShareLink(ctx context.Context, username string, token string) error {
+	revoked, err := c.Repo.RevokeCollectionShare(ctx, repository.RevokeCollectionShareParams{
+		Token:    token,
+		Username: username,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	// Tokens of other users are reported as missing to not leak their existence.
+	if revoked == 0 {
+		return ErrShareNotFound
+	}
+
+	return nil
+}
+
+func (c *BaseCollectionService) GetSharedCollection(ctx context.Context, token string) (models.Collection, error) {
+	shared, err := c.Repo.GetSharedCollection(ctx, token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Collection{}, ErrShareNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.Collection{}, ErrInternalFailure
+	}
+
+	recipes, err := c.Repo.GetCollectionRecipes(ctx, shared.ID)
+	if err != nil {
+		log.Println(err.Error())
+		return models.Collection{}, ErrInternalFailure
+	}
+
+	collection := models.Collection{
+		ID:       shared.ID,
+		Name:     shared.Name,
+		Username: shared.Username,
+		Recipes:  make([]models.CollectionRecipe, 0, len(recipes)),
+	}
+	for _, recipe := range recipes {
+		collection.Recipes = append(collection.Recipes, models.CollectionRecipe{
+			ID:         recipe.ID,
+			Name:       recipe.Name,
+			Time:       recipe.Time,
+			Difficulty: recipe.Difficulty,
+		})
+	}
+
+	return collection, nil
+}
+
+func (c *BaseCollectionService) checkOwner(ctx context.Context, username string, collectionID int32) error {
+	owner, err := c.Repo.GetCollectionOwner(ctx, collectionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCollectionNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if owner != username {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// NewShareToken returns an opaque, URL safe random token.
+func NewShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Maximum number of active favorites per user.
+var favoritesLimit = config.Int("FAVORITES_LIMIT", 1000)
+
+// Archive the oldest favorite instead of rejecting a new one over the limit.
+var favoritesAutoArchive = config.Bool("FAVORITES_AUTO_ARCHIVE", false)
+
+type FavoriteService interface {
+	AddFavorite(ctx context.Context, username string, recipeID int32) error
+	DeleteFavorite(ctx context.Context, username string, recipeID int32) error
+	ArchiveFavorite(ctx context.Context, username string, recipeID int32) error
+	ListFavorites(ctx context.Context, username string) ([]repository.ListFavoritesRow, error)
+	ListArchivedFavorites(ctx context.Context, username string) ([]repository.ListArchivedFavoritesRow, error)
+	MarkRecipeMade(ctx context.Context, username string, recipeID int32) error
+}
+
+type BaseFavoriteService struct {
+	DbConn      *pgx.Conn
+	Repo        *repository.Queries
+	Limit       int64
+	AutoArchive bool
+}
+
+func NewBaseFavoriteService(conn *pgx.Conn) BaseFavoriteService {
+	return BaseFavoriteService{
+		DbConn:      conn,
+		Repo:        repository.New(conn),
+		Limit:       int64(favoritesLimit),
+		AutoArchive: favoritesAutoArchive,
+	}
+}
+
+// FavoriteLimitCheck decides what adding a favorite does when the user already
+// has count favorites: go ahead, archive the oldest one first, or fail with
+// ErrFavoriteLimitReached. Re-adding an existing favorite is always allowed.
+func FavoriteLimitCheck(count int64, limit int64, alreadyFavorite bool, autoArchive bool) (archiveOldest bool, err error) {
+	if alreadyFavorite || limit <= 0 || count < limit {
+		return false, nil
+	}
+	if autoArchive {
+		return true, nil
+	}
+	return false, ErrFavoriteLimitReached
+}
+
+func (f *BaseFavoriteService) AddFavorite(ctx context.Context, username string, recipeID int32) error {
+	tx, err := f.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := f.Repo.WithTx(tx)
+
+	// Locked so a concurrent add can't slip past the limit check.
+	if err := qtx.LockFavoritesOwner(ctx, username); err != nil {
+		log.Println("lock favorites owner failed:", err)
+		return ErrInternalFailure
+	}
+	count, err := qtx.CountFavorites(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	exists, err := qtx.IsFavorite(ctx, repository.IsFavoriteParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	archiveOldest, err := FavoriteLimitCheck(count, f.Limit, exists, f.AutoArchive)
+	if err != nil {
+		return err
+	}
+	if archiveOldest {
+		if _, err := qtx.ArchiveOldestFavorite(ctx, username); err != nil {
+			log.Println(err.Error())
+			return ErrInternalFailure
+		}
+	}
+
+	err = qtx.AddFavorite(ctx, repository.AddFavoriteParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	// A recipe favorited again leaves the archive.
+	err = qtx.DeleteArchivedFavorite(ctx, repository.DeleteArchivedFavoriteParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+func (f *BaseFavoriteService) ArchiveFavorite(ctx context.Context, username string, recipeID int32) error {
+	archived, err := f.Repo.ArchiveFavorite(ctx, repository.ArchiveFavoriteParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if archived == 0 {
+		return ErrFavoriteNotFound
+	}
+
+	return nil
+}
+
+func (f *BaseFavoriteService) ListArchivedFavorites(ctx context.Context, username string) ([]repository.ListArchivedFavoritesRow, error) {
+	favorites, err := f.Repo.ListArchivedFavorites(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return favorites, nil
+}
+
+func (f *BaseFavoriteService) DeleteFavorite(ctx context.Context, username string, recipeID int32) error {
+	err := f.Repo.DeleteFavorite(ctx, repository.DeleteFavoriteParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+func (f *BaseFavoriteService) ListFavorites(ctx context.Context, username string) ([]repository.ListFavoritesRow, error) {
+	favorites, err := f.Repo.ListFavorites(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return favorites, nil
+}
+
+func (f *BaseFavoriteService) MarkRecipeMade(ctx context.Context, username string, recipeID int32) error {
+	err := f.Repo.MarkRecipeMade(ctx, repository.MarkRecipeMadeParams{
+		Username: username,
+		RecipeID: recipeID,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// ProviderInventory tells which ingredients a grocery-delivery provider can
+// deliver.
+type ProviderInventory interface {
+	// Available returns which of the lowercase ingredient names can be
+	// ordered. Names left out of the result can't.
+	Available(ctx context.Context, names []string) (map[string]bool, error)
+}
+
+// MockProviderInventory delivers exactly the ingredients in Stock, keyed by
+// lowercase name.
+type MockProviderInventory struct {
+	Stock map[string]bool
+	Err   error
+}
+
+func (m *MockProviderInventory) Available(ctx context.Context, names []string) (map[string]bool, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	available := make(map[string]bool)
+	for _, name := range names {
+		if m.Stock[name] {
+			available[name] = true
+		}
+	}
+	return available, nil
+}
+
+// AvailabilityScore is the share of ingredients that can be ordered. A recipe
+// without ingredients scores 0, as there's nothing to order it by.
+func AvailabilityScore(ingredients []models.Ingredient, available map[string]bool) float64 {
+	if len(ingredients) == 0 {
+		return 0
+	}
+	var orderable int
+	for _, ingredient := range ingredients {
+		if available[normalizeIngredientName(ingredient.Name)] {
+			orderable++
+		}
+	}
+	return float64(orderable) / float64(len(ingredients))
+}
+
+// RankByAvailability orders recipes by AvailabilityScore, best first, keeping
+// the search order among recipes that tie. With min above 0 recipes scoring
+// below it are left out.
+func RankByAvailability(recipes []repository.FilterRecipesByTagNamesAndParamsRow, ingredients map[int32][]models.Ingredient, available map[string]bool, min float64) []repository.FilterRecipesByTagNamesAndParamsRow {
+	scores := make(map[int32]float64, len(recipes))
+	ranked := make([]repository.FilterRecipesByTagNamesAndParamsRow, 0, len(recipes))
+	for _, recipe := range recipes {
+		score := AvailabilityScore(ingredients[recipe.ID], available)
+		if min > 0 && score < min {
+			continue
+		}
+		scores[recipe.ID] = score
+		ranked = append(ranked, recipe)
+	}
+	slices.SortStableFunc(ranked, func(a, b repository.FilterRecipesByTagNamesAndParamsRow) int {
+		switch {
+		case scores[a.ID] > scores[b.ID]:
+			return -1
+		case scores[a.ID] < scores[b.ID]:
+			return 1
+		}
+		return 0
+	})
+	return ranked
+}
+
+// rankByAvailability asks the inventory about the recipes' ingredients and
+// ranks them with RankByAvailability. When the provider can't answer, a hard
+// minimum fails with ErrInventoryUnavailable and soft ranking leaves the
+// recipes in search order.
+func (b *BaseFinderService) rankByAvailability(ctx context.Context, recipes []repository.FilterRecipesByTagNamesAndParamsRow, min float64) ([]repository.FilterRecipesByTagNamesAndParamsRow, error) {
+	if len(recipes) == 0 {
+		return recipes, nil
+	}
+
+	ids := make([]int32, len(recipes))
+	for i, recipe := range recipes {
+		ids[i] = recipe.ID
+	}
+	rows, err := b.Repo.GetIngredientsForRecipes(ctx, ids)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	ingredients := make(map[int32][]models.Ingredient, len(rows))
+	var names []string
+	for _, row := range rows {
+		ingredients[row.ID] = row.Ingredients.Ingredients
+		for _, ingredient := range row.Ingredients.Ingredients {
+			if name := normalizeIngredientName(ingredient.Name); !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	available, err := b.Inventory.Available(ctx, names)
+	if err != nil {
+		log.Println("grocery inventory lookup failed:", err)
+		if min > 0 {
+			return nil, ErrInventoryUnavailable
+		}
+		return recipes, nil
+	}
+	return RankByAvailability(recipes, ingredients, available, min), nil
+}
+
+func normalizeIngredientName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// BatchCook scales the meal to cover days of one meal slot, with what to buy
+// for it.
+func (b *BaseFinderService) BatchCook(ctx context.Context, mealID int64, days int) (models.BatchCookPlan, error) {
+	if mealID <= 0 || mealID > math.MaxInt32 || days < 1 || days > models.MaxBatchDays {
+		return models.BatchCookPlan{}, ErrValidation
+	}
+
+	recipe, err := b.recipeWithId(ctx, int32(mealID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.BatchCookPlan{}, ErrNoRecipesFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.BatchCookPlan{}, ErrInternalFailure
+	}
+
+	return PlanBatchCook(recipe, days), nil
+}
+
+// PlanBatchCook scales the recipe to days times its servings. Recipes that
+// don't keep for the days, or aren't batch friendly, still get a plan, with a
+// warning.
+func PlanBatchCook(recipe repository.Recipe, days int) models.BatchCookPlan {
+	base := max(recipe.Servings, 1)
+	scaled := ScaleRecipe(recipe, base*int32(days))
+
+	plan := models.BatchCookPlan{
+		MealID:        recipe.ID,
+		Name:          recipe.Name,
+		Days:          days,
+		Servings:      scaled.Servings,
+		BatchFriendly: recipe.BatchFriendly,
+		StorageDays:   recipe.StorageDays,
+		Ingredients:   scaled.Ingredients.Ingredients,
+		ShoppingList:  AggregateIngredients(scaled.Ingredients.Ingredients),
+		Calories:      recipe.Calories,
+		Protein:       recipe.Protein,
+		Carbs:         recipe.Carbs,
+		Fat:           recipe.Fat,
+		TotalCalories: batchTotal(recipe.Calories, scaled.Servings),
+		TotalProtein:  batchTotal(recipe.Protein, scaled.Servings),
+		TotalCarbs:    batchTotal(recipe.Carbs, scaled.Servings),
+		TotalFat:      batchTotal(recipe.Fat, scaled.Servings),
+	}
+
+	if !recipe.BatchFriendly {
+		plan.Warnings = append(plan.Warnings, "this meal isn't marked batch friendly")
+	}
+	switch {
+	case recipe.StorageDays == 0:
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("storage time unknown, make sure it keeps %d days", days))
+	case int(recipe.StorageDays) < days:
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("keeps %d days, shorter than the %d planned", recipe.StorageDays, days))
+	}
+	return plan
+}
+
+func batchTotal(perServing *int32, servings int32) *int32 {
+	if perServing == nil {
+		return nil
+	}
+	total := *perServing * servings
+	return &total
+}
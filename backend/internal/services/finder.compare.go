@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+const (
+	MinComparedMeals = 2
+	MaxComparedMeals = 5
+)
+
+// CompareMeals puts 2 to 5 recipes side by side: nutrition per serving, prep
+// time and average rating, with the winner of each metric.
+func (b *BaseFinderService) CompareMeals(ctx context.Context, mealIDs []int64) (models.MealComparison, error) {
+	if len(mealIDs) < MinComparedMeals || len(mealIDs) > MaxComparedMeals {
+		return models.MealComparison{}, ErrValidation
+	}
+
+	ids := make([]int32, 0, len(mealIDs))
+	seen := make(map[int64]bool, len(mealIDs))
+	for _, id := range mealIDs {
+		if id <= 0 || id > math.MaxInt32 || seen[id] {
+			return models.MealComparison{}, ErrValidation
+		}
+		seen[id] = true
+		ids = append(ids, int32(id))
+	}
+
+	rows, err := b.Repo.CompareRecipes(ctx, ids)
+	if err != nil {
+		log.Println(err.Error())
+		return models.MealComparison{}, ErrInternalFailure
+	}
+	byID := make(map[int32]repository.CompareRecipesRow, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+
+	meals := make([]models.ComparedMeal, 0, len(ids))
+	for _, id := range ids {
+		row, ok := byID[id]
+		if !ok {
+			return models.MealComparison{}, ErrNoRecipesFound
+		}
+		meal := models.ComparedMeal{
+			ID:       row.ID,
+			Name:     row.Name,
+			Time:     row.Time,
+			Calories: row.Calories,
+			Protein:  row.Protein,
+			Carbs:    row.Carbs,
+			Fat:      row.Fat,
+		}
+		if row.ReviewCount > 0 {
+			meal.Rating = &row.Rating
+		}
+		meals = append(meals, meal)
+	}
+
+	return models.MealComparison{Meals: meals, Winners: MealWinners(meals)}, nil
+}
+
+// A compared metric and whether more of it is better.
+type comparedMetric struct {
+	name   string
+	higher bool
+	value  func(models.ComparedMeal) (float64, bool)
+}
+
+func optionalMetric(v *int32) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return float64(*v), true
+}
+
+var comparedMetrics = []comparedMetric{
+	{"calories", false, func(m models.ComparedMeal) (float64, bool) { return optionalMetric(m.Calories) }},
+	{"protein", true, func(m models.ComparedMeal) (float64, bool) { return optionalMetric(m.Protein) }},
+	{"carbs", false, func(m models.ComparedMeal) (float64, bool) { return optionalMetric(m.Carbs) }},
+	{"fat", false, func(m models.ComparedMeal) (float64, bool) { return optionalMetric(m.Fat) }},
+	{"time", false, func(m models.ComparedMeal) (float64, bool) { return float64(m.Time), true }},
+	{"rating", true, func(m models.ComparedMeal) (float64, bool) {
+		if m.Rating == nil {
+			return 0, false
+		}
+		return *m.Rating, true
+	}},
+}
+
+// MealWinners picks the best meals per metric: fewest calories, carbs and fat,
+// most protein, shortest time and highest rating. Meals with the metric
+// unknown never win it.
+func MealWinners(meals []models.ComparedMeal) map[string][]int32 {
+	winners := make(map[string][]int32)
+	for _, metric := range comparedMetrics {
+		var best float64
+		var ids []int32
+		for _, meal := range meals {
+			value, ok := metric.value(meal)
+			if !ok {
+				continue
+			}
+			better := value < best
+			if metric.higher {
+				better = value > best
+			}
+			switch {
+			case ids == nil || better:
+				best, ids = value, []int32{meal.ID}
+			case value == best:
+				ids = append(ids, meal.ID)
+			}
+		}
+		if ids != nil {
+			winners[metric.name] = ids
+		}
+	}
+	return winners
+}
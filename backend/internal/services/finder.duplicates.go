@@ -0,0 +1,79 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Recipes scoring at least this are reported as likely duplicates. The score
+// weighs name similarity against ingredient overlap, both between 0 and 1.
+const (
+	duplicateThreshold    = 0.75
+	duplicateNameWeight   = 0.6
+	duplicateCandidateMax = 20
+)
+
+func (b *BaseFinderService) findDuplicates(ctx context.Context, recipe *models.RecipeAdd) ([]models.DuplicateRecipe, error) {
+	candidates, err := b.Repo.FindSimilarRecipes(ctx, repository.FindSimilarRecipesParams{
+		Name:           recipe.Name,
+		CandidateLimit: duplicateCandidateMax,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return LikelyDuplicates(candidates, recipe.Ingredients.Ingredients), nil
+}
+
+// LikelyDuplicates scores name-similar candidates by their ingredient overlap
+// with ingredients and returns those past the threshold, most similar first.
+func LikelyDuplicates(candidates []repository.FindSimilarRecipesRow, ingredients []models.Ingredient) []models.DuplicateRecipe {
+	duplicates := []models.DuplicateRecipe{}
+	for _, c := range candidates {
+		score := duplicateNameWeight*c.NameSimilarity +
+			(1-duplicateNameWeight)*IngredientOverlap(c.Ingredients.Ingredients, ingredients)
+		if score >= duplicateThreshold {
+			duplicates = append(duplicates, models.DuplicateRecipe{ID: c.ID, Name: c.Name, Similarity: score})
+		}
+	}
+
+	slices.SortStableFunc(duplicates, func(a, b models.DuplicateRecipe) int {
+		return cmp.Compare(b.Similarity, a.Similarity)
+	})
+	return duplicates
+}
+
+// IngredientOverlap is the Jaccard index of the two ingredient name sets,
+// ignoring case, amounts and units. Two empty lists don't overlap.
+func IngredientOverlap(a, b []models.Ingredient) float64 {
+	names := func(ingredients []models.Ingredient) map[string]bool {
+		set := make(map[string]bool, len(ingredients))
+		for _, ingredient := range ingredients {
+			if name := strings.ToLower(strings.TrimSpace(ingredient.Name)); name != "" {
+				set[name] = true
+			}
+		}
+		return set
+	}
+
+	setA, setB := names(a), names(b)
+	shared := 0
+	for name := range setA {
+		if setB[name] {
+			shared++
+		}
+	}
+
+	union := len(setA) + len(setB) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Tag type ids as seeded in tags_types.
+const (
+	tagTypeDiet       = 1
+	tagTypeRegion     = 2
+	tagTypeRecipeType = 3
+	tagTypeAllergy    = 4
+	tagTypeNutrients  = 5
+	tagTypeOthers     = 6
+)
+
+// MatchReasons describes which of the search filters a recipe satisfied, given
+// the recipe's tags and the names of the searching user's tags.
+func MatchReasons(params models.RecipesFinderParams, recipeTags []repository.GetTagsForRecipesRow, userTags []string) []string {
+	var reasons []string
+
+	matched := func(typeID int32, wanted []string) []string {
+		var names []string
+		for _, tag := range recipeTags {
+			if tag.TypeID == typeID && slices.Contains(wanted, tag.Name) {
+				names = append(names, tag.Name)
+			}
+		}
+		return names
+	}
+	add := func(label string, names []string) {
+		if len(names) > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", label, strings.Join(names, ", ")))
+		}
+	}
+
+	add("matches diet", matched(tagTypeDiet, params.Diet))
+	add("matches region", matched(tagTypeRegion, params.Region))
+	add("matches type", matched(tagTypeRecipeType, params.RecipeType))
+	add("matches nutrients", matched(tagTypeNutrients, params.Nutrients))
+	add("matches other", matched(tagTypeOthers, params.Others))
+
+	var userMatched []string
+	for _, tag := range recipeTags {
+		if tag.TypeID != tagTypeAllergy && slices.Contains(userTags, tag.Name) && !slices.Contains(userMatched, tag.Name) {
+			userMatched = append(userMatched, tag.Name)
+		}
+	}
+	add("matches your tags", userMatched)
+
+	if len(params.Allergies) > 0 {
+		reasons = append(reasons, "excludes allergens: "+strings.Join(params.Allergies, ", "))
+	}
+	// Saved exclusions are preferences, reported apart from allergens.
+	if len(params.ExcludeIngredients) > 0 {
+		reasons = append(reasons, "excludes ingredients: "+strings.Join(params.ExcludeIngredients, ", "))
+	}
+	if len(params.SavedExclusions) > 0 {
+		reasons = append(reasons, "excludes your saved ingredients: "+strings.Join(params.SavedExclusions, ", "))
+	}
+	if params.ExcludeFavorited {
+		reasons = append(reasons, "not in your favorites")
+	}
+	if params.ExcludeMade {
+		reasons = append(reasons, "not made by you yet")
+	}
+
+	return reasons
+}
+
+// ExplainRecipes adds match reasons to search results found with params.
+func (b *BaseFinderService) ExplainRecipes(ctx context.Context, params models.RecipesFinderParams, recipes []repository.FilterRecipesByTagNamesAndParamsRow) ([]models.ExplainedRecipe, error) {
+	ids := make([]int32, len(recipes))
+	for i, recipe := range recipes {
+		ids[i] = recipe.ID
+	}
+
+	tags, err := b.Repo.GetTagsForRecipes(ctx, ids)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	byRecipe := make(map[int32][]repository.GetTagsForRecipesRow)
+	for _, tag := range tags {
+		byRecipe[tag.RecipeID] = append(byRecipe[tag.RecipeID], tag)
+	}
+
+	if err := b.loadSavedExclusions(ctx, &params); err != nil {
+		return nil, err
+	}
+
+	var userTags []string
+	if params.Username != "" {
+		rows, err := b.Repo.DisplayUserTag(ctx, params.Username)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, ErrInternalFailure
+		}
+		for _, row := range rows {
+			userTags = append(userTags, row.Value)
+		}
+	}
+
+	explained := make([]models.ExplainedRecipe, len(recipes))
+	for i, recipe := range recipes {
+		explained[i] = models.ExplainedRecipe{
+			ID:           recipe.ID,
+			Name:         recipe.Name,
+			Time:         recipe.Time,
+			Difficulty:   recipe.Difficulty,
+			MatchReasons: MatchReasons(params, byRecipe[recipe.ID], userTags),
+		}
+	}
+	return explained, nil
+}
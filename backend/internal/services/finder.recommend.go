@@ -0,0 +1,303 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+const DefaultRecommendationsLimit = 20
+
+// Recipes recommended, or picked as recipe of the day, within this window are
+// held back until the user has seen the rest. 0 turns the history off.
+var RecommendationRepeatWindow = config.Duration("RECOMMENDATION_REPEAT_WINDOW", 7*24*time.Hour)
+
+// Connections opened for fetching recommendation inputs in parallel. 0 fetches
+// them one after another on the request connection.
+var RecommendationFetchConns = config.Int("RECOMMENDATION_FETCH_CONNECTIONS", 5)
+
+// RankRecipes scores every candidate by the summed weights of the user tags it
+// matches and returns them best first, ties broken by id.
+func RankRecipes(candidates []repository.GetRecommendationCandidatesRow, weights map[int32]int32) []models.RecommendedRecipe {
+	ranked := make([]models.RecommendedRecipe, 0, len(candidates))
+	for _, c := range candidates {
+		var score int32
+		for _, tagID := range c.TagIds {
+			score += weights[tagID]
+		}
+		ranked = append(ranked, models.RecommendedRecipe{
+			ID:         c.ID,
+			Name:       c.Name,
+			Time:       c.Time,
+			Difficulty: c.Difficulty,
+			Score:      score,
+		})
+	}
+
+	slices.SortFunc(ranked, func(a, b models.RecommendedRecipe) int {
+		if a.Score != b.Score {
+			return int(b.Score - a.Score)
+		}
+		return int(a.ID - b.ID)
+	})
+	return ranked
+}
+
+// RecommendationInputs is what recommendations are built from, fetched at
+// once for the user.
+type RecommendationInputs struct {
+	Candidates []repository.GetRecommendationCandidatesRow
+	Weights    map[int32]int32
+	// Favorites are left out, the user knows them already.
+	Favorites []int32
+	// Ratings are average review scores by recipe id, breaking ties in score.
+	Ratings map[int32]float64
+	// Allergens are the user's allergen tags. The candidates query already
+	// leaves them out; they're checked again after merging.
+	Allergens []int32
+	// Diets are the user's diet tags by id, with how strictly each is kept.
+	Diets map[int32]string
+	// Relevance orders what's left; with no weights set the tag score does.
+	Relevance RelevanceWeights
+}
+
+// MergeRecommendations ranks the candidates that are neither favorites,
+// tagged with one of the user's allergens, nor missing one of their strict
+// diet tags. Candidates missing moderate or flexible diet tags come after
+// those missing fewer, by DietPenalty, and then go by relevance.
+func MergeRecommendations(in RecommendationInputs) []models.RecommendedRecipe {
+	penalties := make(map[int32]int32, len(in.Candidates))
+	candidates := slices.DeleteFunc(slices.Clone(in.Candidates), func(c repository.GetRecommendationCandidatesRow) bool {
+		if slices.Contains(in.Favorites, c.ID) ||
+			slices.ContainsFunc(c.TagIds, func(id int32) bool { return slices.Contains(in.Allergens, id) }) {
+			return true
+		}
+		for tagID, strictness := range in.Diets {
+			if slices.Contains(c.TagIds, tagID) {
+				continue
+			}
+			if strictness == models.StrictnessStrict {
+				return true
+			}
+			penalties[c.ID] += models.DietPenalty(strictness)
+		}
+		return false
+	})
+
+	byID := make(map[int32]repository.GetRecommendationCandidatesRow, len(candidates))
+	for _, c := range candidates {
+		byID[c.ID] = c
+	}
+	ranked := RankRecipes(candidates, in.Weights)
+	relevance := make(map[int32]float64, len(ranked))
+	for _, recipe := range ranked {
+		c := byID[recipe.ID]
+		relevance[recipe.ID] = in.Relevance.Score(RelevanceSignals{
+			Tags:        float64(recipe.Score),
+			Rating:      in.Ratings[recipe.ID],
+			Popularity:  c.Popularity,
+			Recency:     c.Recency,
+			Ingredients: c.PantryShare,
+		})
+	}
+	slices.SortStableFunc(ranked, func(a, b models.RecommendedRecipe) int {
+		if penalties[a.ID] != penalties[b.ID] {
+			return cmp.Compare(penalties[a.ID], penalties[b.ID])
+		}
+		if relevance[a.ID] != relevance[b.ID] {
+			return cmp.Compare(relevance[b.ID], relevance[a.ID])
+		}
+		if a.Score != b.Score {
+			return int(b.Score - a.Score)
+		}
+		return cmp.Compare(in.Ratings[b.ID], in.Ratings[a.ID])
+	})
+	return ranked
+}
+
+// fetchRecommendationInputs runs the fetches in parallel when a FetchPool is
+// set, each on a connection of its own, and one after another on Repo
+// otherwise.
+func (b *BaseFinderService) fetchRecommendationInputs(ctx context.Context, username string) (RecommendationInputs, error) {
+	limit := 1
+	if b.FetchPool != nil {
+		limit = b.FetchPool.Size()
+	}
+	in := RecommendationInputs{Relevance: b.Relevance}
+
+	err := RunFetches(ctx, limit,
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) (err error) {
+			in.Candidates, err = repo.GetRecommendationCandidates(ctx, username)
+			return err
+		}),
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) error {
+			rows, err := repo.GetUserTagWeights(ctx, username)
+			in.Weights = make(map[int32]int32, len(rows))
+			for _, row := range rows {
+				in.Weights[row.TagID] = row.Weight
+			}
+			return err
+		}),
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) (err error) {
+			in.Favorites, err = repo.ListFavoriteRecipeIds(ctx, username)
+			return err
+		}),
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) error {
+			rows, err := repo.ListRatingsForUserTags(ctx, username)
+			in.Ratings = make(map[int32]float64, len(rows))
+			for _, row := range rows {
+				in.Ratings[row.RecipeID] = row.Rating
+			}
+			return err
+		}),
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) (err error) {
+			in.Allergens, err = repo.GetUserAllergenTagIds(ctx, username)
+			return err
+		}),
+		b.withRepo(func(ctx context.Context, repo *repository.Queries) error {
+			rows, err := repo.GetUserDietStrictness(ctx, username)
+			in.Diets = make(map[int32]string, len(rows))
+			for _, row := range rows {
+				in.Diets[row.TagID] = row.Strictness
+			}
+			return err
+		}),
+	)
+	return in, err
+}
+
+// withRepo runs fetch on a connection from FetchPool, or on Repo without one.
+func (b *BaseFinderService) withRepo(fetch func(ctx context.Context, repo *repository.Queries) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if b.FetchPool == nil {
+			return fetch(ctx, b.Repo)
+		}
+
+		repo, err := b.FetchPool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer b.FetchPool.Release(repo)
+		return fetch(ctx, repo)
+	}
+}
+
+func (b *BaseFinderService) RecommendRecipes(ctx context.Context, username string, limit int32) ([]models.RecommendedRecipe, error) {
+	if limit <= 0 {
+		limit = DefaultRecommendationsLimit
+	}
+
+	in, err := b.fetchRecommendationInputs(ctx, username)
+	if errors.Is(err, ErrServiceBusy) {
+		return nil, ErrServiceBusy
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	ranked := MergeRecommendations(in)
+	if b.RepeatWindow <= 0 {
+		if len(ranked) > int(limit) {
+			ranked = ranked[:limit]
+		}
+		return ranked, nil
+	}
+
+	recent, err := b.recentRecommendations(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	picked, reset := PickUnseen(ranked, recent, int(limit))
+
+	ids := make([]int32, len(picked))
+	for i, recipe := range picked {
+		ids[i] = recipe.ID
+	}
+	if err := b.recordRecommendations(ctx, username, ids, reset); err != nil {
+		return nil, err
+	}
+	return picked, nil
+}
+
+// PickUnseen takes up to limit recipes in rank order, skipping those in
+// recent, which maps recipe ids to when they were last shown. When too few
+// unseen ones are left the pool is exhausted: the rest is filled with the
+// least recently shown recipes and reset is set, so the history starts over.
+func PickUnseen(ranked []models.RecommendedRecipe, recent map[int32]time.Time, limit int) (picked []models.RecommendedRecipe, reset bool) {
+	picked = make([]models.RecommendedRecipe, 0, min(limit, len(ranked)))
+	var seen []models.RecommendedRecipe
+	for _, recipe := range ranked {
+		if _, ok := recent[recipe.ID]; ok {
+			seen = append(seen, recipe)
+		} else if len(picked) < limit {
+			picked = append(picked, recipe)
+		}
+	}
+	if len(picked) == limit || len(seen) == 0 {
+		return picked, false
+	}
+
+	slices.SortStableFunc(seen, func(a, b models.RecommendedRecipe) int {
+		return recent[a.ID].Compare(recent[b.ID])
+	})
+	for _, recipe := range seen {
+		if len(picked) == limit {
+			break
+		}
+		picked = append(picked, recipe)
+	}
+	return picked, true
+}
+
+func (b *BaseFinderService) recentRecommendations(ctx context.Context, username string) (map[int32]time.Time, error) {
+	rows, err := b.Repo.GetRecentRecommendations(ctx, repository.GetRecentRecommendationsParams{
+		Username:      username,
+		WindowSeconds: int32(b.RepeatWindow / time.Second),
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	recent := make(map[int32]time.Time, len(rows))
+	for _, row := range rows {
+		recent[row.RecipeID] = row.ShownAt
+	}
+	return recent, nil
+}
+
+// recordRecommendations remembers ids as shown now, after clearing the whole
+// history when reset is set. Entries past the window are dropped on the way.
+func (b *BaseFinderService) recordRecommendations(ctx context.Context, username string, ids []int32, reset bool) error {
+	if reset {
+		if err := b.Repo.ClearRecommendationHistory(ctx, username); err != nil {
+			log.Println(err.Error())
+			return ErrInternalFailure
+		}
+	} else if err := b.Repo.PruneRecommendationHistory(ctx, repository.PruneRecommendationHistoryParams{
+		Username:      username,
+		WindowSeconds: int32(b.RepeatWindow / time.Second),
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := b.Repo.RecordRecommendations(ctx, repository.RecordRecommendationsParams{
+		Username:  username,
+		RecipeIds: ids,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
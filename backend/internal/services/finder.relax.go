@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+type RecipesFetcher func(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error)
+
+type softConstraint struct {
+	name   string
+	active func(p *models.RecipesFinderParams) bool
+	relax  func(p *models.RecipesFinderParams)
+}
+
+// Soft constraints in the order they are dropped. Diet and allergies are hard
+// constraints and are never relaxed.
+var softConstraints = []softConstraint{
+	{
+		name:   "others",
+		active: func(p *models.RecipesFinderParams) bool { return len(p.Others) > 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.Others = nil },
+	},
+	{
+		name:   "nutrients",
+		active: func(p *models.RecipesFinderParams) bool { return len(p.Nutrients) > 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.Nutrients = nil },
+	},
+	{
+		name:   "difficulty",
+		active: func(p *models.RecipesFinderParams) bool { return p.MinDifficulty != 0 || p.MaxDifficulty != 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.MinDifficulty, p.MaxDifficulty = 0, 0 },
+	},
+	{
+		name: "time",
+		active: func(p *models.RecipesFinderParams) bool {
+			return p.MinTime != 0 || p.MaxTime != 0 || p.MaxTotalTime != 0
+		},
+		relax: func(p *models.RecipesFinderParams) { p.MinTime, p.MaxTime, p.MaxTotalTime = 0, 0, 0 },
+	},
+	{
+		name:   "recipe_type",
+		active: func(p *models.RecipesFinderParams) bool { return len(p.RecipeType) > 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.RecipeType = nil },
+	},
+	{
+		name:   "region",
+		active: func(p *models.RecipesFinderParams) bool { return len(p.Region) > 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.Region = nil },
+	},
+	{
+		name:   "saved_exclusions",
+		active: func(p *models.RecipesFinderParams) bool { return len(p.SavedExclusions) > 0 },
+		relax:  func(p *models.RecipesFinderParams) { p.SavedExclusions = nil },
+	},
+}
+
+// RelaxToMinimum fetches recipes and, while fewer than recipeParams.RelaxToMinimum
+// are found, drops soft constraints one at a time. It returns the names of the
+// constraints that were relaxed.
+func RelaxToMinimum(ctx context.Context, recipeParams models.RecipesFinderParams, fetch RecipesFetcher) ([]repository.FilterRecipesByTagNamesAndParamsRow, []string, error) {
+	relaxed := []string{}
+
+	recipes, err := fetch(ctx, recipeParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, constraint := range softConstraints {
+		if len(recipes) >= int(recipeParams.RelaxToMinimum) {
+			break
+		}
+		if !constraint.active(&recipeParams) {
+			continue
+		}
+
+		constraint.relax(&recipeParams)
+		relaxed = append(relaxed, constraint.name)
+
+		recipes, err = fetch(ctx, recipeParams)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return recipes, relaxed, nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Weights of the relevance signals: summed user tag weights, average rating
+// (0 to 5), popularity (log of favorites), recency (1 for a new recipe, half
+// at 30 days) and the share of ingredients in the user's pantry. The defaults
+// rank by tags alone, like before the weights were added.
+var (
+	RelevanceWeightTags        = config.Float("RELEVANCE_WEIGHT_TAGS", 1)
+	RelevanceWeightRating      = config.Float("RELEVANCE_WEIGHT_RATING", 0)
+	RelevanceWeightPopularity  = config.Float("RELEVANCE_WEIGHT_POPULARITY", 0)
+	RelevanceWeightRecency     = config.Float("RELEVANCE_WEIGHT_RECENCY", 0)
+	RelevanceWeightIngredients = config.Float("RELEVANCE_WEIGHT_INGREDIENTS", 0)
+)
+
+// RelevanceWeights blends the signals recommendations and the relevance
+// search sort rank by. They only order recipes; allergens and diets filter
+// them before.
+type RelevanceWeights struct {
+	Tags        float64
+	Rating      float64
+	Popularity  float64
+	Recency     float64
+	Ingredients float64
+}
+
+var DefaultRelevanceWeights = RelevanceWeights{Tags: 1}
+
+// NewRelevanceWeights returns the configured weights, or the defaults when
+// they aren't valid.
+func NewRelevanceWeights() RelevanceWeights {
+	weights := RelevanceWeights{
+		Tags:        RelevanceWeightTags,
+		Rating:      RelevanceWeightRating,
+		Popularity:  RelevanceWeightPopularity,
+		Recency:     RelevanceWeightRecency,
+		Ingredients: RelevanceWeightIngredients,
+	}
+	if err := weights.Validate(); err != nil {
+		log.Println("invalid relevance weights, using the defaults:", err)
+		return DefaultRelevanceWeights
+	}
+	return weights
+}
+
+func (w RelevanceWeights) Validate() error {
+	total := 0.0
+	for _, weight := range w.Array() {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return errors.New("relevance weights must be non-negative numbers")
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("at least one relevance weight must be positive")
+	}
+	return nil
+}
+
+// Array lists the weights in the order the relevance sort reads them.
+func (w RelevanceWeights) Array() []float64 {
+	return []float64{w.Tags, w.Rating, w.Popularity, w.Recency, w.Ingredients}
+}
+
+// RelevanceSignals are what a recipe's relevance is computed from.
+type RelevanceSignals struct {
+	Tags        float64
+	Rating      float64
+	Popularity  float64
+	Recency     float64
+	Ingredients float64
+}
+
+func (w RelevanceWeights) Score(s RelevanceSignals) float64 {
+	return w.Tags*s.Tags + w.Rating*s.Rating + w.Popularity*s.Popularity +
+		w.Recency*s.Recency + w.Ingredients*s.Ingredients
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// The share of its weight a recipe shown just now keeps; it climbs back to
+// the full weight over the repeat window.
+const recentPickFloor = 0.05
+
+// AliasSampler draws indexes in proportion to their weights in constant time,
+// using Vose's alias method.
+type AliasSampler struct {
+	index []int // positions in the weights the table covers
+	prob  []float64
+	alias []int
+}
+
+// NewAliasSampler builds a sampler over weights. Entries that aren't positive
+// are never drawn; nil is returned when none is.
+func NewAliasSampler(weights []float64) *AliasSampler {
+	var index []int
+	total := 0.0
+	for i, weight := range weights {
+		if weight > 0 {
+			index = append(index, i)
+			total += weight
+		}
+	}
+	if len(index) == 0 {
+		return nil
+	}
+
+	n := len(index)
+	s := &AliasSampler{index: index, prob: make([]float64, n), alias: make([]int, n)}
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, at := range index {
+		scaled[i] = weights[at] * float64(n) / total
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		less := small[len(small)-1]
+		small = small[:len(small)-1]
+		more := large[len(large)-1]
+		large = large[:len(large)-1]
+
+		s.prob[less] = scaled[less]
+		s.alias[less] = more
+		scaled[more] += scaled[less] - 1
+		if scaled[more] < 1 {
+			small = append(small, more)
+		} else {
+			large = append(large, more)
+		}
+	}
+	// What's left is 1 but for rounding.
+	for _, i := range append(small, large...) {
+		s.prob[i] = 1
+		s.alias[i] = i
+	}
+	return s
+}
+
+// Draw returns an index into the weights the sampler was built from.
+func (s *AliasSampler) Draw(rng *rand.Rand) int {
+	i := rng.IntN(len(s.prob))
+	if rng.Float64() < s.prob[i] {
+		return s.index[i]
+	}
+	return s.index[s.alias[i]]
+}
+
+// SurpriseWeights weighs each candidate by how well it matches the user's
+// tags, 1 plus the weights of the tags it has, and scales that down for
+// recipes in recent, which maps recipe ids to when they were last shown: one
+// shown just now keeps recentPickFloor of it, one shown a whole window ago
+// all of it. recent is ignored when window is 0 or less.
+func SurpriseWeights(candidates []repository.ListSurpriseCandidatesRow, tagWeights map[int32]int32, recent map[int32]time.Time, now time.Time, window time.Duration) []float64 {
+	weights := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		score := 1.0
+		for _, tagID := range candidate.TagIds {
+			score += float64(tagWeights[tagID])
+		}
+
+		if shown, ok := recent[candidate.ID]; ok && window > 0 {
+			score *= min(max(float64(now.Sub(shown))/float64(window), recentPickFloor), 1)
+		}
+		weights[i] = score
+	}
+	return weights
+}
+
+// DayRand returns a random source seeded by the day and username, so a user's
+// draws repeat within a day and differ from other users' and days'.
+func DayRand(day time.Time, username string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(username))
+	return rand.New(rand.NewPCG(uint64(day.Unix()), h.Sum64()))
+}
@@ -2,63 +2,208 @@ package services
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
 	"github.com/miloszbo/meals-finder/internal/models"
 	repository "github.com/miloszbo/meals-finder/internal/repositories"
 )
 
+// Reject new recipes with implausible nutrition instead of only warning.
+var StrictNutrition = config.Bool("STRICT_NUTRITION", false)
+
+// Most ingredients one recipe may list; 0 means no limit.
+var MaxIngredientsPerMeal = config.Int("MAX_INGREDIENTS_PER_MEAL", 50)
+
+// How long until a review counts half as much towards a recipe's recent
+// rating, which the recent_rating sort orders by.
+var RatingHalfLife = config.Duration("RATING_HALF_LIFE", defaultRatingHalfLife)
+
+const defaultRatingHalfLife = 90 * 24 * time.Hour
+
 type FinderService interface {
 	FindRecipe(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error)
-	GetRecipe(ctx context.Context, id int32) (repository.Recipe, error)
+	GetRecipe(ctx context.Context, id int32, username string, servings int32) (repository.Recipe, error)
 	GetTags(ctx context.Context) ([]repository.GetAllTagsRow, error)
 	CreateRecipe(ctx context.Context, recipe *models.RecipeAdd, username string) error
+	FindRecipeRelaxed(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, []string, error)
+	RecipeOfTheDay(ctx context.Context, username string) (repository.Recipe, error)
+	SurpriseRecipe(ctx context.Context, username string, filters *models.RecipesFinderParams) (repository.Recipe, error)
+	RecommendRecipes(ctx context.Context, username string, limit int32) ([]models.RecommendedRecipe, error)
+	ExplainRecipes(ctx context.Context, params models.RecipesFinderParams, recipes []repository.FilterRecipesByTagNamesAndParamsRow) ([]models.ExplainedRecipe, error)
+	TrendingMeals(ctx context.Context, username string, window time.Duration, limit int32) ([]models.Meal, error)
+	CompareMeals(ctx context.Context, mealIDs []int64) (models.MealComparison, error)
+	TransformMealForDiet(ctx context.Context, mealID int64, diet string) (models.MealDetail, error)
+	BatchCook(ctx context.Context, mealID int64, days int) (models.BatchCookPlan, error)
+	ListRecipes(ctx context.Context, query models.ListQuery) ([]repository.ListRecipesRow, error)
+	SearchMealsStream(ctx context.Context, recipeParams models.RecipesFinderParams, w io.Writer) (int, error)
+	ExplainSearch(ctx context.Context, recipeParams models.RecipesFinderParams) (models.SearchPlan, error)
+	SetRecipeImage(ctx context.Context, id int32, username string, req *models.RecipeImageRequest) (models.RecipeImage, error)
 }
 
 type BaseFinderService struct {
 	DbConn *pgx.Conn
 	Repo   *repository.Queries
+	// Cache, when set, serves recipe details; Invalidator is then told about
+	// every recipe change.
+	Cache       *RecipeCache
+	Invalidator RecipeInvalidator
+	// Trending, when set, keeps trending rankings between refreshes.
+	Trending *TrendingCache
+	// How long shown recipes are held back from recommendations.
+	RepeatWindow time.Duration
+	// FetchPool, when set, lets recommendations fetch their inputs in
+	// parallel.
+	FetchPool *QueriesPool
+	// Reject recipes with nutrition warnings; see RecipeAdd.NutritionWarnings.
+	StrictNutrition bool
+	// Most ingredients a new recipe may list; 0 means no limit.
+	MaxIngredients int
+	// How recommendations and the relevance sort weigh their signals.
+	Relevance RelevanceWeights
+	// Half-life of reviews in recent ratings; 0 means 90 days.
+	RatingHalfLife time.Duration
+	// Inventory, when set, is the grocery provider searches can rank by
+	// ingredient availability with.
+	Inventory ProviderInventory
+	// How long a streamed search may run; 0 means no limit.
+	StreamTimeout time.Duration
+	// StreamPool, when set, holds the connections streamed searches read on.
+	StreamPool *QueriesPool
+	// Placeholders, when set, computes placeholders for confirmed images.
+	Placeholders *ImagePlaceholders
 }
 
 func NewBaseFinderService(conn *pgx.Conn) BaseFinderService {
 	return BaseFinderService{
-		DbConn: conn,
-		Repo:   repository.New(conn),
+		DbConn:          conn,
+		Repo:            repository.New(conn),
+		RepeatWindow:    RecommendationRepeatWindow,
+		StrictNutrition: StrictNutrition,
+		MaxIngredients:  MaxIngredientsPerMeal,
+		Relevance:       NewRelevanceWeights(),
+		RatingHalfLife:  RatingHalfLife,
+		StreamTimeout:   SearchStreamTimeout,
+		Placeholders:    NewImagePlaceholders(),
 	}
 }
 
 func (b *BaseFinderService) CreateRecipe(ctx context.Context, recipe *models.RecipeAdd, username string) error {
+	if recipe == nil {
+		return ErrValidation
+	}
+	if recipe.SourceURL != nil && !models.ValidSourceURL(*recipe.SourceURL) {
+		return ErrValidation
+	}
+	if !models.ValidEquipment(recipe.Equipment) || !models.ValidFlags(recipe.Flags) {
+		return ErrValidation
+	}
+	if recipe.Time < 0 || recipe.CookTime < 0 || recipe.StorageDays < 0 {
+		return ErrValidation
+	}
+	ingredients, err := recipe.Ingredients.Normalize(b.MaxIngredients)
+	if err != nil {
+		return ErrValidation
+	}
+	recipe.Ingredients = ingredients
+	if b.StrictNutrition {
+		if warnings := recipe.NutritionWarnings(); len(warnings) > 0 {
+			return &NutritionError{Warnings: warnings}
+		}
+	}
+
+	if !recipe.Force {
+		duplicates, err := b.findDuplicates(ctx, recipe)
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return &DuplicateRecipeError{Duplicates: duplicates}
+		}
+	}
+
 	id, err := b.Repo.CreateRecipe(ctx, repository.CreateRecipeParams{
-		Name:        recipe.Name,
-		Recipe:      recipe.Recipe,
-		Ingredients: recipe.Ingredients,
-		Time:        recipe.Time,
-		Difficulty:  recipe.Difficulty,
-		Username:    username,
+		Name:          recipe.Name,
+		Recipe:        recipe.Recipe,
+		Ingredients:   recipe.Ingredients,
+		Time:          recipe.Time,
+		Difficulty:    recipe.Difficulty,
+		Username:      username,
+		Calories:      recipe.Calories,
+		Protein:       recipe.Protein,
+		Carbs:         recipe.Carbs,
+		Fat:           recipe.Fat,
+		Servings:      max(recipe.Servings, 1),
+		SourceUrl:     recipe.SourceURL,
+		Equipment:     models.NormalizeEquipment(recipe.Equipment),
+		Flags:         models.NormalizeFlags(recipe.Flags),
+		CookTime:      recipe.CookTime,
+		BatchFriendly: recipe.BatchFriendly,
+		StorageDays:   recipe.StorageDays,
 	})
 
 	if err != nil {
 		log.Println(err.Error())
-		return err
+		return ErrInternalFailure
+	}
+
+	if err := addRecipeTags(ctx, b.Repo, id, recipe.Tags); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	b.invalidateRecipe(ctx, id)
+	return nil
+}
+
+// invalidateRecipe drops cached copies of a changed recipe. A failed broadcast
+// is only logged; other instances then catch up when their entry expires.
+func (b *BaseFinderService) invalidateRecipe(ctx context.Context, id int32) {
+	if b.Invalidator == nil {
+		return
+	}
+	if err := b.Invalidator.InvalidateRecipe(ctx, id); err != nil {
+		log.Println("recipe invalidation failed:", err)
+	}
+}
+
+func (b *BaseFinderService) recipeWithId(ctx context.Context, id int32) (repository.Recipe, error) {
+	if b.Cache != nil {
+		if recipe, ok := b.Cache.Get(ctx, id); ok {
+			return recipe, nil
+		}
 	}
 
-	for _, tag := range recipe.Tags {
-		tagId, err := b.Repo.GetTagId(ctx, repository.GetTagIdParams{
+	recipe, err := b.Repo.GetRecipeWithId(ctx, id)
+	if err != nil {
+		return repository.Recipe{}, err
+	}
+	if b.Cache != nil {
+		b.Cache.Put(ctx, recipe)
+	}
+	return recipe, nil
+}
+
+func addRecipeTags(ctx context.Context, q *repository.Queries, recipeID int32, tags []models.RecipeTags) error {
+	for _, tag := range tags {
+		tagId, err := q.GetTagId(ctx, repository.GetTagIdParams{
 			Key:   tag.TagType,
 			Value: tag.Name,
 		})
 		if err != nil {
-			log.Println(err.Error())
 			return err
 		}
-		err = b.Repo.AddTagsForRecipe(ctx, repository.AddTagsForRecipeParams{
+		err = q.AddTagsForRecipe(ctx, repository.AddTagsForRecipeParams{
 			TagID:    tagId,
-			RecipeID: id,
+			RecipeID: recipeID,
 		})
-
 		if err != nil {
-			log.Println(err.Error())
 			return err
 		}
 	}
@@ -71,38 +216,321 @@ func (b *BaseFinderService) GetTags(ctx context.Context) ([]repository.GetAllTag
 	return tags, err
 }
 
-func (b *BaseFinderService) GetRecipe(ctx context.Context, id int32) (repository.Recipe, error) {
-	recipe, err := b.Repo.GetRecipeWithId(ctx, id)
+// GetRecipe returns the recipe scaled to servings. With servings 0 the user's
+// default servings are used, falling back to the recipe's own.
+func (b *BaseFinderService) GetRecipe(ctx context.Context, id int32, username string, servings int32) (repository.Recipe, error) {
+	if servings < 0 {
+		return repository.Recipe{}, ErrValidation
+	}
+
+	recipe, err := b.recipeWithId(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Recipe{}, ErrNoRecipesFound
+	}
 	if err != nil {
+		log.Println(err.Error())
+		return repository.Recipe{}, ErrInternalFailure
+	}
 
+	if servings == 0 && username != "" {
+		defaultServings, err := b.Repo.GetUserDefaultServings(ctx, username)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Println(err.Error())
+			return repository.Recipe{}, ErrInternalFailure
+		}
+		if defaultServings != nil {
+			servings = *defaultServings
+		}
 	}
 
-	return recipe, nil
+	return ScaleRecipe(recipe, servings), nil
+}
+
+// ScaleRecipe scales ingredient amounts from the recipe's servings to the given
+// ones. Nutrition is stored per serving and stays as is. Amounts are rounded
+// but never drop to zero.
+func ScaleRecipe(recipe repository.Recipe, servings int32) repository.Recipe {
+	base := recipe.Servings
+	if base <= 0 {
+		base = 1
+	}
+	if servings <= 0 || servings == base {
+		return recipe
+	}
+
+	ingredients := make([]models.Ingredient, len(recipe.Ingredients.Ingredients))
+	for i, ingredient := range recipe.Ingredients.Ingredients {
+		scaled := (int64(ingredient.Amount)*int64(servings) + int64(base)/2) / int64(base)
+		if scaled == 0 && ingredient.Amount > 0 {
+			scaled = 1
+		}
+		ingredient.Amount = int32(scaled)
+		ingredients[i] = ingredient
+	}
+
+	recipe.Ingredients = models.IngredientsJson{Ingredients: ingredients}
+	recipe.Servings = servings
+	return recipe
 }
 
 func (b *BaseFinderService) FindRecipe(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error) {
-	recipes, _ := b.Repo.FilterRecipesByTagNamesAndParams(ctx, repository.FilterRecipesByTagNamesAndParamsParams{
-		Diet:          recipeParams.Diet,
-		Region:        recipeParams.Region,
-		RecipeType:    recipeParams.RecipeType,
-		Allergies:     recipeParams.Allergies,
-		Nutrients:     recipeParams.Nutrients,
-		Others:        recipeParams.Others,
-		MinTime:       recipeParams.MinTime,
-		MaxTime:       recipeParams.MaxTime,
-		MinDifficulty: recipeParams.MinDifficulty,
-		MaxDifficulty: recipeParams.MaxDifficulty,
-		RecipesOffset: recipeParams.Offset,
-		RecipesLimit:  recipeParams.Limit,
-		Username:      recipeParams.Username,
-	})
+	if err := recipeParams.Validate(); err != nil {
+		return nil, ErrValidation
+	}
+	if recipeParams.ByAvailability() && b.Inventory == nil {
+		return nil, ErrInventoryUnavailable
+	}
+
+	if err := b.loadSavedExclusions(ctx, &recipeParams); err != nil {
+		return nil, err
+	}
+	if err := b.loadSavedEquipment(ctx, &recipeParams); err != nil {
+		return nil, err
+	}
+
+	recipes, err := b.filterRecipes(ctx, recipeParams)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	if recipeParams.ByAvailability() {
+		return b.rankByAvailability(ctx, recipes, recipeParams.MinAvailability)
+	}
+	return recipes, nil
+}
+
+// ExplainSearch runs the search recipeParams describe under EXPLAIN ANALYZE,
+// with the same query and parameters FindRecipe would use. It's for admins
+// looking into slow searches; the plan shows table and index names.
+func (b *BaseFinderService) ExplainSearch(ctx context.Context, recipeParams models.RecipesFinderParams) (models.SearchPlan, error) {
+	if err := recipeParams.Validate(); err != nil {
+		return models.SearchPlan{}, ErrValidation
+	}
+	if err := b.loadSavedExclusions(ctx, &recipeParams); err != nil {
+		return models.SearchPlan{}, err
+	}
+	if err := b.loadSavedEquipment(ctx, &recipeParams); err != nil {
+		return models.SearchPlan{}, err
+	}
+
+	plan, err := b.Repo.ExplainFilterRecipesByTagNamesAndParams(ctx, b.filterParams(recipeParams))
+	if err != nil {
+		log.Println(err.Error())
+		return models.SearchPlan{}, ErrInternalFailure
+	}
+	return models.SearchPlan{Plan: plan}, nil
+}
+
+func (b *BaseFinderService) FindRecipeRelaxed(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, []string, error) {
+	if err := recipeParams.Validate(); err != nil {
+		return nil, nil, ErrValidation
+	}
+	if recipeParams.ByAvailability() && b.Inventory == nil {
+		return nil, nil, ErrInventoryUnavailable
+	}
+
+	if err := b.loadSavedExclusions(ctx, &recipeParams); err != nil {
+		return nil, nil, err
+	}
+	if err := b.loadSavedEquipment(ctx, &recipeParams); err != nil {
+		return nil, nil, err
+	}
 
+	recipes, relaxed, err := RelaxToMinimum(ctx, recipeParams, b.filterRecipes)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, nil, ErrInternalFailure
+	}
+
+	if recipeParams.ByAvailability() {
+		if recipes, err = b.rankByAvailability(ctx, recipes, recipeParams.MinAvailability); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return recipes, relaxed, nil
+}
+
+// ListRecipes lists recipes by the generic filters of RecipeListSpec.
+func (b *BaseFinderService) ListRecipes(ctx context.Context, query models.ListQuery) ([]repository.ListRecipesRow, error) {
+	recipes, err := b.Repo.ListRecipes(ctx, query)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
 	return recipes, nil
 }
 
+func (b *BaseFinderService) filterRecipes(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error) {
+	return b.Repo.FilterRecipesByTagNamesAndParams(ctx, b.filterParams(recipeParams))
+}
+
+// filterParams turns search params into the search query's.
+func (b *BaseFinderService) filterParams(recipeParams models.RecipesFinderParams) repository.FilterRecipesByTagNamesAndParamsParams {
+	requiredFlags, excludedFlags := recipeParams.FlagFilters()
+	halfLife := b.RatingHalfLife
+	if halfLife <= 0 {
+		halfLife = defaultRatingHalfLife
+	}
+	return repository.FilterRecipesByTagNamesAndParamsParams{
+		RatingHalfLife:     halfLife.Seconds(),
+		Diet:               recipeParams.Diet,
+		Region:             recipeParams.Region,
+		RecipeType:         recipeParams.RecipeType,
+		Allergies:          recipeParams.Allergies,
+		Nutrients:          recipeParams.Nutrients,
+		Others:             recipeParams.Others,
+		MinTime:            recipeParams.MinTime,
+		MaxTime:            recipeParams.MaxTime,
+		MaxTotalTime:       recipeParams.MaxTotalTime,
+		MinDifficulty:      recipeParams.MinDifficulty,
+		MaxDifficulty:      recipeParams.MaxDifficulty,
+		ExcludeFavorited:   recipeParams.ExcludeFavorited,
+		ExcludeMade:        recipeParams.ExcludeMade,
+		ExcludeIngredients: MergeExclusions(recipeParams.ExcludeIngredients, recipeParams.SavedExclusions),
+		SourceKind:         recipeParams.SourceKind,
+		NameQuery:          models.EscapeLike(strings.TrimSpace(recipeParams.NameQuery)),
+		AvailableEquipment: availableEquipment(recipeParams.AvailableEquipment),
+		RequiredFlags:      requiredFlags,
+		ExcludedFlags:      excludedFlags,
+		SortBy:             recipeParams.SortBy,
+		RelevanceWeights:   b.Relevance.Array(),
+		RecipesOffset:      recipeParams.Offset,
+		RecipesLimit:       recipeParams.Limit,
+		Username:           recipeParams.Username,
+	}
+}
+
+// loadSavedExclusions fills in the user's saved excluded ingredients unless
+// the search opted out of them.
+func (b *BaseFinderService) loadSavedExclusions(ctx context.Context, recipeParams *models.RecipesFinderParams) error {
+	if recipeParams.Username == "" || recipeParams.IgnoreSavedExclusions {
+		recipeParams.SavedExclusions = nil
+		return nil
+	}
+
+	saved, err := b.Repo.ListExcludedIngredients(ctx, recipeParams.Username)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	recipeParams.SavedExclusions = saved
+	return nil
+}
+
+// loadSavedEquipment applies the user's equipment when the search didn't name
+// any.
+func (b *BaseFinderService) loadSavedEquipment(ctx context.Context, recipeParams *models.RecipesFinderParams) error {
+	if recipeParams.Username == "" || recipeParams.AvailableEquipment != nil {
+		return nil
+	}
+
+	saved, err := b.Repo.GetUserEquipment(ctx, recipeParams.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	recipeParams.AvailableEquipment = models.NormalizeEquipment(saved)
+	return nil
+}
+
+// availableEquipment is the equipment filter as the search query takes it:
+// NULL, from a nil list, doesn't filter; an empty array allows only recipes
+// that need nothing.
+func availableEquipment(items []string) []string {
+	if items == nil {
+		return nil
+	}
+	return models.NormalizeEquipment(items)
+}
+
+// MergeExclusions combines excluded ingredient lists into the lowercase,
+// deduplicated form the search query matches on. It returns nil when there's
+// nothing to exclude.
+func MergeExclusions(lists ...[]string) []string {
+	var merged []string
+	for _, list := range lists {
+		for _, name := range list {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(merged, name) {
+				merged = append(merged, name)
+			}
+		}
+	}
+	return merged
+}
+
 type MockFinderService struct{}
 
 func (m *MockFinderService) FindRecipe(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error) {
 	log.Println(recipeParams)
 	return nil, nil
 }
+
+func (m *MockFinderService) GetRecipe(ctx context.Context, id int32, username string, servings int32) (repository.Recipe, error) {
+	return repository.Recipe{ID: id}, nil
+}
+
+func (m *MockFinderService) GetTags(ctx context.Context) ([]repository.GetAllTagsRow, error) {
+	return nil, nil
+}
+
+func (m *MockFinderService) CreateRecipe(ctx context.Context, recipe *models.RecipeAdd, username string) error {
+	return nil
+}
+
+func (m *MockFinderService) FindRecipeRelaxed(ctx context.Context, recipeParams models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, []string, error) {
+	return nil, nil, nil
+}
+
+func (m *MockFinderService) RecipeOfTheDay(ctx context.Context, username string) (repository.Recipe, error) {
+	return repository.Recipe{}, nil
+}
+
+func (m *MockFinderService) SurpriseRecipe(ctx context.Context, username string, filters *models.RecipesFinderParams) (repository.Recipe, error) {
+	return repository.Recipe{}, nil
+}
+
+func (m *MockFinderService) RecommendRecipes(ctx context.Context, username string, limit int32) ([]models.RecommendedRecipe, error) {
+	return nil, nil
+}
+
+func (m *MockFinderService) ExplainRecipes(ctx context.Context, params models.RecipesFinderParams, recipes []repository.FilterRecipesByTagNamesAndParamsRow) ([]models.ExplainedRecipe, error) {
+	return nil, nil
+}
+
+func (m *MockFinderService) ExplainSearch(ctx context.Context, recipeParams models.RecipesFinderParams) (models.SearchPlan, error) {
+	return models.SearchPlan{Plan: "Limit  (cost=0.00..1.00 rows=1 width=64) (actual time=0.010..0.010 rows=0 loops=1)"}, nil
+}
+
+func (m *MockFinderService) TrendingMeals(ctx context.Context, username string, window time.Duration, limit int32) ([]models.Meal, error) {
+	return nil, nil
+}
+
+func (m *MockFinderService) CompareMeals(ctx context.Context, mealIDs []int64) (models.MealComparison, error) {
+	return models.MealComparison{}, nil
+}
+
+func (m *MockFinderService) TransformMealForDiet(ctx context.Context, mealID int64, diet string) (models.MealDetail, error) {
+	return models.MealDetail{ID: int32(mealID), Diet: diet, Swaps: []models.IngredientSwap{}}, nil
+}
+
+func (m *MockFinderService) ListRecipes(ctx context.Context, query models.ListQuery) ([]repository.ListRecipesRow, error) {
+	return []repository.ListRecipesRow{}, nil
+}
+
+func (m *MockFinderService) SearchMealsStream(ctx context.Context, recipeParams models.RecipesFinderParams, w io.Writer) (int, error) {
+	return 0, nil
+}
+
+func (m *MockFinderService) SetRecipeImage(ctx context.Context, id int32, username string, req *models.RecipeImageRequest) (models.RecipeImage, error) {
+	return models.RecipeImage{}, nil
+}
+
+func (m *MockFinderService) BatchCook(ctx context.Context, mealID int64, days int) (models.BatchCookPlan, error) {
+	return models.BatchCookPlan{}, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How long a streamed search may run before it's cut off. Meals written by
+// then are kept; 0 or less means no limit beyond the request's own.
+var SearchStreamTimeout = config.Duration("SEARCH_STREAM_TIMEOUT", 30*time.Second)
+
+// Connections opened for streamed searches, which hold theirs while the
+// client reads. 0 reads each search whole on the request connection before
+// writing it.
+var SearchStreamConns = config.Int("SEARCH_STREAM_CONNECTIONS", 2)
+
+// RecipesStreamer runs a search and hands each meal to yield as it's read.
+type RecipesStreamer func(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams, yield func(repository.FilterRecipesByTagNamesAndParamsRow) error) error
+
+// StreamRecipes writes the meals stream finds to w as NDJSON, one meal per
+// line and per Write, and returns how many it wrote. It stops as soon as ctx
+// is done, returning ctx's error; the lines written by then stay valid. A
+// deadline passing before the first meal is ErrSearchTimeout, as there's no
+// partial result to keep.
+func StreamRecipes(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams, stream RecipesStreamer, w io.Writer) (int, error) {
+	written := 0
+	err := stream(ctx, params, func(recipe repository.FilterRecipesByTagNamesAndParamsRow) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := json.Marshal(recipe)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if written == 0 && errors.Is(ctxErr, context.DeadlineExceeded) {
+			return 0, ErrSearchTimeout
+		}
+		return written, ctxErr
+	}
+	return written, err
+}
+
+// bufferedStreamer reads the whole search with fetch, which the search limit
+// keeps bounded, before handing its meals to yield, so the connection isn't
+// held while they're written.
+func bufferedStreamer(fetch func(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error)) RecipesStreamer {
+	return func(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams, yield func(repository.FilterRecipesByTagNamesAndParamsRow) error) error {
+		recipes, err := fetch(ctx, params)
+		if err != nil {
+			return err
+		}
+		for _, recipe := range recipes {
+			if err := yield(recipe); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SearchMealsStream is FindRecipe writing meals to w as they're read, so
+// clients see the first ones before the search ends. Ranking by availability
+// needs every meal first and isn't supported. Errors before the first meal is
+// written are the same as FindRecipe's; after it, w holds a valid partial
+// result. Meals are read on a connection from StreamPool, so an aborted
+// stream only costs that one; without a pool the search is read whole first.
+func (b *BaseFinderService) SearchMealsStream(ctx context.Context, recipeParams models.RecipesFinderParams, w io.Writer) (int, error) {
+	if err := recipeParams.Validate(); err != nil {
+		return 0, ErrValidation
+	}
+	if recipeParams.ByAvailability() {
+		return 0, ErrValidation
+	}
+
+	if err := b.loadSavedExclusions(ctx, &recipeParams); err != nil {
+		return 0, err
+	}
+	if err := b.loadSavedEquipment(ctx, &recipeParams); err != nil {
+		return 0, err
+	}
+
+	if b.StreamTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.StreamTimeout)
+		defer cancel()
+	}
+
+	stream := bufferedStreamer(b.Repo.FilterRecipesByTagNamesAndParams)
+	if b.StreamPool != nil {
+		repo, err := b.StreamPool.Acquire(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return 0, ErrSearchTimeout
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer b.StreamPool.Release(repo)
+		stream = repo.StreamFilterRecipesByTagNamesAndParams
+	}
+
+	written, err := StreamRecipes(ctx, b.filterParams(recipeParams), stream, w)
+	if err != nil && err != ErrSearchTimeout && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		log.Println(err.Error())
+		return written, ErrInternalFailure
+	}
+	return written, err
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Ingredients each diet rules out, by lowercase name. Vegan rules out
+// everything vegetarian does too.
+var (
+	nonVegetarianIngredients = []string{
+		"kurczak", "pierś z kurczaka", "indyk", "wołowina", "wieprzowina", "mięso mielone",
+		"boczek", "szynka", "kiełbasa", "łosoś", "tuńczyk", "dorsz", "krewetki", "żelatyna",
+	}
+	nonVeganIngredients = []string{
+		"mleko", "masło", "śmietana", "śmietanka", "jogurt", "jogurt naturalny", "twaróg",
+		"ser", "ser żółty", "mozzarella", "parmezan", "jajko", "jajka", "miód",
+	}
+)
+
+type substitute struct {
+	name  string
+	ratio float64 // substitute amount per unit of the original
+}
+
+// Substitutes by lowercase ingredient name. They're all vegan, so they suit
+// every diet.
+var ingredientSubstitutes = map[string]substitute{
+	"żelatyna":         {"agar", 0.5},
+	"mleko":            {"napój owsiany", 1},
+	"masło":            {"margaryna roślinna", 1},
+	"śmietana":         {"śmietanka kokosowa", 1},
+	"śmietanka":        {"śmietanka kokosowa", 1},
+	"jogurt":           {"jogurt sojowy", 1},
+	"jogurt naturalny": {"jogurt sojowy", 1},
+	"twaróg":           {"tofu", 1},
+	"ser":              {"ser wegański", 1},
+	"ser żółty":        {"ser wegański", 1},
+	"mozzarella":       {"ser wegański", 1},
+	"miód":             {"syrop klonowy", 1},
+}
+
+// Nutrition per 100 g or ml of the substituted ingredients and their
+// substitutes: kcal and grams of protein, carbs and fat.
+var ingredientNutrition = map[string][4]float64{
+	"żelatyna":           {335, 85, 0, 0},
+	"agar":               {26, 0.5, 7, 0},
+	"mleko":              {64, 3.4, 4.8, 3.6},
+	"napój owsiany":      {45, 1, 6.5, 1.5},
+	"masło":              {740, 0.7, 0.7, 82},
+	"margaryna roślinna": {720, 0.2, 0.7, 80},
+	"śmietana":           {190, 2.5, 3.6, 18},
+	"śmietanka":          {190, 2.5, 3.6, 18},
+	"śmietanka kokosowa": {200, 2, 3, 20},
+	"jogurt":             {60, 4.3, 6, 2.5},
+	"jogurt naturalny":   {60, 4.3, 6, 2.5},
+	"jogurt sojowy":      {50, 4, 2, 2.3},
+	"twaróg":             {115, 18, 3.5, 4},
+	"tofu":               {120, 13, 2, 7},
+	"ser":                {350, 26, 0, 27},
+	"ser żółty":          {350, 26, 0, 27},
+	"mozzarella":         {250, 18, 2, 19},
+	"ser wegański":       {300, 1, 20, 24},
+	"miód":               {320, 0.3, 80, 0},
+	"syrop klonowy":      {260, 0, 67, 0},
+}
+
+func restrictedIngredients(diet string) map[string]bool {
+	restricted := make(map[string]bool)
+	for _, name := range nonVegetarianIngredients {
+		restricted[name] = true
+	}
+	if diet == models.DietVegan {
+		for _, name := range nonVeganIngredients {
+			restricted[name] = true
+		}
+	}
+	return restricted
+}
+
+// TransformMealForDiet returns a variant of the meal with the ingredients the
+// diet rules out swapped for substitutes. It's a SubstitutionError when some
+// have none. The variant isn't stored.
+func (b *BaseFinderService) TransformMealForDiet(ctx context.Context, mealID int64, diet string) (models.MealDetail, error) {
+	if mealID <= 0 || mealID > math.MaxInt32 || !models.ValidDiet(diet) {
+		return models.MealDetail{}, ErrValidation
+	}
+
+	recipe, err := b.recipeWithId(ctx, int32(mealID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.MealDetail{}, ErrNoRecipesFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.MealDetail{}, ErrInternalFailure
+	}
+
+	return TransformForDiet(recipe, diet)
+}
+
+// TransformForDiet swaps the recipe's ingredients for the diet and adjusts
+// its per-serving nutrition by the difference. Nutrition becomes unknown when
+// a swapped amount isn't in grams or millilitres.
+func TransformForDiet(recipe repository.Recipe, diet string) (models.MealDetail, error) {
+	restricted := restrictedIngredients(diet)
+
+	var missing []string
+	swaps := []models.IngredientSwap{}
+	ingredients := make([]models.Ingredient, 0, len(recipe.Ingredients.Ingredients))
+	var delta [4]float64
+	nutritionKnown := true
+	for _, ingredient := range recipe.Ingredients.Ingredients {
+		name := strings.ToLower(strings.TrimSpace(ingredient.Name))
+		if !restricted[name] {
+			ingredients = append(ingredients, ingredient)
+			continue
+		}
+		sub, ok := ingredientSubstitutes[name]
+		if !ok {
+			missing = append(missing, ingredient.Name)
+			continue
+		}
+
+		swapped := models.Ingredient{
+			Name:   sub.name,
+			Amount: max(int32(math.Round(float64(ingredient.Amount)*sub.ratio)), 1),
+			Unit:   ingredient.Unit,
+		}
+		ingredients = append(ingredients, swapped)
+		swaps = append(swaps, models.IngredientSwap{Original: ingredient, Substitute: swapped})
+
+		originalAmount, unit := NormalizeQuantity(ingredient.Amount, ingredient.Unit)
+		swappedAmount, _ := NormalizeQuantity(swapped.Amount, swapped.Unit)
+		if unit != "g" && unit != "ml" {
+			nutritionKnown = false
+			continue
+		}
+		original, swappedNutrition := ingredientNutrition[name], ingredientNutrition[sub.name]
+		for i := range delta {
+			delta[i] += (swappedNutrition[i]*float64(swappedAmount) - original[i]*float64(originalAmount)) / 100
+		}
+	}
+	if len(missing) > 0 {
+		return models.MealDetail{}, &SubstitutionError{Ingredients: missing}
+	}
+
+	servings := float64(max(recipe.Servings, 1))
+	adjust := func(value *int32, delta float64) *int32 {
+		if value == nil || !nutritionKnown {
+			return nil
+		}
+		adjusted := max(int32(math.Round(float64(*value)+delta/servings)), 0)
+		return &adjusted
+	}
+
+	return models.MealDetail{
+		ID:          recipe.ID,
+		Name:        recipe.Name,
+		Recipe:      recipe.Recipe,
+		Ingredients: models.IngredientsJson{Ingredients: ingredients},
+		Time:        recipe.Time,
+		CookTime:    recipe.CookTime,
+		Difficulty:  recipe.Difficulty,
+		Servings:    recipe.Servings,
+		Calories:    adjust(recipe.Calories, delta[0]),
+		Protein:     adjust(recipe.Protein, delta[1]),
+		Carbs:       adjust(recipe.Carbs, delta[2]),
+		Fat:         adjust(recipe.Fat, delta[3]),
+		Diet:        diet,
+		Swaps:       swaps,
+	}, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// UserLocation returns the location for an IANA timezone name, defaulting to UTC.
+func UserLocation(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// LocalDay returns midnight of the calendar day that now falls on in the given timezone.
+func LocalDay(now time.Time, timezone string) time.Time {
+	y, m, d := now.In(UserLocation(timezone)).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func (b *BaseFinderService) RecipeOfTheDay(ctx context.Context, username string) (repository.Recipe, error) {
+	timezone, err := b.Repo.GetUserTimezone(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return repository.Recipe{}, ErrInternalFailure
+	}
+
+	// The draw is seeded by the day and weighed as of its start, ignoring
+	// what was shown since, the day's own pick included, so it doesn't change
+	// between calls.
+	loc := UserLocation(timezone)
+	y, m, d := time.Now().In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	params := repository.ListSurpriseCandidatesParams{Username: username}
+	recipe, err := b.pickWeighted(ctx, params, DayRand(LocalDay(today, timezone), username), today)
+	if err != nil {
+		return repository.Recipe{}, err
+	}
+
+	if b.RepeatWindow > 0 {
+		if err := b.recordRecommendations(ctx, username, []int32{recipe.ID}, false); err != nil {
+			return repository.Recipe{}, err
+		}
+	}
+	return recipe, nil
+}
+
+// SurpriseRecipe returns a random recipe that is safe for the user's allergens
+// and matches their diet tags, favoring ones that match their tags and
+// haven't been shown lately. filters may narrow it down further.
+func (b *BaseFinderService) SurpriseRecipe(ctx context.Context, username string, filters *models.RecipesFinderParams) (repository.Recipe, error) {
+	params := repository.ListSurpriseCandidatesParams{Username: username}
+	if filters != nil {
+		params.MaxTime = filters.MaxTime
+		params.MaxDifficulty = filters.MaxDifficulty
+		params.RecipeType = filters.RecipeType
+		params.Allergies = filters.Allergies
+	}
+
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	recipe, err := b.pickWeighted(ctx, params, rng, time.Now())
+	if err != nil {
+		return repository.Recipe{}, err
+	}
+
+	if b.RepeatWindow > 0 {
+		if err := b.recordRecommendations(ctx, username, []int32{recipe.ID}, false); err != nil {
+			return repository.Recipe{}, err
+		}
+	}
+	return recipe, nil
+}
+
+// pickWeighted draws one of the candidates params selects with rng, weighed
+// by SurpriseWeights as of now. Recipes shown after now don't count as shown.
+func (b *BaseFinderService) pickWeighted(ctx context.Context, params repository.ListSurpriseCandidatesParams, rng *rand.Rand, now time.Time) (repository.Recipe, error) {
+	candidates, err := b.Repo.ListSurpriseCandidates(ctx, params)
+	if err != nil {
+		log.Println(err.Error())
+		return repository.Recipe{}, ErrInternalFailure
+	}
+	if len(candidates) == 0 {
+		return repository.Recipe{}, ErrNoRecipesFound
+	}
+
+	rows, err := b.Repo.GetUserTagWeights(ctx, params.Username)
+	if err != nil {
+		log.Println(err.Error())
+		return repository.Recipe{}, ErrInternalFailure
+	}
+	tagWeights := make(map[int32]int32, len(rows))
+	for _, row := range rows {
+		tagWeights[row.TagID] = row.Weight
+	}
+
+	var recent map[int32]time.Time
+	if b.RepeatWindow > 0 {
+		if recent, err = b.recentRecommendations(ctx, params.Username); err != nil {
+			return repository.Recipe{}, err
+		}
+		maps.DeleteFunc(recent, func(_ int32, shown time.Time) bool {
+			return !shown.Before(now)
+		})
+	}
+
+	sampler := NewAliasSampler(SurpriseWeights(candidates, tagWeights, recent, now, b.RepeatWindow))
+	recipe, err := b.recipeWithId(ctx, candidates[sampler.Draw(rng)].ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Recipe{}, ErrNoRecipesFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return repository.Recipe{}, ErrInternalFailure
+	}
+	return recipe, nil
+}
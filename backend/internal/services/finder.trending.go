@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+const (
+	DefaultTrendingWindow = 7 * 24 * time.Hour
+	DefaultTrendingLimit  = 20
+	MaxTrendingWindow     = 90 * 24 * time.Hour
+)
+
+// Number of most active recipes kept per window. Allergen filtering happens
+// on this pool, so it is larger than any single page.
+const trendingPoolSize = 200
+
+// How long a trending ranking is served before it's recomputed.
+var TrendingRefreshInterval = config.Duration("TRENDING_REFRESH_INTERVAL", 10*time.Minute)
+
+// TrendingCache keeps the ranking for each requested window until ttl passes.
+// The ranking is the same for everyone; per-user filtering is done on top.
+type TrendingCache struct {
+	ttl time.Duration
+	// Store holds the rankings, in memory unless replaced with a shared store.
+	Store Cache
+}
+
+func NewTrendingCache(ttl time.Duration) *TrendingCache {
+	return &TrendingCache{
+		ttl:   ttl,
+		Store: NewMemoryCache().Store("trending"),
+	}
+}
+
+// Get returns the cached ranking for window. A store that can't be read is
+// logged and treated as a miss.
+func (c *TrendingCache) Get(ctx context.Context, window time.Duration) ([]repository.GetTrendingRecipesRow, bool) {
+	raw, ok, err := c.Store.Get(ctx, trendingCacheKey(window))
+	if err != nil {
+		log.Println("trending cache get failed:", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	var rows []repository.GetTrendingRecipesRow
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		log.Println("bad cached trending ranking:", err)
+		return nil, false
+	}
+	return rows, true
+}
+
+func (c *TrendingCache) Put(ctx context.Context, window time.Duration, rows []repository.GetTrendingRecipesRow) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	raw, err := json.Marshal(rows)
+	if err == nil {
+		err = c.Store.Set(ctx, trendingCacheKey(window), raw, c.ttl)
+	}
+	if err != nil {
+		log.Println("trending cache set failed:", err)
+	}
+}
+
+func trendingCacheKey(window time.Duration) string {
+	return strconv.FormatInt(int64(window/time.Second), 10)
+}
+
+// TrendingMeals ranks recipes by favorites, reviews and cooked logs within the
+// last window only. Quiet windows return fewer than limit meals. When username
+// is set, recipes with the user's allergens are left out.
+func (b *BaseFinderService) TrendingMeals(ctx context.Context, username string, window time.Duration, limit int32) ([]models.Meal, error) {
+	if window == 0 {
+		window = DefaultTrendingWindow
+	}
+	if window < time.Second || window > MaxTrendingWindow {
+		return nil, ErrValidation
+	}
+	if limit <= 0 {
+		limit = DefaultTrendingLimit
+	}
+
+	rows, err := b.trendingRows(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	var allergens []int32
+	if username != "" {
+		allergens, err = b.Repo.GetUserAllergenTagIds(ctx, username)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, ErrInternalFailure
+		}
+	}
+
+	return FilterTrending(rows, allergens, limit), nil
+}
+
+func (b *BaseFinderService) trendingRows(ctx context.Context, window time.Duration) ([]repository.GetTrendingRecipesRow, error) {
+	if b.Trending != nil {
+		if rows, ok := b.Trending.Get(ctx, window); ok {
+			return rows, nil
+		}
+	}
+
+	rows, err := b.Repo.GetTrendingRecipes(ctx, repository.GetTrendingRecipesParams{
+		WindowSeconds: int32(window / time.Second),
+		PoolSize:      trendingPoolSize,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	if b.Trending != nil {
+		b.Trending.Put(ctx, window, rows)
+	}
+	return rows, nil
+}
+
+// FilterTrending keeps the ranking's order, drops recipes tagged with one of
+// allergens and stops after limit meals.
+func FilterTrending(rows []repository.GetTrendingRecipesRow, allergens []int32, limit int32) []models.Meal {
+	meals := make([]models.Meal, 0, min(len(rows), int(limit)))
+	for _, row := range rows {
+		if len(meals) == int(limit) {
+			break
+		}
+		if slices.ContainsFunc(row.AllergenTagIds, func(id int32) bool { return slices.Contains(allergens, id) }) {
+			continue
+		}
+		meals = append(meals, models.Meal{
+			ID:         row.ID,
+			Name:       row.Name,
+			Time:       row.Time,
+			Difficulty: row.Difficulty,
+			Activity:   row.Activity,
+		})
+	}
+	return meals
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How often meal images without a placeholder are retried.
+var ImageBackfillInterval = config.Duration("IMAGE_BACKFILL_INTERVAL", time.Hour)
+
+// Images looked up per query during a backfill.
+var imageBackfillBatchSize = config.Int("IMAGE_BACKFILL_BATCH_SIZE", 50)
+
+// SetRecipeImage confirms an uploaded image for the user's own recipe and
+// computes its placeholder. An image that can't be fetched yet is stored
+// without one, for the backfill job to retry; one that can't be decoded is
+// ErrInvalidImage and one outside the image storage ErrImageNotAllowed, and
+// neither is stored.
+func (b *BaseFinderService) SetRecipeImage(ctx context.Context, id int32, username string, req *models.RecipeImageRequest) (models.RecipeImage, error) {
+	if req == nil || req.Validate() != nil {
+		return models.RecipeImage{}, ErrValidation
+	}
+
+	recipe, err := b.Repo.GetRecipeWithId(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.RecipeImage{}, ErrNoRecipesFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.RecipeImage{}, ErrInternalFailure
+	}
+	if recipe.Username != username {
+		return models.RecipeImage{}, ErrForbidden
+	}
+
+	image := models.RecipeImage{URL: req.URL}
+	params := repository.SetRecipeImageParams{ImageUrl: req.URL, ID: id}
+	if b.Placeholders != nil {
+		placeholder, err := b.Placeholders.Compute(ctx, req.URL)
+		switch {
+		case errors.Is(err, ErrInvalidImage):
+			return models.RecipeImage{}, ErrInvalidImage
+		case errors.Is(err, ErrImageNotAllowed):
+			return models.RecipeImage{}, ErrImageNotAllowed
+		case err != nil:
+			log.Println("image placeholder left for backfill:", err)
+		default:
+			image.Placeholder = &placeholder
+			params.ImageBlurhash = &placeholder.BlurHash
+			params.ImageColor = &placeholder.Color
+		}
+	}
+
+	if _, err := b.Repo.SetRecipeImage(ctx, params); err != nil {
+		log.Println(err.Error())
+		return models.RecipeImage{}, ErrInternalFailure
+	}
+	b.invalidateRecipe(ctx, id)
+	return image, nil
+}
+
+type ImagePlaceholderJob struct {
+	Repo         *repository.Queries
+	Placeholders *ImagePlaceholders
+	BatchSize    int32
+}
+
+// NewImagePlaceholderJob expects a connection of its own, like
+// NewUserPurgeJob.
+func NewImagePlaceholderJob(conn *pgx.Conn) ImagePlaceholderJob {
+	return ImagePlaceholderJob{
+		Repo:         repository.New(conn),
+		Placeholders: NewImagePlaceholders(),
+		BatchSize:    int32(imageBackfillBatchSize),
+	}
+}
+
+// Backfill computes placeholders for meal images that have none, going
+// through them once in id order. Images that fail are logged and skipped
+// until the next run. Cached recipes pick the placeholder up once they
+// expire. It returns the number of placeholders stored.
+func (j *ImagePlaceholderJob) Backfill(ctx context.Context) (int, error) {
+	stored := 0
+	var afterID int32
+	for ctx.Err() == nil {
+		images, err := j.Repo.ListRecipesMissingImagePlaceholder(ctx, repository.ListRecipesMissingImagePlaceholderParams{
+			AfterID:   afterID,
+			BatchSize: j.BatchSize,
+		})
+		if err != nil {
+			log.Println("image placeholder backfill failed:", err)
+			return stored, ErrInternalFailure
+		}
+
+		for _, image := range images {
+			afterID = image.ID
+			placeholder, err := j.Placeholders.Compute(ctx, image.ImageUrl)
+			if err != nil {
+				log.Printf("image placeholder for recipe %d failed: %v", image.ID, err)
+				continue
+			}
+			updated, err := j.Repo.SetRecipeImagePlaceholder(ctx, repository.SetRecipeImagePlaceholderParams{
+				ImageBlurhash: placeholder.BlurHash,
+				ImageColor:    placeholder.Color,
+				ID:            image.ID,
+				ImageUrl:      image.ImageUrl,
+			})
+			if err != nil {
+				log.Println("image placeholder backfill failed:", err)
+				return stored, ErrInternalFailure
+			}
+			stored += int(updated)
+		}
+
+		if len(images) < int(j.BatchSize) {
+			break
+		}
+	}
+
+	log.Printf("stored %d image placeholders", stored)
+	return stored, nil
+}
+
+// Run backfills once immediately and then every interval until ctx is done.
+func (j *ImagePlaceholderJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Backfill(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+)
+
+// Meal images placeholders are computed from. Larger ones are rejected before
+// they're decoded, so decoding stays bounded in memory.
+var (
+	ImageMaxBytes     = config.Int("IMAGE_MAX_BYTES", 10<<20)
+	ImageMaxPixels    = config.Int("IMAGE_MAX_PIXELS", 16_000_000)
+	ImageFetchTimeout = config.Duration("IMAGE_FETCH_TIMEOUT", 10*time.Second)
+)
+
+// Blurhash components across and down. More keep more detail in a longer
+// hash.
+const (
+	blurHashXComponents = 4
+	blurHashYComponents = 3
+)
+
+// Pixels sampled along each side of an image for its placeholder, which is a
+// blur anyway.
+const placeholderSamples = 64
+
+// ImageDecoder decodes an image. Images it can't or won't decode are
+// ErrInvalidImage.
+type ImageDecoder interface {
+	Decode(r io.Reader) (image.Image, error)
+}
+
+// BoundedDecoder decodes JPEG, PNG and GIF images of at most MaxBytes and
+// MaxPixels. The size is checked from the header before any pixels are
+// decoded.
+type BoundedDecoder struct {
+	MaxBytes  int64
+	MaxPixels int64
+}
+
+func (d BoundedDecoder) Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, d.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > d.MaxBytes {
+		return nil, ErrInvalidImage
+	}
+
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || header.Width <= 0 || header.Height <= 0 || int64(header.Width)*int64(header.Height) > d.MaxPixels {
+		return nil, ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return img, nil
+}
+
+// ImagePlaceholders computes placeholders for images at a URL.
+type ImagePlaceholders struct {
+	Source  ImageSource
+	Decoder ImageDecoder
+}
+
+func NewImagePlaceholders() *ImagePlaceholders {
+	return &ImagePlaceholders{
+		Source:  NewHTTPImageSource(),
+		Decoder: BoundedDecoder{MaxBytes: int64(ImageMaxBytes), MaxPixels: int64(ImageMaxPixels)},
+	}
+}
+
+// Compute fetches and decodes the image at url for its placeholder. An image
+// that can't be decoded or is too large is ErrInvalidImage, one outside the
+// image storage is ErrImageNotAllowed; other errors mean it couldn't be
+// fetched, and it's worth trying again later.
+func (p *ImagePlaceholders) Compute(ctx context.Context, url string) (models.ImagePlaceholder, error) {
+	body, err := p.Source.Open(ctx, url)
+	if err != nil {
+		return models.ImagePlaceholder{}, err
+	}
+	defer body.Close()
+
+	img, err := p.Decoder.Decode(body)
+	if err != nil {
+		return models.ImagePlaceholder{}, err
+	}
+	return Placeholder(img), nil
+}
+
+// Placeholder computes img's blurhash and dominant color.
+func Placeholder(img image.Image) models.ImagePlaceholder {
+	samples := sampleImage(img)
+	if len(samples.pixels) == 0 {
+		return models.ImagePlaceholder{}
+	}
+	return models.ImagePlaceholder{
+		BlurHash: samples.blurHash(blurHashXComponents, blurHashYComponents),
+		Color:    samples.dominantColor(),
+	}
+}
+
+// BlurHash encodes img with the given number of components across and down,
+// each between 1 and 9.
+func BlurHash(img image.Image, xComponents int, yComponents int) string {
+	samples := sampleImage(img)
+	if len(samples.pixels) == 0 {
+		return ""
+	}
+	return samples.blurHash(xComponents, yComponents)
+}
+
+// sampleGrid holds sRGB colors sampled evenly across an image, row by row.
+type sampleGrid struct {
+	width, height int
+	pixels        [][3]uint8
+}
+
+func sampleImage(img image.Image) sampleGrid {
+	bounds := img.Bounds()
+	grid := sampleGrid{
+		width:  min(bounds.Dx(), placeholderSamples),
+		height: min(bounds.Dy(), placeholderSamples),
+	}
+	grid.pixels = make([][3]uint8, 0, grid.width*grid.height)
+	for y := range grid.height {
+		for x := range grid.width {
+			// The center of each sample's share of the image.
+			px := bounds.Min.X + (2*x+1)*bounds.Dx()/(2*grid.width)
+			py := bounds.Min.Y + (2*y+1)*bounds.Dy()/(2*grid.height)
+			r, g, b, _ := img.At(px, py).RGBA()
+			grid.pixels = append(grid.pixels, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+		}
+	}
+	return grid
+}
+
+// blurHash follows the reference encoder at github.com/woltapp/blurhash.
+func (g sampleGrid) blurHash(xComponents int, yComponents int) string {
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := range yComponents {
+		for i := range xComponents {
+			var factor [3]float64
+			for y := range g.height {
+				for x := range g.width {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(g.width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(g.height))
+					pixel := g.pixels[y*g.width+x]
+					for c := range factor {
+						factor[c] += basis * srgbToLinear(pixel[c])
+					}
+				}
+			}
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			for c := range factor {
+				factor[c] *= normalisation / float64(g.width*g.height)
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, factor := range factors[1:] {
+			for _, value := range factor {
+				actualMax = max(actualMax, math.Abs(value))
+			}
+		}
+		quantisedMax := int(max(0, min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	quantise := func(value float64) int {
+		return int(max(0, min(18, math.Floor(signPow(value/maxValue, 0.5)*9+9.5))))
+	}
+	for _, factor := range factors[1:] {
+		hash.WriteString(encodeBase83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+	return hash.String()
+}
+
+// dominantColor is the average of the most common colors, with each channel
+// cut to 4 bits to group near ones. Ties go to the group lowest in red, then
+// green, then blue.
+func (g sampleGrid) dominantColor() string {
+	var counts [4096]int
+	var sums [4096][3]int
+	for _, pixel := range g.pixels {
+		bucket := int(pixel[0]>>4)<<8 | int(pixel[1]>>4)<<4 | int(pixel[2]>>4)
+		counts[bucket]++
+		for c := range pixel {
+			sums[bucket][c] += int(pixel[c])
+		}
+	}
+
+	best := 0
+	for bucket, count := range counts {
+		if count > counts[best] {
+			best = bucket
+		}
+	}
+	n := counts[best]
+	return fmt.Sprintf("#%02x%02x%02x", sums[best][0]/n, sums[best][1]/n, sums[best][2]/n)
+}
+
+const base83Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func encodeBase83(value int, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83Digits[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := max(0, min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Where meal images may be fetched from: comma-separated URL prefixes of the
+// image storage, such as https://storage.example.com/meal-images/. Images
+// anywhere else are never fetched.
+var ImageStorageURLs = config.String("IMAGE_STORAGE_URLS", "")
+
+// Redirects an image fetch follows, each of them to an allowed URL.
+const imageMaxRedirects = 3
+
+// Shared address space of carrier-grade NAT, not public either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// ImageSource opens the image at a URL.
+type ImageSource interface {
+	Open(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// HTTPImageSource fetches images over HTTP from URLs under one of Allowed.
+// Other URLs, including ones redirected to, are ErrImageNotAllowed and
+// responses that aren't images are ErrInvalidImage.
+type HTTPImageSource struct {
+	Client  *http.Client
+	Allowed []*url.URL
+}
+
+// NewHTTPImageSource fetches from ImageStorageURLs with a NewImageClient.
+func NewHTTPImageSource() *HTTPImageSource {
+	return &HTTPImageSource{
+		Client:  NewImageClient(ImageFetchTimeout),
+		Allowed: ParseImageStorageURLs(ImageStorageURLs),
+	}
+}
+
+// NewImageClient returns a client that won't connect to loopback, private,
+// link-local or other non-public addresses. It's checked on every dial, so
+// neither a name resolving to one nor a redirect gets there.
+func NewImageClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: refuseInternalAddress}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// ParseImageStorageURLs reads an ImageStorageURLs spec. Entries that aren't
+// absolute http or https URLs are logged and skipped.
+func ParseImageStorageURLs(spec string) []*url.URL {
+	var allowed []*url.URL
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			log.Printf("skipping image storage URL %q", entry)
+			continue
+		}
+		// A bucket prefix matches the paths inside it, not ones starting alike.
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		allowed = append(allowed, u)
+	}
+	return allowed
+}
+
+func (s *HTTPImageSource) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	if !imageURLAllowed(rawURL, s.Allowed) {
+		return nil, ErrImageNotAllowed
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *s.Client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > imageMaxRedirects {
+			return errors.New("image fetch: too many redirects")
+		}
+		if !imageURLAllowed(req.URL.String(), s.Allowed) {
+			return ErrImageNotAllowed
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("image fetch: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		resp.Body.Close()
+		return nil, ErrInvalidImage
+	}
+	return resp.Body, nil
+}
+
+// imageURLAllowed reports whether rawURL is under one of allowed: the same
+// scheme and host, and a path inside its prefix without dot segments.
+func imageURLAllowed(rawURL string, allowed []*url.URL) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	if cleaned := path.Clean("/" + u.Path); cleaned != u.Path && cleaned+"/" != u.Path {
+		return false
+	}
+	for _, prefix := range allowed {
+		if u.Scheme == prefix.Scheme && strings.EqualFold(u.Host, prefix.Host) && strings.HasPrefix(u.Path, prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func refuseInternalAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("image fetch: %s isn't a public address", addr)
+	}
+	return nil
+}
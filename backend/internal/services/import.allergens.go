@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Ingredients written per transaction during an allergen map import.
+const allergenImportBatchSize = 200
+
+// ParseAllergenMap reads an ingredient to allergens mapping as JSON, an object
+// of ingredient names to lists of allergen tag names, or as CSV with the
+// ingredient in the first column and one allergen per following column. A
+// CSV header row starting with "ingredient" is skipped. Ingredient names are
+// lowercased and rows for the same ingredient are merged.
+func ParseAllergenMap(r io.Reader) ([]models.AllergenMapping, error) {
+	in := bufio.NewReader(r)
+	if bom, _ := in.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		in.Discard(3)
+	}
+	start, _ := in.Peek(64)
+	start = bytes.TrimLeft(start, " \t\r\n")
+
+	var rows []models.AllergenMapping
+	if len(start) > 0 && start[0] == '{' {
+		var byIngredient map[string][]string
+		if err := json.NewDecoder(in).Decode(&byIngredient); err != nil {
+			return nil, err
+		}
+		for ingredient, allergens := range byIngredient {
+			rows = append(rows, models.AllergenMapping{Ingredient: ingredient, Allergens: allergens})
+		}
+	} else {
+		reader := csv.NewReader(in)
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "ingredient") {
+			records = records[1:]
+		}
+		for _, record := range records {
+			rows = append(rows, models.AllergenMapping{Ingredient: record[0], Allergens: record[1:]})
+		}
+	}
+
+	merged := make(map[string][]string, len(rows))
+	for _, row := range rows {
+		ingredient := strings.ToLower(strings.TrimSpace(row.Ingredient))
+		if ingredient == "" || len(ingredient) > models.MaxAllergenIngredientLen {
+			return nil, errors.New("invalid ingredient name")
+		}
+
+		allergens := merged[ingredient]
+		if allergens == nil {
+			allergens = []string{}
+		}
+		for _, allergen := range row.Allergens {
+			if allergen = strings.TrimSpace(allergen); allergen != "" && !slices.Contains(allergens, allergen) {
+				allergens = append(allergens, allergen)
+			}
+		}
+		merged[ingredient] = allergens
+	}
+	if len(merged) > models.MaxAllergenMappings {
+		return nil, errors.New("too many ingredients in one allergen map")
+	}
+
+	mapping := make([]models.AllergenMapping, 0, len(merged))
+	for ingredient, allergens := range merged {
+		mapping = append(mapping, models.AllergenMapping{Ingredient: ingredient, Allergens: allergens})
+	}
+	slices.SortFunc(mapping, func(a, b models.AllergenMapping) int { return strings.Compare(a.Ingredient, b.Ingredient) })
+	return mapping, nil
+}
+
+// ResolveAllergens swaps allergen names for tag ids, matching names case
+// insensitively. Ingredients with an allergen that isn't a tag are dropped
+// and the unknown names returned, sorted.
+func ResolveAllergens(mapping []models.AllergenMapping, tags []repository.ListAllergenTagsRow) (map[string][]int32, []string) {
+	ids := make(map[string]int32, len(tags))
+	for _, tag := range tags {
+		ids[strings.ToLower(tag.Name)] = tag.ID
+	}
+
+	resolved := make(map[string][]int32, len(mapping))
+	unknown := []string{}
+	for _, row := range mapping {
+		tagIDs := []int32{}
+		known := true
+		for _, allergen := range row.Allergens {
+			id, ok := ids[strings.ToLower(allergen)]
+			if !ok {
+				known = false
+				if !slices.Contains(unknown, allergen) {
+					unknown = append(unknown, allergen)
+				}
+				continue
+			}
+			tagIDs = append(tagIDs, id)
+		}
+		if known {
+			resolved[row.Ingredient] = tagIDs
+		}
+	}
+	slices.Sort(unknown)
+	return resolved, unknown
+}
+
+// ImportAllergenMap replaces the allergens of every mapped ingredient that a
+// recipe uses, in batches of one transaction each, and marks the recipes
+// using them so their allergen tags are derived again.
+func (s *BaseImportService) ImportAllergenMap(ctx context.Context, r io.Reader) (models.ImportResult, error) {
+	mapping, err := ParseAllergenMap(r)
+	if err != nil {
+		return models.ImportResult{}, ErrValidation
+	}
+
+	tags, err := s.Repo.ListAllergenTags(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		return models.ImportResult{}, ErrInternalFailure
+	}
+	resolved, unknownAllergens := ResolveAllergens(mapping, tags)
+
+	result := models.ImportResult{
+		UnknownIngredients: []string{},
+		UnknownAllergens:   unknownAllergens,
+	}
+
+	names := make([]string, 0, len(resolved))
+	for _, row := range mapping {
+		if _, ok := resolved[row.Ingredient]; ok {
+			names = append(names, row.Ingredient)
+		}
+	}
+
+	for batch := range slices.Chunk(names, allergenImportBatchSize) {
+		known, err := s.Repo.ListKnownIngredients(ctx, batch)
+		if err != nil {
+			log.Println(err.Error())
+			return result, ErrInternalFailure
+		}
+		for _, name := range batch {
+			if !slices.Contains(known, name) {
+				result.UnknownIngredients = append(result.UnknownIngredients, name)
+			}
+		}
+		if len(known) == 0 {
+			continue
+		}
+
+		dirty, err := s.writeIngredientAllergens(ctx, known, resolved)
+		if err != nil {
+			log.Println(err.Error())
+			return result, ErrInternalFailure
+		}
+		result.Updated += int32(len(known))
+		result.DirtyRecipes += dirty
+	}
+
+	return result, nil
+}
+
+func (s *BaseImportService) writeIngredientAllergens(ctx context.Context, ingredients []string, allergens map[string][]int32) (int64, error) {
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	if err := qtx.ClearIngredientAllergens(ctx, ingredients); err != nil {
+		return 0, err
+	}
+
+	pairs := repository.InsertIngredientAllergensParams{Ingredients: []string{}, TagIds: []int32{}}
+	for _, ingredient := range ingredients {
+		for _, id := range allergens[ingredient] {
+			pairs.Ingredients = append(pairs.Ingredients, ingredient)
+			pairs.TagIds = append(pairs.TagIds, id)
+		}
+	}
+	if len(pairs.TagIds) > 0 {
+		if err := qtx.InsertIngredientAllergens(ctx, pairs); err != nil {
+			return 0, err
+		}
+	}
+
+	dirty, err := qtx.MarkRecipesAllergensDirty(ctx, ingredients)
+	if err != nil {
+		return 0, err
+	}
+	return dirty, tx.Commit(ctx)
+}
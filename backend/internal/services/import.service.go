@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// The job row is updated every this many records while an import runs.
+const importProgressEvery = 25
+
+type ImportService interface {
+	ImportRecipes(ctx context.Context, username string, req *models.ImportRequest) (models.ImportProgress, error)
+	GetImportProgress(ctx context.Context, username string, jobID int32) (models.ImportProgress, error)
+	ImportAllergenMap(ctx context.Context, r io.Reader) (models.ImportResult, error)
+}
+
+type BaseImportService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBaseImportService(conn *pgx.Conn) BaseImportService {
+	return BaseImportService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+// RecipeImporter imports a single record and reports whether it was inserted
+// (false means it had been imported before).
+type RecipeImporter func(ctx context.Context, recipe *models.ImportRecipe) (bool, error)
+
+// RunImport imports recipes one by one, counting imported, skipped and failed
+// records. A failed record doesn't stop the import. report is called
+// periodically and once more when the import is done.
+func RunImport(ctx context.Context, recipes []models.ImportRecipe, importOne RecipeImporter, report func(models.ImportProgress)) models.ImportProgress {
+	progress := models.ImportProgress{
+		Status: models.ImportStatusRunning,
+		Total:  int32(len(recipes)),
+	}
+
+	for i := range recipes {
+		inserted, err := importOne(ctx, &recipes[i])
+		switch {
+		case err != nil:
+			log.Println("import of", recipes[i].SourceID, "failed:", err)
+			progress.Failed++
+		case inserted:
+			progress.Imported++
+		default:
+			progress.Skipped++
+		}
+
+		if (i+1)%importProgressEvery == 0 && i+1 < len(recipes) {
+			report(progress)
+		}
+	}
+
+	progress.Status = models.ImportStatusDone
+	report(progress)
+	return progress
+}
+
+func (s *BaseImportService) ImportRecipes(ctx context.Context, username string, req *models.ImportRequest) (models.ImportProgress, error) {
+	if req == nil {
+		return models.ImportProgress{}, ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return models.ImportProgress{}, ErrValidation
+	}
+
+	jobID := req.JobID
+	if jobID == 0 {
+		id, err := s.Repo.CreateImportJob(ctx, repository.CreateImportJobParams{
+			Username: username,
+			Total:    int32(len(req.Recipes)),
+		})
+		if err != nil {
+			log.Println(err.Error())
+			return models.ImportProgress{}, ErrInternalFailure
+		}
+		jobID = id
+	} else if _, err := s.getJob(ctx, username, jobID); err != nil {
+		return models.ImportProgress{}, err
+	}
+
+	report := func(progress models.ImportProgress) {
+		err := s.Repo.UpdateImportJob(ctx, repository.UpdateImportJobParams{
+			Status:   progress.Status,
+			Total:    progress.Total,
+			Imported: progress.Imported,
+			Skipped:  progress.Skipped,
+			Failed:   progress.Failed,
+			ID:       jobID,
+		})
+		if err != nil {
+			log.Println("update import job failed:", err)
+		}
+	}
+
+	provider := req.Source
+	if provider == "" {
+		provider = models.UnknownImportSource
+	}
+	source := models.SourceImport + ":" + provider
+
+	progress := RunImport(ctx, req.Recipes, func(ctx context.Context, recipe *models.ImportRecipe) (bool, error) {
+		return s.importRecipe(ctx, username, source, recipe)
+	}, report)
+	progress.JobID = jobID
+
+	return progress, nil
+}
+
+func (s *BaseImportService) importRecipe(ctx context.Context, username string, source string, recipe *models.ImportRecipe) (bool, error) {
+	ingredients, err := recipe.Ingredients.Normalize(MaxIngredientsPerMeal)
+	if err != nil {
+		return false, err
+	}
+	recipe.Ingredients = ingredients
+
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	id, err := qtx.InsertImportedRecipe(ctx, repository.InsertImportedRecipeParams{
+		Name:        recipe.Name,
+		Recipe:      recipe.Recipe,
+		Ingredients: recipe.Ingredients,
+		Time:        recipe.Time,
+		Difficulty:  recipe.Difficulty,
+		Username:    username,
+		Calories:    recipe.Calories,
+		Protein:     recipe.Protein,
+		Carbs:       recipe.Carbs,
+		Fat:         recipe.Fat,
+		Servings:    max(recipe.Servings, 1),
+		SourceID:    recipe.SourceID,
+		Source:      source,
+		SourceUrl:   recipe.SourceURL,
+		Equipment:   models.NormalizeEquipment(recipe.Equipment),
+		Flags:       models.NormalizeFlags(recipe.Flags),
+		CookTime:    recipe.CookTime,
+	})
+	// ON CONFLICT DO NOTHING returns no row for records imported before.
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := addRecipeTags(ctx, qtx, id, recipe.Tags); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (s *BaseImportService) GetImportProgress(ctx context.Context, username string, jobID int32) (models.ImportProgress, error) {
+	job, err := s.getJob(ctx, username, jobID)
+	if err != nil {
+		return models.ImportProgress{}, err
+	}
+
+	return models.ImportProgress{
+		JobID:    job.ID,
+		Status:   job.Status,
+		Total:    job.Total,
+		Imported: job.Imported,
+		Skipped:  job.Skipped,
+		Failed:   job.Failed,
+	}, nil
+}
+
+// getJob returns the job if it belongs to username. Other users' jobs are
+// reported as missing.
+func (s *BaseImportService) getJob(ctx context.Context, username string, jobID int32) (repository.ImportJob, error) {
+	job, err := s.Repo.GetImportJob(ctx, jobID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && job.Username != username) {
+		return repository.ImportJob{}, ErrImportJobNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return repository.ImportJob{}, ErrInternalFailure
+	}
+	return job, nil
+}
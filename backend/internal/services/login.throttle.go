@@ -0,0 +1,62 @@
+package services
+
+import (
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// Failed logins after which further attempts are refused for the window:
+// per login from one IP, and per IP across all logins. Keying the first on
+// the IP too means guessing someone's password elsewhere doesn't lock them
+// out at home. 0 turns a limit off.
+var (
+	LoginMaxFailuresPerUserIP = config.Int("LOGIN_MAX_FAILURES_PER_USER_IP", 5)
+	LoginMaxFailuresPerIP     = config.Int("LOGIN_MAX_FAILURES_PER_IP", 50)
+	LoginThrottleWindow       = config.Duration("LOGIN_THROTTLE_WINDOW", 15*time.Minute)
+)
+
+// LoginFailureKey is what failures of login from remoteIP are counted under.
+func LoginFailureKey(login string, remoteIP string) string {
+	return login + "|" + remoteIP
+}
+
+// LoginThrottle refuses logins after too many failures, counted per login
+// and IP, and per IP.
+type LoginThrottle struct {
+	PerUserIP    *LoginFailures
+	PerIP        *LoginFailures
+	MaxPerUserIP int
+	MaxPerIP     int
+}
+
+func NewLoginThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		PerUserIP:    NewLoginFailures(LoginThrottleWindow),
+		PerIP:        NewLoginFailures(LoginThrottleWindow),
+		MaxPerUserIP: LoginMaxFailuresPerUserIP,
+		MaxPerIP:     LoginMaxFailuresPerIP,
+	}
+}
+
+// Check returns ErrLoginThrottled when either limit has been reached.
+func (t *LoginThrottle) Check(login string, remoteIP string, now time.Time) error {
+	if t.MaxPerUserIP > 0 && t.PerUserIP.Count(LoginFailureKey(login, remoteIP), now) >= t.MaxPerUserIP {
+		return ErrLoginThrottled
+	}
+	if t.MaxPerIP > 0 && t.PerIP.Count(remoteIP, now) >= t.MaxPerIP {
+		return ErrLoginThrottled
+	}
+	return nil
+}
+
+func (t *LoginThrottle) Fail(login string, remoteIP string, now time.Time) {
+	t.PerUserIP.Fail(LoginFailureKey(login, remoteIP), now)
+	t.PerIP.Fail(remoteIP, now)
+}
+
+// Succeed forgets the login's failures from remoteIP. The IP's own count is
+// kept, or logging in to one account would reset guessing at others.
+func (t *LoginThrottle) Succeed(login string, remoteIP string) {
+	t.PerUserIP.Reset(LoginFailureKey(login, remoteIP))
+}
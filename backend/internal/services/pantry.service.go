@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+type PantryService interface {
+	ListPantry(ctx context.Context, username string) ([]repository.ListPantryItemsRow, error)
+	SetPantryItem(ctx context.Context, username string, req *models.PantryItemRequest) error
+	DeletePantryItem(ctx context.Context, username string, name string) error
+	GapToCookable(ctx context.Context, username string, mealID int64) ([]models.MissingIngredient, error)
+}
+
+type BasePantryService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBasePantryService(conn *pgx.Conn) BasePantryService {
+	return BasePantryService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+func (p *BasePantryService) ListPantry(ctx context.Context, username string) ([]repository.ListPantryItemsRow, error) {
+	items, err := p.Repo.ListPantryItems(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	return items, nil
+}
+
+func (p *BasePantryService) SetPantryItem(ctx context.Context, username string, req *models.PantryItemRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	if err := p.Repo.UpsertPantryItem(ctx, repository.UpsertPantryItemParams{
+		Username: username,
+		Name:     strings.TrimSpace(req.Name),
+		Amount:   req.Amount,
+		Unit:     req.Unit,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+func (p *BasePantryService) DeletePantryItem(ctx context.Context, username string, name string) error {
+	affected, err := p.Repo.DeletePantryItem(ctx, repository.DeletePantryItemParams{
+		Username: username,
+		Name:     name,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if affected == 0 {
+		return ErrIngredientNotFound
+	}
+	return nil
+}
+
+// GapToCookable lists what the user still has to buy to cook the recipe from
+// their pantry. The list is empty when everything is at hand.
+func (p *BasePantryService) GapToCookable(ctx context.Context, username string, mealID int64) ([]models.MissingIngredient, error) {
+	if mealID <= 0 || mealID > math.MaxInt32 {
+		return nil, ErrValidation
+	}
+
+	recipe, err := p.Repo.GetRecipeWithId(ctx, int32(mealID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoRecipesFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	pantry, err := p.Repo.ListPantryItems(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return PantryGap(recipe.Ingredients.Ingredients, pantry), nil
+}
+
+// Units that convert to a common base unit, as used in recipe ingredients.
+var unitConversions = map[string]struct {
+	base   string
+	factor int64
+}{
+	"g":   {"g", 1},
+	"gr":  {"g", 1},
+	"dag": {"g", 10},
+	"kg":  {"g", 1000},
+	"ml":  {"ml", 1},
+	"l":   {"ml", 1000},
+	"szt": {"szt", 1},
+}
+
+// NormalizeQuantity converts an amount to its base unit. Unknown units are
+// kept as they are and only compare equal to themselves.
+func NormalizeQuantity(amount int32, unit string) (int64, string) {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if conversion, ok := unitConversions[unit]; ok {
+		return int64(amount) * conversion.factor, conversion.base
+	}
+	return int64(amount), unit
+}
+
+type pantryKey struct {
+	name string
+	unit string
+}
+
+// PantryGap compares recipe ingredients with the pantry. Names match case
+// insensitively and amounts are compared in base units; pantry stock in a unit
+// that doesn't convert to the recipe's doesn't count towards it. Ingredients
+// listed twice in a recipe draw from the same stock.
+func PantryGap(needed []models.Ingredient, pantry []repository.ListPantryItemsRow) []models.MissingIngredient {
+	stock := make(map[pantryKey]int64, len(pantry))
+	for _, item := range pantry {
+		amount, unit := NormalizeQuantity(item.Amount, item.Unit)
+		stock[pantryKey{strings.ToLower(strings.TrimSpace(item.Name)), unit}] += amount
+	}
+
+	missing := []models.MissingIngredient{}
+	for _, ingredient := range needed {
+		amount, unit := NormalizeQuantity(ingredient.Amount, ingredient.Unit)
+		if amount <= 0 {
+			continue
+		}
+
+		key := pantryKey{strings.ToLower(strings.TrimSpace(ingredient.Name)), unit}
+		have := min(stock[key], amount)
+		stock[key] -= have
+
+		if short := amount - have; short > 0 {
+			missing = append(missing, models.MissingIngredient{
+				Name:   ingredient.Name,
+				Amount: int32(min(short, math.MaxInt32)),
+				Unit:   unit,
+			})
+		}
+	}
+	return missing
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Plan goals and the daily calorie adjustment applied on top of maintenance.
+const (
+	GoalLose     = "lose"
+	GoalMaintain = "maintain"
+	GoalGain     = "gain"
+)
+
+var goalAdjustments = map[string]float64{
+	GoalLose:     -500,
+	GoalMaintain: 0,
+	GoalGain:     300,
+}
+
+// Maintenance is BMR times a light activity factor; profiles don't store
+// activity, so the estimate errs on the side of a desk job.
+const activityFactor = 1.375
+
+// Sex offsets of the Mifflin-St Jeor equation, keyed by the values the signup
+// form sends as well as their English spellings.
+var bmrSexOffsets = map[string]float64{
+	"mężczyzna": 5,
+	"male":      5,
+	"kobieta":   -161,
+	"female":    -161,
+}
+
+// RecommendCalorieTarget estimates a daily calorie target from the user's
+// profile for goal ("lose", "maintain" or "gain"; empty means maintain).
+func (p *BaseMealPlanService) RecommendCalorieTarget(ctx context.Context, username string, goal string) (int, error) {
+	user, err := p.Repo.GetUserData(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrInternalFailure
+	}
+
+	return CalorieTarget(user.Weight, user.Height, user.Age, user.Sex, goal)
+}
+
+// BMR is the Mifflin-St Jeor basal metabolic rate in kcal/day for weight in
+// kg, height in cm and age in years. Missing values and a sex the equation has
+// no constant for return ErrIncompleteProfile.
+func BMR(weight, height, age int32, sex string) (float64, error) {
+	offset, ok := bmrSexOffsets[strings.ToLower(strings.TrimSpace(sex))]
+	if !ok || weight <= 0 || height <= 0 || age <= 0 {
+		return 0, ErrIncompleteProfile
+	}
+	return 10*float64(weight) + 6.25*float64(height) - 5*float64(age) + offset, nil
+}
+
+// CalorieTarget adjusts the maintenance estimate for goal and rounds it to the
+// nearest 10 kcal.
+func CalorieTarget(weight, height, age int32, sex string, goal string) (int, error) {
+	if goal == "" {
+		goal = GoalMaintain
+	}
+	adjustment, ok := goalAdjustments[goal]
+	if !ok {
+		return 0, ErrValidation
+	}
+
+	bmr, err := BMR(weight, height, age, sex)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round((bmr*activityFactor+adjustment)/10) * 10), nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+type MealPlanService interface {
+	GenerateMealPlan(ctx context.Context, username string, req models.MealPlanRequest) (models.MealPlan, error)
+	GenerateWeeklyPlan(ctx context.Context, username string, req models.WeeklyPlanRequest, progress chan<- models.PlanProgress) (models.WeeklyPlan, error)
+	RecommendCalorieTarget(ctx context.Context, username string, goal string) (int, error)
+}
+
+type BaseMealPlanService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBaseMealPlanService(conn *pgx.Conn) BaseMealPlanService {
+	return BaseMealPlanService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+func (p *BaseMealPlanService) GenerateMealPlan(ctx context.Context, username string, req models.MealPlanRequest) (models.MealPlan, error) {
+	if err := p.fillCalorieTarget(ctx, username, &req); err != nil {
+		return models.MealPlan{}, err
+	}
+	if err := req.Validate(); err != nil {
+		return models.MealPlan{}, ErrValidation
+	}
+
+	candidates, err := p.planCandidates(ctx, username)
+	if err != nil {
+		return models.MealPlan{}, err
+	}
+
+	return PlanMeals(candidates, req), nil
+}
+
+// GenerateWeeklyPlan builds a plan day by day, sending a PlanProgress on
+// progress (when not nil) after each day. It stops when ctx is canceled.
+func (p *BaseMealPlanService) GenerateWeeklyPlan(ctx context.Context, username string, req models.WeeklyPlanRequest, progress chan<- models.PlanProgress) (models.WeeklyPlan, error) {
+	if err := p.fillCalorieTarget(ctx, username, &req.MealPlanRequest); err != nil {
+		return models.WeeklyPlan{}, err
+	}
+	if err := req.Validate(); err != nil {
+		return models.WeeklyPlan{}, ErrValidation
+	}
+
+	candidates, err := p.planCandidates(ctx, username)
+	if err != nil {
+		return models.WeeklyPlan{}, err
+	}
+
+	return PlanWeek(ctx, candidates, req, progress)
+}
+
+// fillCalorieTarget sets the calorie target from the profile when the request
+// leaves it out.
+func (p *BaseMealPlanService) fillCalorieTarget(ctx context.Context, username string, req *models.MealPlanRequest) error {
+	if req.Calories != 0 {
+		return nil
+	}
+
+	target, err := p.RecommendCalorieTarget(ctx, username, req.Goal)
+	if err != nil {
+		return err
+	}
+	req.Calories = int32(target)
+	return nil
+}
+
+func (p *BaseMealPlanService) planCandidates(ctx context.Context, username string) ([]models.PlanMeal, error) {
+	// Allergen exclusion happens in the query, so the planner never sees them.
+	rows, err := p.Repo.GetPlanCandidates(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	candidates := make([]models.PlanMeal, 0, len(rows))
+	for _, row := range rows {
+		candidates = append(candidates, models.PlanMeal{
+			ID:       row.ID,
+			Name:     row.Name,
+			Calories: *row.Calories,
+			Protein:  *row.Protein,
+			Carbs:    *row.Carbs,
+			Fat:      *row.Fat,
+			Servings: 1,
+		})
+	}
+	return candidates, nil
+}
+
+// PlanWeek plans req.Days days with PlanMeals. Recipes used on earlier days are
+// left out while enough unused ones remain, so the week doesn't repeat itself.
+func PlanWeek(ctx context.Context, candidates []models.PlanMeal, req models.WeeklyPlanRequest, progress chan<- models.PlanProgress) (models.WeeklyPlan, error) {
+	plan := models.WeeklyPlan{Days: make([]models.MealPlan, 0, req.Days)}
+	used := make(map[int32]bool)
+
+	for day := int32(1); day <= req.Days; day++ {
+		if err := ctx.Err(); err != nil {
+			return models.WeeklyPlan{}, err
+		}
+
+		fresh := make([]models.PlanMeal, 0, len(candidates))
+		for _, c := range candidates {
+			if !used[c.ID] {
+				fresh = append(fresh, c)
+			}
+		}
+		if len(fresh) < int(req.Meals) {
+			clear(used)
+			fresh = candidates
+		}
+
+		daily := PlanMeals(fresh, req.MealPlanRequest)
+		for _, meal := range daily.Meals {
+			used[meal.ID] = true
+		}
+		plan.Days = append(plan.Days, daily)
+		plan.Daily = append(plan.Daily, daily.Summary())
+
+		if progress != nil {
+			select {
+			case progress <- models.PlanProgress{Day: day, Total: req.Days}:
+			case <-ctx.Done():
+				return models.WeeklyPlan{}, ctx.Err()
+			}
+		}
+	}
+
+	plan.Total = SumNutrition(plan.Daily...)
+	return plan, nil
+}
+
+// PlanScore is the sum of squared relative errors against the calorie target
+// and every macro target that was set. Lower is better.
+func PlanScore(meals []models.PlanMeal, req models.MealPlanRequest) float64 {
+	total := MealsNutrition(meals)
+	kcal, protein, carbs, fat := float64(total.Calories), float64(total.Protein), float64(total.Carbs), float64(total.Fat)
+
+	targetProtein, targetCarbs, targetFat := req.MacroTargets()
+	score := relativeError(kcal, float64(req.Calories))
+	score += relativeError(protein, targetProtein)
+	score += relativeError(carbs, targetCarbs)
+	score += relativeError(fat, targetFat)
+	return score
+}
+
+func relativeError(got, target float64) float64 {
+	if target <= 0 {
+		return 0
+	}
+	diff := (got - target) / target
+	return diff * diff
+}
+
+// PlanMeals picks req.Meals distinct candidates minimizing PlanScore. It seeds
+// the plan greedily and then swaps single meals while the score improves.
+func PlanMeals(candidates []models.PlanMeal, req models.MealPlanRequest) models.MealPlan {
+	size := int(req.Meals)
+	if size <= 0 {
+		size = models.DefaultPlanMeals
+	}
+	if size > len(candidates) {
+		size = len(candidates)
+	}
+
+	used := make([]bool, len(candidates))
+	plan := make([]models.PlanMeal, 0, size)
+	picked := make([]int, 0, size)
+
+	// Greedy seed: score each partial plan against a target scaled to its size.
+	for len(plan) < size {
+		partial := scaledRequest(req, len(plan)+1, size)
+		best, bestScore := -1, 0.0
+		for i, c := range candidates {
+			if used[i] {
+				continue
+			}
+			score := PlanScore(append(plan, c), partial)
+			if best == -1 || score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		picked = append(picked, best)
+		plan = append(plan, candidates[best])
+	}
+
+	for improved := true; improved; {
+		improved = false
+		current := PlanScore(plan, req)
+		for slot := range plan {
+			for i, c := range candidates {
+				if used[i] {
+					continue
+				}
+				previous := plan[slot]
+				plan[slot] = c
+				if score := PlanScore(plan, req); score < current {
+					used[picked[slot]] = false
+					used[i] = true
+					picked[slot] = i
+					current = score
+					improved = true
+					continue
+				}
+				plan[slot] = previous
+			}
+		}
+	}
+
+	return summarizePlan(plan)
+}
+
+func scaledRequest(req models.MealPlanRequest, part, whole int) models.MealPlanRequest {
+	protein, carbs, fat := req.MacroTargets()
+	ratio := float64(part) / float64(whole)
+	return models.MealPlanRequest{
+		Calories: int32(float64(req.Calories) * ratio),
+		Protein:  int32(protein * ratio),
+		Carbs:    int32(carbs * ratio),
+		Fat:      int32(fat * ratio),
+	}
+}
+
+// MealsNutrition totals per-serving nutrition times planned servings.
+func MealsNutrition(meals []models.PlanMeal) models.NutritionSummary {
+	var total models.NutritionSummary
+	for _, m := range meals {
+		if m.NutritionUnknown {
+			total.PartiallyEstimated = true
+			continue
+		}
+		servings := max(m.Servings, 1)
+		total.Calories += m.Calories * servings
+		total.Protein += m.Protein * servings
+		total.Carbs += m.Carbs * servings
+		total.Fat += m.Fat * servings
+	}
+	return total
+}
+
+// SumNutrition adds up summaries, e.g. the days of a plan.
+func SumNutrition(summaries ...models.NutritionSummary) models.NutritionSummary {
+	var total models.NutritionSummary
+	for _, s := range summaries {
+		total.Calories += s.Calories
+		total.Protein += s.Protein
+		total.Carbs += s.Carbs
+		total.Fat += s.Fat
+		total.PartiallyEstimated = total.PartiallyEstimated || s.PartiallyEstimated
+	}
+	return total
+}
+
+func summarizePlan(meals []models.PlanMeal) models.MealPlan {
+	total := MealsNutrition(meals)
+	plan := models.MealPlan{
+		Meals:              meals,
+		Calories:           total.Calories,
+		Protein:            total.Protein,
+		Carbs:              total.Carbs,
+		Fat:                total.Fat,
+		PartiallyEstimated: total.PartiallyEstimated,
+	}
+
+	macroKcal := float64(plan.Protein)*4 + float64(plan.Carbs)*4 + float64(plan.Fat)*9
+	if macroKcal > 0 {
+		plan.Split = models.MacroSplit{
+			ProteinPercent: float64(plan.Protein) * 4 / macroKcal * 100,
+			CarbsPercent:   float64(plan.Carbs) * 4 / macroKcal * 100,
+			FatPercent:     float64(plan.Fat) * 9 / macroKcal * 100,
+		}
+	}
+	return plan
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"golang.org/x/sync/errgroup"
+)
+
+// How long a request waits for a free pooled connection before it's turned
+// away with ErrServiceBusy. 0 waits as long as the request lasts.
+var PoolAcquireTimeout = config.Duration("POOL_ACQUIRE_TIMEOUT", time.Second)
+
+// How long Release waits to replace a closed connection. One it can't
+// replace by then is retried on the next Acquire.
+const poolReconnectTimeout = 5 * time.Second
+
+// QueriesPool hands out queries bound to connections of their own, so the
+// fetches of one request can run in parallel; a pgx.Conn serves one query at
+// a time. A connection closed while in use, as a cancelled query closes it,
+// is replaced through Connect before it's handed out again.
+type QueriesPool struct {
+	free           chan *pooledConn
+	AcquireTimeout time.Duration
+	Connect        func(ctx context.Context) (*pgx.Conn, error)
+	waiting        atomic.Int64
+	exhausted      atomic.Int64
+
+	mu   sync.Mutex
+	held map[*repository.Queries]*pooledConn
+}
+
+type pooledConn struct {
+	conn    *pgx.Conn
+	queries *repository.Queries
+}
+
+// closed reports whether the connection is gone and must be replaced.
+func (c *pooledConn) closed() bool {
+	return c.conn != nil && c.conn.IsClosed()
+}
+
+// PoolStats is a snapshot of a QueriesPool, logged when it runs out.
+type PoolStats struct {
+	Size      int
+	InUse     int
+	Waiting   int64
+	Exhausted int64
+}
+
+func NewQueriesPool(conns []*pgx.Conn) *QueriesPool {
+	pool := &QueriesPool{
+		free:           make(chan *pooledConn, len(conns)),
+		AcquireTimeout: PoolAcquireTimeout,
+		held:           make(map[*repository.Queries]*pooledConn, len(conns)),
+	}
+	for _, conn := range conns {
+		pool.free <- &pooledConn{conn: conn, queries: repository.New(conn)}
+	}
+	return pool
+}
+
+// Acquire waits for a free connection until ctx is done or AcquireTimeout
+// passes. Running out of time is ErrServiceBusy, so callers can tell a
+// saturated pool from a failed query. A closed connection that can't be
+// replaced is ErrInternalFailure and stays in the pool for the next try.
+func (p *QueriesPool) Acquire(ctx context.Context) (*repository.Queries, error) {
+	c, err := p.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.closed() {
+		if err := p.reconnect(ctx, c); err != nil {
+			p.free <- c
+			log.Println("queries pool reconnect failed:", err)
+			return nil, ErrInternalFailure
+		}
+	}
+
+	p.mu.Lock()
+	p.held[c.queries] = c
+	p.mu.Unlock()
+	return c.queries, nil
+}
+
+func (p *QueriesPool) wait(ctx context.Context) (*pooledConn, error) {
+	select {
+	case c := <-p.free:
+		return c, nil
+	default:
+	}
+
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+
+	var timeout <-chan time.Time
+	if p.AcquireTimeout > 0 {
+		timer := time.NewTimer(p.AcquireTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case c := <-p.free:
+		return c, nil
+	case <-timeout:
+		p.exhausted.Add(1)
+		log.Printf("queries pool exhausted: %+v", p.Stats())
+		return nil, ErrServiceBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *QueriesPool) reconnect(ctx context.Context, c *pooledConn) error {
+	if p.Connect == nil {
+		return errors.New("connection closed and pool has no Connect")
+	}
+	conn, err := p.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.queries = repository.New(conn)
+	return nil
+}
+
+// Release returns q to the pool. When its connection was closed meanwhile,
+// it's replaced right away, so the next Acquire doesn't wait on a dead one.
+func (p *QueriesPool) Release(q *repository.Queries) {
+	p.mu.Lock()
+	c, ok := p.held[q]
+	delete(p.held, q)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if c.closed() {
+		ctx, cancel := context.WithTimeout(context.Background(), poolReconnectTimeout)
+		if err := p.reconnect(ctx, c); err != nil {
+			log.Println("queries pool reconnect failed, retrying on acquire:", err)
+		}
+		cancel()
+	}
+	p.free <- c
+}
+
+func (p *QueriesPool) Stats() PoolStats {
+	return PoolStats{
+		Size:      cap(p.free),
+		InUse:     cap(p.free) - len(p.free),
+		Waiting:   p.waiting.Load(),
+		Exhausted: p.exhausted.Load(),
+	}
+}
+
+// Size is the number of connections in the pool.
+func (p *QueriesPool) Size() int {
+	return cap(p.free)
+}
+
+// RunFetches runs independent fetches, at most limit at a time. The first to
+// fail cancels the context the others run with, and its error is returned;
+// fetches not started by then are skipped.
+func RunFetches(ctx context.Context, limit int, fetches ...func(ctx context.Context) error) error {
+	group, fetchCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(limit, 1))
+	for _, fetch := range fetches {
+		if fetchCtx.Err() != nil {
+			break
+		}
+		group.Go(func() error {
+			// Waiting for a free slot may outlast a failed fetch.
+			if err := fetchCtx.Err(); err != nil {
+				return err
+			}
+			return fetch(fetchCtx)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
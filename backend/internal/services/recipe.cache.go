@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How long recipe details are served from cache. 0 disables the cache.
+var RecipeCacheTTL = config.Duration("RECIPE_CACHE_TTL", 5*time.Minute)
+
+// Broadcast recipe invalidations to every instance through Postgres
+// LISTEN/NOTIFY. Single-instance deploys can leave it off and invalidate
+// in process.
+var RecipeCacheBroadcast = config.Bool("RECIPE_CACHE_BROADCAST", false)
+
+// Channel recipe invalidations are published on; the payload is the recipe id.
+const RecipeInvalidationChannel = "recipe_invalidation"
+
+// RecipeCache keeps recipe details by id for ttl. Entries are dropped early
+// with Invalidate when the recipe changes.
+type RecipeCache struct {
+	ttl time.Duration
+	// Store holds the recipes, in memory unless replaced with a shared store.
+	Store Cache
+}
+
+func NewRecipeCache(ttl time.Duration) *RecipeCache {
+	return &RecipeCache{
+		ttl:   ttl,
+		Store: NewMemoryCache().Store("recipes"),
+	}
+}
+
+// Get returns the cached recipe. A store that can't be read is logged and
+// treated as a miss.
+func (c *RecipeCache) Get(ctx context.Context, id int32) (repository.Recipe, bool) {
+	var recipe repository.Recipe
+	raw, ok, err := c.Store.Get(ctx, recipeCacheKey(id))
+	if err != nil {
+		log.Println("recipe cache get failed:", err)
+		return recipe, false
+	}
+	if !ok {
+		return recipe, false
+	}
+	if err := json.Unmarshal(raw, &recipe); err != nil {
+		log.Println("bad cached recipe:", err)
+		return recipe, false
+	}
+	return recipe, true
+}
+
+func (c *RecipeCache) Put(ctx context.Context, recipe repository.Recipe) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	raw, err := json.Marshal(recipe)
+	if err == nil {
+		err = c.Store.Set(ctx, recipeCacheKey(recipe.ID), raw, c.ttl)
+	}
+	if err != nil {
+		log.Println("recipe cache set failed:", err)
+	}
+}
+
+func (c *RecipeCache) Invalidate(id int32) {
+	if err := c.Store.Delete(context.Background(), recipeCacheKey(id)); err != nil {
+		log.Println("recipe cache invalidation failed:", err)
+	}
+}
+
+// Clear drops every cached recipe.
+func (c *RecipeCache) Clear(ctx context.Context) {
+	if err := c.Store.Clear(ctx); err != nil {
+		log.Println("recipe cache clear failed:", err)
+	}
+}
+
+func recipeCacheKey(id int32) string {
+	return strconv.Itoa(int(id))
+}
+
+// RecipeInvalidator is told about every recipe change so cached copies can be
+// dropped.
+type RecipeInvalidator interface {
+	InvalidateRecipe(ctx context.Context, id int32) error
+}
+
+// LocalInvalidator drops the recipe from this instance's cache only.
+type LocalInvalidator struct {
+	Cache *RecipeCache
+}
+
+func (l *LocalInvalidator) InvalidateRecipe(ctx context.Context, id int32) error {
+	l.Cache.Invalidate(id)
+	return nil
+}
+
+// NotifyInvalidator publishes the change on RecipeInvalidationChannel. Every
+// instance, this one included, drops its copy in ListenRecipeInvalidations.
+type NotifyInvalidator struct {
+	Repo *repository.Queries
+}
+
+func (n *NotifyInvalidator) InvalidateRecipe(ctx context.Context, id int32) error {
+	return n.Repo.NotifyRecipeChanged(ctx, strconv.Itoa(int(id)))
+}
+
+// How long the invalidation listener waits before reconnecting after losing
+// its connection. The wait doubles on every failed attempt, up to
+// recipeListenMaxBackoff.
+var RecipeListenBackoff = config.Duration("RECIPE_CACHE_LISTEN_BACKOFF", time.Second)
+
+const recipeListenMaxBackoff = time.Minute
+
+// ListenRecipeInvalidations drops recipes from cache as their invalidations
+// arrive, until ctx is done. It listens on a connection of its own from
+// connect and reconnects with a backoff whenever that's lost. Invalidations
+// sent while it wasn't listening are missed, so the cache is cleared every
+// time it starts listening again.
+func ListenRecipeInvalidations(ctx context.Context, connect func(ctx context.Context) (*pgx.Conn, error), cache *RecipeCache) {
+	backoff := RecipeListenBackoff
+	for attempt := 0; ; attempt++ {
+		listened, err := listenRecipeInvalidations(ctx, connect, cache, attempt > 0)
+		if ctx.Err() != nil {
+			return
+		}
+		if listened {
+			backoff = RecipeListenBackoff
+		}
+		log.Printf("recipe invalidation listener lost, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, recipeListenMaxBackoff)
+	}
+}
+
+// listenRecipeInvalidations listens on one connection until it fails,
+// reporting whether it got as far as listening.
+func listenRecipeInvalidations(ctx context.Context, connect func(ctx context.Context) (*pgx.Conn, error), cache *RecipeCache, reconnected bool) (bool, error) {
+	conn, err := connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+RecipeInvalidationChannel); err != nil {
+		return false, err
+	}
+	if reconnected {
+		cache.Clear(ctx)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 32)
+		if err != nil {
+			log.Println("bad recipe invalidation payload:", notification.Payload)
+			continue
+		}
+		cache.Invalidate(int32(id))
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How reviews with the same helpfulness are ordered: "newest", "oldest" or
+// "score" (highest rating first).
+var ReviewTiebreak = config.String("REVIEW_TIEBREAK", "newest")
+
+// Comma-separated words reviews may not contain, matched case insensitively
+// against whole words.
+var ReviewBlockedWords = config.String("REVIEW_BLOCKED_WORDS", "")
+
+type ReviewService interface {
+	AddReview(ctx context.Context, username string, mealID int64, req *models.ReviewRequest) (int32, error)
+	ListMealReviews(ctx context.Context, mealID int64) ([]repository.ListRecipeReviewsRow, error)
+	VoteReview(ctx context.Context, username string, reviewID int64, up bool) error
+	EditMealReview(ctx context.Context, username string, reviewID int64, newBody string) error
+	ListReviewEdits(ctx context.Context, reviewID int64) ([]repository.ReviewEdit, error)
+}
+
+type BaseReviewService struct {
+	DbConn       *pgx.Conn
+	Repo         *repository.Queries
+	Tiebreak     string
+	BlockedWords []string
+}
+
+func NewBaseReviewService(conn *pgx.Conn) BaseReviewService {
+	return BaseReviewService{
+		DbConn:       conn,
+		Repo:         repository.New(conn),
+		Tiebreak:     ReviewTiebreak,
+		BlockedWords: ParseBlockedWords(ReviewBlockedWords),
+	}
+}
+
+func (r *BaseReviewService) AddReview(ctx context.Context, username string, mealID int64, req *models.ReviewRequest) (int32, error) {
+	if req == nil {
+		return 0, ErrValidation
+	}
+
+	if err := req.Validate(); err != nil || mealID <= 0 || mealID > math.MaxInt32 {
+		return 0, ErrValidation
+	}
+	if !CommentAllowed(req.Comment, r.BlockedWords) {
+		return 0, ErrValidation
+	}
+
+	if _, err := r.Repo.GetRecipeWithId(ctx, int32(mealID)); errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNoRecipesFound
+	} else if err != nil {
+		log.Println(err.Error())
+		return 0, ErrInternalFailure
+	}
+
+	id, err := r.Repo.CreateReview(ctx, repository.CreateReviewParams{
+		RecipeID:    int32(mealID),
+		Username:    username,
+		ReviewScore: req.Score,
+		Comment:     req.Comment,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrInternalFailure
+	}
+	return id, nil
+}
+
+// ListMealReviews returns the recipe's reviews, most helpful first.
+func (r *BaseReviewService) ListMealReviews(ctx context.Context, mealID int64) ([]repository.ListRecipeReviewsRow, error) {
+	if mealID <= 0 || mealID > math.MaxInt32 {
+		return nil, ErrValidation
+	}
+
+	reviews, err := r.Repo.ListRecipeReviews(ctx, int32(mealID))
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	SortReviews(reviews, r.Tiebreak)
+	return reviews, nil
+}
+
+// VoteReview records the user's vote on a review, replacing an earlier one.
+// Authors can't vote on their own reviews.
+func (r *BaseReviewService) VoteReview(ctx context.Context, username string, reviewID int64, up bool) error {
+	if reviewID <= 0 || reviewID > math.MaxInt32 {
+		return ErrValidation
+	}
+
+	author, err := r.Repo.GetReviewAuthor(ctx, int32(reviewID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if author == username {
+		return ErrValidation
+	}
+
+	if err := r.Repo.UpsertReviewVote(ctx, repository.UpsertReviewVoteParams{
+		ReviewID: int32(reviewID),
+		Username: username,
+		Up:       up,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+// EditMealReview replaces the text of the user's own review. The version it
+// replaces is kept in review_edits and the review is marked as edited.
+func (r *BaseReviewService) EditMealReview(ctx context.Context, username string, reviewID int64, newBody string) error {
+	if reviewID <= 0 || reviewID > math.MaxInt32 {
+		return ErrValidation
+	}
+	if len(newBody) > models.MaxReviewCommentLength || !CommentAllowed(newBody, r.BlockedWords) {
+		return ErrValidation
+	}
+
+	tx, err := r.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := r.Repo.WithTx(tx)
+
+	review, err := qtx.GetReviewForUpdate(ctx, int32(reviewID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if review.Username != username {
+		return ErrForbidden
+	}
+	if review.Comment == newBody {
+		return nil
+	}
+
+	writtenAt := review.CreatedAt
+	if review.EditedAt.Valid {
+		writtenAt = review.EditedAt.Time
+	}
+	if err := qtx.InsertReviewEdit(ctx, repository.InsertReviewEditParams{
+		ReviewID:  int32(reviewID),
+		Comment:   review.Comment,
+		WrittenAt: writtenAt,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := qtx.UpdateReviewComment(ctx, repository.UpdateReviewCommentParams{
+		Comment: newBody,
+		ID:      int32(reviewID),
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+// ListReviewEdits returns the earlier versions of a review, oldest first.
+func (r *BaseReviewService) ListReviewEdits(ctx context.Context, reviewID int64) ([]repository.ReviewEdit, error) {
+	if reviewID <= 0 || reviewID > math.MaxInt32 {
+		return nil, ErrValidation
+	}
+
+	if _, err := r.Repo.GetReviewAuthor(ctx, int32(reviewID)); errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	} else if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	edits, err := r.Repo.ListReviewEdits(ctx, int32(reviewID))
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	if edits == nil {
+		edits = []repository.ReviewEdit{}
+	}
+	return edits, nil
+}
+
+// ParseBlockedWords splits a comma-separated word list, dropping blanks.
+func ParseBlockedWords(spec string) []string {
+	var words []string
+	for _, word := range strings.Split(spec, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// CommentAllowed reports whether the comment contains none of the blocked
+// words. Words are compared whole and case insensitively, so a blocked word
+// inside a longer one doesn't count.
+func CommentAllowed(comment string, blocked []string) bool {
+	if len(blocked) == 0 {
+		return true
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(comment), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	for _, word := range words {
+		if slices.Contains(blocked, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortReviews orders reviews by net helpfulness, then by tiebreak, then by id.
+// Unknown tiebreaks fall back to "newest".
+func SortReviews(reviews []repository.ListRecipeReviewsRow, tiebreak string) {
+	slices.SortStableFunc(reviews, func(a, b repository.ListRecipeReviewsRow) int {
+		if c := cmp.Compare(b.Helpfulness, a.Helpfulness); c != 0 {
+			return c
+		}
+
+		switch tiebreak {
+		case "oldest":
+			if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+				return c
+			}
+		case "score":
+			if c := cmp.Compare(b.ReviewScore, a.ReviewScore); c != 0 {
+				return c
+			}
+		default:
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+)
+
+// MinimalClaims keeps tokens down to sub, exp, iat and jti. The role is then
+// resolved from the database on every request instead of trusted from the token.
+var MinimalClaims = config.Bool("JWT_MINIMAL_CLAIMS", false)
+
+// How long a resolved role is reused before it's looked up again.
+var RoleCacheTTL = config.Duration("ROLE_CACHE_TTL", 30*time.Second)
+
+type RoleLookup func(ctx context.Context, username string) (string, error)
+
+// RoleCache is a TTL cache in front of a role lookup. Entries are dropped
+// with Invalidate as soon as a role changes; with a cache only this instance
+// sees, the TTL bounds staleness everywhere else.
+type RoleCache struct {
+	lookup RoleLookup
+	ttl    time.Duration
+	// Store holds the roles, in memory unless replaced with a shared store.
+	Store Cache
+}
+
+func NewRoleCache(lookup RoleLookup, ttl time.Duration) *RoleCache {
+	return &RoleCache{
+		lookup: lookup,
+		ttl:    ttl,
+		Store:  NewMemoryCache().Store("roles"),
+	}
+}
+
+func (c *RoleCache) Role(ctx context.Context, username string) (string, error) {
+	role, err := c.Store.GetOrLoad(ctx, username, c.ttl, func(ctx context.Context) ([]byte, error) {
+		role, err := c.lookup(ctx, username)
+		return []byte(role), err
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(role), nil
+}
+
+func (c *RoleCache) Invalidate(username string) {
+	if err := c.Store.Delete(context.Background(), username); err != nil {
+		log.Println("role cache invalidation failed:", err)
+	}
+}
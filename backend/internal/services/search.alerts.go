@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How often saved searches are checked for new recipes.
+var SearchAlertInterval = config.Duration("SEARCH_ALERT_INTERVAL", 15*time.Minute)
+
+type SearchAlertJob struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+// NewSearchAlertJob expects a connection of its own, like NewUserPurgeJob.
+func NewSearchAlertJob(conn *pgx.Conn) SearchAlertJob {
+	return SearchAlertJob{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+// CheckSavedSearches queues an alert for every recipe added since a saved
+// search was last checked that matches it, and moves the search's
+// last_checked_at up. It returns the number of alerts queued.
+func (j *SearchAlertJob) CheckSavedSearches(ctx context.Context) (int, error) {
+	searches, err := j.Repo.ListAllSavedSearches(ctx)
+	if err != nil {
+		log.Println("list saved searches failed:", err)
+		return 0, ErrInternalFailure
+	}
+	if len(searches) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	since := slices.MinFunc(searches, func(a, b repository.SavedSearch) int {
+		return a.LastCheckedAt.Compare(b.LastCheckedAt)
+	}).LastCheckedAt
+	recipes, err := j.Repo.ListRecipesCreatedBetween(ctx, repository.ListRecipesCreatedBetweenParams{
+		Since: since,
+		Until: now,
+	})
+	if err != nil {
+		log.Println("list new recipes failed:", err)
+		return 0, ErrInternalFailure
+	}
+
+	queued := 0
+	for _, search := range searches {
+		if ctx.Err() != nil {
+			break
+		}
+		matches := NewSearchMatches(search, recipes)
+		if err := j.queueAlerts(ctx, search.ID, matches, now); err != nil {
+			log.Printf("queue alerts for saved search %d failed: %v", search.ID, err)
+			continue
+		}
+		queued += len(matches)
+	}
+
+	log.Printf("queued %d saved search alerts", queued)
+	return queued, nil
+}
+
+func (j *SearchAlertJob) queueAlerts(ctx context.Context, searchID int64, recipeIDs []int32, checkedAt time.Time) error {
+	tx, err := j.DbConn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	qtx := j.Repo.WithTx(tx)
+
+	for _, id := range recipeIDs {
+		if err := qtx.InsertSearchAlert(ctx, repository.InsertSearchAlertParams{
+			SavedSearchID: searchID,
+			RecipeID:      id,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := qtx.SetSavedSearchChecked(ctx, repository.SetSavedSearchCheckedParams{
+		CheckedAt: checkedAt,
+		ID:        searchID,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Run checks once immediately and then every interval until ctx is done.
+func (j *SearchAlertJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.CheckSavedSearches(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewSearchMatches returns the ids of the recipes added after the search was
+// last checked that match it.
+func NewSearchMatches(search repository.SavedSearch, recipes []repository.ListRecipesCreatedBetweenRow) []int32 {
+	var ids []int32
+	for _, recipe := range recipes {
+		if recipe.CreatedAt.After(search.LastCheckedAt) && SearchMatches(&search.Params, recipe) {
+			ids = append(ids, recipe.ID)
+		}
+	}
+	return ids
+}
+
+// SearchMatches reports whether the recipe passes the search's filters, with
+// tag types as in FilterRecipesByTagNamesAndParams.
+func SearchMatches(search *models.MealSearchRequest, recipe repository.ListRecipesCreatedBetweenRow) bool {
+	if search.MinTime > 0 && recipe.Time < search.MinTime ||
+		search.MaxTime > 0 && recipe.Time > search.MaxTime ||
+		search.MinDifficulty > 0 && recipe.Difficulty < search.MinDifficulty ||
+		search.MaxDifficulty > 0 && recipe.Difficulty > search.MaxDifficulty {
+		return false
+	}
+
+	hasTag := func(typeID int32, names []string) bool {
+		for i, name := range recipe.TagNames {
+			if i < len(recipe.TagTypeIds) && recipe.TagTypeIds[i] == typeID && slices.Contains(names, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	required := []struct {
+		typeID int32
+		names  []string
+	}{
+		{1, search.Diet},
+		{2, search.Region},
+		{3, search.RecipeType},
+		{5, search.Nutrients},
+		{6, search.Others},
+	}
+	for _, filter := range required {
+		if len(filter.names) > 0 && !hasTag(filter.typeID, filter.names) {
+			return false
+		}
+	}
+	return len(search.Allergies) == 0 || !hasTag(4, search.Allergies)
+}
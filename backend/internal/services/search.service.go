@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+type SavedSearchService interface {
+	SaveSearch(ctx context.Context, username string, req *models.MealSearchRequest, name string) (int64, error)
+	ListSavedSearches(ctx context.Context, username string) ([]repository.ListSavedSearchesRow, error)
+}
+
+type BaseSavedSearchService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+}
+
+func NewBaseSavedSearchService(conn *pgx.Conn) BaseSavedSearchService {
+	return BaseSavedSearchService{
+		DbConn: conn,
+		Repo:   repository.New(conn),
+	}
+}
+
+// SaveSearch keeps the search under name, replacing the user's search of the
+// same name. Alerts cover recipes added from now on.
+func (s *BaseSavedSearchService) SaveSearch(ctx context.Context, username string, req *models.MealSearchRequest, name string) (int64, error) {
+	if req == nil {
+		return 0, ErrValidation
+	}
+
+	save := models.SaveSearchRequest{Name: name, Search: *req}
+	if err := save.Validate(); err != nil {
+		return 0, ErrValidation
+	}
+
+	id, err := s.Repo.SaveSearch(ctx, repository.SaveSearchParams{
+		Username: username,
+		Name:     strings.TrimSpace(name),
+		Params:   *req,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrInternalFailure
+	}
+	return id, nil
+}
+
+func (s *BaseSavedSearchService) ListSavedSearches(ctx context.Context, username string) ([]repository.ListSavedSearchesRow, error) {
+	searches, err := s.Repo.ListSavedSearches(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	return searches, nil
+}
@@ -1,8 +1,112 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+)
 
 var (
-	ErrUnauthorizedUser = errors.New("wrong login or password")
-	ErrInternalFailure  = errors.New("internal failure")
+	ErrUnauthorizedUser     = errors.New("wrong login or password")
+	ErrInternalFailure      = errors.New("internal failure")
+	ErrValidation           = errors.New("validation failed")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrWrongPassword        = errors.New("wrong password")
+	ErrPasswordReused       = errors.New("password was used recently")
+	ErrForbidden            = errors.New("forbidden")
+	ErrCollectionNotFound   = errors.New("collection not found")
+	ErrShareNotFound        = errors.New("share link not found")
+	ErrNoRecipesFound       = errors.New("no recipes found")
+	ErrTagNotFound          = errors.New("tag not found")
+	ErrChangeTooSoon        = errors.New("changed too recently")
+	ErrImportJobNotFound    = errors.New("import job not found")
+	ErrFavoriteLimitReached = errors.New("favorites limit reached")
+	ErrFavoriteNotFound     = errors.New("favorite not found")
+	ErrIngredientNotFound   = errors.New("ingredient not found")
+	ErrReviewNotFound       = errors.New("review not found")
+	ErrIncompleteProfile    = errors.New("profile is missing weight, height, age or sex")
+	ErrDuplicateRecipe      = errors.New("similar recipes already exist")
+	ErrAPIKeyNotFound       = errors.New("api key not found")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrCaptchaRequired      = errors.New("captcha required")
+	ErrCaptchaFailed        = errors.New("captcha verification failed")
+	ErrServiceBusy          = errors.New("service busy, try again later")
+	ErrSearchTimeout        = errors.New("search took too long")
+	ErrNoSubstitute         = errors.New("some ingredients have no substitute for the diet")
+	ErrInventoryUnavailable = errors.New("grocery provider inventory unavailable")
+	ErrLoginThrottled       = errors.New("too many failed logins, try again later")
+	ErrInvalidImage         = errors.New("image can't be decoded or is too large")
+	ErrImageNotAllowed      = errors.New("image isn't on the configured image storage")
 )
+
+// ChangeTooSoonError wraps ErrChangeTooSoon with the time left until the
+// change is allowed again.
+type ChangeTooSoonError struct {
+	Remaining time.Duration
+}
+
+func (e *ChangeTooSoonError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrChangeTooSoon, e.Remaining.Round(time.Second))
+}
+
+func (e *ChangeTooSoonError) Unwrap() error {
+	return ErrChangeTooSoon
+}
+
+// DuplicateRecipeError wraps ErrDuplicateRecipe with the recipes the new one
+// looks like. Creating again with force set skips the check.
+type DuplicateRecipeError struct {
+	Duplicates []models.DuplicateRecipe
+}
+
+func (e *DuplicateRecipeError) Error() string {
+	return ErrDuplicateRecipe.Error()
+}
+
+func (e *DuplicateRecipeError) Unwrap() error {
+	return ErrDuplicateRecipe
+}
+
+// NutritionError wraps ErrValidation with the nutrition warnings that
+// blocked a recipe while strict nutrition checks are on.
+type NutritionError struct {
+	Warnings []models.NutritionWarning
+}
+
+func (e *NutritionError) Error() string {
+	return "implausible nutrition values"
+}
+
+func (e *NutritionError) Unwrap() error {
+	return ErrValidation
+}
+
+// SubstitutionError wraps ErrNoSubstitute with the ingredients that stop a
+// meal from being transformed for a diet.
+type SubstitutionError struct {
+	Ingredients []string
+}
+
+func (e *SubstitutionError) Error() string {
+	return ErrNoSubstitute.Error()
+}
+
+func (e *SubstitutionError) Unwrap() error {
+	return ErrNoSubstitute
+}
+
+// LoginError wraps ErrUnauthorizedUser with why the login failed. Its message
+// is ErrUnauthorizedUser's, so the reason can't leak into a response.
+type LoginError struct {
+	Reason error
+}
+
+func (e *LoginError) Error() string {
+	return ErrUnauthorizedUser.Error()
+}
+
+func (e *LoginError) Unwrap() []error {
+	return []error{ErrUnauthorizedUser, e.Reason}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+)
+
+// IngredientCategories maps lowercase ingredient names to the aisle they're
+// bought in. Ingredients missing here are listed under "other".
+var IngredientCategories = map[string]string{
+	"cebula":                    models.ShoppingCategoryProduce,
+	"czerwona cebula":           models.ShoppingCategoryProduce,
+	"czosnek":                   models.ShoppingCategoryProduce,
+	"ząbek czosnku":             models.ShoppingCategoryProduce,
+	"imbir":                     models.ShoppingCategoryProduce,
+	"natka pietruszki":          models.ShoppingCategoryProduce,
+	"szczypiorek":               models.ShoppingCategoryProduce,
+	"kolendra":                  models.ShoppingCategoryProduce,
+	"bazylia":                   models.ShoppingCategoryProduce,
+	"papryka":                   models.ShoppingCategoryProduce,
+	"papryka czerwona":          models.ShoppingCategoryProduce,
+	"papryczka chili":           models.ShoppingCategoryProduce,
+	"marchewka":                 models.ShoppingCategoryProduce,
+	"pomidor":                   models.ShoppingCategoryProduce,
+	"pomidorki koktajlowe":      models.ShoppingCategoryProduce,
+	"szpinak":                   models.ShoppingCategoryProduce,
+	"ziemniak":                  models.ShoppingCategoryProduce,
+	"ziemniaki":                 models.ShoppingCategoryProduce,
+	"seler naciowy":             models.ShoppingCategoryProduce,
+	"por":                       models.ShoppingCategoryProduce,
+	"kapusta":                   models.ShoppingCategoryProduce,
+	"cukinia":                   models.ShoppingCategoryProduce,
+	"cytryna":                   models.ShoppingCategoryProduce,
+	"limonka":                   models.ShoppingCategoryProduce,
+	"mięso mielone wołowe":      models.ShoppingCategoryMeat,
+	"pierś z kurczaka":          models.ShoppingCategoryMeat,
+	"filet z piersi kurczaka":   models.ShoppingCategoryMeat,
+	"boczek":                    models.ShoppingCategoryMeat,
+	"krewetki":                  models.ShoppingCategoryFish,
+	"łosoś":                     models.ShoppingCategoryFish,
+	"tuńczyk":                   models.ShoppingCategoryFish,
+	"jajko":                     models.ShoppingCategoryDairy,
+	"masło":                     models.ShoppingCategoryDairy,
+	"mleko":                     models.ShoppingCategoryDairy,
+	"śmietana":                  models.ShoppingCategoryDairy,
+	"śmietanka 30%":             models.ShoppingCategoryDairy,
+	"jogurt naturalny":          models.ShoppingCategoryDairy,
+	"ser cheddar":               models.ShoppingCategoryDairy,
+	"parmezan":                  models.ShoppingCategoryDairy,
+	"mozzarella":                models.ShoppingCategoryDairy,
+	"chleb":                     models.ShoppingCategoryBakery,
+	"bułka tarta":               models.ShoppingCategoryBakery,
+	"tortilla":                  models.ShoppingCategoryBakery,
+	"mąka pszenna":              models.ShoppingCategoryPantry,
+	"cukier":                    models.ShoppingCategoryPantry,
+	"miód":                      models.ShoppingCategoryPantry,
+	"ryż":                       models.ShoppingCategoryPantry,
+	"makaron":                   models.ShoppingCategoryPantry,
+	"skrobia ziemniaczana":      models.ShoppingCategoryPantry,
+	"proszek do pieczenia":      models.ShoppingCategoryPantry,
+	"olej":                      models.ShoppingCategoryPantry,
+	"olej roślinny":             models.ShoppingCategoryPantry,
+	"olej sezamowy":             models.ShoppingCategoryPantry,
+	"oliwa":                     models.ShoppingCategoryPantry,
+	"oliwa z oliwek":            models.ShoppingCategoryPantry,
+	"sos sojowy":                models.ShoppingCategoryPantry,
+	"ocet ryżowy":               models.ShoppingCategoryPantry,
+	"ketchup":                   models.ShoppingCategoryPantry,
+	"koncentrat pomidorowy":     models.ShoppingCategoryPantry,
+	"pomidory siekane w puszce": models.ShoppingCategoryPantry,
+	"suszone pomidory":          models.ShoppingCategoryPantry,
+	"bulion":                    models.ShoppingCategoryPantry,
+	"bulion drobiowy":           models.ShoppingCategoryPantry,
+	"bulion warzywny":           models.ShoppingCategoryPantry,
+	"sok z cytryny":             models.ShoppingCategoryPantry,
+	"sok z limonki":             models.ShoppingCategoryPantry,
+	"sól":                       models.ShoppingCategorySpices,
+	"sól morska":                models.ShoppingCategorySpices,
+	"pieprz":                    models.ShoppingCategorySpices,
+	"pieprz czarny":             models.ShoppingCategorySpices,
+	"pieprz biały":              models.ShoppingCategorySpices,
+	"pieprz cayenne":            models.ShoppingCategorySpices,
+	"papryka słodka":            models.ShoppingCategorySpices,
+	"papryka ostra":             models.ShoppingCategorySpices,
+	"papryka wędzona":           models.ShoppingCategorySpices,
+	"papryka mielona":           models.ShoppingCategorySpices,
+	"płatki chili":              models.ShoppingCategorySpices,
+	"cynamon":                   models.ShoppingCategorySpices,
+	"kurkuma":                   models.ShoppingCategorySpices,
+	"kmin rzymski":              models.ShoppingCategorySpices,
+	"kolendra mielona":          models.ShoppingCategorySpices,
+	"imbir mielony":             models.ShoppingCategorySpices,
+	"czosnek granulowany":       models.ShoppingCategorySpices,
+	"liść laurowy":              models.ShoppingCategorySpices,
+	"ziele angielskie":          models.ShoppingCategorySpices,
+	"oregano":                   models.ShoppingCategorySpices,
+	"oregano suszone":           models.ShoppingCategorySpices,
+	"tymianek":                  models.ShoppingCategorySpices,
+	"rozmaryn":                  models.ShoppingCategorySpices,
+	"majeranek":                 models.ShoppingCategorySpices,
+	"przyprawa curry":           models.ShoppingCategorySpices,
+	"mrożony groszek":           models.ShoppingCategoryFrozen,
+	"mrożone warzywa":           models.ShoppingCategoryFrozen,
+}
+
+// IngredientCategory returns the aisle of an ingredient by categories, or
+// "other" when it has none.
+func IngredientCategory(name string, categories map[string]string) string {
+	if category, ok := categories[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return category
+	}
+	return models.ShoppingCategoryOther
+}
+
+// GroupByAisle splits a shopping list into aisles, in the order of
+// models.ShoppingCategories. Items keep their order within an aisle; ones in an
+// aisle not listed there go to "other".
+func GroupByAisle(items []models.ShoppingItem, categories map[string]string) []models.ShoppingAisle {
+	byCategory := make(map[string][]models.ShoppingItem)
+	for _, item := range items {
+		category := IngredientCategory(item.Name, categories)
+		if !slices.Contains(models.ShoppingCategories, category) {
+			category = models.ShoppingCategoryOther
+		}
+		byCategory[category] = append(byCategory[category], item)
+	}
+
+	aisles := make([]models.ShoppingAisle, 0, len(byCategory))
+	for _, category := range models.ShoppingCategories {
+		if items := byCategory[category]; len(items) > 0 {
+			aisles = append(aisles, models.ShoppingAisle{Category: category, Items: items})
+		}
+	}
+	return aisles
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+const MaxShoppingListMeals = 50
+
+// Most planned meals a weekly shopping list is made from, two weeks of ten a
+// day.
+const MaxWeeklyShoppingListMeals = 140
+
+type ShoppingListService interface {
+	ShoppingList(ctx context.Context, username string, mealIDs []int64) ([]models.ShoppingItem, error)
+	GenerateWeeklyShoppingList(ctx context.Context, username string, plan models.WeeklyPlan) (models.WeeklyShoppingList, error)
+}
+
+type BaseShoppingListService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+	// Aisle of each lowercase ingredient name.
+	Categories map[string]string
+}
+
+func NewBaseShoppingListService(conn *pgx.Conn) BaseShoppingListService {
+	return BaseShoppingListService{
+		DbConn:     conn,
+		Repo:       repository.New(conn),
+		Categories: IngredientCategories,
+	}
+}
+
+// ShoppingList adds up the ingredients of the recipes, each scaled to the
+// user's default servings. A recipe listed twice is bought for twice.
+func (s *BaseShoppingListService) ShoppingList(ctx context.Context, username string, mealIDs []int64) ([]models.ShoppingItem, error) {
+	if len(mealIDs) == 0 || len(mealIDs) > MaxShoppingListMeals {
+		return nil, ErrValidation
+	}
+
+	servings, err := s.Repo.GetUserDefaultServings(ctx, username)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	var ingredients []models.Ingredient
+	for _, id := range mealIDs {
+		if id <= 0 || id > math.MaxInt32 {
+			return nil, ErrValidation
+		}
+		recipe, err := s.Repo.GetRecipeWithId(ctx, int32(id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecipesFound
+		}
+		if err != nil {
+			log.Println(err.Error())
+			return nil, ErrInternalFailure
+		}
+		if servings != nil {
+			recipe = ScaleRecipe(recipe, *servings)
+		}
+		ingredients = append(ingredients, recipe.Ingredients.Ingredients...)
+	}
+
+	return AggregateIngredients(ingredients), nil
+}
+
+// GenerateWeeklyShoppingList adds up the ingredients of every meal of the
+// plan, grouped by aisle. Each meal is bought for its planned servings (one
+// when unset) times the user's default servings, so a meal planned on three
+// days is bought three times.
+func (s *BaseShoppingListService) GenerateWeeklyShoppingList(ctx context.Context, username string, plan models.WeeklyPlan) (models.WeeklyShoppingList, error) {
+	var meals []models.PlanMeal
+	for _, day := range plan.Days {
+		for _, meal := range day.Meals {
+			if meal.ID <= 0 || meal.Servings < 0 {
+				return models.WeeklyShoppingList{}, ErrValidation
+			}
+			meals = append(meals, meal)
+		}
+	}
+	if len(meals) == 0 || len(meals) > MaxWeeklyShoppingListMeals {
+		return models.WeeklyShoppingList{}, ErrValidation
+	}
+
+	household, err := s.Repo.GetUserDefaultServings(ctx, username)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println(err.Error())
+		return models.WeeklyShoppingList{}, ErrInternalFailure
+	}
+
+	recipes := make(map[int32]repository.Recipe)
+	var ingredients []models.Ingredient
+	for _, meal := range meals {
+		recipe, ok := recipes[meal.ID]
+		if !ok {
+			recipe, err = s.Repo.GetRecipeWithId(ctx, meal.ID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return models.WeeklyShoppingList{}, ErrNoRecipesFound
+			}
+			if err != nil {
+				log.Println(err.Error())
+				return models.WeeklyShoppingList{}, ErrInternalFailure
+			}
+			recipes[meal.ID] = recipe
+		}
+		ingredients = append(ingredients, ScaleRecipe(recipe, PlannedServings(meal, household)).Ingredients.Ingredients...)
+	}
+
+	return models.WeeklyShoppingList{
+		Aisles: GroupByAisle(AggregateIngredients(ingredients), s.Categories),
+	}, nil
+}
+
+// PlannedServings is how many servings of a planned meal to buy for: its
+// planned servings for each of the household's default servings.
+func PlannedServings(meal models.PlanMeal, household *int32) int32 {
+	servings := max(meal.Servings, 1)
+	if household != nil && *household > 0 {
+		servings *= *household
+	}
+	return servings
+}
+
+// AggregateIngredients sums ingredients by name (case insensitive) and base
+// unit, sorted by name, and fills in the display quantities.
+func AggregateIngredients(ingredients []models.Ingredient) []models.ShoppingItem {
+	totals := make(map[pantryKey]*models.ShoppingItem)
+	for _, ingredient := range ingredients {
+		amount, unit := NormalizeQuantity(ingredient.Amount, ingredient.Unit)
+		if amount <= 0 {
+			continue
+		}
+		key := pantryKey{strings.ToLower(strings.TrimSpace(ingredient.Name)), unit}
+		if item, ok := totals[key]; ok {
+			item.Amount += amount
+			continue
+		}
+		totals[key] = &models.ShoppingItem{Name: strings.TrimSpace(ingredient.Name), Amount: amount, Unit: unit}
+	}
+
+	items := make([]models.ShoppingItem, 0, len(totals))
+	for _, item := range totals {
+		item.DisplayAmount, item.DisplayUnit = DisplayQuantity(item.Amount, item.Unit)
+		items = append(items, *item)
+	}
+	slices.SortFunc(items, func(a, b models.ShoppingItem) int {
+		if c := cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Unit, b.Unit)
+	})
+	return items
+}
+
+// DisplayRule shows amounts of a base unit below Below (0 = any amount) in
+// Unit, Factor base units each, rounded to the nearest Step.
+type DisplayRule struct {
+	Below  int64
+	Unit   string
+	Factor int64
+	Step   float64
+}
+
+// DisplayRules lists, per base unit, the rules tried in order. Base units
+// without rules are shown as they are.
+var DisplayRules = map[string][]DisplayRule{
+	"g": {
+		{Below: 10, Unit: "g", Factor: 1, Step: 1},
+		{Below: 100, Unit: "g", Factor: 1, Step: 5},
+		{Below: 1000, Unit: "g", Factor: 1, Step: 50},
+		{Unit: "kg", Factor: 1000, Step: 0.25},
+	},
+	"ml": {
+		{Below: 100, Unit: "ml", Factor: 1, Step: 10},
+		{Below: 1000, Unit: "ml", Factor: 1, Step: 50},
+		{Unit: "l", Factor: 1000, Step: 0.25},
+	},
+	"szt": {
+		{Unit: "szt", Factor: 1, Step: 1},
+	},
+}
+
+// DisplayQuantity rounds an amount in a base unit for a shopping list, e.g.
+// 473 ml to "450" ml and 1240 g to "1.25" kg. Amounts never round down to
+// zero, and an amount that rounds up past a rule's range uses the next rule.
+func DisplayQuantity(amount int64, unit string) (string, string) {
+	for _, rule := range DisplayRules[unit] {
+		if rule.Below > 0 && amount >= rule.Below {
+			continue
+		}
+		rounded := math.Round(float64(amount)/float64(rule.Factor)/rule.Step) * rule.Step
+		if rounded == 0 {
+			rounded = rule.Step
+		}
+		if rule.Below > 0 && rounded*float64(rule.Factor) >= float64(rule.Below) {
+			continue
+		}
+		return strconv.FormatFloat(rounded, 'f', -1, 64), rule.Unit
+	}
+	return strconv.FormatInt(amount, 10), unit
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Credentials other services use for POST /introspect (HTTP basic auth).
+// Without a secret the endpoint rejects every client.
+var (
+	IntrospectionClientID     = config.String("INTROSPECTION_CLIENT_ID", "introspect")
+	IntrospectionClientSecret = config.String("INTROSPECTION_CLIENT_SECRET", "")
+)
+
+// How long tokens last for each client. Mobile apps stay signed in longer.
+var (
+	WebSessionTTL    = config.Duration("WEB_SESSION_TTL", 24*time.Hour)
+	MobileSessionTTL = config.Duration("MOBILE_SESSION_TTL", 30*24*time.Hour)
+	APISessionTTL    = config.Duration("API_SESSION_TTL", 24*time.Hour)
+)
+
+// SessionTTL is how long a token issued to client lasts. Unknown clients get
+// the web policy.
+func SessionTTL(client string) time.Duration {
+	switch client {
+	case models.ClientMobile:
+		return MobileSessionTTL
+	case models.ClientAPI:
+		return APISessionTTL
+	default:
+		return WebSessionTTL
+	}
+}
+
+// Type reported for the tokens issued at login.
+const AccessTokenType = "access"
+
+type TokenService interface {
+	Introspect(ctx context.Context, token string) (models.Introspection, error)
+	RevokeToken(ctx context.Context, token string) error
+	RevokeAllSessions(ctx context.Context, username string, client string) error
+	ListSessions(ctx context.Context, username string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, username string, sessionID string) error
+}
+
+type BaseTokenService struct {
+	DbConn *pgx.Conn
+	Repo   *repository.Queries
+	Keys   *auth.KeyStore
+	// AcceptUsernameSubject keeps tokens with a username subject active, as
+	// for the API's own requests.
+	AcceptUsernameSubject bool
+}
+
+func NewBaseTokenService(conn *pgx.Conn) BaseTokenService {
+	return BaseTokenService{
+		DbConn:                conn,
+		Repo:                  repository.New(conn),
+		Keys:                  auth.Keys(),
+		AcceptUsernameSubject: AcceptUsernameSubject,
+	}
+}
+
+// Introspect reports whether token is currently valid: correctly signed, not
+// expired, not signed out and not issued before the user's tokens were
+// revoked. A token that isn't gets {active: false}, never an error.
+func (t *BaseTokenService) Introspect(ctx context.Context, token string) (models.Introspection, error) {
+	inactive := models.Introspection{}
+
+	claims, err := VerifyToken(token, t.Keys)
+	if err != nil {
+		return inactive, nil
+	}
+	subject, _ := claims.GetSubject()
+	exp, _ := claims.GetExpirationTime()
+	iat, _ := claims.GetIssuedAt()
+	if subject == "" || exp == nil || iat == nil {
+		return inactive, nil
+	}
+	// Tokens from before clients were told apart were all issued to web.
+	client, _ := claims["client"].(string)
+	if client == "" {
+		client = models.ClientWeb
+	}
+
+	username := subject
+	if !models.LooksLikeUUID(subject) && !t.AcceptUsernameSubject {
+		return inactive, nil
+	}
+	if models.LooksLikeUUID(subject) {
+		username, err = t.Repo.GetUsernameByUserID(ctx, subject)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return inactive, nil
+		}
+		if err != nil {
+			log.Println(err.Error())
+			return inactive, ErrInternalFailure
+		}
+	}
+
+	revoked, err := t.IsRevoked(ctx, username, claims)
+	if err != nil {
+		return inactive, err
+	}
+	if revoked {
+		return inactive, nil
+	}
+
+	// Minimal tokens carry no role; report the current one.
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role, err = t.Repo.GetUserRole(ctx, username)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return inactive, nil
+		}
+		if err != nil {
+			log.Println(err.Error())
+			return inactive, ErrInternalFailure
+		}
+	}
+
+	return models.Introspection{
+		Active: true,
+		Sub:    subject,
+		Exp:    exp.Unix(),
+		Role:   role,
+		Typ:    AccessTokenType,
+		Client: client,
+	}, nil
+}
+
+// IsRevoked reports whether the token with claims, issued to username, was
+// signed out or issued before the user's tokens, or those of its client, were
+// revoked. Tokens without an issue time count as revoked.
+func (t *BaseTokenService) IsRevoked(ctx context.Context, username string, claims jwt.MapClaims) (bool, error) {
+	iat, _ := claims.GetIssuedAt()
+	if iat == nil {
+		return true, nil
+	}
+	jti, _ := claims["jti"].(string)
+	// Tokens from before clients were told apart were all issued to web.
+	client, _ := claims["client"].(string)
+	if client == "" {
+		client = models.ClientWeb
+	}
+
+	revoked, err := t.Repo.IsTokenRevoked(ctx, repository.IsTokenRevokedParams{
+		Jti:      jti,
+		Username: username,
+		IssuedAt: iat.Unix(),
+		Client:   client,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return false, ErrInternalFailure
+	}
+	return revoked, nil
+}
+
+// RevokeToken signs a token out until it expires. Tokens that are already
+// invalid are ignored.
+func (t *BaseTokenService) RevokeToken(ctx context.Context, token string) error {
+	claims, err := VerifyToken(token, t.Keys)
+	if err != nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims.GetExpirationTime()
+	if jti == "" || exp == nil {
+		return nil
+	}
+
+	if err := t.Repo.RevokeToken(ctx, repository.RevokeTokenParams{
+		Jti:       jti,
+		ExpiresAt: exp.Unix(),
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if err := t.Repo.PruneRevokedTokens(ctx); err != nil {
+		log.Println("prune revoked tokens failed:", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions invalidates every token issued to the user before now,
+// or only those of client when it's set. Tokens of other clients stay valid.
+func (t *BaseTokenService) RevokeAllSessions(ctx context.Context, username string, client string) error {
+	if client != "" && !models.ValidClient(client) {
+		return ErrValidation
+	}
+
+	var err error
+	if client == "" {
+		err = t.Repo.RevokeUserTokens(ctx, username)
+	} else {
+		err = t.Repo.RevokeClientTokens(ctx, repository.RevokeClientTokensParams{
+			Username: username,
+			Client:   client,
+		})
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+// VerifyToken checks the signature and expiry of an HS256 token.
+func VerifyToken(token string, keys *auth.KeyStore) (jwt.MapClaims, error) {
+	return keys.Verify(token, jwt.WithExpirationRequired())
+}
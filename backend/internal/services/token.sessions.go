@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Longest User-Agent kept for a session, in characters.
+const MaxSessionUserAgentLength = 255
+
+// ListSessions returns the user's sessions that are still valid, most
+// recently used first.
+func (t *BaseTokenService) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	rows, err := t.Repo.ListSessions(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	sessions := make([]models.Session, len(rows))
+	for i, row := range rows {
+		sessions[i] = models.Session{
+			ID:         row.ID,
+			Client:     row.Client,
+			Device:     row.UserAgent,
+			IP:         row.Ip,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+		}
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's sessions out. Sessions of other
+// users are reported as missing.
+func (t *BaseTokenService) RevokeSession(ctx context.Context, username string, sessionID string) error {
+	if sessionID == "" {
+		return ErrValidation
+	}
+
+	tx, err := t.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := t.Repo.WithTx(tx)
+
+	expiresAt, err := qtx.DeleteSession(ctx, repository.DeleteSessionParams{
+		ID:       sessionID,
+		Username: username,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if err := qtx.RevokeToken(ctx, repository.RevokeTokenParams{
+		Jti:       sessionID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+// TouchSession records that the session was used now.
+func (t *BaseTokenService) TouchSession(ctx context.Context, sessionID string) error {
+	return t.Repo.TouchSession(ctx, sessionID)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
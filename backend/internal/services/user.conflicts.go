@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+)
+
+// Pairs of tags that contradict each other, written "A|B" and separated by
+// commas. Names match case insensitively.
+var TagConflictPairs = config.String("TAG_CONFLICTS", "Wegańska|Mięsna,Wegetariańska|Mięsna,Jarska|Mięsna,Wegańska|Keto")
+
+// TagConflictMatrix holds which tags conflict, by lowercase name, both ways.
+type TagConflictMatrix map[string]map[string]bool
+
+// ParseTagConflicts reads a TagConflictPairs spec. Malformed pairs are
+// logged and skipped.
+func ParseTagConflicts(spec string) TagConflictMatrix {
+	matrix := TagConflictMatrix{}
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		a, b, ok := strings.Cut(pair, "|")
+		a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+		if !ok || a == "" || b == "" || a == b {
+			log.Println("bad tag conflict pair:", pair)
+			continue
+		}
+		matrix.add(a, b)
+		matrix.add(b, a)
+	}
+	return matrix
+}
+
+func (m TagConflictMatrix) add(a, b string) {
+	if m[a] == nil {
+		m[a] = map[string]bool{}
+	}
+	m[a][b] = true
+}
+
+// Conflicts returns every conflicting pair among tags, in the order the tags
+// are given.
+func (m TagConflictMatrix) Conflicts(tags []string) []models.TagConflict {
+	conflicts := []models.TagConflict{}
+	for i, a := range tags {
+		for _, b := range tags[i+1:] {
+			if m[strings.ToLower(a)][strings.ToLower(b)] {
+				conflicts = append(conflicts, models.TagConflict{Tags: [2]string{a, b}})
+			}
+		}
+	}
+	return conflicts
+}
+
+// DetectTagConflicts reports the user's contradicting tags so they can be
+// warned. It doesn't stop the tags from being saved.
+func (s *BaseUserService) DetectTagConflicts(ctx context.Context, username string) ([]models.TagConflict, error) {
+	rows, err := s.Repo.DisplayUserTag(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	tags := make([]string, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, row.Value)
+	}
+	return s.Conflicts.Conflicts(tags), nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Extensions image entries keep from their URL; others get none.
+var archiveImageExts = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// UserExport is everything kept about a user, as written to export.json.
+type UserExport struct {
+	ExportedAt          time.Time                       `json:"exported_at"`
+	Account             repository.GetUserDataRow       `json:"account"`
+	Tags                []repository.DisplayUserTagRow  `json:"tags"`
+	ExcludedIngredients []string                        `json:"excluded_ingredients"`
+	Favorites           []repository.ListFavoritesRow   `json:"favorites"`
+	Pantry              []repository.ListPantryItemsRow `json:"pantry"`
+	Recipes             []repository.Recipe             `json:"recipes"`
+}
+
+// ExportUserArchive writes a ZIP of the user's data and the images of their
+// recipes to w.
+func (s *BaseUserService) ExportUserArchive(ctx context.Context, username string, w io.Writer) error {
+	export, err := s.loadUserExport(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	images := s.Images
+	if images == nil {
+		images = NewHTTPImageSource()
+	}
+	return WriteUserArchive(ctx, w, export, images, int64(ImageMaxBytes))
+}
+
+func (s *BaseUserService) loadUserExport(ctx context.Context, username string) (export UserExport, err error) {
+	export.ExportedAt = time.Now().UTC()
+	if export.Account, err = s.Repo.GetUserData(ctx, username); err != nil {
+		return export, err
+	}
+	if export.Tags, err = s.Repo.DisplayUserTag(ctx, username); err != nil {
+		return export, err
+	}
+	if export.ExcludedIngredients, err = s.Repo.ListExcludedIngredients(ctx, username); err != nil {
+		return export, err
+	}
+	if export.Favorites, err = s.Repo.ListFavorites(ctx, username); err != nil {
+		return export, err
+	}
+	if export.Pantry, err = s.Repo.ListPantryItems(ctx, username); err != nil {
+		return export, err
+	}
+	export.Recipes, err = s.Repo.ListUserRecipes(ctx, username)
+	return export, err
+}
+
+// WriteUserArchive writes export.json and then each recipe image, opened from
+// images, as images/recipe-<id><ext>. Only one image of at most maxBytes is
+// held in memory at a time. Images that can't be fetched or are too large
+// are skipped and listed in images/missing.txt.
+func WriteUserArchive(ctx context.Context, w io.Writer, export UserExport, images ImageSource, maxBytes int64) error {
+	archive := zip.NewWriter(w)
+
+	entry, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, recipe := range export.Recipes {
+		if recipe.ImageUrl == nil || *recipe.ImageUrl == "" {
+			continue
+		}
+		data, err := readArchiveImage(ctx, images, *recipe.ImageUrl, maxBytes)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("recipe %d (%s): %s", recipe.ID, *recipe.ImageUrl, err))
+			continue
+		}
+
+		entry, err := archive.Create(fmt.Sprintf("images/recipe-%d%s", recipe.ID, archiveImageExt(*recipe.ImageUrl)))
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		entry, err := archive.Create("images/missing.txt")
+		if err != nil {
+			return err
+		}
+		note := "These images couldn't be fetched and were left out:\n" + strings.Join(missing, "\n") + "\n"
+		if _, err := io.WriteString(entry, note); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func readArchiveImage(ctx context.Context, images ImageSource, imageURL string, maxBytes int64) ([]byte, error) {
+	body, err := images.Open(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var data bytes.Buffer
+	if _, err := io.Copy(&data, io.LimitReader(body, maxBytes+1)); err != nil {
+		return nil, err
+	}
+	if int64(data.Len()) > maxBytes {
+		return nil, errors.New("image too large")
+	}
+	return data.Bytes(), nil
+}
+
+func archiveImageExt(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if !slices.Contains(archiveImageExts, ext) {
+		return ""
+	}
+	return ext
+}
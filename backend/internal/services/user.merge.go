@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MergeAccounts moves source's favorites, collections, cooking log, tags,
+// exclusions, pantry and saved searches to target, then soft-deletes source,
+// all in one transaction. Things target already has, like the same favorite
+// or a saved search of the same name, are kept as target has them. Favorites
+// beyond FavoritesLimit are archived, oldest first.
+func (s *BaseUserService) MergeAccounts(ctx context.Context, source string, target string) error {
+	if err := validateMerge(source, target); err != nil {
+		return err
+	}
+
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+
+	if err := mergeAccounts(ctx, s.Repo.WithTx(tx), source, target, s.FavoritesLimit); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+// MergeGuestAccount merges the account req logs in to into target, the
+// signed-in user. The password proves the account is theirs, and is checked
+// with the same throttle and CAPTCHA as a login.
+func (s *BaseUserService) MergeGuestAccount(ctx context.Context, target string, req *models.MergeAccountRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	if err := s.checkLoginAttempt(ctx, req.Login, req.RemoteIP, req.CaptchaToken); err != nil {
+		return err
+	}
+	source, err := s.Repo.LoginUserWithUsername(ctx, req.Login)
+	if err != nil {
+		s.loginFailed(req.Login, req.RemoteIP)
+		return ErrUnauthorizedUser
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(source.Passwdhash), []byte(req.Password)); err != nil {
+		s.loginFailed(req.Login, req.RemoteIP)
+		return ErrUnauthorizedUser
+	}
+	s.loginSucceeded(req.Login, req.RemoteIP)
+
+	return s.MergeAccounts(ctx, source.Username, target)
+}
+
+// validateMerge rejects merging an account into itself or into nothing.
+func validateMerge(source string, target string) error {
+	if source == "" || target == "" || source == target {
+		return ErrValidation
+	}
+	return nil
+}
+
+// mergeAccounts does the work of MergeAccounts within qtx's transaction, once
+// validateMerge has passed. A favoritesLimit of 0 keeps every favorite.
+func mergeAccounts(ctx context.Context, qtx *repository.Queries, source string, target string, favoritesLimit int64) error {
+	locked, err := qtx.LockActiveUsers(ctx, []string{source, target})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if len(locked) != 2 {
+		return ErrUserNotFound
+	}
+
+	arg := repository.MoveFavoritesParams{Target: target, Source: source}
+	// Favorites go first so archived favorites see which the target has.
+	moves := []struct {
+		name string
+		move func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error)
+	}{
+		{"favorites", qtx.MoveFavorites},
+		{"archived favorites", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveArchivedFavorites(ctx, repository.MoveArchivedFavoritesParams(arg))
+		}},
+		{"collections", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveCollections(ctx, repository.MoveCollectionsParams(arg))
+		}},
+		{"recipes made", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveRecipesMade(ctx, repository.MoveRecipesMadeParams(arg))
+		}},
+		{"tags", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveUserTags(ctx, repository.MoveUserTagsParams(arg))
+		}},
+		{"excluded ingredients", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveExcludedIngredients(ctx, repository.MoveExcludedIngredientsParams(arg))
+		}},
+		{"pantry", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MovePantryItems(ctx, repository.MovePantryItemsParams(arg))
+		}},
+		{"saved searches", func(ctx context.Context, arg repository.MoveFavoritesParams) (int64, error) {
+			return qtx.MoveSavedSearches(ctx, repository.MoveSavedSearchesParams(arg))
+		}},
+	}
+	for _, step := range moves {
+		if _, err := step.move(ctx, arg); err != nil {
+			log.Printf("move %s failed: %v", step.name, err)
+			return ErrInternalFailure
+		}
+	}
+
+	if favoritesLimit > 0 {
+		if _, err := qtx.ArchiveFavoritesOverLimit(ctx, repository.ArchiveFavoritesOverLimitParams{
+			Username:       target,
+			FavoritesLimit: favoritesLimit,
+		}); err != nil {
+			log.Println("archive favorites over limit failed:", err)
+			return ErrInternalFailure
+		}
+	}
+
+	if _, err := qtx.SoftDeleteUser(ctx, source); err != nil {
+		log.Println("soft delete merged user failed:", err)
+		return ErrInternalFailure
+	}
+	return nil
+}
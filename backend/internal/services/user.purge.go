@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// How long a soft-deleted account is kept, and restorable, before it's purged.
+var UserDeleteRetention = config.Duration("USER_DELETE_RETENTION", 30*24*time.Hour)
+
+// How often the purge job runs.
+var UserPurgeInterval = config.Duration("USER_PURGE_INTERVAL", time.Hour)
+
+// Number of users removed per statement, so a large backlog doesn't hold
+// row locks for long.
+var userPurgeBatchSize = config.Int("USER_PURGE_BATCH_SIZE", 100)
+
+type UserPurgeJob struct {
+	Repo      *repository.Queries
+	Retention time.Duration
+	BatchSize int32
+}
+
+// NewUserPurgeJob expects a connection of its own; the job runs alongside
+// request handling and a pgx.Conn can't be shared between goroutines.
+func NewUserPurgeJob(conn *pgx.Conn) UserPurgeJob {
+	return UserPurgeJob{
+		Repo:      repository.New(conn),
+		Retention: UserDeleteRetention,
+		BatchSize: int32(userPurgeBatchSize),
+	}
+}
+
+// PurgeDeletedUsers hard-deletes users soft-deleted longer than Retention ago,
+// one batch at a time until nothing is left. Restored users have no deleted_at
+// and are never picked up. It returns the number of users purged.
+func (j *UserPurgeJob) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		usernames, err := j.Repo.PurgeDeletedUsers(ctx, repository.PurgeDeletedUsersParams{
+			RetentionSeconds: int32(j.Retention / time.Second),
+			BatchSize:        j.BatchSize,
+		})
+		if err != nil {
+			log.Println("purge deleted users failed:", err)
+			return purged, ErrInternalFailure
+		}
+		purged += len(usernames)
+
+		if len(usernames) == 0 || len(usernames) < int(j.BatchSize) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	log.Printf("purged %d deleted users", purged)
+	return purged, nil
+}
+
+// Run purges once immediately and then every interval until ctx is done.
+func (j *UserPurgeJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.PurgeDeletedUsers(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
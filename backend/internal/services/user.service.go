@@ -2,85 +2,313 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"log"
-	"os"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/config"
 	"github.com/miloszbo/meals-finder/internal/models"
 	repository "github.com/miloszbo/meals-finder/internal/repositories"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var key []byte = []byte(os.Getenv("APP_JWT_KEY"))
+// Number of previous password hashes kept per user and checked on password change.
+var passwordHistorySize = config.Int("PASSWORD_HISTORY_SIZE", 5)
+
+// Cost passwords are hashed with. Raising it only affects new hashes.
+var BcryptCost = config.Int("BCRYPT_COST", bcrypt.DefaultCost)
+
+// Minimum time between two email changes made by the user themselves.
+var EmailChangeCooldown = config.Duration("EMAIL_CHANGE_COOLDOWN", 7*24*time.Hour)
+
+// What the token subject holds: "id" for the user's stable uuid, or
+// "username" for the old behavior.
+var JwtSubject = config.String("JWT_SUBJECT", "id")
+
+// Keep accepting tokens with a username subject, issued before the switch to
+// ids, until they've all expired.
+var AcceptUsernameSubject = config.Bool("JWT_ACCEPT_USERNAME_SUBJECT", true)
+
+// Tell unknown users and wrong passwords apart in login errors, for logs and
+// tests during development. Clients always get ErrUnauthorizedUser's message.
+var LoginDetailedErrors = config.Bool("LOGIN_DETAILED_ERRORS", false)
 
 type UserService interface {
 	LoginUser(ctx context.Context, loginData *models.LoginUserRequest) (string, error)
 	CreateUser(ctx context.Context, req *models.CreateUserRequest) error
+	ValidateSignup(ctx context.Context, req *models.CreateUserRequest) (models.ValidationResult, error)
 	GetUser(ctx context.Context, username string) (repository.GetUserDataRow, error)
 	UpdateUserSettings(ctx context.Context, req *models.UpdateUserSettingsRequest, username string) error
 	AddUserTag(ctx context.Context, username string, req *models.UserTag) error
 	DisplayUserTag(ctx context.Context, username string) ([]repository.DisplayUserTagRow, error)
 	DeleteUserTag(ctx context.Context, username string, tagName string) error
+	SetUserTagWeight(ctx context.Context, username string, tagName string, req *models.TagWeightRequest) error
+	SetUserTagStrictness(ctx context.Context, username string, tagName string, req *models.TagStrictnessRequest) error
+	ReorderUserTags(ctx context.Context, username string, orderedNames []string) error
+	DetectTagConflicts(ctx context.Context, username string) ([]models.TagConflict, error)
+	ChangePassword(ctx context.Context, username string, req *models.ChangePasswordRequest) error
+	GetUsers(ctx context.Context, usernames []string) ([]repository.GetUsersRow, error)
+	GetUsersDetailed(ctx context.Context, usernames []string) ([]repository.GetUsersDetailedRow, error)
+	DeleteAccount(ctx context.Context, username string) error
+	MergeGuestAccount(ctx context.Context, target string, req *models.MergeAccountRequest) error
+	GetSettingsChangeLog(ctx context.Context, username string) ([]models.FieldChange, error)
+	ListExcludedIngredients(ctx context.Context, username string) ([]string, error)
+	AddExcludedIngredient(ctx context.Context, username string, req *models.ExcludedIngredientRequest) error
+	DeleteExcludedIngredient(ctx context.Context, username string, name string) error
+	RecordConsent(ctx context.Context, username string, version string) error
+	HasAcceptedCurrentTerms(ctx context.Context, username string) (bool, error)
+	GetTermsStatus(ctx context.Context, username string) (models.TermsStatus, error)
+	ExportUserArchive(ctx context.Context, username string, w io.Writer) error
 }
 
 type BaseUserService struct {
-	DbConn *pgx.Conn
-	Repo   *repository.Queries
+	DbConn              *pgx.Conn
+	Repo                *repository.Queries
+	DetailedLoginErrors bool
+	Conflicts           TagConflictMatrix
+	// TermsVersion is the terms version signups and consents must accept.
+	TermsVersion string
+	// Captcha, when set, is required on signup and on logins once
+	// LoginFailures has CaptchaAfterFailures recent failures for the login
+	// from the same IP, counted under LoginFailureKey.
+	Captcha              CaptchaVerifier
+	LoginFailures        *LoginFailures
+	CaptchaAfterFailures int
+	// Throttle, when set, refuses logins after too many failures.
+	Throttle *LoginThrottle
+	// Images opens recipe images for archive exports; nil fetches them over
+	// HTTP.
+	Images ImageSource
+	// Most favorites an account keeps after a merge, the oldest archived;
+	// 0 means no limit.
+	FavoritesLimit int64
 }
 
 func NewBaseUserService(conn *pgx.Conn) BaseUserService {
 	return BaseUserService{
-		DbConn: conn,
-		Repo:   repository.New(conn),
+		DbConn:               conn,
+		Repo:                 repository.New(conn),
+		DetailedLoginErrors:  LoginDetailedErrors,
+		Conflicts:            ParseTagConflicts(TagConflictPairs),
+		TermsVersion:         TermsVersion,
+		Captcha:              NewCaptchaVerifier(),
+		LoginFailures:        NewLoginFailures(CaptchaLoginFailureWindow),
+		CaptchaAfterFailures: CaptchaLoginFailures,
+		Throttle:             NewLoginThrottle(),
+		FavoritesLimit:       int64(favoritesLimit),
 	}
 }
 
 func (s *BaseUserService) LoginUser(ctx context.Context, loginData *models.LoginUserRequest) (string, error) {
+	if loginData == nil {
+		return "", ErrValidation
+	}
+
+	if err := s.checkLoginAttempt(ctx, loginData.Login, loginData.RemoteIP, loginData.CaptchaToken); err != nil {
+		return "", err
+	}
+
 	user, err := s.Repo.LoginUserWithUsername(ctx, loginData.Login)
 	if err != nil {
-		return "", ErrUnauthorizedUser
+		s.loginFailed(loginData.Login, loginData.RemoteIP)
+		return "", LoginFailure(ErrUserNotFound, s.DetailedLoginErrors)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Passwdhash), []byte(loginData.Password)); err != nil {
-		return "", ErrUnauthorizedUser
+		s.loginFailed(loginData.Login, loginData.RemoteIP)
+		return "", LoginFailure(ErrWrongPassword, s.DetailedLoginErrors)
+	}
+	s.loginSucceeded(loginData.Login, loginData.RemoteIP)
+
+	subject := user.UserID
+	if JwtSubject == "username" {
+		subject = user.Username
 	}
 
-	token, err := s.generateJWT(user.Username)
+	token, claims, err := s.generateJWT(subject, user.Role, loginData.Client)
 	if err != nil {
 		log.Println(err.Error())
 		return "", ErrInternalFailure
 	}
+	s.recordSession(ctx, user.Username, claims, loginData)
 
 	return token, nil
 }
 
+// recordSession keeps the login for the session list. Without it the token
+// still works and is still revoked with all the user's sessions, so failures
+// are only logged.
+func (s *BaseUserService) recordSession(ctx context.Context, username string, claims jwt.MapClaims, loginData *models.LoginUserRequest) {
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims.GetExpirationTime()
+	client, _ := claims["client"].(string)
+	if jti == "" || exp == nil {
+		return
+	}
+
+	if err := s.Repo.CreateSession(ctx, repository.CreateSessionParams{
+		ID:        jti,
+		Username:  username,
+		Client:    client,
+		UserAgent: truncateRunes(loginData.UserAgent, MaxSessionUserAgentLength),
+		Ip:        loginData.RemoteIP,
+		ExpiresAt: exp.Unix(),
+	}); err != nil {
+		log.Println("record session failed:", err)
+		return
+	}
+	if err := s.Repo.PruneUserSessions(ctx, username); err != nil {
+		log.Println("prune sessions failed:", err)
+	}
+}
+
+// checkLoginAttempt refuses to check a password for login from remoteIP
+// while Throttle does, and requires a solved CAPTCHA once LoginFailures has
+// CaptchaAfterFailures recent failures for them. Every password check goes
+// through it, so none is an unthrottled way to guess passwords.
+func (s *BaseUserService) checkLoginAttempt(ctx context.Context, login string, remoteIP string, captchaToken string) error {
+	now := time.Now()
+	if s.Throttle != nil {
+		if err := s.Throttle.Check(login, remoteIP, now); err != nil {
+			return err
+		}
+	}
+	if s.Captcha != nil && s.LoginFailures != nil && s.LoginFailures.Count(LoginFailureKey(login, remoteIP), now) >= s.CaptchaAfterFailures {
+		return checkCaptcha(ctx, s.Captcha, captchaToken, remoteIP)
+	}
+	return nil
+}
+
+func (s *BaseUserService) loginFailed(login string, remoteIP string) {
+	now := time.Now()
+	if s.LoginFailures != nil {
+		s.LoginFailures.Fail(LoginFailureKey(login, remoteIP), now)
+	}
+	if s.Throttle != nil {
+		s.Throttle.Fail(login, remoteIP, now)
+	}
+}
+
+func (s *BaseUserService) loginSucceeded(login string, remoteIP string) {
+	if s.LoginFailures != nil {
+		s.LoginFailures.Reset(LoginFailureKey(login, remoteIP))
+	}
+	if s.Throttle != nil {
+		s.Throttle.Succeed(login, remoteIP)
+	}
+}
+
+// LoginFailure is the error for a failed login. It's ErrUnauthorizedUser
+// itself unless detailed is set, in which case the reason is logged and
+// wrapped as well.
+func LoginFailure(reason error, detailed bool) error {
+	if !detailed {
+		return ErrUnauthorizedUser
+	}
+	log.Println("login failed:", reason)
+	return &LoginError{Reason: reason}
+}
+
+// ValidateSignup runs every signup check, including whether the username and
+// email are still free, without creating anything, so a form can show all its
+// problems at once.
+func (s *BaseUserService) ValidateSignup(ctx context.Context, req *models.CreateUserRequest) (models.ValidationResult, error) {
+	if req == nil {
+		return models.ValidationResult{}, ErrValidation
+	}
+
+	fields := req.CheckFormat()
+	_, badUsername := fields["username"]
+	_, badEmail := fields["email"]
+	if !badUsername || !badEmail {
+		availability, err := s.Repo.GetSignupAvailability(ctx, repository.GetSignupAvailabilityParams{
+			Username: req.Username,
+			Email:    req.Email,
+		})
+		if err != nil {
+			log.Println(err.Error())
+			return models.ValidationResult{}, ErrInternalFailure
+		}
+		if !badUsername && availability.UsernameTaken {
+			fields["username"] = "is already taken"
+		}
+		if !badEmail && availability.EmailTaken {
+			fields["email"] = "is already registered"
+		}
+	}
+
+	return models.ValidationResult{Valid: len(fields) == 0, Fields: fields}, nil
+}
+
 func (s *BaseUserService) CreateUser(ctx context.Context, req *models.CreateUserRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
 	if err := req.Validate(); err != nil {
 		return ErrInternalFailure
 	}
+	if req.TermsVersion != s.TermsVersion {
+		return ErrValidation
+	}
+	if s.Captcha != nil {
+		if err := checkCaptcha(ctx, s.Captcha, req.CaptchaToken, req.RemoteIP); err != nil {
+			return err
+		}
+	}
 
-	hashedPasswd, err := bcrypt.GenerateFromPassword([]byte(req.Passwdhash), bcrypt.DefaultCost)
+	hashedPasswd, err := bcrypt.GenerateFromPassword([]byte(req.Passwdhash), BcryptCost)
 	if err != nil {
 		log.Println("password hashing failed:", err)
 		return ErrInternalFailure
 	}
 
-	err = s.Repo.CreateUser(ctx, repository.CreateUserParams{
-		Username:    req.Username,
-		Passwdhash:  string(hashedPasswd),
-		Email:       req.Email,
-		PhoneNumber: req.PhoneNumber,
-		Age:         req.Age,
-		Sex:         req.Sex,
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	err = qtx.CreateUser(ctx, repository.CreateUserParams{
+		Username:     req.Username,
+		Passwdhash:   string(hashedPasswd),
+		Email:        req.Email,
+		PhoneNumber:  req.PhoneNumber,
+		Age:          req.Age,
+		Sex:          req.Sex,
+		TermsVersion: req.TermsVersion,
 	})
 	if err != nil {
 		log.Println("create user failed:", err)
 		return ErrInternalFailure
 	}
 
+	err = qtx.InsertPasswordHistory(ctx, repository.InsertPasswordHistoryParams{
+		Username:   req.Username,
+		Passwdhash: string(hashedPasswd),
+	})
+	if err != nil {
+		log.Println("insert password history failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
 	return nil
 }
 
@@ -90,39 +318,243 @@ func (s *BaseUserService) GetUser(ctx context.Context, username string) (reposit
 	return data, err
 }
 
-func (s *BaseUserService) generateJWT(username string) (string, error) {
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub": username,
-			"exp": time.Now().Add(24 * time.Hour).Unix(),
-			"iat": time.Now().Unix(),
-		})
-	return t.SignedString(key)
+// GetUsers returns public profile data only, contact fields are never selected.
+func (s *BaseUserService) GetUsers(ctx context.Context, usernames []string) ([]repository.GetUsersRow, error) {
+	users, err := s.Repo.GetUsers(ctx, usernames)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return users, nil
+}
+
+// GetUsersDetailed includes contact data and must only be exposed to admins.
+func (s *BaseUserService) GetUsersDetailed(ctx context.Context, usernames []string) ([]repository.GetUsersDetailedRow, error) {
+	users, err := s.Repo.GetUsersDetailed(ctx, usernames)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	return users, nil
+}
+
+func (s *BaseUserService) generateJWT(subject string, role string, client string) (string, jwt.MapClaims, error) {
+	claims, err := TokenClaims(subject, role, client, MinimalClaims)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := auth.Keys().Sign(claims)
+	return token, claims, err
+}
+
+// TokenClaims builds the JWT claims for a login by client, which also sets
+// how long the token lasts. In minimal mode the role is left out and has to be
+// resolved per request.
+func TokenClaims(subject string, role string, client string, minimal bool) (jwt.MapClaims, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	if client == "" {
+		client = models.ClientWeb
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":    subject,
+		"exp":    now.Add(SessionTTL(client)).Unix(),
+		"iat":    now.Unix(),
+		"jti":    hex.EncodeToString(jti),
+		"client": client,
+	}
+	if !minimal {
+		claims["role"] = role
+	}
+	return claims, nil
+}
+
+// ChangeCooldownRemaining returns how long until a change is allowed again
+// after one made at lastChanged. A zero lastChanged means never changed.
+func ChangeCooldownRemaining(lastChanged time.Time, now time.Time, cooldown time.Duration) time.Duration {
+	if lastChanged.IsZero() {
+		return 0
+	}
+	return max(lastChanged.Add(cooldown).Sub(now), 0)
 }
 
 func (s *BaseUserService) UpdateUserSettings(ctx context.Context, req *models.UpdateUserSettingsRequest, username string) error {
-	// Update user settings
-	err := s.Repo.UpdateUserSettings(ctx, repository.UpdateUserSettingsParams{
-		Username:    username,
-		Email:       req.Email,
-		Name:        req.Name,
-		Surname:     req.Surname,
-		PhoneNumber: req.PhoneNumber,
-		Age:         req.Age,
-		Sex:         req.Sex,
-		Weight:      req.Weight,
-		Height:      req.Height,
-		Bmi:         req.Bmi,
-	})
+	if req == nil || req.Validate() != nil {
+		return ErrValidation
+	}
+
+	if req.Email != "" {
+		current, err := s.Repo.GetUserEmailChange(ctx, username)
+		if err != nil {
+			log.Println(err.Error())
+			return ErrInternalFailure
+		}
+		if req.Email != current.Email {
+			remaining := ChangeCooldownRemaining(current.EmailChangedAt.Time, time.Now(), EmailChangeCooldown)
+			if remaining > 0 {
+				return &ChangeTooSoonError{Remaining: remaining}
+			}
+		}
+	}
+
+	params := repository.UpdateUserSettingsParams{
+		Username:        username,
+		Email:           req.Email,
+		Name:            req.Name,
+		Surname:         req.Surname,
+		PhoneNumber:     req.PhoneNumber,
+		Age:             req.Age,
+		Sex:             req.Sex,
+		Weight:          req.Weight,
+		Height:          req.Height,
+		Bmi:             req.Bmi,
+		Timezone:        req.Timezone,
+		Locale:          req.Locale,
+		DefaultServings: -1,
+	}
+	if req.DefaultServings != nil {
+		params.DefaultServings = *req.DefaultServings
+	}
+	if req.Equipment != nil {
+		params.EquipmentSet = true
+		params.Equipment = models.NormalizeEquipment(*req.Equipment)
+	}
+
+	tx, err := s.DbConn.Begin(ctx)
 	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	if req.Weight != -1 || req.Height != -1 {
+		stored, err := qtx.GetUserMeasurementsForUpdate(ctx, username)
+		if err != nil {
+			log.Println("get user measurements failed:", err)
+			return ErrInternalFailure
+		}
+		params.Bmi = PatchedBMI(req, stored.Weight, stored.Height)
+	}
+
+	// The first change also records what the settings were before it.
+	if err := qtx.InsertSettingsSnapshot(ctx, repository.InsertSettingsSnapshotParams{
+		Username:      username,
+		OnlyIfMissing: true,
+	}); err != nil {
+		log.Println("insert settings snapshot failed:", err)
+		return ErrInternalFailure
+	}
+
+	// Update user settings
+	if err := qtx.UpdateUserSettings(ctx, params); err != nil {
 		log.Println("update user settings failed:", err)
 		return ErrInternalFailure
 	}
 
+	if err := qtx.InsertSettingsSnapshot(ctx, repository.InsertSettingsSnapshotParams{
+		Username: username,
+	}); err != nil {
+		log.Println("insert settings snapshot failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
 	return nil
 }
 
+// PatchedBMI returns the BMI to store for a settings patch. When the patch
+// changes weight or height, BMI is recomputed from the patched values with
+// the stored ones filling in the rest, overriding any bmi sent along. It's -1
+// (no update) when the weight or height is still unknown.
+func PatchedBMI(req *models.UpdateUserSettingsRequest, storedWeight int32, storedHeight int32) int32 {
+	if req.Weight == -1 && req.Height == -1 {
+		return req.Bmi
+	}
+
+	weight, height := storedWeight, storedHeight
+	if req.Weight != -1 {
+		weight = req.Weight
+	}
+	if req.Height != -1 {
+		height = req.Height
+	}
+	if weight <= 0 || height <= 0 {
+		return -1
+	}
+
+	meters := float64(height) / 100
+	return int32(math.Round(float64(weight) / (meters * meters)))
+}
+
+// GetSettingsChangeLog lists every settings field the user changed, oldest
+// first, by diffing consecutive snapshots.
+func (s *BaseUserService) GetSettingsChangeLog(ctx context.Context, username string) ([]models.FieldChange, error) {
+	snapshots, err := s.Repo.ListSettingsSnapshots(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+
+	changes, err := DiffSettingsSnapshots(snapshots)
+	if err != nil {
+		log.Println("decode settings snapshot failed:", err)
+		return nil, ErrInternalFailure
+	}
+	return changes, nil
+}
+
+// DiffSettingsSnapshots turns consecutive snapshots into field-level changes,
+// dated by the later snapshot. Unchanged fields are left out and fields
+// changed together are ordered by name.
+func DiffSettingsSnapshots(snapshots []repository.ListSettingsSnapshotsRow) ([]models.FieldChange, error) {
+	changes := []models.FieldChange{}
+	var previous map[string]string
+	for _, snapshot := range snapshots {
+		var current map[string]string
+		if err := json.Unmarshal(snapshot.Snapshot, &current); err != nil {
+			return nil, err
+		}
+
+		if previous != nil {
+			fields := make([]string, 0, len(current))
+			for field := range current {
+				fields = append(fields, field)
+			}
+			slices.Sort(fields)
+
+			for _, field := range fields {
+				if old := previous[field]; old != current[field] {
+					changes = append(changes, models.FieldChange{
+						Field:     field,
+						Old:       old,
+						New:       current[field],
+						ChangedAt: snapshot.CreatedAt,
+					})
+				}
+			}
+		}
+		previous = current
+	}
+	return changes, nil
+}
+
 func (s *BaseUserService) AddUserTag(ctx context.Context, username string, userTag *models.UserTag) error {
+	if userTag == nil {
+		return ErrValidation
+	}
+
 	err := s.Repo.InsertUserTag(ctx, repository.InsertUserTagParams{
 		Username:    username,
 		TagName:     userTag.Name,
@@ -137,6 +569,115 @@ func (s *BaseUserService) AddUserTag(ctx context.Context, username string, userT
 	return nil
 }
 
+func (s *BaseUserService) SetUserTagWeight(ctx context.Context, username string, tagName string, req *models.TagWeightRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	updated, err := s.Repo.SetUserTagWeight(ctx, repository.SetUserTagWeightParams{
+		Weight:   req.Weight,
+		Username: username,
+		TagName:  tagName,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if updated == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// SetUserTagStrictness sets how strictly the user keeps one of their diet
+// tags. Any other tag is ErrTagNotFound.
+func (s *BaseUserService) SetUserTagStrictness(ctx context.Context, username string, tagName string, req *models.TagStrictnessRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	updated, err := s.Repo.SetUserTagStrictness(ctx, repository.SetUserTagStrictnessParams{
+		Strictness: req.Strictness,
+		Username:   username,
+		TagName:    tagName,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if updated == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// ReorderUserTags stores orderedNames as the user's tag order. The names must
+// be exactly the user's tags, each once.
+func (s *BaseUserService) ReorderUserTags(ctx context.Context, username string, orderedNames []string) error {
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	// Locked so a tag added or removed meanwhile can't slip past the check.
+	current, err := qtx.LockUserTagNames(ctx, username)
+	if err != nil {
+		log.Println("lock user tags failed:", err)
+		return ErrInternalFailure
+	}
+	if err := ValidateTagOrder(current, orderedNames); err != nil {
+		return err
+	}
+
+	if err := qtx.SetUserTagOrder(ctx, repository.SetUserTagOrderParams{
+		TagNames: orderedNames,
+		Username: username,
+	}); err != nil {
+		log.Println("set user tag order failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+// ValidateTagOrder checks that ordered holds every name in current exactly
+// once and nothing else.
+func ValidateTagOrder(current []string, ordered []string) error {
+	if len(ordered) != len(current) {
+		return ErrValidation
+	}
+
+	remaining := make(map[string]bool, len(current))
+	for _, name := range current {
+		remaining[name] = true
+	}
+	for _, name := range ordered {
+		if !remaining[name] {
+			return ErrValidation
+		}
+		delete(remaining, name)
+	}
+	return nil
+}
+
 func (s *BaseUserService) DeleteUserTag(ctx context.Context, username string, tagName string) error {
 	err := s.Repo.DeleteUserTag(ctx, repository.DeleteUserTagParams{
 		Username: username,
@@ -162,19 +703,279 @@ func (s *BaseUserService) DisplayUserTag(ctx context.Context, username string) (
 	return data, nil
 }
 
+func (s *BaseUserService) ChangePassword(ctx context.Context, username string, req *models.ChangePasswordRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	user, err := s.Repo.LoginUserWithUsername(ctx, username)
+	if err != nil {
+		return ErrUnauthorizedUser
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Passwdhash), []byte(req.OldPassword)); err != nil {
+		return ErrUnauthorizedUser
+	}
+
+	history, err := s.Repo.GetPasswordHistory(ctx, repository.GetPasswordHistoryParams{
+		Username:     username,
+		HistoryLimit: int32(passwordHistorySize),
+	})
+	if err != nil {
+		log.Println("get password history failed:", err)
+		return ErrInternalFailure
+	}
+
+	// Accounts created before history was tracked only have the current hash.
+	if PasswordInHistory(append(history, user.Passwdhash), req.NewPassword) {
+		return ErrPasswordReused
+	}
+
+	hashedPasswd, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), BcryptCost)
+	if err != nil {
+		log.Println("password hashing failed:", err)
+		return ErrInternalFailure
+	}
+
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	if err := qtx.UpdateUserPassword(ctx, repository.UpdateUserPasswordParams{
+		Passwdhash: string(hashedPasswd),
+		Username:   username,
+	}); err != nil {
+		log.Println("update password failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := qtx.InsertPasswordHistory(ctx, repository.InsertPasswordHistoryParams{
+		Username:   username,
+		Passwdhash: string(hashedPasswd),
+	}); err != nil {
+		log.Println("insert password history failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := qtx.PrunePasswordHistory(ctx, repository.PrunePasswordHistoryParams{
+		Username:     username,
+		HistoryLimit: int32(passwordHistorySize),
+	}); err != nil {
+		log.Println("prune password history failed:", err)
+		return ErrInternalFailure
+	}
+
+	// Sessions opened with the old password end with it.
+	if err := qtx.RevokeUserTokens(ctx, username); err != nil {
+		log.Println("revoke user tokens failed:", err)
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+
+	return nil
+}
+
+// PasswordInHistory reports whether password matches any of the given bcrypt hashes.
+func PasswordInHistory(hashes []string, password string) bool {
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteAccount soft-deletes the user and revokes every token issued so far,
+// including ones with a username subject, which don't go through the user id
+// lookup that skips deleted users. The account can still be restored by an
+// admin until it's purged after UserDeleteRetention.
+func (s *BaseUserService) DeleteAccount(ctx context.Context, username string) error {
+	tx, err := s.DbConn.Begin(ctx)
+	if err != nil {
+		log.Println("begin transaction failed:", err)
+		return ErrInternalFailure
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	affected, err := qtx.SoftDeleteUser(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	if err := qtx.RevokeUserTokens(ctx, username); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("commit failed:", err)
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+func (s *BaseUserService) ListExcludedIngredients(ctx context.Context, username string) ([]string, error) {
+	names, err := s.Repo.ListExcludedIngredients(ctx, username)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, ErrInternalFailure
+	}
+	return names, nil
+}
+
+// AddExcludedIngredient saves an ingredient to leave out of the user's searches.
+// Names are stored lowercase, the way searches match them.
+func (s *BaseUserService) AddExcludedIngredient(ctx context.Context, username string, req *models.ExcludedIngredientRequest) error {
+	if req == nil {
+		return ErrValidation
+	}
+
+	if err := req.Validate(); err != nil {
+		return ErrValidation
+	}
+
+	if err := s.Repo.AddExcludedIngredient(ctx, repository.AddExcludedIngredientParams{
+		Username: username,
+		Name:     strings.ToLower(strings.TrimSpace(req.Name)),
+	}); err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	return nil
+}
+
+func (s *BaseUserService) DeleteExcludedIngredient(ctx context.Context, username string, name string) error {
+	affected, err := s.Repo.DeleteExcludedIngredient(ctx, repository.DeleteExcludedIngredientParams{
+		Username: username,
+		Name:     strings.ToLower(strings.TrimSpace(name)),
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if affected == 0 {
+		return ErrIngredientNotFound
+	}
+	return nil
+}
+
 // For testing
 type MockUserService struct{}
 
 func (s *MockUserService) LoginUser(ctx context.Context, loginData *models.LoginUserRequest) (string, error) {
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub": "testUser",
-			"exp": time.Now().Add(24 * time.Hour).Unix(),
-			"iat": time.Now().Unix(),
-		})
-	return t.SignedString(key)
+	return auth.Keys().Sign(jwt.MapClaims{
+		"sub":    "testUser",
+		"role":   "user",
+		"exp":    time.Now().Add(24 * time.Hour).Unix(),
+		"iat":    time.Now().Unix(),
+		"client": models.ClientWeb,
+	})
 }
 
 func (s *MockUserService) CreateUser(ctx context.Context, req *models.CreateUserRequest) error {
 	return nil
 }
+
+func (s *MockUserService) ValidateSignup(ctx context.Context, req *models.CreateUserRequest) (models.ValidationResult, error) {
+	return models.ValidationResult{Valid: true, Fields: map[string]string{}}, nil
+}
+
+func (s *MockUserService) GetUser(ctx context.Context, username string) (repository.GetUserDataRow, error) {
+	return repository.GetUserDataRow{Username: username}, nil
+}
+
+func (s *MockUserService) UpdateUserSettings(ctx context.Context, req *models.UpdateUserSettingsRequest, username string) error {
+	return nil
+}
+
+func (s *MockUserService) AddUserTag(ctx context.Context, username string, req *models.UserTag) error {
+	return nil
+}
+
+func (s *MockUserService) DisplayUserTag(ctx context.Context, username string) ([]repository.DisplayUserTagRow, error) {
+	return nil, nil
+}
+
+func (s *MockUserService) DeleteUserTag(ctx context.Context, username string, tagName string) error {
+	return nil
+}
+
+func (s *MockUserService) ReorderUserTags(ctx context.Context, username string, orderedNames []string) error {
+	return nil
+}
+
+func (s *MockUserService) DetectTagConflicts(ctx context.Context, username string) ([]models.TagConflict, error) {
+	return []models.TagConflict{}, nil
+}
+
+func (s *MockUserService) SetUserTagWeight(ctx context.Context, username string, tagName string, req *models.TagWeightRequest) error {
+	return nil
+}
+
+func (s *MockUserService) SetUserTagStrictness(ctx context.Context, username string, tagName string, req *models.TagStrictnessRequest) error {
+	return nil
+}
+
+func (s *MockUserService) ChangePassword(ctx context.Context, username string, req *models.ChangePasswordRequest) error {
+	return nil
+}
+
+func (s *MockUserService) MergeGuestAccount(ctx context.Context, target string, req *models.MergeAccountRequest) error {
+	return nil
+}
+
+func (s *MockUserService) GetUsers(ctx context.Context, usernames []string) ([]repository.GetUsersRow, error) {
+	return nil, nil
+}
+
+func (s *MockUserService) GetUsersDetailed(ctx context.Context, usernames []string) ([]repository.GetUsersDetailedRow, error) {
+	return nil, nil
+}
+
+func (s *MockUserService) DeleteAccount(ctx context.Context, username string) error {
+	return nil
+}
+
+func (s *MockUserService) GetSettingsChangeLog(ctx context.Context, username string) ([]models.FieldChange, error) {
+	return nil, nil
+}
+
+func (s *MockUserService) ListExcludedIngredients(ctx context.Context, username string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *MockUserService) AddExcludedIngredient(ctx context.Context, username string, req *models.ExcludedIngredientRequest) error {
+	return nil
+}
+
+func (s *MockUserService) DeleteExcludedIngredient(ctx context.Context, username string, name string) error {
+	return nil
+}
+
+func (s *MockUserService) RecordConsent(ctx context.Context, username string, version string) error {
+	return nil
+}
+
+func (s *MockUserService) HasAcceptedCurrentTerms(ctx context.Context, username string) (bool, error) {
+	return true, nil
+}
+
+func (s *MockUserService) GetTermsStatus(ctx context.Context, username string) (models.TermsStatus, error) {
+	return models.TermsStatus{CurrentVersion: TermsVersion, AcceptedVersion: TermsVersion, Accepted: true}, nil
+}
+
+func (s *MockUserService) ExportUserArchive(ctx context.Context, username string, w io.Writer) error {
+	return WriteUserArchive(ctx, w, UserExport{Account: repository.GetUserDataRow{Username: username}}, nil, 0)
+}
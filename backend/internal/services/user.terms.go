@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/config"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+)
+
+// Version of the terms and privacy policy users have to accept. Bump it when
+// either changes.
+var TermsVersion = config.String("TERMS_VERSION", "1")
+
+// Turn away authenticated requests from users who haven't accepted the
+// current TermsVersion, until they accept it.
+var TermsRequireReconsent = config.Bool("TERMS_REQUIRE_RECONSENT", false)
+
+// RecordConsent records that the user accepted the given terms version now.
+// Only the current version can be accepted.
+func (s *BaseUserService) RecordConsent(ctx context.Context, username string, version string) error {
+	if version != s.TermsVersion {
+		return ErrValidation
+	}
+
+	affected, err := s.Repo.RecordTermsConsent(ctx, repository.RecordTermsConsentParams{
+		TermsVersion: version,
+		Username:     username,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return ErrInternalFailure
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// HasAcceptedCurrentTerms reports whether the last terms version the user
+// accepted is the current one.
+func (s *BaseUserService) HasAcceptedCurrentTerms(ctx context.Context, username string) (bool, error) {
+	status, err := s.GetTermsStatus(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return status.Accepted, nil
+}
+
+func (s *BaseUserService) GetTermsStatus(ctx context.Context, username string) (models.TermsStatus, error) {
+	consent, err := s.Repo.GetTermsConsent(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TermsStatus{}, ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return models.TermsStatus{}, ErrInternalFailure
+	}
+
+	status := models.TermsStatus{
+		CurrentVersion:  s.TermsVersion,
+		AcceptedVersion: consent.TermsVersion,
+		Accepted:        consent.TermsVersion == s.TermsVersion,
+	}
+	if consent.TermsAcceptedAt.Valid {
+		status.AcceptedAt = &consent.TermsAcceptedAt.Time
+	}
+	return status, nil
+}
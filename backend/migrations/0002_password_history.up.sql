@@ -0,0 +1,10 @@
+-- Table: password_history
+CREATE TABLE IF NOT EXISTS password_history (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    passwdhash VARCHAR(60) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_password_history_username ON password_history (username);
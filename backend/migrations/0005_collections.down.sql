@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS collection_shares CASCADE;
+
+DROP TABLE IF EXISTS collections_recipes CASCADE;
+
+DROP TABLE IF EXISTS collections CASCADE;
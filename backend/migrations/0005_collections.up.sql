@@ -0,0 +1,29 @@
+-- Table: collections
+CREATE TABLE IF NOT EXISTS collections (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
+
+-- Table: collections_recipes
+CREATE TABLE IF NOT EXISTS collections_recipes (
+    collection_id INTEGER NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id),
+    CONSTRAINT unique_collection_recipe UNIQUE (collection_id, recipe_id)
+);
+
+-- Table: collection_shares
+CREATE TABLE IF NOT EXISTS collection_shares (
+    token VARCHAR(64) PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_collections_username ON collections (username);
+CREATE INDEX idx_collection_shares_collection_id ON collection_shares (collection_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS recipes_made CASCADE;
+
+DROP TABLE IF EXISTS favorites CASCADE;
@@ -0,0 +1,21 @@
+-- Table: favorites
+CREATE TABLE IF NOT EXISTS favorites (
+    username VARCHAR(40) NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE,
+    CONSTRAINT unique_favorite UNIQUE (username, recipe_id)
+);
+
+-- Table: recipes_made
+CREATE TABLE IF NOT EXISTS recipes_made (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    made_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recipes_made_username_recipe_id ON recipes_made (username, recipe_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS admin_audit CASCADE;
\ No newline at end of file
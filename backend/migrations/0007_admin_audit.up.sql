@@ -0,0 +1,12 @@
+-- Table: admin_audit
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    actor VARCHAR(40) NOT NULL,
+    action VARCHAR(40) NOT NULL,
+    target VARCHAR(100) NOT NULL,
+    before_value TEXT NOT NULL DEFAULT '',
+    after_value TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0)
+);
+
+CREATE INDEX idx_admin_audit_created_at ON admin_audit (created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE recipes
+    DROP COLUMN IF EXISTS calories,
+    DROP COLUMN IF EXISTS protein,
+    DROP COLUMN IF EXISTS carbs,
+    DROP COLUMN IF EXISTS fat;
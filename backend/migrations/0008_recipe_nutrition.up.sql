@@ -0,0 +1,6 @@
+-- Nutrition per serving, NULL when unknown
+ALTER TABLE recipes
+    ADD COLUMN IF NOT EXISTS calories INTEGER,
+    ADD COLUMN IF NOT EXISTS protein INTEGER,
+    ADD COLUMN IF NOT EXISTS carbs INTEGER,
+    ADD COLUMN IF NOT EXISTS fat INTEGER;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS default_servings;
+ALTER TABLE recipes DROP COLUMN IF EXISTS servings;
@@ -0,0 +1,5 @@
+-- Servings a recipe's ingredient amounts are written for
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS servings INTEGER NOT NULL DEFAULT 1 CHECK (servings > 0);
+
+-- Household size recipes get scaled to, NULL means the recipe's own servings
+ALTER TABLE users ADD COLUMN IF NOT EXISTS default_servings INTEGER CHECK (default_servings > 0);
@@ -0,0 +1 @@
+ALTER TABLE users_tags DROP COLUMN IF EXISTS weight;
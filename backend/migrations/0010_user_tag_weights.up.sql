@@ -0,0 +1,2 @@
+-- How much a user tag counts when ranking recommendations
+ALTER TABLE users_tags ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 1 CHECK (weight > 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS import_jobs CASCADE;
+ALTER TABLE recipes DROP COLUMN IF EXISTS source_id;
@@ -0,0 +1,16 @@
+-- Stable external id of imported recipes, used to skip records on re-runs
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS source_id TEXT UNIQUE;
+
+-- Table: import_jobs
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    total INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
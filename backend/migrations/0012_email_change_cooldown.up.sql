@@ -0,0 +1,2 @@
+-- Last time the user changed their email, NULL when never changed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_changed_at TIMESTAMP;
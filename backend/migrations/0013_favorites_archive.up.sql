@@ -0,0 +1,10 @@
+-- Table: favorites_archive, favorites moved out of the active list
+CREATE TABLE IF NOT EXISTS favorites_archive (
+    username VARCHAR(40) NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE,
+    CONSTRAINT unique_favorite_archive UNIQUE (username, recipe_id)
+);
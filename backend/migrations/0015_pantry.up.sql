@@ -0,0 +1,10 @@
+-- Table: pantry_items, ingredients the user has at home
+CREATE TABLE IF NOT EXISTS pantry_items (
+    username VARCHAR(40) NOT NULL,
+    name VARCHAR(60) NOT NULL,
+    amount INTEGER NOT NULL,
+    unit VARCHAR(10) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    CONSTRAINT unique_pantry_item UNIQUE (username, name)
+);
@@ -0,0 +1,2 @@
+-- Stable user id used as the token subject, unlike the username it never changes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
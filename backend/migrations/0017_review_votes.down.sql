@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_votes CASCADE;
+ALTER TABLE reviews DROP COLUMN IF EXISTS created_at;
+ALTER TABLE reviews DROP COLUMN IF EXISTS comment;
@@ -0,0 +1,14 @@
+-- Review text and time, used when listing reviews
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS comment TEXT NOT NULL DEFAULT '';
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0);
+
+-- Table: review_votes, one helpfulness vote per user per review
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id INTEGER NOT NULL,
+    username VARCHAR(40) NOT NULL,
+    up BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    PRIMARY KEY (review_id, username)
+);
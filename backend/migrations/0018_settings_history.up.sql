@@ -0,0 +1,10 @@
+-- Table: settings_history, snapshots of user settings taken on every change
+CREATE TABLE IF NOT EXISTS settings_history (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_settings_history_username ON settings_history (username);
@@ -0,0 +1,8 @@
+-- Table: users_excluded_ingredients, ingredients left out of the user's searches by default
+CREATE TABLE IF NOT EXISTS users_excluded_ingredients (
+    username VARCHAR(40) NOT NULL,
+    name VARCHAR(60) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    CONSTRAINT unique_user_excluded_ingredient UNIQUE (username, name)
+);
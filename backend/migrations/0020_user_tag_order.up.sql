@@ -0,0 +1,2 @@
+-- Position of the tag in the user's own ordering, lowest first
+ALTER TABLE users_tags ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
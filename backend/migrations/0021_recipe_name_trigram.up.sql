@@ -0,0 +1,3 @@
+-- Trigram index for finding recipes with similar names
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_recipes_name_trgm ON recipes USING gin (lower(name) gin_trgm_ops);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS search_alerts CASCADE;
+DROP TABLE IF EXISTS saved_searches CASCADE;
+DROP INDEX IF EXISTS idx_recipes_created_at;
+ALTER TABLE recipes DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,28 @@
+-- When the recipe was added, so saved searches can alert about new ones
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Table: saved_searches
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    username VARCHAR(40) NOT NULL,
+    name VARCHAR(60) NOT NULL,
+    params JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    CONSTRAINT unique_saved_search UNIQUE (username, name)
+);
+
+-- Table: search_alerts, new recipes matching a saved search waiting to be sent
+CREATE TABLE IF NOT EXISTS search_alerts (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    saved_search_id BIGINT NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    sent_at TIMESTAMP,
+    FOREIGN KEY (saved_search_id) REFERENCES saved_searches(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE,
+    CONSTRAINT unique_search_alert UNIQUE (saved_search_id, recipe_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recipes_created_at ON recipes (created_at);
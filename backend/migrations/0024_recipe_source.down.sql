@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_recipes_source;
+ALTER TABLE recipes DROP COLUMN IF EXISTS source_url;
+ALTER TABLE recipes DROP COLUMN IF EXISTS source;
@@ -0,0 +1,11 @@
+-- Where a recipe comes from: "user:<username>" for community recipes and
+-- "import:<provider>" for imported ones, with the original page when known.
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS source_url VARCHAR(500);
+
+UPDATE recipes SET source = CASE WHEN source_id IS NULL THEN 'user:' || username ELSE 'import:unknown' END
+WHERE source = '';
+
+ALTER TABLE recipes ALTER COLUMN source DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_recipes_source ON recipes (source text_pattern_ops);
@@ -0,0 +1,7 @@
+-- Table: client_revocations, tokens of one client (web, mobile, api) issued before revoked_at are no longer valid
+CREATE TABLE IF NOT EXISTS client_revocations (
+    username VARCHAR(40) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    client VARCHAR(16) NOT NULL,
+    revoked_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (username, client)
+);
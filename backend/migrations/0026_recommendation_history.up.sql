@@ -0,0 +1,9 @@
+-- Table: recommendation_history, recipes recently shown to a user, so the same ones aren't recommended every day
+CREATE TABLE IF NOT EXISTS recommendation_history (
+    username VARCHAR(40) NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    shown_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, recipe_id),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS equipment;
+DROP INDEX IF EXISTS idx_recipes_equipment;
+ALTER TABLE recipes DROP COLUMN IF EXISTS equipment;
@@ -0,0 +1,8 @@
+-- Equipment a recipe needs; empty when it needs none
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS equipment TEXT[] NOT NULL DEFAULT '{}'
+    CHECK (equipment <@ ARRAY['oven', 'stovetop', 'microwave']::text[]);
+
+CREATE INDEX IF NOT EXISTS idx_recipes_equipment ON recipes USING GIN (equipment);
+
+-- Equipment the user has, applied to searches by default; everyone starts with all of it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS equipment TEXT[] NOT NULL DEFAULT '{oven,stovetop,microwave}';
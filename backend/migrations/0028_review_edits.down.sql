@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS review_edits CASCADE;
+ALTER TABLE reviews DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,14 @@
+-- When the review text was last changed; NULL for reviews never edited
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+
+-- Table: review_edits, earlier versions of edited reviews, kept for moderation
+CREATE TABLE IF NOT EXISTS review_edits (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    review_id INTEGER NOT NULL,
+    comment TEXT NOT NULL,
+    written_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_edits_review_id ON review_edits (review_id);
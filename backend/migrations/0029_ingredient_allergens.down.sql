@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_recipes_allergens_dirty;
+ALTER TABLE recipes DROP COLUMN IF EXISTS allergens_dirty;
+DROP TABLE IF EXISTS ingredient_allergens CASCADE;
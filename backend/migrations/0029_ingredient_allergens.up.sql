@@ -0,0 +1,12 @@
+-- Table: ingredient_allergens, allergen tags of each ingredient, by lowercase ingredient name
+CREATE TABLE IF NOT EXISTS ingredient_allergens (
+    ingredient VARCHAR(100) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (ingredient, tag_id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- Set when an ingredient's allergens change, until the recipe's allergen tags are derived again
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS allergens_dirty BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_recipes_allergens_dirty ON recipes (id) WHERE allergens_dirty;
@@ -0,0 +1,5 @@
+-- Yes/no attributes of a recipe, e.g. kid_friendly; a flag that's absent is false
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS flags TEXT[] NOT NULL DEFAULT '{}'
+    CHECK (flags <@ ARRAY['kid_friendly', 'spicy', 'freezer_friendly']::text[]);
+
+CREATE INDEX IF NOT EXISTS idx_recipes_flags ON recipes USING GIN (flags);
@@ -0,0 +1 @@
+ALTER TABLE recipes DROP COLUMN IF EXISTS cook_time;
@@ -0,0 +1,2 @@
+-- Unattended cooking time in minutes, e.g. braising or baking; time stays the prep time
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS cook_time INT NOT NULL DEFAULT 0 CHECK (cook_time >= 0);
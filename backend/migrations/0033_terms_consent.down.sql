@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS terms_accepted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS terms_version;
@@ -0,0 +1,3 @@
+-- Terms and privacy policy version the user last accepted, and when
+ALTER TABLE users ADD COLUMN IF NOT EXISTS terms_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS terms_accepted_at TIMESTAMP;
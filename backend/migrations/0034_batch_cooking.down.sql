@@ -0,0 +1,2 @@
+ALTER TABLE recipes DROP COLUMN IF EXISTS storage_days;
+ALTER TABLE recipes DROP COLUMN IF EXISTS batch_friendly;
@@ -0,0 +1,3 @@
+-- Meals that scale up and keep well, and how many days they keep in the fridge; 0 = not known
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS batch_friendly BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS storage_days INT NOT NULL DEFAULT 0 CHECK (storage_days >= 0);
@@ -0,0 +1,2 @@
+-- How strictly a diet tag is kept: strict excludes recipes without it, moderate and flexible only rank them lower
+ALTER TABLE users_tags ADD COLUMN IF NOT EXISTS strictness TEXT NOT NULL DEFAULT 'strict' CHECK (strictness IN ('strict', 'moderate', 'flexible'));
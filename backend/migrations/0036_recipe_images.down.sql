@@ -0,0 +1,3 @@
+ALTER TABLE recipes DROP COLUMN IF EXISTS image_color;
+ALTER TABLE recipes DROP COLUMN IF EXISTS image_blurhash;
+ALTER TABLE recipes DROP COLUMN IF EXISTS image_url;
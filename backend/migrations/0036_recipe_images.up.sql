@@ -0,0 +1,4 @@
+-- The meal's image and the placeholder shown while it loads: a blurhash and the dominant color as #rrggbb. No placeholder yet = NULL
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS image_url TEXT;
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS image_blurhash TEXT;
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS image_color TEXT;
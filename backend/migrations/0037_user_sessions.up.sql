@@ -0,0 +1,13 @@
+-- Table: user_sessions, one row per login, keyed by the token's jti, with the device it was made from
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(40) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    client VARCHAR(16) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP(0),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_username ON user_sessions (username);
@@ -0,0 +1,41 @@
+-- name: InsertAdminAudit :exec
+INSERT INTO admin_audit (actor, action, target, before_value, after_value) VALUES
+(@actor::text, @action::text, @target::text, @before_value::text, @after_value::text);
+
+-- name: ListAdminAudit :many
+SELECT id, actor, action, target, before_value, after_value, created_at FROM admin_audit
+WHERE (@actor::text = '' OR actor = @actor::text)
+  AND (@action::text = '' OR action = @action::text)
+  AND (@target::text = '' OR target = @target::text)
+ORDER BY created_at DESC, id DESC
+LIMIT @audit_limit::int OFFSET @audit_offset::int;
+
+-- name: ExportRecipesPage :many
+-- Keyset pages for the CSV export, so each query stays small however large
+-- the catalog is.
+SELECT r.id, r.name, r.username, r.time, r.difficulty, r.servings, r.calories, r.protein, r.carbs, r.fat,
+  COALESCE((
+    SELECT string_agg(t.name, '; ' ORDER BY t.name) FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id
+  ), '')::text AS tags
+FROM recipes r
+WHERE r.id > @after_id::int
+  AND (@author::text = '' OR r.username = @author::text)
+  AND (@tag::text = '' OR EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id AND t.name = @tag::text
+  ))
+ORDER BY r.id
+LIMIT @page_size::int;
+
+-- name: ListExpiredAdminAudit :many
+-- Oldest first, one batch at a time, for the retention job.
+SELECT id, actor, action, target, before_value, after_value, created_at FROM admin_audit
+WHERE created_at < CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int)
+ORDER BY id
+LIMIT @batch_size::int;
+
+-- name: DeleteAdminAuditByIDs :execrows
+DELETE FROM admin_audit WHERE id = ANY(@ids::int[]);
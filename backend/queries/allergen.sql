@@ -0,0 +1,29 @@
+-- name: ListAllergenTags :many
+SELECT id, name FROM tags WHERE type_id = 4 ORDER BY id;
+
+-- name: ListKnownIngredients :many
+-- The given lowercase ingredient names that at least one recipe uses.
+SELECT DISTINCT lower(i->>'name')::text AS name
+FROM recipes r, json_array_elements(r.ingredients->'ingredients') i
+WHERE lower(i->>'name') = ANY(@names::text[]);
+
+-- name: ClearIngredientAllergens :exec
+DELETE FROM ingredient_allergens WHERE ingredient = ANY(@ingredients::text[]);
+
+-- name: InsertIngredientAllergens :exec
+INSERT INTO ingredient_allergens (ingredient, tag_id)
+SELECT unnest(@ingredients::text[]), unnest(@tag_ids::int[])
+ON CONFLICT DO NOTHING;
+
+-- name: MarkRecipesAllergensDirty :execrows
+-- Flags every recipe using one of the lowercase ingredient names.
+UPDATE recipes r SET allergens_dirty = TRUE
+WHERE NOT r.allergens_dirty AND EXISTS (
+  SELECT 1 FROM json_array_elements(r.ingredients->'ingredients') i
+  WHERE lower(i->>'name') = ANY(@ingredients::text[])
+);
+
+-- name: ListIngredientAllergens :many
+SELECT ingredient, tag_id FROM ingredient_allergens
+WHERE ingredient = ANY(@ingredients::text[])
+ORDER BY ingredient, tag_id;
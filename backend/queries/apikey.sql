@@ -0,0 +1,21 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (username, name, prefix, key_hash, scopes)
+VALUES (@username::text, @name::text, @prefix::text, @key_hash::text, @scopes::text[])
+RETURNING id;
+
+-- name: ListAPIKeys :many
+SELECT id, name, prefix, scopes, created_at, last_used_at FROM api_keys
+WHERE username = @username::text AND revoked_at IS NULL
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP(0)
+WHERE id = @id::int AND username = @username::text AND revoked_at IS NULL;
+
+-- name: UseAPIKey :one
+-- Resolves a live key of an active user and records that it was used.
+UPDATE api_keys k SET last_used_at = CURRENT_TIMESTAMP(0)
+FROM users u
+WHERE k.key_hash = @key_hash::text AND k.revoked_at IS NULL
+  AND u.username = k.username AND u.deleted_at IS NULL
+RETURNING k.id, k.scopes, u.uuid::text AS user_id, u.role;
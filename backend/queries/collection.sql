@@ -0,0 +1,31 @@
+-- name: CreateCollection :one
+INSERT INTO collections (username, name) VALUES (@username::text, @name::text) RETURNING id;
+
+-- name: GetCollectionOwner :one
+SELECT username FROM collections WHERE id = $1;
+
+-- name: AddRecipeToCollection :exec
+INSERT INTO collections_recipes (collection_id, recipe_id) VALUES (@collection_id::int, @recipe_id::int)
+ON CONFLICT (collection_id, recipe_id) DO NOTHING;
+
+-- name: GetCollectionRecipes :many
+SELECT r.id, r.name, r.time, r.difficulty FROM recipes r
+JOIN collections_recipes cr ON cr.recipe_id = r.id
+WHERE cr.collection_id = @collection_id::int
+ORDER BY r.id;
+
+-- name: CreateCollectionShare :exec
+INSERT INTO collection_shares (token, collection_id) VALUES (@token::text, @collection_id::int);
+
+-- name: GetSharedCollection :one
+SELECT c.id, c.name, c.username FROM collection_shares cs
+JOIN collections c ON c.id = cs.collection_id
+WHERE cs.token = @token::text AND cs.revoked_at IS NULL;
+
+-- name: RevokeCollectionShare :execrows
+UPDATE collection_shares SET revoked_at = CURRENT_TIMESTAMP(0)
+FROM collections c
+WHERE collection_shares.collection_id = c.id
+  AND collection_shares.token = @token::text
+  AND c.username = @username::text
+  AND collection_shares.revoked_at IS NULL;
@@ -0,0 +1,65 @@
+-- name: AddFavorite :exec
+INSERT INTO favorites (username, recipe_id) VALUES (@username::text, @recipe_id::int)
+ON CONFLICT (username, recipe_id) DO NOTHING;
+
+-- name: DeleteFavorite :exec
+DELETE FROM favorites WHERE username = @username::text AND recipe_id = @recipe_id::int;
+
+-- name: ListFavorites :many
+SELECT r.id, r.name, r.time, r.difficulty, f.created_at FROM favorites f
+JOIN recipes r ON r.id = f.recipe_id
+WHERE f.username = @username::text
+ORDER BY f.created_at DESC, r.id;
+
+-- name: MarkRecipeMade :exec
+INSERT INTO recipes_made (username, recipe_id) VALUES (@username::text, @recipe_id::int);
+
+-- name: CountFavorites :one
+SELECT COUNT(*) FROM favorites WHERE username = $1;
+
+-- name: IsFavorite :one
+SELECT EXISTS (
+  SELECT 1 FROM favorites WHERE username = @username::text AND recipe_id = @recipe_id::int
+);
+
+-- name: ArchiveFavorite :execrows
+WITH moved AS (
+  DELETE FROM favorites
+  WHERE username = @username::text AND recipe_id = @recipe_id::int
+  RETURNING username, recipe_id, created_at
+)
+INSERT INTO favorites_archive (username, recipe_id, created_at)
+SELECT username, recipe_id, created_at FROM moved
+ON CONFLICT (username, recipe_id) DO UPDATE SET created_at = EXCLUDED.created_at, archived_at = CURRENT_TIMESTAMP(0);
+
+-- name: ArchiveOldestFavorite :execrows
+WITH moved AS (
+  DELETE FROM favorites
+  WHERE (username, recipe_id) IN (
+    SELECT f.username, f.recipe_id FROM favorites f
+    WHERE f.username = @username::text
+    ORDER BY f.created_at, f.recipe_id
+    LIMIT 1
+  )
+  RETURNING username, recipe_id, created_at
+)
+INSERT INTO favorites_archive (username, recipe_id, created_at)
+SELECT username, recipe_id, created_at FROM moved
+ON CONFLICT (username, recipe_id) DO UPDATE SET created_at = EXCLUDED.created_at, archived_at = CURRENT_TIMESTAMP(0);
+
+-- name: DeleteArchivedFavorite :exec
+DELETE FROM favorites_archive WHERE username = @username::text AND recipe_id = @recipe_id::int;
+
+-- name: ListArchivedFavorites :many
+SELECT r.id, r.name, r.time, r.difficulty, fa.created_at, fa.archived_at FROM favorites_archive fa
+JOIN recipes r ON r.id = fa.recipe_id
+WHERE fa.username = @username::text
+ORDER BY fa.archived_at DESC, r.id;
+
+-- name: ListFavoriteRecipeIds :many
+SELECT recipe_id FROM favorites WHERE username = @username::text;
+
+-- name: LockFavoritesOwner :exec
+-- Taken before counting a user's favorites, so concurrent adds can't both
+-- pass the limit.
+SELECT 1 FROM users WHERE username = @username::text FOR UPDATE;
@@ -0,0 +1,40 @@
+-- name: CreateImportJob :one
+INSERT INTO import_jobs (username, total) VALUES (@username::text, @total::int)
+RETURNING id;
+
+-- name: GetImportJob :one
+SELECT * FROM import_jobs WHERE id = $1;
+
+-- name: UpdateImportJob :exec
+UPDATE import_jobs SET
+  status = @status::text,
+  total = @total::int,
+  imported = @imported::int,
+  skipped = @skipped::int,
+  failed = @failed::int,
+  updated_at = CURRENT_TIMESTAMP(0)
+WHERE id = @id::int;
+
+-- name: InsertImportedRecipe :one
+INSERT INTO recipes (name,recipe,ingredients,time,difficulty,username,calories,protein,carbs,fat,servings,source_id,source,source_url,equipment,flags,cook_time) VALUES
+(
+  @name::text,
+  @recipe::text,
+  @ingredients,
+  @time::int,
+  @difficulty::int,
+  @username::text,
+  sqlc.narg('calories')::int,
+  sqlc.narg('protein')::int,
+  sqlc.narg('carbs')::int,
+  sqlc.narg('fat')::int,
+  @servings::int,
+  @source_id::text,
+  @source::text,
+  sqlc.narg('source_url')::text,
+  @equipment::text[],
+  @flags::text[],
+  @cook_time::int
+)
+ON CONFLICT (source_id) DO NOTHING
+RETURNING id;
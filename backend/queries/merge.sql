@@ -0,0 +1,58 @@
+-- name: LockActiveUsers :many
+SELECT username FROM users WHERE username = ANY(@usernames::text[]) AND deleted_at IS NULL FOR UPDATE;
+
+-- name: MoveFavorites :execrows
+UPDATE favorites f SET username = @target::text
+WHERE f.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM favorites t WHERE t.username = @target::text AND t.recipe_id = f.recipe_id);
+
+-- name: MoveArchivedFavorites :execrows
+UPDATE favorites_archive f SET username = @target::text
+WHERE f.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM favorites_archive t WHERE t.username = @target::text AND t.recipe_id = f.recipe_id)
+  -- Still a favorite of the target, so not archived for them
+  AND NOT EXISTS (SELECT 1 FROM favorites t WHERE t.username = @target::text AND t.recipe_id = f.recipe_id);
+
+-- name: MoveCollections :execrows
+UPDATE collections SET username = @target::text WHERE username = @source::text;
+
+-- name: MoveRecipesMade :execrows
+UPDATE recipes_made SET username = @target::text WHERE username = @source::text;
+
+-- name: MoveUserTags :execrows
+UPDATE users_tags u SET username = @target::text,
+  -- Moved tags go after the target's own
+  sort_order = u.sort_order + (SELECT COALESCE(MAX(t.sort_order), 0) FROM users_tags t WHERE t.username = @target::text)
+WHERE u.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM users_tags t WHERE t.username = @target::text AND t.tag_id = u.tag_id);
+
+-- name: MoveExcludedIngredients :execrows
+UPDATE users_excluded_ingredients e SET username = @target::text
+WHERE e.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM users_excluded_ingredients t WHERE t.username = @target::text AND t.name = e.name);
+
+-- name: MovePantryItems :execrows
+UPDATE pantry_items p SET username = @target::text
+WHERE p.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM pantry_items t WHERE t.username = @target::text AND t.name = p.name);
+
+-- name: MoveSavedSearches :execrows
+UPDATE saved_searches s SET username = @target::text
+WHERE s.username = @source::text
+  AND NOT EXISTS (SELECT 1 FROM saved_searches t WHERE t.username = @target::text AND t.name = s.name);
+
+-- name: ArchiveFavoritesOverLimit :execrows
+-- Archives the user's oldest favorites, keeping the newest favorites_limit.
+WITH moved AS (
+  DELETE FROM favorites
+  WHERE (username, recipe_id) IN (
+    SELECT f.username, f.recipe_id FROM favorites f
+    WHERE f.username = @username::text
+    ORDER BY f.created_at DESC, f.recipe_id DESC
+    OFFSET @favorites_limit::bigint
+  )
+  RETURNING username, recipe_id, created_at
+)
+INSERT INTO favorites_archive (username, recipe_id, created_at)
+SELECT username, recipe_id, created_at FROM moved
+ON CONFLICT (username, recipe_id) DO UPDATE SET created_at = EXCLUDED.created_at, archived_at = CURRENT_TIMESTAMP(0);
@@ -0,0 +1,11 @@
+-- name: ListPantryItems :many
+SELECT name, amount, unit FROM pantry_items WHERE username = $1 ORDER BY name;
+
+-- name: UpsertPantryItem :exec
+INSERT INTO pantry_items (username, name, amount, unit)
+VALUES (@username::text, @name::text, @amount::int, @unit::text)
+ON CONFLICT (username, name) DO UPDATE
+SET amount = EXCLUDED.amount, unit = EXCLUDED.unit, updated_at = CURRENT_TIMESTAMP(0);
+
+-- name: DeletePantryItem :execrows
+DELETE FROM pantry_items WHERE username = @username::text AND name = @name::text;
@@ -1,12 +1,31 @@
 -- name: FilterRecipesByTagNamesAndParams :many
-SELECT r.id, r.name, r.time, r.difficulty
+SELECT r.id, r.name, r.time, r.cook_time, (r.time + r.cook_time)::int AS total_time, r.difficulty, rr.recent_rating
 FROM recipes r
+-- Average rating with each review's weight halving every half-life (in
+-- seconds), pulled towards a neutral 3 as if a fresh 3 were added, so high
+-- but old ratings fade. NULL without reviews
+LEFT JOIN LATERAL (
+  SELECT ((SUM(rv.review_score * w.weight) + 3) / (SUM(w.weight) + 1))::float8 AS recent_rating
+  FROM reviews rv
+  CROSS JOIN LATERAL (
+    SELECT power(0.5, EXTRACT(EPOCH FROM LOCALTIMESTAMP - rv.created_at) / @rating_half_life::float8) AS weight
+  ) w
+  WHERE rv.recipe_id = r.id
+) rr ON TRUE
 WHERE
-  -- User tags
-  (NOT EXISTS (SELECT 1 FROM users_tags ut WHERE ut.username = @username::text) OR
+  -- User tags. Diet tags that aren't strict only rank recipes, see ORDER BY
+  (NOT EXISTS (SELECT 1 FROM users_tags ut WHERE ut.username = @username::text AND ut.strictness = 'strict') OR
 
   EXISTS (SELECT 1 FROM recipes_tags rt JOIN users_tags ut ON rt.tag_id = ut.tag_id WHERE
-  ut.username = @username::text AND rt.recipe_id = r.id AND rt.tag_id IN (SELECT tag_id FROM users_tags ut WHERE ut.username = @username::text)))
+  ut.username = @username::text AND rt.recipe_id = r.id AND rt.tag_id IN (SELECT tag_id FROM users_tags ut WHERE ut.username = @username::text AND ut.strictness = 'strict')))
+
+  -- Every strict diet tag of the user is on the recipe
+  AND NOT EXISTS (
+    SELECT 1 FROM users_tags ut
+    JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = @username::text AND t.type_id = 1 AND ut.strictness = 'strict'
+      AND NOT EXISTS (SELECT 1 FROM recipes_tags rt WHERE rt.recipe_id = r.id AND rt.tag_id = ut.tag_id)
+  )
 
   -- Min preparation time (optional)
   AND (@min_time::int = 0 OR r.time >= @min_time::int)
@@ -14,6 +33,9 @@ WHERE
   -- Max preparation time (optional)
   AND (@max_time::int = 0 OR r.time <= @max_time::int)
 
+  -- Max total time, preparation and cooking (optional)
+  AND (@max_total_time::int = 0 OR r.time + r.cook_time <= @max_total_time::int)
+
   -- Min difficulty (optional)
   AND (@min_difficulty::int = 0 OR r.difficulty >= @min_difficulty::int)
 
@@ -74,11 +96,92 @@ WHERE
       AND t.name = ANY(@others::text[])
   ))
 
-ORDER BY r.id LIMIT @recipes_limit::int OFFSET @recipes_offset::int;
+  -- Hide favorited recipes (optional)
+  AND (NOT @exclude_favorited::bool OR NOT EXISTS (
+    SELECT 1 FROM favorites f WHERE f.recipe_id = r.id AND f.username = @username::text
+  ))
+
+  -- Hide recipes already made (optional)
+  AND (NOT @exclude_made::bool OR NOT EXISTS (
+    SELECT 1 FROM recipes_made rm WHERE rm.recipe_id = r.id AND rm.username = @username::text
+  ))
+
+  -- Leave out recipes using any of these ingredients, matched by lowercase name (optional)
+  AND (@exclude_ingredients::text[] IS NULL OR NOT EXISTS (
+    SELECT 1 FROM json_array_elements(r.ingredients->'ingredients') i
+    WHERE lower(i->>'name') = ANY(@exclude_ingredients::text[])
+  ))
+
+  -- Only recipes of one source kind, e.g. "user" or "import" (optional)
+  AND (@source_kind::text = '' OR r.source LIKE @source_kind::text || ':%')
+
+  -- Name contains the query, case insensitively. Wildcards in it are escaped
+  -- by the finder, so they match literally (optional)
+  AND (@name_query::text = '' OR r.name ILIKE '%' || @name_query::text || '%' ESCAPE '\')
+
+  -- Only recipes that need nothing beyond this equipment (optional)
+  AND (@available_equipment::text[] IS NULL OR r.equipment <@ @available_equipment::text[])
+
+  -- Only recipes with all of these flags, and none of the excluded ones (optional)
+  AND (@required_flags::text[] IS NULL OR r.flags @> @required_flags::text[])
+  AND (@excluded_flags::text[] IS NULL OR NOT r.flags && @excluded_flags::text[])
+
+ORDER BY
+  -- Recipes missing fewer of the user's moderate (2 points each) and flexible
+  -- (1 point) diet tags come first, whatever the sort
+  (
+    SELECT COALESCE(SUM(CASE ut.strictness WHEN 'moderate' THEN 2 ELSE 1 END), 0)
+    FROM users_tags ut
+    JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = @username::text AND t.type_id = 1 AND ut.strictness <> 'strict'
+      AND NOT EXISTS (SELECT 1 FROM recipes_tags rt WHERE rt.recipe_id = r.id AND rt.tag_id = ut.tag_id)
+  ),
+  -- Sort order (optional). Every order ends with the id, so recipes that tie
+  -- keep their place between pages
+  CASE WHEN @sort_by::text = 'time' THEN r.time END,
+  CASE WHEN @sort_by::text = 'quickest' THEN r.time + r.cook_time END,
+  CASE WHEN @sort_by::text = 'calories' THEN r.calories END NULLS LAST,
+  CASE WHEN @sort_by::text = 'rating' THEN (
+    SELECT AVG(rv.review_score) FROM reviews rv WHERE rv.recipe_id = r.id
+  ) END DESC NULLS LAST,
+  CASE WHEN @sort_by::text = 'recent_rating' THEN rr.recent_rating END DESC NULLS LAST,
+  CASE WHEN @sort_by::text = 'newest' THEN r.created_at END DESC,
+  -- Relevance weighs the same signals as recommendations, in the order of
+  -- RelevanceWeights.Array
+  CASE WHEN @sort_by::text = 'relevance' THEN
+    (@relevance_weights::float8[])[1] * (
+      SELECT COALESCE(SUM(ut.weight), 0) FROM recipes_tags rt
+      JOIN users_tags ut ON ut.tag_id = rt.tag_id
+      WHERE rt.recipe_id = r.id AND ut.username = @username::text
+    )
+    + (@relevance_weights::float8[])[2] * COALESCE((
+      SELECT AVG(rv.review_score) FROM reviews rv WHERE rv.recipe_id = r.id
+    ), 0)
+    + (@relevance_weights::float8[])[3] * ln(1 + (SELECT COUNT(*) FROM favorites f WHERE f.recipe_id = r.id))
+    + (@relevance_weights::float8[])[4] / (1 + EXTRACT(EPOCH FROM now() - r.created_at) / 2592000)
+    + (@relevance_weights::float8[])[5] * COALESCE((
+      SELECT AVG(CASE WHEN EXISTS (
+        SELECT 1 FROM pantry_items p
+        WHERE p.username = @username::text AND lower(trim(p.name)) = lower(trim(i->>'name'))
+      ) THEN 1 ELSE 0 END)
+      FROM json_array_elements(r.ingredients->'ingredients') i
+    ), 0)
+  END DESC NULLS LAST,
+  r.id
+LIMIT @recipes_limit::int OFFSET @recipes_offset::int;
 
 -- name: GetRecipeWithId :one
 SELECT * FROM recipes WHERE id = $1;
 
+-- name: ListUserRecipes :many
+SELECT * FROM recipes WHERE username = $1 ORDER BY id;
+
+-- name: CountRecipes :one
+SELECT COUNT(*) FROM recipes;
+
+-- name: GetRecipeAtOffset :one
+SELECT * FROM recipes ORDER BY id LIMIT 1 OFFSET @recipe_offset::int;
+
 -- name: GetAllTags :many
 SELECT tt.name AS type_name, t.name AS tag_name
 FROM tags t
@@ -86,14 +189,26 @@ JOIN tags_types tt ON t.type_id = tt.id
 ORDER BY tt.id, t.name;
 
 -- name: CreateRecipe :one
-INSERT INTO recipes (name,recipe,ingredients,time,difficulty,username) VALUES 
+INSERT INTO recipes (name,recipe,ingredients,time,difficulty,username,calories,protein,carbs,fat,servings,source,source_url,equipment,flags,cook_time,batch_friendly,storage_days) VALUES 
 (
   @name::text,
   @recipe::text,
   @ingredients,
   @time::int,
   @difficulty::int,
-  @username::text
+  @username::text,
+  sqlc.narg('calories')::int,
+  sqlc.narg('protein')::int,
+  sqlc.narg('carbs')::int,
+  sqlc.narg('fat')::int,
+  @servings::int,
+  'user:' || @username::text,
+  sqlc.narg('source_url')::text,
+  @equipment::text[],
+  @flags::text[],
+  @cook_time::int,
+  @batch_friendly::bool,
+  @storage_days::int
 ) RETURNING id;
 
 -- name: AddTagsForRecipe :exec
@@ -104,4 +219,166 @@ INSERT INTO recipes_tags (recipe_id, tag_id) VALUES
 SELECT t.id AS tag_id
 FROM tags t
 JOIN tags_types tt ON t.type_id = tt.id
-WHERE tags_types.name = @key::text AND tags.name = @value::text;
\ No newline at end of file
+WHERE tags_types.name = @key::text AND tags.name = @value::text;
+
+-- name: GetPlanCandidates :many
+SELECT r.id, r.name, r.calories, r.protein, r.carbs, r.fat
+FROM recipes r
+WHERE r.calories IS NOT NULL AND r.protein IS NOT NULL AND r.carbs IS NOT NULL AND r.fat IS NOT NULL
+  -- Never plan recipes containing the user's allergens
+  AND NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4 AND ut.username = @username::text
+  )
+ORDER BY r.id;
+
+-- name: ListSurpriseCandidates :many
+-- Recipes a random pick may return, with the user tags each matches.
+SELECT r.id, ARRAY(
+  SELECT rt.tag_id FROM recipes_tags rt
+  JOIN users_tags ut ON ut.tag_id = rt.tag_id AND ut.username = @username::text
+  WHERE rt.recipe_id = r.id
+)::int[] AS tag_ids
+FROM recipes r
+WHERE
+  -- Never return a recipe with one of the user's allergens
+  NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4 AND ut.username = @username::text
+  )
+
+  -- Respect the user's strict diet tags when there are any
+  AND (NOT EXISTS (
+    SELECT 1 FROM users_tags ut JOIN tags t ON t.id = ut.tag_id
+    WHERE ut.username = @username::text AND t.type_id = 1 AND ut.strictness = 'strict'
+  ) OR EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    JOIN users_tags ut ON ut.tag_id = t.id
+    WHERE rt.recipe_id = r.id AND t.type_id = 1 AND ut.username = @username::text AND ut.strictness = 'strict'
+  ))
+
+  AND (@max_time::int = 0 OR r.time <= @max_time::int)
+  AND (@max_difficulty::int = 0 OR r.difficulty <= @max_difficulty::int)
+
+  AND (@recipe_type::text[] IS NULL OR EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id
+      AND t.type_id = 3
+      AND t.name = ANY(@recipe_type::text[])
+  ))
+
+  AND (@allergies::text[] IS NULL OR NOT EXISTS (
+    SELECT 1 FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id
+      AND t.type_id = 4
+      AND t.name = ANY(@allergies::text[])
+  ))
+
+ORDER BY r.id;
+
+-- name: GetRecommendationCandidates :many
+SELECT r.id, r.name, r.time, r.difficulty, array_agg(rt.tag_id)::int[] AS tag_ids,
+  -- Relevance signals besides tags and ratings, as in the relevance sort
+  ln(1 + (SELECT COUNT(*) FROM favorites f WHERE f.recipe_id = r.id))::float8 AS popularity,
+  (1 / (1 + EXTRACT(EPOCH FROM now() - r.created_at) / 2592000))::float8 AS recency,
+  COALESCE((
+    SELECT AVG(CASE WHEN EXISTS (
+      SELECT 1 FROM pantry_items p
+      WHERE p.username = @username::text AND lower(trim(p.name)) = lower(trim(i->>'name'))
+    ) THEN 1 ELSE 0 END)
+    FROM json_array_elements(r.ingredients->'ingredients') i
+  ), 0)::float8 AS pantry_share
+FROM recipes r
+JOIN recipes_tags rt ON rt.recipe_id = r.id
+JOIN users_tags ut ON ut.tag_id = rt.tag_id AND ut.username = @username::text
+WHERE NOT EXISTS (
+  -- Allergens are a hard filter, whatever their weight
+  SELECT 1 FROM recipes_tags art
+  JOIN tags t ON t.id = art.tag_id
+  JOIN users_tags aut ON aut.tag_id = t.id
+  WHERE art.recipe_id = r.id AND t.type_id = 4 AND aut.username = @username::text
+)
+GROUP BY r.id;
+
+-- name: CompareRecipes :many
+SELECT r.id, r.name, r.time, r.calories, r.protein, r.carbs, r.fat,
+  COALESCE(AVG(rv.review_score), 0)::float8 AS rating,
+  COUNT(rv.id)::int AS review_count
+FROM recipes r
+LEFT JOIN reviews rv ON rv.recipe_id = r.id
+WHERE r.id = ANY(@recipe_ids::int[])
+GROUP BY r.id;
+
+-- name: FindSimilarRecipes :many
+-- % uses the trigram index, so only recipes past pg_trgm's similarity
+-- threshold are considered.
+SELECT r.id, r.name, similarity(lower(r.name), lower(@name::text))::float8 AS name_similarity, r.ingredients
+FROM recipes r
+WHERE lower(r.name) % lower(@name::text)
+ORDER BY name_similarity DESC, r.id
+LIMIT @candidate_limit::int;
+
+-- name: GetTrendingRecipes :many
+-- Activity inside the window only: a favorite counts 3, a review 2 and a
+-- cooked log 1. Recipes without activity in the window are left out.
+WITH activity AS (
+  SELECT recipe_id, 3 AS points FROM favorites
+  WHERE created_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int)
+  UNION ALL
+  SELECT recipe_id, 2 FROM reviews
+  WHERE created_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int)
+  UNION ALL
+  SELECT recipe_id, 1 FROM recipes_made
+  WHERE made_at >= CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int)
+)
+SELECT r.id, r.name, r.time, r.difficulty, SUM(a.points)::int AS activity,
+  COALESCE((
+    SELECT array_agg(t.id) FROM recipes_tags rt
+    JOIN tags t ON t.id = rt.tag_id
+    WHERE rt.recipe_id = r.id AND t.type_id = 4
+  ), '{}')::int[] AS allergen_tag_ids
+FROM activity a
+JOIN recipes r ON r.id = a.recipe_id
+GROUP BY r.id
+ORDER BY activity DESC, r.id
+LIMIT @pool_size::int;
+
+-- name: GetIngredientsForRecipes :many
+SELECT r.id, r.ingredients
+FROM recipes r
+WHERE r.id = ANY(@recipe_ids::int[]);
+
+-- name: GetTagsForRecipes :many
+SELECT rt.recipe_id, t.type_id, t.name
+FROM recipes_tags rt
+JOIN tags t ON t.id = rt.tag_id
+WHERE rt.recipe_id = ANY(@recipe_ids::int[])
+ORDER BY rt.recipe_id, t.type_id, t.name;
+
+-- name: NotifyRecipeChanged :exec
+SELECT pg_notify('recipe_invalidation', @recipe_id::text);
+
+-- name: SetRecipeImage :execrows
+UPDATE recipes SET image_url = @image_url::text,
+  image_blurhash = sqlc.narg('image_blurhash')::text,
+  image_color = sqlc.narg('image_color')::text
+WHERE id = @id::int;
+
+-- name: ListRecipesMissingImagePlaceholder :many
+-- Recipes with an image but no placeholder yet, in id order after after_id.
+SELECT id, image_url::text AS image_url FROM recipes
+WHERE image_url IS NOT NULL AND image_blurhash IS NULL AND id > @after_id::int
+ORDER BY id
+LIMIT @batch_size::int;
+
+-- name: SetRecipeImagePlaceholder :execrows
+-- Only while the image is still the one the placeholder was made from.
+UPDATE recipes SET image_blurhash = @image_blurhash::text, image_color = @image_color::text
+WHERE id = @id::int AND image_url = @image_url::text;
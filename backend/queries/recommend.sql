@@ -0,0 +1,18 @@
+-- name: GetRecentRecommendations :many
+SELECT recipe_id, shown_at FROM recommendation_history
+WHERE username = @username::text
+  AND shown_at > CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int);
+
+-- name: RecordRecommendations :exec
+INSERT INTO recommendation_history (username, recipe_id, shown_at)
+SELECT @username::text, unnest(@recipe_ids::int[]), CURRENT_TIMESTAMP(0)
+ON CONFLICT (username, recipe_id) DO UPDATE SET shown_at = EXCLUDED.shown_at;
+
+-- name: PruneRecommendationHistory :exec
+-- Entries past the window no longer count, so they're dropped.
+DELETE FROM recommendation_history
+WHERE username = @username::text
+  AND shown_at <= CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int);
+
+-- name: ClearRecommendationHistory :exec
+DELETE FROM recommendation_history WHERE username = @username::text;
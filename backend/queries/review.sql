@@ -0,0 +1,54 @@
+-- name: CreateReview :one
+INSERT INTO reviews (recipe_id, username, review_score, comment)
+VALUES (@recipe_id::int, @username::text, @review_score::int, @comment::text)
+RETURNING id;
+
+-- name: GetReviewAuthor :one
+SELECT username FROM reviews WHERE id = $1;
+
+-- name: UpsertReviewVote :exec
+INSERT INTO review_votes (review_id, username, up)
+VALUES (@review_id::int, @username::text, @up::boolean)
+ON CONFLICT (review_id, username) DO UPDATE
+SET up = EXCLUDED.up, created_at = CURRENT_TIMESTAMP(0);
+
+-- name: ListRecipeReviews :many
+SELECT r.id, r.username, r.review_score, r.comment, r.created_at, r.edited_at,
+  COUNT(v.username) FILTER (WHERE v.up)::int AS upvotes,
+  COUNT(v.username) FILTER (WHERE NOT v.up)::int AS downvotes,
+  (COUNT(v.username) FILTER (WHERE v.up) - COUNT(v.username) FILTER (WHERE NOT v.up))::int AS helpfulness
+FROM reviews r
+LEFT JOIN review_votes v ON v.review_id = r.id
+WHERE r.recipe_id = $1
+GROUP BY r.id
+ORDER BY r.id;
+
+-- name: GetReviewForUpdate :one
+SELECT username, comment, created_at, edited_at FROM reviews
+WHERE id = $1
+FOR UPDATE;
+
+-- name: InsertReviewEdit :exec
+-- Keeps the version being replaced; written_at is when that version was written.
+INSERT INTO review_edits (review_id, comment, written_at)
+VALUES (@review_id::int, @comment::text, @written_at::timestamp);
+
+-- name: UpdateReviewComment :exec
+UPDATE reviews SET comment = @comment::text, edited_at = CURRENT_TIMESTAMP(0)
+WHERE id = @id::int;
+
+-- name: ListReviewEdits :many
+SELECT id, review_id, comment, written_at, replaced_at FROM review_edits
+WHERE review_id = $1
+ORDER BY id;
+
+-- name: ListRatingsForUserTags :many
+-- Average review scores of the recipes sharing a tag with the user.
+SELECT r.recipe_id, AVG(r.review_score)::float8 AS rating
+FROM reviews r
+WHERE r.recipe_id IN (
+  SELECT rt.recipe_id FROM recipes_tags rt
+  JOIN users_tags ut ON ut.tag_id = rt.tag_id
+  WHERE ut.username = @username::text
+)
+GROUP BY r.recipe_id;
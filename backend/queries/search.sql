@@ -0,0 +1,31 @@
+-- name: SaveSearch :one
+-- Saving under an existing name replaces that search and restarts its alerts.
+INSERT INTO saved_searches (username, name, params) VALUES (@username::text, @name::text, @params)
+ON CONFLICT (username, name) DO UPDATE SET params = EXCLUDED.params, last_checked_at = CURRENT_TIMESTAMP
+RETURNING id;
+
+-- name: ListSavedSearches :many
+SELECT id, name, params, created_at, last_checked_at FROM saved_searches
+WHERE username = $1
+ORDER BY name;
+
+-- name: ListAllSavedSearches :many
+SELECT * FROM saved_searches ORDER BY id;
+
+-- name: ListRecipesCreatedBetween :many
+SELECT r.id, r.time, r.difficulty, r.created_at,
+  COALESCE(array_agg(t.type_id) FILTER (WHERE t.id IS NOT NULL), '{}')::int[] AS tag_type_ids,
+  COALESCE(array_agg(t.name) FILTER (WHERE t.id IS NOT NULL), '{}')::text[] AS tag_names
+FROM recipes r
+LEFT JOIN recipes_tags rt ON rt.recipe_id = r.id
+LEFT JOIN tags t ON t.id = rt.tag_id
+WHERE r.created_at > @since::timestamp AND r.created_at <= @until::timestamp
+GROUP BY r.id
+ORDER BY r.id;
+
+-- name: InsertSearchAlert :exec
+INSERT INTO search_alerts (saved_search_id, recipe_id) VALUES (@saved_search_id::bigint, @recipe_id::int)
+ON CONFLICT (saved_search_id, recipe_id) DO NOTHING;
+
+-- name: SetSavedSearchChecked :exec
+UPDATE saved_searches SET last_checked_at = @checked_at::timestamp WHERE id = @id::bigint;
@@ -0,0 +1,62 @@
+-- name: RevokeToken :exec
+INSERT INTO revoked_tokens (jti, expires_at) VALUES (@jti::text, to_timestamp(@expires_at::bigint))
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: PruneRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP(0);
+
+-- name: RevokeUserTokens :exec
+UPDATE users SET tokens_revoked_at = date_trunc('second', CURRENT_TIMESTAMP) WHERE username = @username::text;
+
+-- name: RevokeClientTokens :exec
+INSERT INTO client_revocations (username, client, revoked_at)
+VALUES (@username::text, @client::text, date_trunc('second', CURRENT_TIMESTAMP))
+ON CONFLICT (username, client) DO UPDATE SET revoked_at = EXCLUDED.revoked_at;
+
+-- name: IsTokenRevoked :one
+-- Revoked when signed out, or issued before the user's tokens, or those of
+-- its client, were revoked.
+SELECT (
+  EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = @jti::text)
+  OR EXISTS (
+    SELECT 1 FROM users
+    WHERE username = @username::text AND tokens_revoked_at > to_timestamp(@issued_at::bigint)
+  )
+  OR EXISTS (
+    SELECT 1 FROM client_revocations
+    WHERE username = @username::text AND client = @client::text
+      AND revoked_at > to_timestamp(@issued_at::bigint)
+  )
+)::bool AS revoked;
+
+-- name: CreateSession :exec
+INSERT INTO user_sessions (id, username, client, user_agent, ip, expires_at)
+VALUES (@id::text, @username::text, @client::text, @user_agent::text, @ip::text, to_timestamp(@expires_at::bigint));
+
+-- name: PruneUserSessions :exec
+DELETE FROM user_sessions WHERE username = @username::text AND expires_at < CURRENT_TIMESTAMP(0);
+
+-- name: ListSessions :many
+-- Sessions that haven't expired or been revoked, the way IsTokenRevoked
+-- decides it, most recently used first.
+SELECT s.id, s.client, s.user_agent, s.ip, s.created_at, s.last_used_at, s.expires_at
+FROM user_sessions s
+JOIN users u ON u.username = s.username
+LEFT JOIN client_revocations c ON c.username = s.username AND c.client = s.client
+WHERE s.username = @username::text
+  AND s.expires_at > CURRENT_TIMESTAMP(0)
+  AND NOT EXISTS (SELECT 1 FROM revoked_tokens t WHERE t.jti = s.id)
+  AND (u.tokens_revoked_at IS NULL OR u.tokens_revoked_at <= s.created_at)
+  AND (c.revoked_at IS NULL OR c.revoked_at <= s.created_at)
+ORDER BY s.last_used_at DESC, s.created_at DESC;
+
+-- name: TouchSession :exec
+-- Written at most once a minute per session.
+UPDATE user_sessions SET last_used_at = CURRENT_TIMESTAMP(0)
+WHERE id = @id::text AND last_used_at < CURRENT_TIMESTAMP(0) - INTERVAL '1 minute';
+
+-- name: DeleteSession :one
+-- Only the owner's sessions match, so others' look missing.
+DELETE FROM user_sessions
+WHERE id = @id::text AND username = @username::text AND expires_at > CURRENT_TIMESTAMP(0)
+RETURNING extract(epoch FROM expires_at)::bigint AS expires_at;
@@ -1,5 +1,5 @@
 -- name: LoginUserWithUsername :one
-SELECT username, passwdhash FROM users WHERE username = $1;  
+SELECT username, passwdhash, role, uuid::text AS user_id FROM users WHERE username = $1 AND deleted_at IS NULL;
 
 -- name: CreateUser :exec
 INSERT INTO users (
@@ -8,20 +8,44 @@ INSERT INTO users (
     email,
     phone_number,
     age,
-    sex
+    sex,
+    terms_version,
+    terms_accepted_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP(0)
 );
 
 -- name: GetUserData :one
-SELECT username, created_at, email, name, surname, phone_number, age, sex, weight, height, BMI FROM users WHERE users.username = $1;
+SELECT username, created_at, email, name, surname, phone_number, age, sex, weight, height, BMI, timezone, locale, default_servings, equipment FROM users WHERE users.username = $1;
+
+-- name: GetUsers :many
+SELECT username, name, surname, created_at FROM users
+WHERE username = ANY(@usernames::text[])
+ORDER BY username;
+
+-- name: GetUsersDetailed :many
+SELECT username, name, surname, created_at, email, phone_number, role FROM users
+WHERE username = ANY(@usernames::text[])
+ORDER BY username;
+
+-- name: GetUserDefaultServings :one
+SELECT default_servings FROM users WHERE username = $1;
+
+-- name: GetUserTimezone :one
+SELECT timezone FROM users WHERE username = $1;
+
+-- name: GetUserEquipment :one
+SELECT equipment FROM users WHERE username = $1;
 
 -- name: GetUserTags :many
 SELECT tag_id FROM users_tags WHERE username = $1;
 
 -- name: InsertUserTag :exec
-INSERT INTO users_tags (username, tag_id)
-SELECT @username::text AS username, t.id AS tag_id FROM tags t
+-- New tags go to the end of the user's ordering.
+INSERT INTO users_tags (username, tag_id, sort_order)
+SELECT @username::text AS username, t.id AS tag_id,
+  (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM users_tags WHERE username = @username::text)
+FROM tags t
 JOIN tags_types tt ON tt.id = t.type_id
 WHERE t.name = @tag_name::text AND tt.name = @tag_type_name::text
 ON CONFLICT (username, tag_id) DO NOTHING;
@@ -30,13 +54,53 @@ ON CONFLICT (username, tag_id) DO NOTHING;
 DELETE FROM users_tags USING tags WHERE users_tags.tag_id = tags.id AND users_tags.username = @username::text AND tags.name = @tag_name::text;
 
 -- name: DisplayUserTag :many
-SELECT t.name AS value, tt.name AS category FROM tags t 
+SELECT t.name AS value, tt.name AS category, ut.weight, ut.strictness FROM tags t 
 JOIN tags_types tt ON tt.id = t.type_id
-JOIN users_tags ut ON ut.tag_id = t.id WHERE ut.username = @username::text;
+JOIN users_tags ut ON ut.tag_id = t.id WHERE ut.username = @username::text
+ORDER BY ut.sort_order, t.name;
+
+-- name: LockUserTagNames :many
+SELECT t.name FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1
+FOR UPDATE OF ut;
+
+-- name: SetUserTagOrder :exec
+UPDATE users_tags ut SET sort_order = o.position
+FROM unnest(@tag_names::text[]) WITH ORDINALITY AS o(name, position)
+JOIN tags t ON t.name = o.name
+WHERE ut.tag_id = t.id AND ut.username = @username::text;
+
+-- name: GetUserTagWeights :many
+SELECT tag_id, weight FROM users_tags WHERE username = $1;
+
+-- name: GetUserAllergenTagIds :many
+SELECT ut.tag_id FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1 AND t.type_id = 4
+ORDER BY ut.tag_id;
+
+-- name: SetUserTagWeight :execrows
+UPDATE users_tags SET weight = @weight::int
+FROM tags
+WHERE users_tags.tag_id = tags.id AND users_tags.username = @username::text AND tags.name = @tag_name::text;
+
+-- name: SetUserTagStrictness :execrows
+-- Only diet tags have a strictness; other tags aren't matched.
+UPDATE users_tags SET strictness = @strictness::text
+FROM tags
+WHERE users_tags.tag_id = tags.id AND users_tags.username = @username::text AND tags.name = @tag_name::text AND tags.type_id = 1;
+
+-- name: GetUserDietStrictness :many
+SELECT ut.tag_id, ut.strictness FROM users_tags ut
+JOIN tags t ON t.id = ut.tag_id
+WHERE ut.username = $1 AND t.type_id = 1
+ORDER BY ut.tag_id;
 
 -- name: UpdateUserSettings :exec
 UPDATE users
 SET
+email_changed_at = CASE WHEN sqlc.arg('email')::text IN ('', email) THEN email_changed_at ELSE CURRENT_TIMESTAMP(0) END,
 email = CASE WHEN sqlc.arg('email')::text = ''  THEN email        ELSE sqlc.arg('email')::text        END,
 name = CASE WHEN sqlc.arg('name')::text = ''  THEN name         ELSE sqlc.arg('name')::text         END,
 surname = CASE WHEN sqlc.arg('surname')::text = ''  THEN surname      ELSE sqlc.arg('surname')::text      END,
@@ -45,5 +109,134 @@ age = CASE WHEN sqlc.arg('age')::int = -1  THEN age          ELSE sqlc.arg('age'
 sex = CASE WHEN sqlc.arg('sex')::text = ''  THEN sex          ELSE sqlc.arg('sex')::text          END,
 weight = CASE WHEN sqlc.arg('weight')::int = -1  THEN weight       ELSE sqlc.arg('weight')::int       END,
 height = CASE WHEN sqlc.arg('height')::int = -1  THEN height       ELSE sqlc.arg('height')::int       END,
-bmi = CASE WHEN sqlc.arg('bmi')::int = -1  THEN bmi          ELSE sqlc.arg('bmi')::int          END
-WHERE username = sqlc.arg('username')::text;
\ No newline at end of file
+bmi = CASE WHEN sqlc.arg('bmi')::int = -1  THEN bmi          ELSE sqlc.arg('bmi')::int          END,
+timezone = CASE WHEN sqlc.arg('timezone')::text = ''  THEN timezone     ELSE sqlc.arg('timezone')::text     END,
+locale = CASE WHEN sqlc.arg('locale')::text = ''  THEN locale       ELSE sqlc.arg('locale')::text       END,
+default_servings = CASE sqlc.arg('default_servings')::int WHEN -1 THEN default_servings WHEN 0 THEN NULL ELSE sqlc.arg('default_servings')::int END,
+equipment = CASE WHEN sqlc.arg('equipment_set')::bool THEN sqlc.arg('equipment')::text[] ELSE equipment END
+WHERE username = sqlc.arg('username')::text;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET passwdhash = @passwdhash::text WHERE username = @username::text;
+
+-- name: InsertPasswordHistory :exec
+INSERT INTO password_history (username, passwdhash) VALUES (@username::text, @passwdhash::text);
+
+-- name: GetPasswordHistory :many
+SELECT passwdhash FROM password_history
+WHERE username = @username::text
+ORDER BY created_at DESC, id DESC
+LIMIT @history_limit::int;
+
+-- name: PrunePasswordHistory :exec
+DELETE FROM password_history
+WHERE username = @username::text AND id NOT IN (
+  SELECT id FROM password_history
+  WHERE username = @username::text
+  ORDER BY created_at DESC, id DESC
+  LIMIT @history_limit::int
+);
+
+-- name: GetUserEmailChange :one
+SELECT email, email_changed_at FROM users WHERE username = $1;
+
+-- name: GetUserMeasurementsForUpdate :one
+SELECT weight, height FROM users WHERE username = $1 FOR UPDATE;
+
+-- name: UpdateUserEmail :execrows
+UPDATE users SET email = @email::text WHERE username = @username::text;
+
+-- name: RecordTermsConsent :execrows
+UPDATE users SET terms_version = @terms_version::text, terms_accepted_at = CURRENT_TIMESTAMP(0)
+WHERE username = @username::text AND deleted_at IS NULL;
+
+-- name: GetTermsConsent :one
+SELECT terms_version, terms_accepted_at FROM users WHERE username = $1;
+
+-- name: GetUserRole :one
+SELECT role FROM users WHERE username = $1;
+
+-- name: UpdateUserRole :execrows
+UPDATE users SET role = @role::text WHERE username = @username::text;
+
+-- name: SoftDeleteUser :execrows
+UPDATE users SET deleted_at = CURRENT_TIMESTAMP(0) WHERE username = $1 AND deleted_at IS NULL;
+
+-- name: RestoreUser :execrows
+UPDATE users SET deleted_at = NULL WHERE username = $1 AND deleted_at IS NOT NULL;
+
+-- name: PurgeDeletedUsers :many
+-- users_tags and reviews have no foreign key to users, so they're cleared here;
+-- everything else goes with ON DELETE CASCADE.
+WITH purged AS (
+  SELECT username FROM users
+  WHERE deleted_at IS NOT NULL
+    AND deleted_at < CURRENT_TIMESTAMP(0) - make_interval(secs => @retention_seconds::int)
+  ORDER BY deleted_at
+  LIMIT @batch_size::int
+  FOR UPDATE SKIP LOCKED
+), purged_tags AS (
+  DELETE FROM users_tags WHERE username IN (SELECT username FROM purged)
+), purged_reviews AS (
+  DELETE FROM reviews WHERE username IN (SELECT username FROM purged)
+)
+DELETE FROM users WHERE username IN (SELECT username FROM purged)
+RETURNING username;
+
+-- name: GetUsernameByUserID :one
+SELECT username FROM users WHERE uuid = (@user_id::text)::uuid AND deleted_at IS NULL;
+
+-- name: InsertSettingsSnapshot :exec
+-- With only_if_missing set it only records a baseline for users without history.
+INSERT INTO settings_history (username, snapshot)
+SELECT username, jsonb_build_object(
+  'email', email,
+  'name', name,
+  'surname', surname,
+  'phone_number', phone_number,
+  'age', age::text,
+  'sex', sex,
+  'weight', weight::text,
+  'height', height::text,
+  'bmi', bmi::text,
+  'timezone', timezone,
+  'locale', locale,
+  'default_servings', COALESCE(default_servings::text, ''),
+  'equipment', array_to_string(equipment, ',')
+)
+FROM users
+WHERE users.username = @username::text
+  AND NOT (@only_if_missing::boolean AND EXISTS (
+    SELECT 1 FROM settings_history h WHERE h.username = @username::text
+  ));
+
+-- name: ListSettingsSnapshots :many
+SELECT snapshot, created_at FROM settings_history
+WHERE username = $1
+ORDER BY created_at, id;
+
+-- name: ListExcludedIngredients :many
+SELECT name FROM users_excluded_ingredients WHERE username = $1 ORDER BY name;
+
+-- name: AddExcludedIngredient :exec
+INSERT INTO users_excluded_ingredients (username, name) VALUES (@username::text, @name::text)
+ON CONFLICT (username, name) DO NOTHING;
+
+-- name: DeleteExcludedIngredient :execrows
+DELETE FROM users_excluded_ingredients WHERE username = @username::text AND name = @name::text;
+
+-- name: GetSignupAvailability :one
+-- Usernames of soft-deleted accounts stay taken until they're purged.
+SELECT
+  EXISTS (SELECT 1 FROM users WHERE username = @username::text)::bool AS username_taken,
+  EXISTS (SELECT 1 FROM users WHERE lower(email) = lower(@email::text) AND deleted_at IS NULL)::bool AS email_taken;
+
+-- name: ListExpiredSettingsHistory :many
+-- Oldest first, one batch at a time, for the retention job.
+SELECT id, username, snapshot, created_at FROM settings_history
+WHERE created_at < CURRENT_TIMESTAMP(0) - make_interval(secs => @window_seconds::int)
+ORDER BY id
+LIMIT @batch_size::int;
+
+-- name: DeleteSettingsHistoryByIDs :execrows
+DELETE FROM settings_history WHERE id = ANY(@ids::int[]);
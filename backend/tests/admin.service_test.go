@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestSetRoleRequestValidate(t *testing.T) {
+	for _, role := range []string{"user", "admin"} {
+		req := models.SetRoleRequest{Role: role}
+		if err := req.Validate(); err != nil {
+			t.Errorf("role %q: got %v, want nil", role, err)
+		}
+	}
+	for _, role := range []string{"", "root", "Admin"} {
+		req := models.SetRoleRequest{Role: role}
+		if err := req.Validate(); err == nil {
+			t.Errorf("role %q: got nil, want error", role)
+		}
+	}
+}
+
+func TestSetUserRoleAuditIntegration(t *testing.T) {
+	conn := testConnection(t)
+	admin := services.NewBaseAdminService(conn)
+	ctx := context.Background()
+	actor := createTestUser(t, conn, "adm", "Admin1!")
+	target := createTestUser(t, conn, "tgt", "Target1!")
+
+	if err := admin.SetUserRole(ctx, actor, target, &models.SetRoleRequest{Role: "admin"}); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+
+	entries, err := admin.ListAudit(ctx, models.AuditFilter{Target: target, Limit: 10})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Actor != actor || entry.Action != services.AuditActionSetRole || entry.BeforeValue != "user" || entry.AfterValue != "admin" {
+		t.Errorf("got audit entry %+v", entry)
+	}
+
+	if err := admin.SetUserRole(ctx, actor, target, &models.SetRoleRequest{Role: "root"}); err != services.ErrValidation {
+		t.Errorf("invalid role: got %v, want %v", err, services.ErrValidation)
+	}
+	if entries, _ := admin.ListAudit(ctx, models.AuditFilter{Target: target, Limit: 10}); len(entries) != 1 {
+		t.Errorf("failed action should not be audited, got %d entries", len(entries))
+	}
+}
+
+func int32Ptr(v int32) *int32 { return &v }
+
+// pagedMeals serves rows in pages of size, as the export query does.
+func pagedMeals(rows []repository.ExportRecipesPageRow, size int) services.MealPageFetcher {
+	return func(ctx context.Context, afterID int32) ([]repository.ExportRecipesPageRow, error) {
+		var page []repository.ExportRecipesPageRow
+		for _, row := range rows {
+			if row.ID > afterID && len(page) < size {
+				page = append(page, row)
+			}
+		}
+		return page, nil
+	}
+}
+
+func TestStreamMealsCSVGolden(t *testing.T) {
+	rows := []repository.ExportRecipesPageRow{
+		{ID: 1, Name: "Bigos", Username: "karol", Time: 120, Difficulty: 3, Servings: 4,
+			Calories: int32Ptr(450), Protein: int32Ptr(25), Carbs: int32Ptr(20), Fat: int32Ptr(30), Tags: "Obiad; Polska"},
+		{ID: 2, Name: `Sałatka "grecka", lekka`, Username: "ania", Time: 15, Difficulty: 1, Servings: 2},
+		{ID: 3, Name: "Żurek", Username: "karol", Time: 60, Difficulty: 2, Servings: 4,
+			Calories: int32Ptr(320), Protein: int32Ptr(14), Carbs: int32Ptr(30), Fat: int32Ptr(16), Tags: "Polska"},
+		// User text a spreadsheet would run as formulas.
+		{ID: 4, Name: `=HYPERLINK("http://evil.example","Bigos")`, Username: "@mallory", Time: 5, Difficulty: 1, Servings: 1,
+			Tags: "+cmd|' /C calc'!A0"},
+		{ID: 5, Name: "-2+3", Username: "ania", Time: 5, Difficulty: 1, Servings: 1, Tags: "\tObiad"},
+	}
+
+	var out bytes.Buffer
+	if err := services.StreamMealsCSV(context.Background(), &out, pagedMeals(rows, 2)); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	golden, err := os.ReadFile("testdata/meals_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(golden) {
+		t.Errorf("export differs from golden file:\n%s", out.String())
+	}
+}
+
+// countingWriter records how much was written without keeping it.
+type countingWriter struct {
+	total   int
+	largest int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.total += len(p)
+	c.largest = max(c.largest, len(p))
+	return len(p), nil
+}
+
+func TestStreamMealsCSVDoesNotBuffer(t *testing.T) {
+	const pages, pageSize = 200, 500
+	out := &countingWriter{}
+
+	fetched, written := 0, -1
+	fetch := func(ctx context.Context, afterID int32) ([]repository.ExportRecipesPageRow, error) {
+		// The previous page must be out before the next one is fetched.
+		if written >= 0 && out.total <= written {
+			t.Fatalf("page ending at id %d wasn't flushed before the next fetch", afterID)
+		}
+		written = out.total
+		if fetched == pages {
+			return nil, nil
+		}
+		fetched++
+
+		page := make([]repository.ExportRecipesPageRow, pageSize)
+		for i := range page {
+			id := afterID + int32(i) + 1
+			page[i] = repository.ExportRecipesPageRow{ID: id, Name: fmt.Sprintf("Przepis %d", id), Username: "karol", Servings: 1}
+		}
+		return page, nil
+	}
+
+	if err := services.StreamMealsCSV(context.Background(), out, fetch); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if out.total < 1<<20 {
+		t.Fatalf("expected over 1MB of output, got %d bytes", out.total)
+	}
+	// Writes come in buffer-sized chunks, never the whole export at once.
+	if out.largest > 64<<10 {
+		t.Errorf("largest single write was %d bytes of %d", out.largest, out.total)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Scopes []string
+		Method string
+		Path   string
+		Want   bool
+	}{
+		{"unscoped", nil, http.MethodPost, "/user/pantry", true},
+		{"unscoped admin", nil, http.MethodGet, "/admin/users", false},
+		{"unscoped key management", nil, http.MethodPost, "/user/api-keys", false},
+		{"unscoped password", nil, http.MethodPatch, "/user/password", false},
+		{"unscoped account deletion", nil, http.MethodDelete, "/user", false},
+		{"unscoped account merge", nil, http.MethodPost, "/user/merge", false},
+		{"in scope", []string{"recipes"}, http.MethodPost, "/re/4/reviews", true},
+		{"out of scope", []string{"recipes"}, http.MethodGet, "/user/pantry", false},
+		{"read scope get", []string{"pantry:read"}, http.MethodGet, "/user/pantry", true},
+		{"read scope write", []string{"pantry:read"}, http.MethodPut, "/user/pantry", false},
+		{"prefix is not a path", []string{"recipes"}, http.MethodGet, "/recipesx", false},
+		{"second scope", []string{"pantry:read", "plans"}, http.MethodPost, "/plan/generate", true},
+	}
+	for _, tt := range tests {
+		if got := models.APIKeyAllows(tt.Scopes, tt.Method, tt.Path); got != tt.Want {
+			t.Errorf("%s: got %v, want %v", tt.Name, got, tt.Want)
+		}
+	}
+
+	req := models.CreateAPIKeyRequest{Name: "script", Scopes: []string{"recipes:read", "pantry"}}
+	if err := req.Validate(); err != nil {
+		t.Errorf("valid scopes rejected: %v", err)
+	}
+	req.Scopes = []string{"admin"}
+	if err := req.Validate(); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	resolve := func(ctx context.Context, rawKey string) (models.APIKeyIdentity, error) {
+		switch rawKey {
+		case "mf_all":
+			return models.APIKeyIdentity{KeyID: 1, UserID: "user-id", Role: "user"}, nil
+		case "mf_pantry":
+			return models.APIKeyIdentity{KeyID: 2, UserID: "user-id", Role: "user", Scopes: []string{"pantry:read"}}, nil
+		}
+		return models.APIKeyIdentity{}, services.ErrUnauthorizedUser
+	}
+
+	var subject string
+	handler := middlewares.APIKeyAuthentication(resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.MapClaims)
+		subject, _ = claims["sub"].(string)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		Name   string
+		Header string
+		Path   string
+		Want   int
+	}{
+		{"valid key", "ApiKey mf_all", "/profile", http.StatusOK},
+		{"unknown key", "ApiKey mf_nope", "/profile", http.StatusUnauthorized},
+		{"out of scope", "ApiKey mf_pantry", "/profile", http.StatusForbidden},
+		{"in scope", "ApiKey mf_pantry", "/user/pantry", http.StatusOK},
+		{"token still works", "Bearer " + createTestToken(false), "/profile", http.StatusOK},
+		{"nothing", "", "/profile", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		subject = ""
+		req := httptest.NewRequest(http.MethodGet, tt.Path, nil)
+		req.Header.Set("Authorization", tt.Header)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != tt.Want {
+			t.Errorf("%s: got %d, want %d", tt.Name, resp.Code, tt.Want)
+		}
+		if strings.HasPrefix(tt.Header, "ApiKey") && tt.Want == http.StatusOK && subject != "user-id" {
+			t.Errorf("%s: handler saw subject %q", tt.Name, subject)
+		}
+	}
+}
+
+func TestAPIKeyRevocationIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseAPIKeyService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "apikey", "ApiKey1!")
+	other := createTestUser(t, conn, "apikey", "ApiKey1!")
+
+	rawKey, err := service.CreateAPIKey(ctx, username, "nightly sync", "recipes:read")
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	identity, err := service.ResolveAPIKey(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("resolve key: %v", err)
+	}
+	if identity.UserID == "" || len(identity.Scopes) != 1 || identity.Scopes[0] != "recipes:read" {
+		t.Errorf("got identity %+v", identity)
+	}
+
+	keys, err := service.ListAPIKeys(ctx, username)
+	if err != nil || len(keys) != 1 || !strings.HasPrefix(rawKey, keys[0].Prefix) || !keys[0].LastUsedAt.Valid {
+		t.Fatalf("list keys: %+v, %v", keys, err)
+	}
+
+	if err := service.RevokeAPIKey(ctx, other, int64(keys[0].ID)); err != services.ErrAPIKeyNotFound {
+		t.Errorf("revoke by another user: got %v, want %v", err, services.ErrAPIKeyNotFound)
+	}
+	if err := service.RevokeAPIKey(ctx, username, int64(keys[0].ID)); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := service.ResolveAPIKey(ctx, rawKey); err != services.ErrUnauthorizedUser {
+		t.Errorf("revoked key: got %v, want %v", err, services.ErrUnauthorizedUser)
+	}
+	if keys, _ := service.ListAPIKeys(ctx, username); len(keys) != 0 {
+		t.Errorf("revoked key still listed: %+v", keys)
+	}
+}
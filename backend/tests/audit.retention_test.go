@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// memArchive keeps archives in memory, failing writes when broken.
+type memArchive struct {
+	files  map[string]*bytes.Buffer
+	broken bool
+}
+
+type memArchiveFile struct {
+	*bytes.Buffer
+	broken bool
+}
+
+func (f memArchiveFile) Write(p []byte) (int, error) {
+	if f.broken {
+		return 0, errors.New("disk full")
+	}
+	return f.Buffer.Write(p)
+}
+
+func (f memArchiveFile) Close() error { return nil }
+
+func (a *memArchive) Create(name string) (io.WriteCloser, error) {
+	if a.files == nil {
+		a.files = make(map[string]*bytes.Buffer)
+	}
+	buf := &bytes.Buffer{}
+	a.files[name] = buf
+	return memArchiveFile{Buffer: buf, broken: a.broken}, nil
+}
+
+type fakeHistoryRow struct {
+	id   int32
+	age  time.Duration
+	note string
+}
+
+// fakeHistoryTable is a retention table over rows kept in memory.
+func fakeHistoryTable(rows *[]fakeHistoryRow, window time.Duration) services.RetentionTable {
+	return services.RetentionTable{
+		Name:   "fake",
+		Window: window,
+		Header: []string{"id", "note"},
+		Expired: func(ctx context.Context, windowSeconds int32, limit int32) ([]int32, [][]string, error) {
+			var ids []int32
+			var records [][]string
+			for _, row := range *rows {
+				if row.age > time.Duration(windowSeconds)*time.Second && len(ids) < int(limit) {
+					ids = append(ids, row.id)
+					records = append(records, []string{fmt.Sprint(row.id), row.note})
+				}
+			}
+			return ids, records, nil
+		},
+		Delete: func(ctx context.Context, ids []int32) (int64, error) {
+			kept := (*rows)[:0]
+			var deleted int64
+			for _, row := range *rows {
+				if slices.Contains(ids, row.id) {
+					deleted++
+					continue
+				}
+				kept = append(kept, row)
+			}
+			*rows = kept
+			return deleted, nil
+		},
+	}
+}
+
+func TestAuditRetentionArchivesThenPurges(t *testing.T) {
+	day := 24 * time.Hour
+	rows := []fakeHistoryRow{
+		{1, 400 * day, "old, one"}, {2, 390 * day, "old"}, {3, 380 * day, "old"},
+		{4, 370 * day, "old"}, {5, 366 * day, "old"}, {6, 10 * day, "recent"}, {7, time.Hour, "recent"},
+	}
+	archive := &memArchive{}
+	job := services.AuditRetentionJob{
+		Tables:    []services.RetentionTable{fakeHistoryTable(&rows, 365*day)},
+		BatchSize: 2,
+		Archive:   archive,
+	}
+	now := time.Date(2024, time.May, 1, 3, 0, 0, 0, time.UTC)
+
+	purged, err := job.PurgeExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged["fake"] != 5 {
+		t.Errorf("purged %d rows, want 5", purged["fake"])
+	}
+	if len(rows) != 2 || rows[0].id != 6 || rows[1].id != 7 {
+		t.Errorf("kept %v, want the two recent rows", rows)
+	}
+
+	file, ok := archive.files["fake-20240501T030000Z.csv"]
+	if !ok {
+		t.Fatalf("no archive written, got %v", archive.files)
+	}
+	want := "id,note\n1,\"old, one\"\n2,old\n3,old\n4,old\n5,old\n"
+	if file.String() != want {
+		t.Errorf("archive:\n%s\nwant:\n%s", file.String(), want)
+	}
+}
+
+func TestAuditRetentionKeepsRowsWhenArchiveFails(t *testing.T) {
+	rows := []fakeHistoryRow{{1, 48 * time.Hour, "old"}}
+	job := services.AuditRetentionJob{
+		Tables:    []services.RetentionTable{fakeHistoryTable(&rows, time.Hour)},
+		BatchSize: 10,
+		Archive:   &memArchive{broken: true},
+	}
+
+	if _, err := job.PurgeExpired(context.Background(), time.Now()); err == nil {
+		t.Error("expected an error when the archive can't be written")
+	}
+	if len(rows) != 1 {
+		t.Errorf("rows deleted without being archived: %v", rows)
+	}
+}
+
+func TestAuditRetentionDisabledWindow(t *testing.T) {
+	rows := []fakeHistoryRow{{1, 1000 * 24 * time.Hour, "old"}}
+	job := services.AuditRetentionJob{
+		Tables:    []services.RetentionTable{fakeHistoryTable(&rows, 0)},
+		BatchSize: 10,
+	}
+
+	if _, err := job.PurgeExpired(context.Background(), time.Now()); err != nil || len(rows) != 1 {
+		t.Errorf("window 0 should keep everything: %v, %v", rows, err)
+	}
+}
+
+func TestAuditRetentionIntegration(t *testing.T) {
+	conn := testConnection(t)
+	ctx := context.Background()
+	actor := fmt.Sprintf("retention%d", time.Now().UnixNano()%1e9)
+
+	for _, age := range []string{"400 days", "1 day"} {
+		if _, err := conn.Exec(ctx, `INSERT INTO admin_audit (actor, action, target, created_at)
+			VALUES ($1, 'test', $2, CURRENT_TIMESTAMP(0) - $3::interval)`, actor, age, age); err != nil {
+			t.Fatalf("insert audit row: %v", err)
+		}
+	}
+
+	archive := &memArchive{}
+	job := services.NewAuditRetentionJob(conn)
+	job.Archive = archive
+	job.Tables = job.Tables[:1]
+	job.Tables[0].Window = 365 * 24 * time.Hour
+
+	if _, err := job.PurgeExpired(ctx, time.Now()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	var targets []string
+	rows, err := conn.Query(ctx, "SELECT target FROM admin_audit WHERE actor = $1", actor)
+	if err != nil {
+		t.Fatalf("list audit rows: %v", err)
+	}
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) != 1 || targets[0] != "1 day" {
+		t.Errorf("kept %v, want only the recent row", targets)
+	}
+
+	var archived string
+	for _, file := range archive.files {
+		archived += file.String()
+	}
+	if !strings.Contains(archived, actor+",test,400 days") {
+		t.Errorf("old row missing from archive:\n%s", archived)
+	}
+	if strings.Contains(archived, "1 day") {
+		t.Errorf("recent row archived:\n%s", archived)
+	}
+}
@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestMemoryCacheGetOrLoadCollapsesConcurrentLoads(t *testing.T) {
+	cache := services.NewMemoryCache()
+	ctx := context.Background()
+	var loads atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.GetOrLoad(ctx, "profile", time.Minute, func(ctx context.Context) ([]byte, error) {
+				loads.Add(1)
+				<-release
+				return []byte("karol"), nil
+			})
+			if err != nil {
+				t.Errorf("get or load: %v", err)
+			}
+			results[i] = string(value)
+		}()
+	}
+	// Let every caller reach the load before it finishes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loaded %d times, want 1", got)
+	}
+	for _, result := range results {
+		if result != "karol" {
+			t.Errorf("got %q, want the loaded value", result)
+		}
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	cache := services.NewMemoryCache()
+	cache.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	cache.Set(ctx, "short", []byte("a"), time.Minute)
+	cache.Set(ctx, "forever", []byte("b"), 0)
+	if _, ok, _ := cache.Get(ctx, "short"); !ok {
+		t.Fatal("fresh value missing")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "short"); ok {
+		t.Error("value still served after its ttl")
+	}
+	if _, ok, _ := cache.Get(ctx, "forever"); !ok {
+		t.Error("value without a ttl expired")
+	}
+
+	loads := 0
+	load := func(ctx context.Context) ([]byte, error) {
+		loads++
+		return []byte("c"), nil
+	}
+	cache.GetOrLoad(ctx, "loaded", time.Minute, load)
+	cache.GetOrLoad(ctx, "loaded", time.Minute, load)
+	now = now.Add(2 * time.Minute)
+	cache.GetOrLoad(ctx, "loaded", time.Minute, load)
+	if loads != 2 {
+		t.Errorf("loaded %d times, want a reload only after expiry", loads)
+	}
+}
+
+func TestMemoryCacheStores(t *testing.T) {
+	cache := services.NewMemoryCache()
+	ctx := context.Background()
+	profiles, searches := cache.Store("profiles"), cache.Store("searches")
+
+	profiles.Set(ctx, "karol", []byte("profile"), 0)
+	searches.Set(ctx, "karol", []byte("search"), 0)
+	if value, _, _ := profiles.Get(ctx, "karol"); string(value) != "profile" {
+		t.Errorf("stores share keys: got %q", value)
+	}
+
+	profiles.Clear(ctx)
+	if _, ok, _ := profiles.Get(ctx, "karol"); ok {
+		t.Error("cleared store still has its key")
+	}
+	if _, ok, _ := searches.Get(ctx, "karol"); !ok {
+		t.Error("clearing one store dropped another's key")
+	}
+}
+
+func TestCacheLoadErrorsAreNotCached(t *testing.T) {
+	cache := services.NewMemoryCache()
+	ctx := context.Background()
+	failure := errors.New("db down")
+
+	if _, err := cache.GetOrLoad(ctx, "k", time.Minute, func(ctx context.Context) ([]byte, error) {
+		return nil, failure
+	}); err != failure {
+		t.Errorf("got %v, want the load error", err)
+	}
+	type profile struct{ Name string }
+	got, err := services.GetOrLoadJSON(ctx, cache, "k", time.Minute, func(ctx context.Context) (profile, error) {
+		return profile{Name: "karol"}, nil
+	})
+	if err != nil || got.Name != "karol" {
+		t.Errorf("got %+v, %v after a failed load", got, err)
+	}
+}
+
+func TestCacheLoadPanicReleasesKey(t *testing.T) {
+	cache := services.NewMemoryCache()
+	ctx := context.Background()
+
+	_, err := cache.GetOrLoad(ctx, "k", time.Minute, func(ctx context.Context) ([]byte, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("panicking load returned no error")
+	}
+	value, err := cache.GetOrLoad(ctx, "k", time.Minute, func(ctx context.Context) ([]byte, error) {
+		return []byte("karol"), nil
+	})
+	if err != nil || string(value) != "karol" {
+		t.Errorf("load after a panic: got %q, %v", value, err)
+	}
+}
+
+func TestCacheLoadOutlivesCancelledLeader(t *testing.T) {
+	cache := services.NewMemoryCache()
+	started, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context) ([]byte, error) {
+		close(started)
+		select {
+		case <-release:
+			return []byte("karol"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cache.GetOrLoad(leaderCtx, "k", time.Minute, load)
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan string, 1)
+	go func() {
+		value, err := cache.GetOrLoad(context.Background(), "k", time.Minute, load)
+		if err != nil {
+			t.Errorf("waiter: %v", err)
+		}
+		waiter <- string(value)
+	}()
+	// Let the waiter join the load before the leader gives up.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader: got %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if got := <-waiter; got != "karol" {
+		t.Errorf("waiter got %q, want the loaded value", got)
+	}
+}
+
+// fakeRedis answers the commands of one connection from replies and sends
+// every command it read on the returned channel.
+func fakeRedis(t *testing.T, replies map[string]string) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	commands := make(chan []string, 16)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			var count int
+			if _, err := fmt.Fscanf(reader, "*%d\r\n", &count); err != nil {
+				return
+			}
+			args := make([]string, count)
+			for i := range args {
+				var size int
+				if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+					return
+				}
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, data); err != nil {
+					return
+				}
+				args[i] = string(data[:size])
+			}
+			commands <- args
+			reply, ok := replies[args[0]]
+			if !ok {
+				reply = "-ERR unknown command"
+			}
+			fmt.Fprintf(conn, "%s\r\n", reply)
+		}
+	}()
+	return listener.Addr().String(), commands
+}
+
+func TestRedisCacheAuthenticatesAndSelectsDB(t *testing.T) {
+	addr, commands := fakeRedis(t, map[string]string{"AUTH": "+OK", "SELECT": "+OK", "GET": "$5\r\nkarol"})
+	defer func(username, password string, db int) {
+		services.RedisUsername, services.RedisPassword, services.RedisDB = username, password, db
+	}(services.RedisUsername, services.RedisPassword, services.RedisDB)
+	services.RedisUsername, services.RedisPassword, services.RedisDB = "app", "s3cret", 3
+
+	value, ok, err := services.NewRedisCache(addr, "mf:").Get(context.Background(), "profile")
+	if err != nil || !ok || string(value) != "karol" {
+		t.Fatalf("get: got %q, %v, %v", value, ok, err)
+	}
+
+	want := [][]string{{"AUTH", "app", "s3cret"}, {"SELECT", "3"}, {"GET", "mf:profile"}}
+	for _, command := range want {
+		if got := <-commands; !slices.Equal(got, command) {
+			t.Errorf("got command %q, want %q", got, command)
+		}
+	}
+}
+
+func TestRedisCacheRejectedAuth(t *testing.T) {
+	addr, _ := fakeRedis(t, map[string]string{"AUTH": "-WRONGPASS invalid username-password pair"})
+	defer func(password string) { services.RedisPassword = password }(services.RedisPassword)
+	services.RedisPassword = "wrong"
+
+	if _, _, err := services.NewRedisCache(addr, "mf:").Get(context.Background(), "profile"); err == nil {
+		t.Error("get succeeded with a rejected password")
+	}
+}
+
+func TestRedisCacheIntegration(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set, skipping integration test")
+	}
+	cache := services.NewRedisCache(addr, "meals-finder-test:")
+	ctx := context.Background()
+	store := cache.Store("profiles")
+
+	if err := store.Set(ctx, "karol", []byte("profile"), time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if value, ok, err := store.Get(ctx, "karol"); err != nil || !ok || string(value) != "profile" {
+		t.Errorf("get: got %q, %v, %v", value, ok, err)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if _, ok, err := store.Get(ctx, "karol"); err != nil || ok {
+		t.Errorf("after clear: got %v, %v", ok, err)
+	}
+}
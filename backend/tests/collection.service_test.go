@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestNewShareToken(t *testing.T) {
+	first, err := services.NewShareToken()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	second, _ := services.NewShareToken()
+
+	if len(first) < 40 {
+		t.Errorf("token %q is too short", first)
+	}
+	if first == second {
+		t.Errorf("tokens should be unique, both got %q", first)
+	}
+}
+
+func TestSharedCollectionIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseCollectionService(conn)
+	ctx := context.Background()
+	owner := createTestUser(t, conn, "own", "Owner1!")
+	stranger := createTestUser(t, conn, "str", "Stranger1!")
+
+	id, err := service.CreateCollection(ctx, owner, &models.CreateCollectionRequest{Name: "Weekend"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+
+	if _, err := service.GenerateCollectionShareLink(ctx, stranger, id); err != services.ErrForbidden {
+		t.Errorf("stranger share link: got %v, want %v", err, services.ErrForbidden)
+	}
+
+	token, err := service.GenerateCollectionShareLink(ctx, owner, id)
+	if err != nil {
+		t.Fatalf("generate share link: %v", err)
+	}
+
+	collection, err := service.GetSharedCollection(ctx, token)
+	if err != nil {
+		t.Fatalf("get shared collection: %v", err)
+	}
+	if collection.ID != id || collection.Name != "Weekend" {
+		t.Errorf("got collection %+v, want id %d named Weekend", collection, id)
+	}
+
+	if err := service.RevokeShareLink(ctx, stranger, token); err != services.ErrShareNotFound {
+		t.Errorf("stranger revoke: got %v, want %v", err, services.ErrShareNotFound)
+	}
+	if err := service.RevokeShareLink(ctx, owner, token); err != nil {
+		t.Fatalf("revoke share link: %v", err)
+	}
+
+	if _, err := service.GetSharedCollection(ctx, token); err != services.ErrShareNotFound {
+		t.Errorf("revoked token: got %v, want %v", err, services.ErrShareNotFound)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestExcludeFlagsRequireUser(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Input   models.RecipesFinderParams
+		WantErr bool
+	}{
+		{"Anonymous without flags", models.RecipesFinderParams{}, false},
+		{"Anonymous exclude favorited", models.RecipesFinderParams{ExcludeFavorited: true}, true},
+		{"Anonymous exclude made", models.RecipesFinderParams{ExcludeMade: true}, true},
+		{"User with both flags", models.RecipesFinderParams{Username: "karol", ExcludeFavorited: true, ExcludeMade: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if err := tt.Input.Validate(); (err != nil) != tt.WantErr {
+				t.Errorf("got %v, want error %v", err, tt.WantErr)
+			}
+		})
+	}
+
+	finder := services.BaseFinderService{}
+	if _, err := finder.FindRecipe(context.Background(), models.RecipesFinderParams{ExcludeFavorited: true}); err != services.ErrValidation {
+		t.Errorf("FindRecipe: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestExcludeFavoritedIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	favorites := services.NewBaseFavoriteService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "fav", "Favorite1!")
+
+	params := models.RecipesFinderParams{Username: username, Limit: 1000}
+	recipes, err := finder.FindRecipe(ctx, params)
+	if err != nil || len(recipes) == 0 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+	favorite := recipes[0].ID
+
+	if err := favorites.AddFavorite(ctx, username, favorite); err != nil {
+		t.Fatalf("add favorite: %v", err)
+	}
+
+	params.ExcludeFavorited = true
+	recipes, err = finder.FindRecipe(ctx, params)
+	if err != nil {
+		t.Fatalf("find recipes: %v", err)
+	}
+	for _, recipe := range recipes {
+		if recipe.ID == favorite {
+			t.Errorf("favorited recipe %d should be excluded", favorite)
+		}
+	}
+}
+
+func TestFavoriteLimitCheck(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Count       int64
+		Exists      bool
+		AutoArchive bool
+		WantArchive bool
+		WantErr     error
+	}{
+		{"Below limit", 2, false, false, false, nil},
+		{"At limit", 3, false, false, false, services.ErrFavoriteLimitReached},
+		{"At limit, already favorite", 3, true, false, false, nil},
+		{"At limit, auto archive", 3, false, true, true, nil},
+		{"Below limit, auto archive", 2, false, true, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			archive, err := services.FavoriteLimitCheck(tt.Count, 3, tt.Exists, tt.AutoArchive)
+			if archive != tt.WantArchive || err != tt.WantErr {
+				t.Errorf("got (%v, %v), want (%v, %v)", archive, err, tt.WantArchive, tt.WantErr)
+			}
+		})
+	}
+
+	if _, err := services.FavoriteLimitCheck(5000, 0, false, false); err != nil {
+		t.Errorf("limit 0 should be unlimited, got %v", err)
+	}
+}
+
+func TestFavoritesLimitIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	favorites := services.NewBaseFavoriteService(conn)
+	favorites.Limit = 2
+	ctx := context.Background()
+	username := createTestUser(t, conn, "favlim", "Favorite1!")
+
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 3})
+	if err != nil || len(recipes) < 3 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+
+	for _, recipe := range recipes[:2] {
+		if err := favorites.AddFavorite(ctx, username, recipe.ID); err != nil {
+			t.Fatalf("add favorite: %v", err)
+		}
+	}
+	if err := favorites.AddFavorite(ctx, username, recipes[2].ID); err != services.ErrFavoriteLimitReached {
+		t.Fatalf("over limit: got %v, want %v", err, services.ErrFavoriteLimitReached)
+	}
+
+	favorites.AutoArchive = true
+	if err := favorites.AddFavorite(ctx, username, recipes[2].ID); err != nil {
+		t.Fatalf("auto archive: %v", err)
+	}
+
+	active, err := favorites.ListFavorites(ctx, username)
+	if err != nil || len(active) != 2 {
+		t.Fatalf("list favorites: got %d, error %v", len(active), err)
+	}
+	archived, err := favorites.ListArchivedFavorites(ctx, username)
+	if err != nil || len(archived) != 1 || archived[0].ID != recipes[0].ID {
+		t.Errorf("expected oldest favorite %d archived, got %+v (error %v)", recipes[0].ID, archived, err)
+	}
+}
+
+func TestFavoritesLimitConcurrentAddsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "favrace", "Favorite1!")
+
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 6})
+	if err != nil || len(recipes) < 6 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+
+	// Each add on a connection of its own, as from separate requests.
+	errs := make([]error, len(recipes))
+	var wg sync.WaitGroup
+	for i, recipe := range recipes {
+		addConn, err := pgx.Connect(ctx, server.TestDatabaseURL())
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { addConn.Close(context.Background()) })
+		favorites := services.NewBaseFavoriteService(addConn)
+		favorites.Limit = 2
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = favorites.AddFavorite(ctx, username, recipe.ID)
+		}()
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			added++
+		case services.ErrFavoriteLimitReached:
+		default:
+			t.Errorf("add favorite: %v", err)
+		}
+	}
+	var count int
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM favorites WHERE username = $1", username).Scan(&count); err != nil {
+		t.Fatalf("count favorites: %v", err)
+	}
+	if added != 2 || count != 2 {
+		t.Errorf("got %d adds and %d favorites, want 2 of each", added, count)
+	}
+}
@@ -1,11 +1,17 @@
 package tests
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
+	"github.com/miloszbo/meals-finder/internal/models"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
@@ -19,3 +25,96 @@ func TestFindRecipes(t *testing.T) {
 
 	handler.FindRecipes(res, req)
 }
+
+func TestCreateRecipeWarnsAboutNutrition(t *testing.T) {
+	handler := handlers.FinderHandler{
+		FinderService: &services.MockFinderService{},
+	}
+
+	tests := []struct {
+		Name     string
+		Body     string
+		Warnings bool
+	}{
+		{"implausible calories", `{"name":"Ciasto","calories":50000}`, true},
+		{"reasonable", `{"name":"Owsianka","calories":350,"protein":12,"carbs":55,"fat":9}`, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/recipe", strings.NewReader(tt.Body))
+		req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "user"}))
+		res := httptest.NewRecorder()
+
+		handler.CreateRecipe(res, req)
+
+		if res.Code != http.StatusCreated {
+			t.Fatalf("%s: got status %d", tt.Name, res.Code)
+		}
+		var body struct {
+			Warnings []models.NutritionWarning `json:"warnings"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode: %v", tt.Name, err)
+		}
+		if got := len(body.Warnings) > 0; got != tt.Warnings {
+			t.Errorf("%s: got warnings %+v", tt.Name, body.Warnings)
+		}
+	}
+}
+
+func TestCreateRecipeRejectsInvalidIngredients(t *testing.T) {
+	finder := services.NewBaseFinderService(nil)
+	finder.MaxIngredients = 2
+	handler := handlers.FinderHandler{FinderService: &finder}
+
+	tests := map[string]string{
+		"over the cap":  `{"name":"Bigos","ingredients":{"ingredients":[{"name":"kapusta","amount":1,"unit":"kg"},{"name":"kiełbasa","amount":300,"unit":"g"},{"name":"grzyby","amount":50,"unit":"g"}]}}`,
+		"unknown unit":  `{"name":"Bigos","ingredients":{"ingredients":[{"name":"kapusta","amount":1,"unit":"bucket"}]}}`,
+		"bad cook time": `{"name":"Bigos","cook_time":-5}`,
+		"unknown flag":  `{"name":"Bigos","flags":["radioactive"]}`,
+	}
+	for name, body := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/recipe", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "user"}))
+		res := httptest.NewRecorder()
+
+		handler.CreateRecipe(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d %q, want %d", name, res.Code, res.Body.String(), http.StatusBadRequest)
+		}
+	}
+}
+
+func TestExplainSearchAdminOnly(t *testing.T) {
+	handler := handlers.FinderHandler{FinderService: &services.MockFinderService{}}
+	// Gated as in the routes.
+	explain := middlewares.RequireRole("admin")(http.HandlerFunc(handler.ExplainSearch))
+
+	for role, want := range map[string]int{"user": http.StatusForbidden, "": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/search/plan?Dieta=wegetariańska", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "someone", "role": role}))
+		rec := httptest.NewRecorder()
+		explain.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("role %q got %d, want %d", role, rec.Code, want)
+			continue
+		}
+		if want != http.StatusOK {
+			if strings.Contains(rec.Body.String(), "cost=") {
+				t.Errorf("role %q was shown a plan", role)
+			}
+			continue
+		}
+		var plan models.SearchPlan
+		if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil || plan.Plan == "" {
+			t.Errorf("admin got %q, want a plan", rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	explain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/search/plan", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without claims got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,1942 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// fakeRecipes returns one recipe while region, recipe type and "others" filters
+// are set and five once they are all relaxed.
+func fakeRecipes(calls *[]models.RecipesFinderParams) services.RecipesFetcher {
+	return func(ctx context.Context, p models.RecipesFinderParams) ([]repository.FilterRecipesByTagNamesAndParamsRow, error) {
+		*calls = append(*calls, p)
+		count := 1
+		if len(p.Region) == 0 && len(p.RecipeType) == 0 && len(p.Others) == 0 {
+			count = 5
+		}
+		return make([]repository.FilterRecipesByTagNamesAndParamsRow, count), nil
+	}
+}
+
+func TestRelaxToMinimum(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Diet:           []string{"Wegańska"},
+		Allergies:      []string{"Orzechy"},
+		Region:         []string{"Polska"},
+		RecipeType:     []string{"Zupy"},
+		Others:         []string{"Tanie"},
+		RelaxToMinimum: 3,
+	}
+
+	var calls []models.RecipesFinderParams
+	recipes, relaxed, err := services.RelaxToMinimum(context.Background(), params, fakeRecipes(&calls))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(recipes) != 5 {
+		t.Errorf("got %d recipes, want 5", len(recipes))
+	}
+	if want := []string{"others", "recipe_type", "region"}; !slices.Equal(relaxed, want) {
+		t.Errorf("got relaxed %v, want %v", relaxed, want)
+	}
+
+	for i, call := range calls {
+		if !slices.Equal(call.Allergies, params.Allergies) {
+			t.Errorf("call %d: allergies relaxed to %v", i, call.Allergies)
+		}
+		if !slices.Equal(call.Diet, params.Diet) {
+			t.Errorf("call %d: diet relaxed to %v", i, call.Diet)
+		}
+	}
+}
+
+func TestRelaxToMinimumAboveThreshold(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Region:         []string{"Polska"},
+		RelaxToMinimum: 1,
+	}
+
+	var calls []models.RecipesFinderParams
+	_, relaxed, err := services.RelaxToMinimum(context.Background(), params, fakeRecipes(&calls))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(relaxed) != 0 || len(calls) != 1 {
+		t.Errorf("got relaxed %v after %d calls, want no relaxation", relaxed, len(calls))
+	}
+}
+
+func TestRelaxToMinimumNeverRelaxesAllergies(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Allergies:      []string{"Orzechy"},
+		RelaxToMinimum: 100,
+	}
+
+	var calls []models.RecipesFinderParams
+	_, relaxed, err := services.RelaxToMinimum(context.Background(), params, fakeRecipes(&calls))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(relaxed) != 0 {
+		t.Errorf("got relaxed %v, want none", relaxed)
+	}
+	for i, call := range calls {
+		if !slices.Equal(call.Allergies, params.Allergies) {
+			t.Errorf("call %d: allergies relaxed to %v", i, call.Allergies)
+		}
+	}
+}
+
+func TestRecipeOfTheDayFollowsUserTimezone(t *testing.T) {
+	// 23:30 UTC on 1 January is already 2 January in Warsaw and still 1 January in New York.
+	now := time.Date(2024, time.January, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		Timezone string
+		Want     time.Time
+	}{
+		{"", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"UTC", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"Europe/Warsaw", time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"America/New_York", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"Not/AZone", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Timezone, func(t *testing.T) {
+			if got := services.LocalDay(now, tt.Timezone); !got.Equal(tt.Want) {
+				t.Errorf("got %v, want %v", got, tt.Want)
+			}
+		})
+	}
+
+	utcDraw := services.DayRand(services.LocalDay(now, "UTC"), "user").Uint64()
+	warsawDraw := services.DayRand(services.LocalDay(now, "Europe/Warsaw"), "user").Uint64()
+	if utcDraw == warsawDraw {
+		t.Errorf("recipe of the day should change at Warsaw midnight, both drew %d", utcDraw)
+	}
+	if again := services.DayRand(services.LocalDay(now, "UTC"), "user").Uint64(); again != utcDraw {
+		t.Errorf("recipe of the day should hold within a day, drew %d then %d", utcDraw, again)
+	}
+}
+
+func TestAliasSamplerFollowsWeights(t *testing.T) {
+	weights := []float64{1, 0, 3, 6}
+	sampler := services.NewAliasSampler(weights)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	const draws = 100000
+	counts := make([]int, len(weights))
+	for range draws {
+		counts[sampler.Draw(rng)]++
+	}
+	if counts[1] != 0 {
+		t.Errorf("zero weight drawn %d times", counts[1])
+	}
+	for i, weight := range weights {
+		want := weight / 10 * draws
+		if math.Abs(float64(counts[i])-want) > 0.02*draws {
+			t.Errorf("index %d drawn %d times, want about %.0f", i, counts[i], want)
+		}
+	}
+
+	if services.NewAliasSampler([]float64{0, -1}) != nil {
+		t.Error("sampler without positive weights should be nil")
+	}
+}
+
+func TestSurpriseWeightsFavorMatchesAndVariety(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	window := 7 * 24 * time.Hour
+	candidates := []repository.ListSurpriseCandidatesRow{
+		{ID: 1},
+		{ID: 2, TagIds: []int32{10}},
+		{ID: 3, TagIds: []int32{10}},
+		{ID: 4, TagIds: []int32{10}},
+	}
+	tagWeights := map[int32]int32{10: 4}
+	recent := map[int32]time.Time{
+		3: now.Add(-time.Hour),
+		4: now.Add(-window),
+	}
+
+	weights := services.SurpriseWeights(candidates, tagWeights, recent, now, window)
+	counts := make(map[int32]int)
+	sampler := services.NewAliasSampler(weights)
+	rng := rand.New(rand.NewPCG(3, 4))
+	for range 20000 {
+		counts[candidates[sampler.Draw(rng)].ID]++
+	}
+
+	if counts[2] <= 3*counts[1] {
+		t.Errorf("matching meal should be picked far more often: %d vs %d", counts[2], counts[1])
+	}
+	if counts[3] >= counts[1] {
+		t.Errorf("meal shown an hour ago should be picked less: %d vs %d", counts[3], counts[1])
+	}
+	if math.Abs(float64(counts[4]-counts[2])) > 0.1*float64(counts[2]) {
+		t.Errorf("meal shown a window ago should count as unseen: %d vs %d", counts[4], counts[2])
+	}
+
+	unscaled := services.SurpriseWeights(candidates, tagWeights, recent, now, 0)
+	if unscaled[2] != unscaled[1] {
+		t.Errorf("history should be ignored without a window, got %v", unscaled)
+	}
+}
+
+func TestRecipeOfTheDayStableWithHistoryIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "today", "TodayPick1!")
+
+	first, err := finder.RecipeOfTheDay(ctx, username)
+	if err != nil {
+		t.Fatalf("recipe of the day: %v", err)
+	}
+	second, err := finder.RecipeOfTheDay(ctx, username)
+	if err != nil {
+		t.Fatalf("recipe of the day again: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("recipe of the day changed within the day: %d then %d", first.ID, second.ID)
+	}
+}
+
+func TestSurpriseRecipeAllergenSafeIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	users := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "surprise", "Surprise1!")
+
+	allergen := &models.UserTag{Name: "Orzechy", TagType: "Alergie"}
+	if err := users.AddUserTag(ctx, username, allergen); err != nil {
+		t.Fatalf("add user tag: %v", err)
+	}
+
+	for range 20 {
+		recipe, err := finder.SurpriseRecipe(ctx, username, nil)
+		if err != nil {
+			t.Fatalf("surprise recipe: %v", err)
+		}
+
+		var tagged bool
+		err = conn.QueryRow(ctx, `SELECT EXISTS (
+			SELECT 1 FROM recipes_tags rt JOIN tags t ON t.id = rt.tag_id
+			WHERE rt.recipe_id = $1 AND t.type_id = 4 AND t.name = $2)`,
+			recipe.ID, allergen.Name).Scan(&tagged)
+		if err != nil {
+			t.Fatalf("check tags: %v", err)
+		}
+		if tagged {
+			t.Fatalf("recipe %d contains allergen %s", recipe.ID, allergen.Name)
+		}
+	}
+}
+
+func TestSurpriseRecipeEmptyIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	username := createTestUser(t, conn, "surprise", "Surprise1!")
+
+	filters := &models.RecipesFinderParams{RecipeType: []string{"no such type"}}
+	if _, err := finder.SurpriseRecipe(context.Background(), username, filters); err != services.ErrNoRecipesFound {
+		t.Errorf("got %v, want %v", err, services.ErrNoRecipesFound)
+	}
+}
+
+func TestScaleRecipe(t *testing.T) {
+	recipe := repository.Recipe{
+		Servings: 2,
+		Ingredients: models.IngredientsJson{Ingredients: []models.Ingredient{
+			{Name: "Mąka pszenna", Amount: 200, Unit: "gr"},
+			{Name: "Jajko", Amount: 3, Unit: "szt"},
+			{Name: "Sól", Amount: 1, Unit: "gr"},
+		}},
+	}
+
+	scaled := services.ScaleRecipe(recipe, 4)
+	want := []int32{400, 6, 2}
+	for i, ingredient := range scaled.Ingredients.Ingredients {
+		if ingredient.Amount != want[i] {
+			t.Errorf("%s: got %d, want %d", ingredient.Name, ingredient.Amount, want[i])
+		}
+	}
+	if scaled.Servings != 4 {
+		t.Errorf("got %d servings, want 4", scaled.Servings)
+	}
+	if recipe.Ingredients.Ingredients[0].Amount != 200 {
+		t.Error("scaling modified the original recipe")
+	}
+
+	halved := services.ScaleRecipe(recipe, 1)
+	want = []int32{100, 2, 1}
+	for i, ingredient := range halved.Ingredients.Ingredients {
+		if ingredient.Amount != want[i] {
+			t.Errorf("%s: got %d, want %d", ingredient.Name, ingredient.Amount, want[i])
+		}
+	}
+
+	if unchanged := services.ScaleRecipe(recipe, 0); unchanged.Servings != 2 {
+		t.Errorf("got %d servings, want base servings", unchanged.Servings)
+	}
+}
+
+func TestDefaultServingsValidation(t *testing.T) {
+	servings := int32(-2)
+	req := models.UpdateUserSettingsRequest{DefaultServings: &servings}
+	if req.Validate() == nil {
+		t.Error("expected negative default servings to fail")
+	}
+	servings = 2
+	if err := req.Validate(); err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestGetRecipeDefaultServingsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	users := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "servings", "Servings1!")
+
+	base, err := finder.GetRecipe(ctx, 1, "", 0)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+
+	servings := base.Servings * 2
+	if err := users.UpdateUserSettings(ctx, &models.UpdateUserSettingsRequest{
+		Age: -1, Weight: -1, Height: -1, Bmi: -1, DefaultServings: &servings,
+	}, username); err != nil {
+		t.Fatalf("update settings: %v", err)
+	}
+
+	scaled, err := finder.GetRecipe(ctx, 1, username, 0)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+	if scaled.Servings != servings {
+		t.Errorf("got %d servings, want %d", scaled.Servings, servings)
+	}
+	for i, ingredient := range scaled.Ingredients.Ingredients {
+		if want := base.Ingredients.Ingredients[i].Amount * 2; ingredient.Amount != want {
+			t.Errorf("%s: got %d, want %d", ingredient.Name, ingredient.Amount, want)
+		}
+	}
+
+	// An explicit request overrides the user default.
+	override, err := finder.GetRecipe(ctx, 1, username, base.Servings)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+	if override.Servings != base.Servings {
+		t.Errorf("got %d servings, want %d", override.Servings, base.Servings)
+	}
+}
+
+func TestRankRecipesWeights(t *testing.T) {
+	const vegan, quick = 1, 2
+	candidates := []repository.GetRecommendationCandidatesRow{
+		{ID: 10, Name: "Szybki omlet", TagIds: []int32{quick}},
+		{ID: 20, Name: "Wegański gulasz", TagIds: []int32{vegan}},
+		{ID: 30, Name: "Szybka sałatka wegańska", TagIds: []int32{vegan, quick}},
+	}
+
+	ids := func(ranked []models.RecommendedRecipe) []int32 {
+		out := make([]int32, len(ranked))
+		for i, r := range ranked {
+			out[i] = r.ID
+		}
+		return out
+	}
+
+	equal := services.RankRecipes(candidates, map[int32]int32{vegan: 1, quick: 1})
+	if got, want := ids(equal), []int32{30, 10, 20}; !slices.Equal(got, want) {
+		t.Errorf("default weights: got %v, want %v", got, want)
+	}
+
+	boosted := services.RankRecipes(candidates, map[int32]int32{vegan: 5, quick: 1})
+	if got, want := ids(boosted), []int32{30, 20, 10}; !slices.Equal(got, want) {
+		t.Errorf("boosted vegan: got %v, want %v", got, want)
+	}
+	if boosted[0].Score != 6 {
+		t.Errorf("got score %d, want 6", boosted[0].Score)
+	}
+}
+
+func TestPickUnseenCyclesThroughPool(t *testing.T) {
+	var ranked []models.RecommendedRecipe
+	for id := int32(1); id <= 5; id++ {
+		ranked = append(ranked, models.RecommendedRecipe{ID: id, Score: 10 - id})
+	}
+
+	// Simulates the stored history: every call records what it picked, the
+	// exhausted call clears it first.
+	recent := map[int32]time.Time{}
+	clock := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	call := func() ([]int32, bool) {
+		picked, reset := services.PickUnseen(ranked, recent, 2)
+		if reset {
+			clear(recent)
+		}
+		clock = clock.Add(time.Hour)
+		ids := make([]int32, len(picked))
+		for i, recipe := range picked {
+			ids[i] = recipe.ID
+			recent[recipe.ID] = clock
+		}
+		return ids, reset
+	}
+
+	tests := []struct {
+		Want  []int32
+		Reset bool
+	}{
+		{[]int32{1, 2}, false},
+		{[]int32{3, 4}, false},
+		// Only 5 is unseen; the pool is exhausted and 1, shown longest ago, repeats.
+		{[]int32{5, 1}, true},
+		{[]int32{2, 3}, false},
+	}
+	for i, tt := range tests {
+		got, reset := call()
+		if !slices.Equal(got, tt.Want) || reset != tt.Reset {
+			t.Errorf("call %d: got %v reset=%v, want %v reset=%v", i+1, got, reset, tt.Want, tt.Reset)
+		}
+	}
+}
+
+func TestPickUnseenSmallPool(t *testing.T) {
+	ranked := []models.RecommendedRecipe{{ID: 1}, {ID: 2}}
+	shown := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	if got, reset := services.PickUnseen(ranked, nil, 20); len(got) != 2 || reset {
+		t.Errorf("fresh pool: got %v reset=%v", got, reset)
+	}
+	got, reset := services.PickUnseen(ranked, map[int32]time.Time{1: shown, 2: shown}, 20)
+	if len(got) != 2 || !reset {
+		t.Errorf("all shown: got %v reset=%v, want both again with a reset", got, reset)
+	}
+	if got, _ := services.PickUnseen(nil, nil, 20); len(got) != 0 {
+		t.Errorf("no candidates: got %v", got)
+	}
+}
+
+func TestTagWeightValidation(t *testing.T) {
+	for _, weight := range []int32{0, -1, 101} {
+		req := models.TagWeightRequest{Weight: weight}
+		if req.Validate() == nil {
+			t.Errorf("expected weight %d to fail", weight)
+		}
+	}
+}
+
+func TestMatchReasons(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Diet:             []string{"Wegańska", "Keto"},
+		Region:           []string{"Polska"},
+		Allergies:        []string{"Orzechy", "Gluten(Zboże)"},
+		ExcludeFavorited: true,
+	}
+	tags := []repository.GetTagsForRecipesRow{
+		{RecipeID: 1, TypeID: 1, Name: "Wegańska"},
+		{RecipeID: 1, TypeID: 2, Name: "Włoska"},
+		{RecipeID: 1, TypeID: 6, Name: "Tanie"},
+	}
+
+	got := services.MatchReasons(params, tags, []string{"Tanie", "Orzechy"})
+	want := []string{
+		"matches diet: Wegańska",
+		"matches your tags: Tanie",
+		"excludes allergens: Orzechy, Gluten(Zboże)",
+		"not in your favorites",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := services.MatchReasons(models.RecipesFinderParams{}, tags, nil); len(got) != 0 {
+		t.Errorf("expected no reasons without filters, got %q", got)
+	}
+}
+
+func TestMergeExclusions(t *testing.T) {
+	got := services.MergeExclusions([]string{"Kolendra ", "cebula"}, []string{"kolendra", "Czosnek", ""})
+	if want := []string{"kolendra", "cebula", "czosnek"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := services.MergeExclusions(nil, nil); got != nil {
+		t.Errorf("got %q, want nil so the filter is skipped", got)
+	}
+}
+
+func TestSavedExclusionsReportedApartFromAllergens(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Allergies:       []string{"Orzechy"},
+		SavedExclusions: []string{"kolendra"},
+	}
+	got := services.MatchReasons(params, nil, nil)
+	want := []string{
+		"excludes allergens: Orzechy",
+		"excludes your saved ingredients: kolendra",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRelaxToMinimumDropsSavedExclusionsLast(t *testing.T) {
+	params := models.RecipesFinderParams{
+		Region:          []string{"Polska"},
+		Allergies:       []string{"Orzechy"},
+		SavedExclusions: []string{"kolendra"},
+		RelaxToMinimum:  100,
+	}
+
+	var calls []models.RecipesFinderParams
+	_, relaxed, err := services.RelaxToMinimum(context.Background(), params, fakeRecipes(&calls))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if want := []string{"region", "saved_exclusions"}; !slices.Equal(relaxed, want) {
+		t.Errorf("got relaxed %v, want %v", relaxed, want)
+	}
+}
+
+func TestSavedExclusionsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	users := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "exclude", "Exclude1!")
+
+	if err := users.AddExcludedIngredient(ctx, username, &models.ExcludedIngredientRequest{Name: "Cebula"}); err != nil {
+		t.Fatalf("add exclusion: %v", err)
+	}
+
+	usesOnion := func(recipes []repository.FilterRecipesByTagNamesAndParamsRow) int {
+		t.Helper()
+		count := 0
+		for _, row := range recipes {
+			recipe, err := finder.Repo.GetRecipeWithId(ctx, row.ID)
+			if err != nil {
+				t.Fatalf("get recipe %d: %v", row.ID, err)
+			}
+			for _, ingredient := range recipe.Ingredients.Ingredients {
+				if ingredient.Name == "Cebula" {
+					count++
+					break
+				}
+			}
+		}
+		return count
+	}
+
+	params := models.RecipesFinderParams{Username: username, Limit: 1000}
+	recipes, err := finder.FindRecipe(ctx, params)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if n := usesOnion(recipes); n != 0 {
+		t.Errorf("saved exclusion applied by default: got %d recipes with onion", n)
+	}
+
+	params.IgnoreSavedExclusions = true
+	recipes, err = finder.FindRecipe(ctx, params)
+	if err != nil {
+		t.Fatalf("find ignoring exclusions: %v", err)
+	}
+	if n := usesOnion(recipes); n == 0 {
+		t.Errorf("override: expected recipes with onion from the seed data")
+	}
+}
+
+func ingredients(names ...string) []models.Ingredient {
+	list := make([]models.Ingredient, 0, len(names))
+	for _, name := range names {
+		list = append(list, models.Ingredient{Name: name, Amount: 1, Unit: "szt"})
+	}
+	return list
+}
+
+func TestIngredientOverlap(t *testing.T) {
+	tests := []struct {
+		Name string
+		A, B []models.Ingredient
+		Want float64
+	}{
+		{"Same set, different case", ingredients("Pomidory", "cebula"), ingredients("pomidory", "Cebula"), 1},
+		{"Half shared", ingredients("pomidory", "cebula", "czosnek"), ingredients("pomidory", "cebula", "bazylia"), 0.5},
+		{"Nothing shared", ingredients("ryż"), ingredients("makaron"), 0},
+		{"Both empty", nil, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if got := services.IngredientOverlap(tt.A, tt.B); got != tt.Want {
+				t.Errorf("got %v, want %v", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestLikelyDuplicates(t *testing.T) {
+	soup := ingredients("pomidory", "cebula", "bulion")
+	candidates := []repository.FindSimilarRecipesRow{
+		// Similar name, different dish.
+		{ID: 1, Name: "Zupa pomidorowa z ryżem", NameSimilarity: 0.7, Ingredients: models.IngredientsJson{Ingredients: ingredients("ryż", "mleko")}},
+		// Near-identical name and ingredients.
+		{ID: 2, Name: "Zupa pomidorowa", NameSimilarity: 0.95, Ingredients: models.IngredientsJson{Ingredients: soup}},
+		// Same ingredients under a looser name.
+		{ID: 3, Name: "Pomidorowa", NameSimilarity: 0.6, Ingredients: models.IngredientsJson{Ingredients: soup}},
+	}
+
+	got := services.LikelyDuplicates(candidates, soup)
+	if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Fatalf("got %+v, want recipes 2 and 3, most similar first", got)
+	}
+}
+
+func TestCreateRecipeDuplicateIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "dup", "Duplicate1!")
+	name := fmt.Sprintf("Zupa pomidorowa babci %d", time.Now().UnixNano()%1e9)
+
+	recipe := models.RecipeAdd{
+		Name:        name,
+		Recipe:      "Ugotuj.",
+		Ingredients: models.IngredientsJson{Ingredients: ingredients("pomidory", "cebula", "bulion")},
+		Time:        40,
+		Difficulty:  1,
+	}
+	if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+		t.Fatalf("create original: %v", err)
+	}
+	var originalID int32
+	if err := conn.QueryRow(ctx, "SELECT id FROM recipes WHERE name = $1", name).Scan(&originalID); err != nil {
+		t.Fatalf("find original: %v", err)
+	}
+
+	again := recipe
+	again.Name = name + "!"
+	err := finder.CreateRecipe(ctx, &again, username)
+	var duplicate *services.DuplicateRecipeError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("got %v, want a DuplicateRecipeError", err)
+	}
+	if !slices.ContainsFunc(duplicate.Duplicates, func(d models.DuplicateRecipe) bool { return d.ID == originalID }) {
+		t.Errorf("duplicates %+v don't include the original %d", duplicate.Duplicates, originalID)
+	}
+
+	again.Force = true
+	if err := finder.CreateRecipe(ctx, &again, username); err != nil {
+		t.Errorf("forced create: %v", err)
+	}
+}
+
+func TestValidSourceURL(t *testing.T) {
+	cases := map[string]bool{
+		"https://www.allrecipes.com/recipe/1": true,
+		"http://example.com":                  true,
+		"HTTPS://example.com/a?b=c":           true,
+		"ftp://example.com/file":              false,
+		"javascript:alert(1)":                 false,
+		"/relative/path":                      false,
+		"":                                    false,
+		"https://" + strings.Repeat("a", 500): false,
+	}
+	for raw, want := range cases {
+		if got := models.ValidSourceURL(raw); got != want {
+			t.Errorf("ValidSourceURL(%q) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestFinderParamsSourceKind(t *testing.T) {
+	for kind, valid := range map[string]bool{"": true, models.SourceUser: true, models.SourceImport: true, "admin": false, "user:karol": false} {
+		params := models.RecipesFinderParams{SourceKind: kind}
+		if err := params.Validate(); (err == nil) != valid {
+			t.Errorf("source kind %q: got error %v", kind, err)
+		}
+	}
+}
+
+func TestSourceFilterIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	imports := services.NewBaseImportService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "source", "Source1!")
+	stamp := time.Now().UnixNano() % 1e9
+
+	url := "https://example.com/zupa"
+	community := models.RecipeAdd{Name: fmt.Sprintf("Zupa społeczności %d", stamp), Recipe: "-", Time: 913, Difficulty: 1, Force: true, SourceURL: &url}
+	if err := finder.CreateRecipe(ctx, &community, username); err != nil {
+		t.Fatalf("create recipe: %v", err)
+	}
+	if _, err := imports.ImportRecipes(ctx, username, &models.ImportRequest{
+		Source: "allrecipes",
+		Recipes: []models.ImportRecipe{{
+			SourceID:  fmt.Sprintf("src-%d", stamp),
+			RecipeAdd: models.RecipeAdd{Name: fmt.Sprintf("Zupa z importu %d", stamp), Recipe: "-", Time: 913, Difficulty: 1},
+		}},
+	}); err != nil {
+		t.Fatalf("import recipe: %v", err)
+	}
+
+	sources := func(kind string) map[string]string {
+		recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{
+			MinTime: 913, MaxTime: 913, Limit: 1000, Username: username, SourceKind: kind,
+		})
+		if err != nil {
+			t.Fatalf("find %q recipes: %v", kind, err)
+		}
+		got := make(map[string]string)
+		for _, found := range recipes {
+			recipe, err := finder.Repo.GetRecipeWithId(ctx, found.ID)
+			if err != nil {
+				t.Fatalf("get recipe: %v", err)
+			}
+			got[recipe.Name] = recipe.Source
+		}
+		return got
+	}
+
+	user := sources(models.SourceUser)
+	if user[community.Name] != "user:"+username {
+		t.Errorf("community recipe source: got %q", user[community.Name])
+	}
+	imported := sources(models.SourceImport)
+	if got := imported[fmt.Sprintf("Zupa z importu %d", stamp)]; got != "import:allrecipes" {
+		t.Errorf("imported recipe source: got %q", got)
+	}
+	if _, ok := imported[community.Name]; ok {
+		t.Errorf("community recipe returned for the import filter")
+	}
+	if len(sources("")) < 2 {
+		t.Errorf("unfiltered search should return both recipes")
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"zupa":     "zupa",
+		"50%":      `50\%`,
+		"a_b":      `a\_b`,
+		`C:\dom`:   `C:\\dom`,
+		`100%_\\%`: `100\%\_\\\\\%`,
+	}
+	for in, want := range tests {
+		if got := models.EscapeLike(in); got != want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNameSearchWildcardsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "like", "LikeSearch1!")
+	stamp := time.Now().UnixNano() % 1e9
+
+	names := []string{
+		fmt.Sprintf("Czekolada 50%% kakao %d", stamp),
+		fmt.Sprintf("Czekolada 500 g %d", stamp),
+		fmt.Sprintf("Ciasto_na_weekend %d", stamp),
+		fmt.Sprintf("Ciasto na weekend %d", stamp),
+	}
+	for _, name := range names {
+		recipe := models.RecipeAdd{Name: name, Recipe: "-", Time: 914, Difficulty: 1, Force: true}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+	}
+
+	search := func(query string) []string {
+		recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{
+			MinTime: 914, MaxTime: 914, Limit: 1000, Username: username, NameQuery: query,
+		})
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		var got []string
+		for _, recipe := range recipes {
+			if strings.HasSuffix(recipe.Name, fmt.Sprint(stamp)) {
+				got = append(got, recipe.Name)
+			}
+		}
+		return got
+	}
+
+	if got := search("50%"); len(got) != 1 || got[0] != names[0] {
+		t.Errorf(`search "50%%": got %v, want only %q`, got, names[0])
+	}
+	if got := search("_na_"); len(got) != 1 || got[0] != names[2] {
+		t.Errorf(`search "_na_": got %v, want only %q`, got, names[2])
+	}
+	if got := search("czekolada"); len(got) != 2 {
+		t.Errorf(`search "czekolada": got %v, want both chocolate recipes`, got)
+	}
+}
+
+func TestEquipmentValidation(t *testing.T) {
+	tests := map[string]bool{
+		"":                  true,
+		"oven":              true,
+		"oven,microwave":    true,
+		"none":              true,
+		"none,oven":         false,
+		"grill":             false,
+		"stovetop,Stovetop": false,
+	}
+	for list, want := range tests {
+		var items []string
+		if list != "" {
+			items = strings.Split(list, ",")
+		}
+		if got := models.ValidEquipment(items); got != want {
+			t.Errorf("ValidEquipment(%q) = %v, want %v", list, got, want)
+		}
+	}
+
+	if got := models.NormalizeEquipment([]string{"oven", "microwave", "oven"}); !slices.Equal(got, []string{"microwave", "oven"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := models.NormalizeEquipment([]string{"none"}); got == nil || len(got) != 0 {
+		t.Errorf("none: got %#v, want an empty list", got)
+	}
+}
+
+func TestEquipmentFilterIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	users := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "equip", "Equipment1!")
+	stamp := time.Now().UnixNano() % 1e9
+
+	recipes := map[string][]string{
+		fmt.Sprintf("Zapiekanka %d", stamp):           {models.EquipmentOven},
+		fmt.Sprintf("Owsianka z mikrofali %d", stamp): {models.EquipmentMicrowave},
+		fmt.Sprintf("Sałatka %d", stamp):              {models.EquipmentNone},
+	}
+	for name, equipment := range recipes {
+		recipe := models.RecipeAdd{Name: name, Recipe: "-", Time: 915, Difficulty: 1, Force: true, Equipment: equipment}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+	}
+
+	search := func(available []string) []string {
+		found, err := finder.FindRecipe(ctx, models.RecipesFinderParams{
+			MinTime: 915, MaxTime: 915, Limit: 1000, Username: username, AvailableEquipment: available,
+		})
+		if err != nil {
+			t.Fatalf("find recipes with %v: %v", available, err)
+		}
+		var names []string
+		for _, recipe := range found {
+			if _, ok := recipes[recipe.Name]; ok {
+				names = append(names, strings.Fields(recipe.Name)[0])
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if got := search([]string{models.EquipmentMicrowave}); !slices.Equal(got, []string{"Owsianka", "Sałatka"}) {
+		t.Errorf("microwave only: got %v", got)
+	}
+	if got := search([]string{models.EquipmentNone}); !slices.Equal(got, []string{"Sałatka"}) {
+		t.Errorf("no equipment: got %v", got)
+	}
+	if got := search(nil); len(got) != 3 {
+		t.Errorf("default equipment should allow everything, got %v", got)
+	}
+
+	microwave := []string{models.EquipmentMicrowave}
+	if err := users.UpdateUserSettings(ctx, &models.UpdateUserSettingsRequest{
+		Age: -1, Weight: -1, Height: -1, Bmi: -1, Equipment: &microwave,
+	}, username); err != nil {
+		t.Fatalf("save equipment: %v", err)
+	}
+	if got := search(nil); slices.Contains(got, "Zapiekanka") || len(got) != 2 {
+		t.Errorf("saved microwave only: got %v, want the oven recipe left out", got)
+	}
+}
+
+func TestMealWinners(t *testing.T) {
+	rating := 4.5
+	meals := []models.ComparedMeal{
+		{ID: 1, Time: 30, Calories: int32Ptr(600), Protein: int32Ptr(40), Carbs: int32Ptr(50), Fat: nil},
+		{ID: 2, Time: 15, Calories: int32Ptr(450), Protein: int32Ptr(40), Carbs: nil, Fat: nil, Rating: &rating},
+		{ID: 3, Time: 15, Calories: nil, Protein: int32Ptr(20), Carbs: int32Ptr(70), Fat: nil},
+	}
+
+	got := services.MealWinners(meals)
+	want := map[string][]int32{
+		"calories": {2},
+		"protein":  {1, 2},
+		"carbs":    {1},
+		"time":     {2, 3},
+		"rating":   {2},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got winners %v, want %v", got, want)
+	}
+	for metric, ids := range want {
+		if !slices.Equal(got[metric], ids) {
+			t.Errorf("%s: got %v, want %v", metric, got[metric], ids)
+		}
+	}
+	if _, ok := got["fat"]; ok {
+		t.Error("fat is unknown for every meal and shouldn't have a winner")
+	}
+}
+
+func TestCompareMealsCount(t *testing.T) {
+	finder := services.BaseFinderService{}
+	for _, ids := range [][]int64{{1}, {1, 2, 3, 4, 5, 6}, {1, 1}} {
+		if _, err := finder.CompareMeals(context.Background(), ids); !errors.Is(err, services.ErrValidation) {
+			t.Errorf("ids %v: got %v, want %v", ids, err, services.ErrValidation)
+		}
+	}
+}
+
+func TestMergeRecommendations(t *testing.T) {
+	const vegan, quick, nuts = 1, 2, 3
+	in := services.RecommendationInputs{
+		Candidates: []repository.GetRecommendationCandidatesRow{
+			{ID: 1, TagIds: []int32{vegan}},
+			{ID: 2, TagIds: []int32{vegan}},
+			{ID: 3, TagIds: []int32{vegan, quick}},
+			{ID: 4, TagIds: []int32{vegan, nuts}},
+			{ID: 5, TagIds: []int32{vegan}},
+		},
+		Weights:   map[int32]int32{vegan: 1, quick: 1, nuts: 5},
+		Favorites: []int32{5},
+		Ratings:   map[int32]float64{2: 4.5, 1: 3},
+		Allergens: []int32{nuts},
+	}
+
+	var ids []int32
+	for _, recipe := range services.MergeRecommendations(in) {
+		ids = append(ids, recipe.ID)
+	}
+	if want := []int32{3, 2, 1}; !slices.Equal(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
+
+func TestMergeRecommendationsDietStrictness(t *testing.T) {
+	const vegetarian, quick = 1, 2
+	candidates := []repository.GetRecommendationCandidatesRow{
+		{ID: 1, TagIds: []int32{quick}},
+		{ID: 2, TagIds: []int32{vegetarian}},
+	}
+	weights := map[int32]int32{vegetarian: 1, quick: 5}
+
+	tests := []struct {
+		Strictness string
+		Want       []int32
+	}{
+		// The meat dish outscores the vegetarian one, but isn't vegetarian.
+		{models.StrictnessStrict, []int32{2}},
+		{models.StrictnessModerate, []int32{2, 1}},
+		{models.StrictnessFlexible, []int32{2, 1}},
+	}
+	for _, tt := range tests {
+		in := services.RecommendationInputs{
+			Candidates: candidates,
+			Weights:    weights,
+			Diets:      map[int32]string{vegetarian: tt.Strictness},
+		}
+		var ids []int32
+		for _, recipe := range services.MergeRecommendations(in) {
+			ids = append(ids, recipe.ID)
+		}
+		if !slices.Equal(ids, tt.Want) {
+			t.Errorf("%s: got %v, want %v", tt.Strictness, ids, tt.Want)
+		}
+	}
+}
+
+func TestMergeRecommendationsAllergensIgnoreStrictness(t *testing.T) {
+	const vegetarian, nuts = 1, 2
+	in := services.RecommendationInputs{
+		Candidates: []repository.GetRecommendationCandidatesRow{
+			{ID: 1, TagIds: []int32{vegetarian, nuts}},
+			{ID: 2, TagIds: []int32{}},
+		},
+		Weights:   map[int32]int32{vegetarian: 1},
+		Allergens: []int32{nuts},
+		Diets:     map[int32]string{vegetarian: models.StrictnessFlexible},
+	}
+	var ids []int32
+	for _, recipe := range services.MergeRecommendations(in) {
+		ids = append(ids, recipe.ID)
+	}
+	if want := []int32{2}; !slices.Equal(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
+
+func TestMergeRecommendationsRelevanceWeights(t *testing.T) {
+	const vegan, quick, nuts = 1, 2, 3
+	in := services.RecommendationInputs{
+		Candidates: []repository.GetRecommendationCandidatesRow{
+			{ID: 1, TagIds: []int32{vegan, quick}},
+			{ID: 2, TagIds: []int32{vegan}},
+			{ID: 3, TagIds: []int32{vegan}},
+			{ID: 4, TagIds: []int32{vegan, nuts}},
+		},
+		Weights:   map[int32]int32{vegan: 1, quick: 1},
+		Ratings:   map[int32]float64{1: 2, 2: 4.5, 3: 3.5, 4: 5},
+		Allergens: []int32{nuts},
+	}
+	ids := func() []int32 {
+		var out []int32
+		for _, recipe := range services.MergeRecommendations(in) {
+			out = append(out, recipe.ID)
+		}
+		return out
+	}
+
+	in.Relevance = services.DefaultRelevanceWeights
+	if got, want := ids(), []int32{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("default weights: got %v, want %v", got, want)
+	}
+
+	// The best rated recipe has an allergen and stays out however much
+	// ratings count.
+	in.Relevance = services.RelevanceWeights{Tags: 1, Rating: 10}
+	if got, want := ids(), []int32{2, 3, 1}; !slices.Equal(got, want) {
+		t.Errorf("boosted rating: got %v, want %v", got, want)
+	}
+}
+
+func TestRelevanceWeightsValidate(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Weights services.RelevanceWeights
+		Valid   bool
+	}{
+		{"defaults", services.DefaultRelevanceWeights, true},
+		{"blend", services.RelevanceWeights{Tags: 1, Rating: 0.5, Popularity: 0.2, Recency: 0.1, Ingredients: 2}, true},
+		{"all zero", services.RelevanceWeights{}, false},
+		{"negative", services.RelevanceWeights{Tags: 1, Rating: -1}, false},
+		{"not a number", services.RelevanceWeights{Tags: math.NaN()}, false},
+		{"infinite", services.RelevanceWeights{Recency: math.Inf(1)}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.Weights.Validate(); (err == nil) != tt.Valid {
+			t.Errorf("%s: got %v, want valid %v", tt.Name, err, tt.Valid)
+		}
+	}
+}
+
+func TestSearchRelevanceSortByRatingIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	finder.Relevance = services.RelevanceWeights{Rating: 1}
+	ctx := context.Background()
+
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{SortBy: models.SortRelevance, Limit: 50})
+	if err != nil {
+		t.Fatalf("find recipes: %v", err)
+	}
+	previous := math.Inf(1)
+	for _, recipe := range recipes {
+		var rating float64
+		err := conn.QueryRow(ctx, "SELECT COALESCE(AVG(review_score), 0)::float8 FROM reviews WHERE recipe_id = $1", recipe.ID).Scan(&rating)
+		if err != nil {
+			t.Fatalf("rating of %d: %v", recipe.ID, err)
+		}
+		if rating > previous {
+			t.Fatalf("recipe %d rated %.2f after one rated %.2f", recipe.ID, rating, previous)
+		}
+		previous = rating
+	}
+}
+
+func TestExplainSearchIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+
+	plan, err := finder.ExplainSearch(context.Background(), models.RecipesFinderParams{
+		Diet:      []string{"wegetariańska"},
+		NameQuery: "zupa",
+		SortBy:    models.SortRelevance,
+		Limit:     20,
+	})
+	if err != nil {
+		t.Fatalf("explain search: %v", err)
+	}
+	if !strings.Contains(plan.Plan, "Execution Time") || !strings.Contains(plan.Plan, "Buffers") {
+		t.Errorf("got plan %q, want EXPLAIN ANALYZE output with buffers", plan.Plan)
+	}
+}
+
+func TestTagStrictnessRequestValidate(t *testing.T) {
+	for _, strictness := range []string{models.StrictnessStrict, models.StrictnessModerate, models.StrictnessFlexible} {
+		if err := (&models.TagStrictnessRequest{Strictness: strictness}).Validate(); err != nil {
+			t.Errorf("%s: %v", strictness, err)
+		}
+	}
+	for _, strictness := range []string{"", "lenient", "STRICT"} {
+		if err := (&models.TagStrictnessRequest{Strictness: strictness}).Validate(); err == nil {
+			t.Errorf("%q: got no error", strictness)
+		}
+	}
+}
+
+func TestFindRecipeDietStrictnessIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	users := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "strict", "Strict1!")
+
+	const diet = "Wegetariańska"
+	if err := users.AddUserTag(ctx, username, &models.UserTag{Name: diet, TagType: "Dieta"}); err != nil {
+		t.Fatalf("add user tag: %v", err)
+	}
+	rows, err := conn.Query(ctx, `SELECT rt.recipe_id FROM recipes_tags rt JOIN tags t ON t.id = rt.tag_id WHERE t.name = $1`, diet)
+	if err != nil {
+		t.Fatalf("tagged recipes: %v", err)
+	}
+	tagged, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+	if err != nil {
+		t.Fatalf("tagged recipes: %v", err)
+	}
+
+	search := func() []repository.FilterRecipesByTagNamesAndParamsRow {
+		t.Helper()
+		recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 1000})
+		if err != nil {
+			t.Fatalf("find recipes: %v", err)
+		}
+		return recipes
+	}
+
+	// Strict by default: only vegetarian meals.
+	for _, recipe := range search() {
+		if !slices.Contains(tagged, recipe.ID) {
+			t.Errorf("strict: got meal %d without %s", recipe.ID, diet)
+		}
+	}
+
+	if err := users.SetUserTagStrictness(ctx, username, diet, &models.TagStrictnessRequest{Strictness: models.StrictnessFlexible}); err != nil {
+		t.Fatalf("set strictness: %v", err)
+	}
+	recipes := search()
+	untagged, sawUntagged := 0, false
+	for _, recipe := range recipes {
+		if !slices.Contains(tagged, recipe.ID) {
+			sawUntagged = true
+			untagged++
+		} else if sawUntagged {
+			t.Errorf("flexible: vegetarian meal %d ranked after a meal without %s", recipe.ID, diet)
+		}
+	}
+	if untagged == 0 {
+		t.Errorf("flexible: got only vegetarian meals, want the rest ranked after them")
+	}
+
+	// Allergens and other tag types have no strictness.
+	if err := users.AddUserTag(ctx, username, &models.UserTag{Name: "Orzechy", TagType: "Alergie"}); err != nil {
+		t.Fatalf("add allergen: %v", err)
+	}
+	err = users.SetUserTagStrictness(ctx, username, "Orzechy", &models.TagStrictnessRequest{Strictness: models.StrictnessFlexible})
+	if err != services.ErrTagNotFound {
+		t.Errorf("allergen strictness: got %v, want %v", err, services.ErrTagNotFound)
+	}
+}
+
+func TestRunFetchesCancelsOthersOnFailure(t *testing.T) {
+	boom := errors.New("boom")
+	// Fetches waiting for a slot after the failure are skipped, so only the
+	// ones that started can be cancelled.
+	var started, cancelled [3]atomic.Bool
+	blocked := func(i int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			started[i].Store(true)
+			select {
+			case <-ctx.Done():
+				cancelled[i].Store(true)
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		}
+	}
+
+	start := time.Now()
+	err := services.RunFetches(context.Background(), 3,
+		blocked(0),
+		func(ctx context.Context) error { started[1].Store(true); return boom },
+		blocked(2),
+	)
+	if err != boom {
+		t.Errorf("got %v, want %v", err, boom)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %v for the failure to come back", elapsed)
+	}
+	for _, i := range []int{0, 2} {
+		if started[i].Load() && !cancelled[i].Load() {
+			t.Errorf("fetch %d started but wasn't cancelled", i)
+		}
+	}
+
+	var ran atomic.Bool
+	err = services.RunFetches(context.Background(), 1,
+		func(ctx context.Context) error { return boom },
+		func(ctx context.Context) error { ran.Store(true); return nil },
+	)
+	if err != boom || ran.Load() {
+		t.Errorf("sequential: got %v, later fetch ran %v", err, ran.Load())
+	}
+}
+
+func TestSortOrderValidation(t *testing.T) {
+	for _, sortBy := range append([]string{""}, models.SortOrders...) {
+		params := models.RecipesFinderParams{SortBy: sortBy}
+		if err := params.Validate(); err != nil {
+			t.Errorf("%q: %v", sortBy, err)
+		}
+	}
+	params := models.RecipesFinderParams{SortBy: "popularity"}
+	if err := params.Validate(); err == nil {
+		t.Error("expected an unknown sort order to be rejected")
+	}
+}
+
+func TestSortedPagesDontOverlapIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	reviews := services.NewBaseReviewService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "pages", "Pages1!x")
+	reviewer := createTestUser(t, conn, "pagesrev", "Pages1!x")
+	query := fmt.Sprintf("Strona %d", time.Now().UnixNano()%1e9)
+
+	// Same time, calories and rating everywhere, so only the id tells them apart.
+	calories := int32(400)
+	want := map[int32]bool{}
+	for i := range 13 {
+		recipe := models.RecipeAdd{Name: fmt.Sprintf("%s %d", query, i), Recipe: "-", Time: 916, Difficulty: 1, Calories: &calories, Force: true}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+	}
+	all, err := finder.FindRecipe(ctx, models.RecipesFinderParams{MinTime: 916, MaxTime: 916, Limit: 100, Username: username, NameQuery: query})
+	if err != nil || len(all) != 13 {
+		t.Fatalf("list created recipes: %d, %v", len(all), err)
+	}
+	for _, recipe := range all {
+		want[recipe.ID] = true
+		if _, err := reviews.AddReview(ctx, reviewer, int64(recipe.ID), &models.ReviewRequest{Score: 4}); err != nil {
+			t.Fatalf("add review: %v", err)
+		}
+	}
+
+	for _, sortBy := range append([]string{""}, models.SortOrders...) {
+		seen := map[int32]bool{}
+		for offset := int32(0); offset < 13; offset += 4 {
+			page, err := finder.FindRecipe(ctx, models.RecipesFinderParams{
+				MinTime: 916, MaxTime: 916, Limit: 4, Offset: offset, Username: username, NameQuery: query, SortBy: sortBy,
+			})
+			if err != nil {
+				t.Fatalf("%q page at %d: %v", sortBy, offset, err)
+			}
+			for _, recipe := range page {
+				if seen[recipe.ID] {
+					t.Errorf("%q: recipe %d on more than one page", sortBy, recipe.ID)
+				}
+				seen[recipe.ID] = true
+			}
+		}
+		if len(seen) != len(want) {
+			t.Errorf("%q: pages covered %d of %d recipes", sortBy, len(seen), len(want))
+		}
+	}
+}
+
+func TestNutritionWarnings(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Recipe models.RecipeAdd
+		Fields []string
+	}{
+		{"reasonable", models.RecipeAdd{Calories: int32Ptr(520), Protein: int32Ptr(30), Carbs: int32Ptr(60), Fat: int32Ptr(18)}, nil},
+		{"implausible calories", models.RecipeAdd{Calories: int32Ptr(50000)}, []string{"calories"}},
+		{"negative protein", models.RecipeAdd{Calories: int32Ptr(400), Protein: int32Ptr(-5)}, []string{"protein"}},
+		{"macros don't add up", models.RecipeAdd{Calories: int32Ptr(200), Protein: int32Ptr(30), Carbs: int32Ptr(60), Fat: int32Ptr(18)}, []string{"macros"}},
+		{"small meal within margin", models.RecipeAdd{Calories: int32Ptr(60), Protein: int32Ptr(2), Carbs: int32Ptr(20), Fat: int32Ptr(0)}, nil},
+		{"no nutrition", models.RecipeAdd{}, nil},
+	}
+	for _, tt := range tests {
+		var fields []string
+		for _, warning := range tt.Recipe.NutritionWarnings() {
+			fields = append(fields, warning.Field)
+		}
+		if !slices.Equal(fields, tt.Fields) {
+			t.Errorf("%s: got warnings for %v, want %v", tt.Name, fields, tt.Fields)
+		}
+	}
+}
+
+func TestStrictNutritionRejectsRecipe(t *testing.T) {
+	finder := services.BaseFinderService{StrictNutrition: true}
+	recipe := models.RecipeAdd{Name: "Ciasto", Calories: int32Ptr(50000)}
+
+	err := finder.CreateRecipe(context.Background(), &recipe, "user")
+	var nutrition *services.NutritionError
+	if !errors.As(err, &nutrition) || !errors.Is(err, services.ErrValidation) {
+		t.Fatalf("got %v, want a nutrition error", err)
+	}
+	if len(nutrition.Warnings) != 1 || nutrition.Warnings[0].Field != "calories" {
+		t.Errorf("got warnings %+v", nutrition.Warnings)
+	}
+}
+
+func TestIngredientsCap(t *testing.T) {
+	list := models.IngredientsJson{}
+	for i := range 4 {
+		list.Ingredients = append(list.Ingredients, models.Ingredient{Name: fmt.Sprintf("Składnik %d", i), Amount: 1, Unit: "szt"})
+	}
+
+	if _, err := list.Normalize(4); err != nil {
+		t.Errorf("4 ingredients with a cap of 4: %v", err)
+	}
+	if _, err := list.Normalize(3); err == nil {
+		t.Error("4 ingredients with a cap of 3 should be rejected")
+	}
+	if _, err := list.Normalize(0); err != nil {
+		t.Errorf("no cap: %v", err)
+	}
+
+	finder := services.BaseFinderService{MaxIngredients: 3}
+	recipe := models.RecipeAdd{Name: "Sałatka", Ingredients: list}
+	if err := finder.CreateRecipe(context.Background(), &recipe, "user"); err != services.ErrValidation {
+		t.Errorf("got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestIngredientsValidation(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Ingredient models.Ingredient
+		Valid      bool
+	}{
+		{"valid", models.Ingredient{Name: "Mąka", Amount: 200, Unit: "gr"}, true},
+		{"unit case and spaces", models.Ingredient{Name: " Mleko ", Amount: 1, Unit: " L"}, true},
+		{"empty name", models.Ingredient{Name: "  ", Amount: 1, Unit: "szt"}, false},
+		{"long name", models.Ingredient{Name: strings.Repeat("a", models.MaxIngredientNameLength+1), Amount: 1, Unit: "szt"}, false},
+		{"zero amount", models.Ingredient{Name: "Sól", Amount: 0, Unit: "gr"}, false},
+		{"negative amount", models.Ingredient{Name: "Sól", Amount: -5, Unit: "gr"}, false},
+		{"unknown unit", models.Ingredient{Name: "Cukier", Amount: 2, Unit: "wiadro"}, false},
+	}
+	for _, tt := range tests {
+		_, err := models.IngredientsJson{Ingredients: []models.Ingredient{tt.Ingredient}}.Normalize(0)
+		if (err == nil) != tt.Valid {
+			t.Errorf("%s: got %v, want valid %v", tt.Name, err, tt.Valid)
+		}
+	}
+}
+
+func TestIngredientsDuplicates(t *testing.T) {
+	list := models.IngredientsJson{Ingredients: []models.Ingredient{
+		{Name: "Mąka", Amount: 200, Unit: "gr"},
+		{Name: "Jajka", Amount: 2, Unit: "szt"},
+		{Name: "mąka ", Amount: 50, Unit: "GR"},
+	}}
+	got, err := list.Normalize(0)
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	want := []models.Ingredient{
+		{Name: "Mąka", Amount: 250, Unit: "gr"},
+		{Name: "Jajka", Amount: 2, Unit: "szt"},
+	}
+	if !reflect.DeepEqual(got.Ingredients, want) {
+		t.Errorf("got %+v, want %+v", got.Ingredients, want)
+	}
+
+	list.Ingredients[2].Unit = "kg"
+	if _, err := list.Normalize(0); err == nil {
+		t.Error("the same ingredient in different units should be rejected")
+	}
+}
+
+func TestRecipeFlagFilters(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Flags    map[string]bool
+		Required []string
+		Excluded []string
+	}{
+		{"unset", nil, nil, nil},
+		{"true", map[string]bool{models.FlagKidFriendly: true}, []string{models.FlagKidFriendly}, nil},
+		{"false", map[string]bool{models.FlagKidFriendly: false}, nil, []string{models.FlagKidFriendly}},
+	}
+	for _, tt := range tests {
+		params := models.RecipesFinderParams{Flags: tt.Flags}
+		if err := params.Validate(); err != nil {
+			t.Errorf("%s: %v", tt.Name, err)
+		}
+		required, excluded := params.FlagFilters()
+		if !slices.Equal(required, tt.Required) || !slices.Equal(excluded, tt.Excluded) {
+			t.Errorf("%s: got required %v, excluded %v", tt.Name, required, excluded)
+		}
+	}
+
+	params := models.RecipesFinderParams{Flags: map[string]bool{"gluten_free": true}}
+	if err := params.Validate(); err == nil {
+		t.Error("unknown flag accepted")
+	}
+	if models.ValidFlags([]string{models.FlagSpicy, "hot"}) {
+		t.Error("unknown recipe flag accepted on create")
+	}
+}
+
+func TestKidFriendlyFlagIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "flags", "Flags1!")
+	stamp := time.Now().UnixNano() % 1e9
+
+	recipes := map[string][]string{
+		fmt.Sprintf("Naleśniki %d", stamp): {models.FlagKidFriendly},
+		fmt.Sprintf("Curry %d", stamp):     {models.FlagSpicy},
+	}
+	for name, flags := range recipes {
+		recipe := models.RecipeAdd{Name: name, Recipe: "-", Time: 916, Difficulty: 1, Force: true, Flags: flags}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+	}
+
+	search := func(flags map[string]bool) []string {
+		found, err := finder.FindRecipe(ctx, models.RecipesFinderParams{
+			MinTime: 916, MaxTime: 916, Limit: 1000, Username: username, Flags: flags,
+		})
+		if err != nil {
+			t.Fatalf("find recipes with %v: %v", flags, err)
+		}
+		var names []string
+		for _, recipe := range found {
+			if _, ok := recipes[recipe.Name]; ok {
+				names = append(names, strings.Fields(recipe.Name)[0])
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if got := search(map[string]bool{models.FlagKidFriendly: true}); !slices.Equal(got, []string{"Naleśniki"}) {
+		t.Errorf("kid_friendly=true: got %v", got)
+	}
+	if got := search(map[string]bool{models.FlagKidFriendly: false}); !slices.Equal(got, []string{"Curry"}) {
+		t.Errorf("kid_friendly=false: got %v", got)
+	}
+	if got := search(nil); !slices.Equal(got, []string{"Curry", "Naleśniki"}) {
+		t.Errorf("kid_friendly unset: got %v", got)
+	}
+}
+
+func TestQueriesPoolExhausted(t *testing.T) {
+	pool := services.NewQueriesPool([]*pgx.Conn{nil})
+	pool.AcquireTimeout = 20 * time.Millisecond
+	ctx := context.Background()
+
+	held, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := pool.Acquire(ctx); err != services.ErrServiceBusy {
+		t.Errorf("saturated pool: got %v, want %v", err, services.ErrServiceBusy)
+	}
+	if stats := pool.Stats(); stats.InUse != 1 || stats.Exhausted != 1 || stats.Waiting != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	finder := services.BaseFinderService{FetchPool: pool}
+	if _, err := finder.RecommendRecipes(ctx, "user", 10); err != services.ErrServiceBusy {
+		t.Errorf("recommendations on a saturated pool: got %v, want %v", err, services.ErrServiceBusy)
+	}
+
+	pool.Release(held)
+	if _, err := pool.Acquire(ctx); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+
+	res := httptest.NewRecorder()
+	handlers.WriteError(res, services.ErrServiceBusy)
+	if res.Code != http.StatusServiceUnavailable || res.Header().Get("Retry-After") == "" {
+		t.Errorf("got status %d, Retry-After %q", res.Code, res.Header().Get("Retry-After"))
+	}
+}
+
+func TestQueriesPoolExhaustedIntegration(t *testing.T) {
+	conn := testConnection(t)
+	pool := services.NewQueriesPool([]*pgx.Conn{conn})
+	pool.AcquireTimeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	held, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := conn.Exec(ctx, "SELECT pg_sleep(0.5)")
+		pool.Release(held)
+		done <- err
+	}()
+
+	finder := services.BaseFinderService{FetchPool: pool}
+	if _, err := finder.RecommendRecipes(ctx, "user", 10); err != services.ErrServiceBusy {
+		t.Errorf("got %v, want %v", err, services.ErrServiceBusy)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("blocking query: %v", err)
+	}
+}
+
+func TestQueriesPoolReplacesCancelledConnIntegration(t *testing.T) {
+	testConnection(t)
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, server.TestDatabaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	pool := services.NewQueriesPool([]*pgx.Conn{conn})
+	connects := 0
+	pool.Connect = func(ctx context.Context) (*pgx.Conn, error) {
+		connects++
+		return pgx.Connect(ctx, server.TestDatabaseURL())
+	}
+
+	// The failing fetch cancels the slow one mid-query, which closes its
+	// connection.
+	boom := errors.New("boom")
+	err = services.RunFetches(ctx, 2,
+		func(ctx context.Context) error {
+			repo, err := pool.Acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer pool.Release(repo)
+			_, err = conn.Exec(ctx, "SELECT pg_sleep(5)")
+			return err
+		},
+		func(ctx context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return boom
+		},
+	)
+	if err != boom {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+	if !conn.IsClosed() {
+		t.Fatal("cancelled query left its connection open")
+	}
+
+	repo, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire after cancel: %v", err)
+	}
+	defer pool.Release(repo)
+	if _, err := repo.CountRecipes(ctx); err != nil {
+		t.Errorf("query after cancel: %v", err)
+	}
+	if connects != 1 {
+		t.Errorf("got %d reconnects, want 1", connects)
+	}
+}
+
+func TestRecipeTimesValidation(t *testing.T) {
+	params := models.RecipesFinderParams{MaxTotalTime: -1}
+	if err := params.Validate(); err == nil {
+		t.Error("negative total time accepted")
+	}
+	params = models.RecipesFinderParams{MaxTotalTime: 30, SortBy: models.SortQuickest}
+	if err := params.Validate(); err != nil {
+		t.Errorf("valid total time rejected: %v", err)
+	}
+
+	finder := services.BaseFinderService{}
+	recipe := models.RecipeAdd{Name: "Gulasz", Time: 10, CookTime: -5}
+	if err := finder.CreateRecipe(context.Background(), &recipe, "user"); err != services.ErrValidation {
+		t.Errorf("negative cook time: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestMaxTotalTimeIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "cooktime", "CookTime1!")
+	stamp := fmt.Sprint(time.Now().UnixNano() % 1e9)
+
+	for _, recipe := range []models.RecipeAdd{
+		{Name: "Gulasz " + stamp, Time: 10, CookTime: 120},
+		{Name: "Omlet " + stamp, Time: 20},
+	} {
+		recipe.Recipe, recipe.Difficulty, recipe.Force = "-", 1, true
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+	}
+
+	search := func(params models.RecipesFinderParams) []string {
+		params.NameQuery, params.Limit, params.Username = stamp, 1000, username
+		found, err := finder.FindRecipe(ctx, params)
+		if err != nil {
+			t.Fatalf("find recipes: %v", err)
+		}
+		var names []string
+		for _, recipe := range found {
+			names = append(names, strings.Fields(recipe.Name)[0])
+		}
+		return names
+	}
+
+	if got := search(models.RecipesFinderParams{MaxTime: 60}); len(got) != 2 {
+		t.Errorf("prep time alone should pass both, got %v", got)
+	}
+	if got := search(models.RecipesFinderParams{MaxTotalTime: 60}); !slices.Equal(got, []string{"Omlet"}) {
+		t.Errorf("max total time 60: got %v, want the long braise left out", got)
+	}
+	if got := search(models.RecipesFinderParams{SortBy: models.SortQuickest}); !slices.Equal(got, []string{"Omlet", "Gulasz"}) {
+		t.Errorf("quickest first: got %v", got)
+	}
+	if got := search(models.RecipesFinderParams{SortBy: models.SortTime}); !slices.Equal(got, []string{"Gulasz", "Omlet"}) {
+		t.Errorf("shortest prep first: got %v", got)
+	}
+}
+
+func TestTransformForDietSwapsDairy(t *testing.T) {
+	recipe := repository.Recipe{
+		ID:       7,
+		Name:     "Naleśniki",
+		Servings: 2,
+		Calories: int32Ptr(300),
+		Protein:  int32Ptr(10),
+		Carbs:    int32Ptr(40),
+		Fat:      int32Ptr(10),
+		Ingredients: models.IngredientsJson{Ingredients: []models.Ingredient{
+			{Name: "Mleko", Amount: 200, Unit: "ml"},
+			{Name: "Mąka", Amount: 100, Unit: "g"},
+		}},
+	}
+
+	meal, err := services.TransformForDiet(recipe, models.DietVegan)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	want := []models.Ingredient{{Name: "napój owsiany", Amount: 200, Unit: "ml"}, {Name: "Mąka", Amount: 100, Unit: "g"}}
+	if !reflect.DeepEqual(meal.Ingredients.Ingredients, want) {
+		t.Errorf("ingredients: got %v, want %v", meal.Ingredients.Ingredients, want)
+	}
+	if len(meal.Swaps) != 1 || meal.Swaps[0].Original.Name != "Mleko" {
+		t.Errorf("swaps: got %v", meal.Swaps)
+	}
+	// 200 ml of oat drink has 38 kcal and 4.8 g protein less than milk,
+	// split over two servings.
+	if meal.Calories == nil || *meal.Calories != 281 || meal.Protein == nil || *meal.Protein != 8 {
+		t.Errorf("nutrition: got %v kcal, %v g protein", meal.Calories, meal.Protein)
+	}
+	if recipe.Ingredients.Ingredients[0].Name != "Mleko" {
+		t.Error("original recipe changed")
+	}
+
+	vegetarian, err := services.TransformForDiet(recipe, models.DietVegetarian)
+	if err != nil || len(vegetarian.Swaps) != 0 || *vegetarian.Calories != 300 {
+		t.Errorf("vegetarian keeps the milk: got %+v, %v", vegetarian, err)
+	}
+}
+
+func TestTransformForDietReportsUnsubstitutable(t *testing.T) {
+	recipe := repository.Recipe{
+		Ingredients: models.IngredientsJson{Ingredients: []models.Ingredient{
+			{Name: "Jajka", Amount: 3, Unit: "szt"},
+			{Name: "Masło", Amount: 20, Unit: "g"},
+			{Name: "Boczek", Amount: 100, Unit: "g"},
+		}},
+	}
+
+	_, err := services.TransformForDiet(recipe, models.DietVegan)
+	var substitution *services.SubstitutionError
+	if !errors.As(err, &substitution) || !errors.Is(err, services.ErrNoSubstitute) {
+		t.Fatalf("got %v, want a substitution error", err)
+	}
+	if !slices.Equal(substitution.Ingredients, []string{"Jajka", "Boczek"}) {
+		t.Errorf("got %v, want the eggs and the bacon", substitution.Ingredients)
+	}
+	if got := handlers.StatusFromError(err); got != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d", got)
+	}
+
+	finder := services.BaseFinderService{}
+	if _, err := finder.TransformMealForDiet(context.Background(), 1, "keto"); err != services.ErrValidation {
+		t.Errorf("unknown diet: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestRecentRatingSortIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "recent", "Recent123!")
+	stamp := fmt.Sprint(time.Now().UnixNano() % 1e9)
+
+	// Both average 5 stars, but only one was rated lately.
+	for name, age := range map[string]string{"Stary": "3 years", "Świeży": "1 day"} {
+		recipe := models.RecipeAdd{Name: name + " " + stamp, Recipe: "-", Time: 15, Difficulty: 1, Force: true}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+		if _, err := conn.Exec(ctx, `INSERT INTO reviews (recipe_id, username, review_score, created_at)
+			SELECT id, $2, 5, LOCALTIMESTAMP - $3::interval FROM recipes WHERE name = $1`, recipe.Name, username, age); err != nil {
+			t.Fatalf("insert review: %v", err)
+		}
+	}
+
+	search := func(sortBy string) []repository.FilterRecipesByTagNamesAndParamsRow {
+		found, err := finder.FindRecipe(ctx, models.RecipesFinderParams{NameQuery: stamp, SortBy: sortBy, Limit: 10, Username: username})
+		if err != nil || len(found) != 2 {
+			t.Fatalf("find recipes: got %v, %v", found, err)
+		}
+		return found
+	}
+
+	found := search(models.SortRecentRating)
+	if !strings.HasPrefix(found[0].Name, "Świeży") {
+		t.Errorf("recently rated meal should come first, got %s", found[0].Name)
+	}
+	fresh, stale := found[0].RecentRating, found[1].RecentRating
+	if fresh == nil || stale == nil || *fresh < 3.9 || *stale > 3.1 {
+		t.Errorf("recent ratings: got %v and %v, want about 4 and 3", fresh, stale)
+	}
+}
+
+func TestRankByAvailability(t *testing.T) {
+	recipes := []repository.FilterRecipesByTagNamesAndParamsRow{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	ingredients := map[int32][]models.Ingredient{
+		1: {{Name: "Tofu"}, {Name: "Miso"}},
+		2: {{Name: "Pasta"}, {Name: "Tomato"}},
+		3: {{Name: "Pasta"}, {Name: "Saffron"}},
+		4: {{Name: " pasta "}, {Name: "TOMATO"}},
+	}
+	inventory := &services.MockProviderInventory{Stock: map[string]bool{"pasta": true, "tomato": true}}
+	available, err := inventory.Available(context.Background(), []string{"tofu", "miso", "pasta", "tomato", "saffron"})
+	if err != nil {
+		t.Fatalf("available: %v", err)
+	}
+
+	ids := func(rows []repository.FilterRecipesByTagNamesAndParamsRow) []int32 {
+		var got []int32
+		for _, row := range rows {
+			got = append(got, row.ID)
+		}
+		return got
+	}
+
+	// Fully available recipes first, in search order, then partly, then not.
+	if got := ids(services.RankByAvailability(recipes, ingredients, available, 0)); !reflect.DeepEqual(got, []int32{2, 4, 3, 1}) {
+		t.Errorf("soft ranking: got %v, want [2 4 3 1]", got)
+	}
+	if got := ids(services.RankByAvailability(recipes, ingredients, available, 0.5)); !reflect.DeepEqual(got, []int32{2, 4, 3}) {
+		t.Errorf("minimum 0.5: got %v, want [2 4 3]", got)
+	}
+	if got := ids(services.RankByAvailability(recipes, ingredients, available, 1)); !reflect.DeepEqual(got, []int32{2, 4}) {
+		t.Errorf("minimum 1: got %v, want [2 4]", got)
+	}
+}
+
+func TestFindRecipeAvailabilityValidation(t *testing.T) {
+	finder := services.BaseFinderService{}
+	ctx := context.Background()
+
+	if _, err := finder.FindRecipe(ctx, models.RecipesFinderParams{MinAvailability: 1.5}); err != services.ErrValidation {
+		t.Errorf("minimum over 1: got %v, want ErrValidation", err)
+	}
+	if _, err := finder.FindRecipe(ctx, models.RecipesFinderParams{RankByAvailability: true}); err != services.ErrInventoryUnavailable {
+		t.Errorf("no inventory: got %v, want ErrInventoryUnavailable", err)
+	}
+}
+
+func TestFindRecipeAvailabilityIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "avail", "Avail1!")
+
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 20})
+	if err != nil || len(recipes) < 2 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+	last := recipes[len(recipes)-1]
+	recipe, err := finder.GetRecipe(ctx, last.ID, username, 0)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+
+	// Stocking only the last recipe's ingredients moves it up among the
+	// recipes that can be ordered in full.
+	stock := map[string]bool{}
+	for _, ingredient := range recipe.Ingredients.Ingredients {
+		stock[strings.ToLower(strings.TrimSpace(ingredient.Name))] = true
+	}
+	finder.Inventory = &services.MockProviderInventory{Stock: stock}
+
+	ranked, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 20, RankByAvailability: true})
+	if err != nil {
+		t.Fatalf("ranked search: %v", err)
+	}
+	if len(ranked) != len(recipes) {
+		t.Fatalf("ranked search: got %d recipes, want %d", len(ranked), len(recipes))
+	}
+	ids := make([]int32, len(ranked))
+	for i, row := range ranked {
+		ids[i] = row.ID
+	}
+	rows, err := finder.Repo.GetIngredientsForRecipes(ctx, ids)
+	if err != nil {
+		t.Fatalf("get ingredients: %v", err)
+	}
+	scores := map[int32]float64{}
+	for _, row := range rows {
+		scores[row.ID] = services.AvailabilityScore(row.Ingredients.Ingredients, stock)
+	}
+	for i := 1; i < len(ranked); i++ {
+		if scores[ranked[i-1].ID] < scores[ranked[i].ID] {
+			t.Errorf("recipe %d (%.2f) ranked above %d (%.2f)", ranked[i-1].ID, scores[ranked[i-1].ID], ranked[i].ID, scores[ranked[i].ID])
+		}
+	}
+	if scores[ranked[0].ID] != 1 {
+		t.Errorf("top recipe %d scores %.2f, want 1", ranked[0].ID, scores[ranked[0].ID])
+	}
+
+	filtered, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 20, MinAvailability: 1})
+	if err != nil {
+		t.Fatalf("filtered search: %v", err)
+	}
+	if !slices.ContainsFunc(filtered, func(row repository.FilterRecipesByTagNamesAndParamsRow) bool { return row.ID == last.ID }) {
+		t.Errorf("filtered search %v is missing fully stocked recipe %d", filtered, last.ID)
+	}
+	for _, row := range filtered {
+		if scores[row.ID] < 1 {
+			t.Errorf("filtered search kept recipe %d scoring %.2f", row.ID, scores[row.ID])
+		}
+	}
+
+	finder.Inventory = &services.MockProviderInventory{Err: errors.New("provider down")}
+	if _, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: username, Limit: 20, MinAvailability: 1}); err != services.ErrInventoryUnavailable {
+		t.Errorf("provider down with a minimum: got %v, want ErrInventoryUnavailable", err)
+	}
+}
+
+func TestPlanBatchCookScalesForDays(t *testing.T) {
+	recipe := repository.Recipe{
+		ID:            9,
+		Name:          "Gulasz",
+		Servings:      2,
+		Calories:      int32Ptr(450),
+		Protein:       int32Ptr(30),
+		BatchFriendly: true,
+		StorageDays:   5,
+		Ingredients: models.IngredientsJson{Ingredients: []models.Ingredient{
+			{Name: "Wołowina", Amount: 400, Unit: "g"},
+			{Name: "Papryka", Amount: 1, Unit: "szt"},
+			{Name: "Bulion", Amount: 300, Unit: "ml"},
+		}},
+	}
+
+	plan := services.PlanBatchCook(recipe, 5)
+	want := []models.Ingredient{
+		{Name: "Wołowina", Amount: 2000, Unit: "g"},
+		{Name: "Papryka", Amount: 5, Unit: "szt"},
+		{Name: "Bulion", Amount: 1500, Unit: "ml"},
+	}
+	if !reflect.DeepEqual(plan.Ingredients, want) {
+		t.Errorf("ingredients: got %v, want %v", plan.Ingredients, want)
+	}
+	if plan.Servings != 10 {
+		t.Errorf("servings: got %d, want 10", plan.Servings)
+	}
+	if len(plan.ShoppingList) != 3 {
+		t.Errorf("shopping list: got %v", plan.ShoppingList)
+	}
+	// Per-serving nutrition stays; the batch totals cover all ten servings.
+	if *plan.Calories != 450 || plan.TotalCalories == nil || *plan.TotalCalories != 4500 || *plan.TotalProtein != 300 {
+		t.Errorf("nutrition: got %v kcal per serving, %v in total, %v g protein in total", *plan.Calories, plan.TotalCalories, plan.TotalProtein)
+	}
+	if plan.TotalCarbs != nil {
+		t.Errorf("unknown carbs totalled to %v", *plan.TotalCarbs)
+	}
+	if len(plan.Warnings) != 0 {
+		t.Errorf("keeps five days: got warnings %v", plan.Warnings)
+	}
+	if batch := services.PlanBatchCook(recipe, 1); !reflect.DeepEqual(batch.Ingredients, recipe.Ingredients.Ingredients) {
+		t.Errorf("one day: got %v, want the recipe as is", batch.Ingredients)
+	}
+}
+
+func TestPlanBatchCookWarnsAboutStorage(t *testing.T) {
+	recipe := repository.Recipe{
+		Servings:      1,
+		BatchFriendly: true,
+		StorageDays:   3,
+		Ingredients:   models.IngredientsJson{Ingredients: []models.Ingredient{{Name: "Ryż", Amount: 100, Unit: "g"}}},
+	}
+
+	plan := services.PlanBatchCook(recipe, 5)
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "keeps 3 days") {
+		t.Errorf("storage shorter than the days: got warnings %v", plan.Warnings)
+	}
+	if plan.Ingredients[0].Amount != 500 {
+		t.Errorf("still scaled: got %d g", plan.Ingredients[0].Amount)
+	}
+
+	recipe.BatchFriendly = false
+	recipe.StorageDays = 0
+	if plan := services.PlanBatchCook(recipe, 2); len(plan.Warnings) != 2 {
+		t.Errorf("not batch friendly, storage unknown: got warnings %v", plan.Warnings)
+	}
+
+	finder := services.BaseFinderService{}
+	for _, days := range []int{0, models.MaxBatchDays + 1} {
+		if _, err := finder.BatchCook(context.Background(), 1, days); err != services.ErrValidation {
+			t.Errorf("%d days: got %v, want ErrValidation", days, err)
+		}
+	}
+}
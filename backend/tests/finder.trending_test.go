@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestFilterTrending(t *testing.T) {
+	const gluten, lactose = 40, 41
+	rows := []repository.GetTrendingRecipesRow{
+		{ID: 1, Name: "Pierogi", Activity: 9, AllergenTagIds: []int32{gluten}},
+		{ID: 2, Name: "Bigos", Activity: 7},
+		{ID: 3, Name: "Sernik", Activity: 5, AllergenTagIds: []int32{lactose}},
+		{ID: 4, Name: "Żurek", Activity: 2},
+	}
+
+	meals := services.FilterTrending(rows, []int32{gluten}, 2)
+	if len(meals) != 2 || meals[0].ID != 2 || meals[1].ID != 3 {
+		t.Errorf("with gluten allergy: got %+v, want Bigos and Sernik", meals)
+	}
+
+	// A quiet window returns what there is rather than padding.
+	if meals := services.FilterTrending(rows, nil, 10); len(meals) != 4 {
+		t.Errorf("got %d meals, want all 4", len(meals))
+	}
+	if meals := services.FilterTrending(nil, nil, 10); meals == nil || len(meals) != 0 {
+		t.Errorf("got %v, want an empty list", meals)
+	}
+}
+
+func TestTrendingCacheExpires(t *testing.T) {
+	ctx := context.Background()
+	cache := services.NewTrendingCache(20 * time.Millisecond)
+	cache.Put(ctx, time.Hour, []repository.GetTrendingRecipesRow{{ID: 1}})
+
+	if rows, ok := cache.Get(ctx, time.Hour); !ok || len(rows) != 1 {
+		t.Fatalf("got %v %v, want cached ranking", rows, ok)
+	}
+	if _, ok := cache.Get(ctx, 2*time.Hour); ok {
+		t.Error("other window should not be cached")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.Get(ctx, time.Hour); ok {
+		t.Error("ranking still cached after ttl")
+	}
+}
+
+func TestTrendingMealsWindowIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "trend", "Trending1!")
+
+	newRecipe := func(name string) int32 {
+		id, err := finder.Repo.CreateRecipe(ctx, repository.CreateRecipeParams{
+			Name: name, Recipe: "-", Time: 10, Difficulty: 1, Username: username, Servings: 1,
+		})
+		if err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+		return id
+	}
+	recent, old := newRecipe(username+" recent"), newRecipe(username+" old")
+
+	// Recent: a favorite and a cooked log today. Old: the same, a month ago.
+	for _, stmt := range []string{
+		"INSERT INTO favorites (username, recipe_id) VALUES ($1, $2)",
+		"INSERT INTO recipes_made (username, recipe_id) VALUES ($1, $2)",
+	} {
+		if _, err := conn.Exec(ctx, stmt, username, recent); err != nil {
+			t.Fatalf("recent activity: %v", err)
+		}
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO favorites (username, recipe_id, created_at) VALUES ($1, $2, CURRENT_TIMESTAMP(0) - interval '30 days')", username, old); err != nil {
+		t.Fatalf("old favorite: %v", err)
+	}
+	if _, err := conn.Exec(ctx, "INSERT INTO recipes_made (username, recipe_id, made_at) VALUES ($1, $2, CURRENT_TIMESTAMP(0) - interval '30 days')", username, old); err != nil {
+		t.Fatalf("old log: %v", err)
+	}
+
+	activity := func(window time.Duration) map[int32]int32 {
+		meals, err := finder.TrendingMeals(ctx, username, window, 200)
+		if err != nil {
+			t.Fatalf("trending meals: %v", err)
+		}
+		got := make(map[int32]int32)
+		for _, meal := range meals {
+			got[meal.ID] = meal.Activity
+		}
+		return got
+	}
+
+	week := activity(7 * 24 * time.Hour)
+	if week[recent] != 4 {
+		t.Errorf("recent recipe activity in a week: got %d, want 4", week[recent])
+	}
+	if _, ok := week[old]; ok {
+		t.Error("activity outside the window was counted")
+	}
+
+	quarter := activity(60 * 24 * time.Hour)
+	if quarter[old] != 4 {
+		t.Errorf("old recipe activity in 60 days: got %d, want 4", quarter[old])
+	}
+}
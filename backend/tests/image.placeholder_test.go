@@ -0,0 +1,287 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// fixtureSource serves the same file for every URL, or fails with err.
+type fixtureSource struct {
+	path string
+	err  error
+}
+
+func (s fixtureSource) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return os.Open(s.path)
+}
+
+var testDecoder = services.BoundedDecoder{MaxBytes: 1 << 20, MaxPixels: 1 << 20}
+
+func TestPlaceholderFromFixture(t *testing.T) {
+	placeholders := &services.ImagePlaceholders{
+		Source:  fixtureSource{path: "testdata/meal.png"},
+		Decoder: testDecoder,
+	}
+	placeholder, err := placeholders.Compute(context.Background(), "https://example.com/meal.png")
+	if err != nil {
+		t.Fatalf("compute: %v", err)
+	}
+
+	// 4x3 components: size flag, max AC, 4 DC characters and 2 per AC.
+	if len(placeholder.BlurHash) != 28 || !strings.HasPrefix(placeholder.BlurHash, "L") {
+		t.Errorf("got blurhash %q, want 28 characters starting with L", placeholder.BlurHash)
+	}
+	// Mostly tomato red, getting greener lower down, with a strip of basil.
+	if placeholder.Color != "#c84628" {
+		t.Errorf("got dominant color %q, want #c84628", placeholder.Color)
+	}
+
+	again, _ := placeholders.Compute(context.Background(), "https://example.com/meal.png")
+	if again != placeholder {
+		t.Errorf("got %+v, then %+v", placeholder, again)
+	}
+}
+
+func TestBlurHashSolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	// The average color is encoded as is, in characters 2 to 6.
+	if got := services.BlurHash(img, 4, 3); len(got) != 28 || got[2:6] != "TI:j" {
+		t.Errorf("got %q, want 28 characters with TI:j for the average", got)
+	}
+	if got := services.BlurHash(img, 1, 1); got != "00TI:j" {
+		t.Errorf("1x1: got %q, want 00TI:j", got)
+	}
+}
+
+func TestBoundedDecoderRejectsLargeImages(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/meal.png")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	tests := []struct {
+		Name    string
+		Decoder services.BoundedDecoder
+		Data    []byte
+	}{
+		{"Too many bytes", services.BoundedDecoder{MaxBytes: 100, MaxPixels: 1 << 20}, fixture},
+		{"Too many pixels", services.BoundedDecoder{MaxBytes: 1 << 20, MaxPixels: 16*12 - 1}, fixture},
+		{"Not an image", testDecoder, []byte("<html>not found</html>")},
+	}
+	for _, tt := range tests {
+		if _, err := tt.Decoder.Decode(bytes.NewReader(tt.Data)); err != services.ErrInvalidImage {
+			t.Errorf("%s: got %v, want %v", tt.Name, err, services.ErrInvalidImage)
+		}
+	}
+
+	if _, err := testDecoder.Decode(bytes.NewReader(fixture)); err != nil {
+		t.Errorf("fixture: %v", err)
+	}
+}
+
+func TestHTTPImageSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/meals/jump":
+			http.Redirect(w, r, "/private/a.png", http.StatusFound)
+		case "/meals/page":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html></html>")
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, "png bytes")
+		}
+	}))
+	defer srv.Close()
+	// The test server is on loopback, so this client doesn't refuse it.
+	source := &services.HTTPImageSource{
+		Client:  srv.Client(),
+		Allowed: services.ParseImageStorageURLs(srv.URL + "/meals"),
+	}
+
+	body, err := source.Open(context.Background(), srv.URL+"/meals/a.png")
+	if err != nil {
+		t.Fatalf("open allowed image: %v", err)
+	}
+	if data, _ := io.ReadAll(body); string(data) != "png bytes" {
+		t.Errorf("got %q", data)
+	}
+	body.Close()
+
+	for name, tc := range map[string]struct {
+		url  string
+		want error
+	}{
+		"Outside the bucket":     {srv.URL + "/private/a.png", services.ErrImageNotAllowed},
+		"Bucket name prefix":     {srv.URL + "/meals-private/a.png", services.ErrImageNotAllowed},
+		"Dot segments":           {srv.URL + "/meals/../private/a.png", services.ErrImageNotAllowed},
+		"Other host":             {"http://169.254.169.254/meals/a.png", services.ErrImageNotAllowed},
+		"Redirect out of bucket": {srv.URL + "/meals/jump", services.ErrImageNotAllowed},
+		"Not an image":           {srv.URL + "/meals/page", services.ErrInvalidImage},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body, err := source.Open(context.Background(), tc.url)
+			if err == nil {
+				body.Close()
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestImageClientRefusesInternalAddresses(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "image/png")
+	}))
+	defer srv.Close()
+	source := &services.HTTPImageSource{
+		Client:  services.NewImageClient(time.Second),
+		Allowed: services.ParseImageStorageURLs(srv.URL + "/"),
+	}
+
+	if body, err := source.Open(context.Background(), srv.URL+"/a.png"); err == nil {
+		body.Close()
+		t.Error("fetched an image from loopback")
+	}
+	if hits != 0 {
+		t.Errorf("server got %d requests, want none", hits)
+	}
+}
+
+func TestImagePlaceholdersFetchOnlyFromStorage(t *testing.T) {
+	hits := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "image/png")
+	}))
+	defer internal.Close()
+	placeholders := services.NewImagePlaceholders()
+	ctx := context.Background()
+
+	if _, err := placeholders.Compute(ctx, "http://169.254.169.254/latest/meta-data/"); err != services.ErrImageNotAllowed {
+		t.Errorf("URL outside the storage: got %v, want %v", err, services.ErrImageNotAllowed)
+	}
+
+	source, ok := placeholders.Source.(*services.HTTPImageSource)
+	if !ok {
+		t.Fatalf("got source %T, want *services.HTTPImageSource", placeholders.Source)
+	}
+	source.Allowed = services.ParseImageStorageURLs(internal.URL + "/meals/")
+	if _, err := placeholders.Compute(ctx, internal.URL+"/meals/1.png"); err == nil {
+		t.Error("computed a placeholder from loopback")
+	}
+	if hits != 0 {
+		t.Errorf("internal server got %d requests, want none", hits)
+	}
+}
+
+func TestSetRecipeImageValidation(t *testing.T) {
+	finder := services.NewBaseFinderService(nil)
+	for _, url := range []string{"", "ftp://example.com/meal.png", "not a url"} {
+		if _, err := finder.SetRecipeImage(context.Background(), 1, "user", &models.RecipeImageRequest{URL: url}); err != services.ErrValidation {
+			t.Errorf("%q: got %v, want %v", url, err, services.ErrValidation)
+		}
+	}
+}
+
+func TestSetRecipeImageIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "image", "Image1!")
+	name := fmt.Sprintf("Shakshuka ze zdjęciem %d", time.Now().UnixNano()%1e9)
+
+	recipe := models.RecipeAdd{Name: name, Recipe: "-", Time: 20, Difficulty: 1, Force: true}
+	if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+		t.Fatalf("create recipe: %v", err)
+	}
+	var id int32
+	if err := conn.QueryRow(ctx, "SELECT id FROM recipes WHERE name = $1", name).Scan(&id); err != nil {
+		t.Fatalf("find recipe: %v", err)
+	}
+
+	fixture := &services.ImagePlaceholders{Source: fixtureSource{path: "testdata/meal.png"}, Decoder: testDecoder}
+	finder.Placeholders = fixture
+	req := &models.RecipeImageRequest{URL: "https://example.com/shakshuka.png"}
+
+	other := createTestUser(t, conn, "image", "Image1!")
+	if _, err := finder.SetRecipeImage(ctx, id, other, req); err != services.ErrForbidden {
+		t.Errorf("someone else's recipe: got %v, want %v", err, services.ErrForbidden)
+	}
+
+	confirmed, err := finder.SetRecipeImage(ctx, id, username, req)
+	if err != nil || confirmed.Placeholder == nil {
+		t.Fatalf("confirm image: got %+v, %v", confirmed, err)
+	}
+	stored, err := finder.GetRecipe(ctx, id, username, 0)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+	if stored.ImageBlurhash == nil || *stored.ImageBlurhash != confirmed.Placeholder.BlurHash {
+		t.Errorf("stored blurhash %v, want %q", stored.ImageBlurhash, confirmed.Placeholder.BlurHash)
+	}
+	if stored.ImageColor == nil || *stored.ImageColor != confirmed.Placeholder.Color {
+		t.Errorf("stored color %v, want %q", stored.ImageColor, confirmed.Placeholder.Color)
+	}
+
+	// An image that can't be fetched yet is kept for the backfill.
+	finder.Placeholders = &services.ImagePlaceholders{Source: fixtureSource{err: errors.New("storage not ready")}, Decoder: testDecoder}
+	req.URL = "https://example.com/shakshuka-2.png"
+	pending, err := finder.SetRecipeImage(ctx, id, username, req)
+	if err != nil || pending.Placeholder != nil {
+		t.Fatalf("pending image: got %+v, %v", pending, err)
+	}
+
+	job := services.NewImagePlaceholderJob(conn)
+	job.Placeholders = fixture
+	if filled, err := job.Backfill(ctx); err != nil || filled < 1 {
+		t.Fatalf("backfill: filled %d, error %v", filled, err)
+	}
+	stored, err = finder.Repo.GetRecipeWithId(ctx, id)
+	if err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+	if stored.ImageBlurhash == nil || *stored.ImageBlurhash != confirmed.Placeholder.BlurHash {
+		t.Errorf("backfilled blurhash %v, want %q", stored.ImageBlurhash, confirmed.Placeholder.BlurHash)
+	}
+
+	// An image that isn't one is rejected and not stored.
+	finder.Placeholders = &services.ImagePlaceholders{Source: fixtureSource{path: "testdata/meals_export.csv"}, Decoder: testDecoder}
+	req.URL = "https://example.com/not-an-image.png"
+	if _, err := finder.SetRecipeImage(ctx, id, username, req); err != services.ErrInvalidImage {
+		t.Errorf("not an image: got %v, want %v", err, services.ErrInvalidImage)
+	}
+
+	// Nor is one outside the image storage.
+	finder.Placeholders = services.NewImagePlaceholders()
+	req.URL = "http://169.254.169.254/latest/meta-data/"
+	if _, err := finder.SetRecipeImage(ctx, id, username, req); err != services.ErrImageNotAllowed {
+		t.Errorf("outside the storage: got %v, want %v", err, services.ErrImageNotAllowed)
+	}
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func importBatch(prefix string, n int) []models.ImportRecipe {
+	recipes := make([]models.ImportRecipe, n)
+	for i := range recipes {
+		recipes[i] = models.ImportRecipe{
+			SourceID:  fmt.Sprintf("%s-%d", prefix, i),
+			RecipeAdd: models.RecipeAdd{Name: fmt.Sprintf("Przepis %d", i)},
+		}
+	}
+	return recipes
+}
+
+func TestRunImportSkipsImported(t *testing.T) {
+	imported := map[string]bool{}
+	importOne := func(ctx context.Context, recipe *models.ImportRecipe) (bool, error) {
+		if recipe.SourceID == "src-3" {
+			return false, errors.New("unknown tag")
+		}
+		if imported[recipe.SourceID] {
+			return false, nil
+		}
+		imported[recipe.SourceID] = true
+		return true, nil
+	}
+
+	var reports []models.ImportProgress
+	report := func(p models.ImportProgress) { reports = append(reports, p) }
+
+	recipes := importBatch("src", 60)
+	first := services.RunImport(context.Background(), recipes, importOne, report)
+	if first.Imported != 59 || first.Skipped != 0 || first.Failed != 1 {
+		t.Errorf("first run: got %+v", first)
+	}
+	if first.Status != models.ImportStatusDone || first.Total != 60 {
+		t.Errorf("first run: got status %s, total %d", first.Status, first.Total)
+	}
+	// Two intermediate reports (after 25 and 50 records) and the final one.
+	if len(reports) != 3 || reports[0].Imported != 24 {
+		t.Errorf("got reports %+v", reports)
+	}
+
+	second := services.RunImport(context.Background(), recipes, importOne, report)
+	if second.Imported != 0 || second.Skipped != 59 || second.Failed != 1 {
+		t.Errorf("second run: got %+v", second)
+	}
+	if len(imported) != 59 {
+		t.Errorf("expected 59 distinct imports, got %d", len(imported))
+	}
+}
+
+func TestImportRequestValidation(t *testing.T) {
+	badURL, goodURL := "javascript:alert(1)", "https://www.allrecipes.com/recipe/1"
+	tests := []struct {
+		Name    string
+		Input   models.ImportRequest
+		WantErr bool
+	}{
+		{"Empty", models.ImportRequest{}, true},
+		{"Missing source id", models.ImportRequest{Recipes: []models.ImportRecipe{{RecipeAdd: models.RecipeAdd{Name: "Zupa"}}}}, true},
+		{"Valid", models.ImportRequest{Recipes: importBatch("v", 2)}, false},
+		{"Valid source", models.ImportRequest{Source: "allrecipes", Recipes: importBatch("v", 1)}, false},
+		{"Source with spaces", models.ImportRequest{Source: "All Recipes", Recipes: importBatch("v", 1)}, true},
+		{"Source with colon", models.ImportRequest{Source: "user:karol", Recipes: importBatch("v", 1)}, true},
+		{"Bad source url", models.ImportRequest{Recipes: []models.ImportRecipe{{SourceID: "u", RecipeAdd: models.RecipeAdd{Name: "Zupa", SourceURL: &badURL}}}}, true},
+		{"Source url", models.ImportRequest{Recipes: []models.ImportRecipe{{SourceID: "u", RecipeAdd: models.RecipeAdd{Name: "Zupa", SourceURL: &goodURL}}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if err := tt.Input.Validate(); (err != nil) != tt.WantErr {
+				t.Errorf("got %v, want error %v", err, tt.WantErr)
+			}
+		})
+	}
+}
+
+func TestImportRecipesIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseImportService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "import", "Import1!")
+
+	req := &models.ImportRequest{Recipes: importBatch(fmt.Sprintf("it%d", time.Now().UnixNano()), 3)}
+	first, err := service.ImportRecipes(ctx, username, req)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if first.Imported != 3 || first.Skipped != 0 {
+		t.Errorf("first run: got %+v", first)
+	}
+
+	req.JobID = first.JobID
+	second, err := service.ImportRecipes(ctx, username, req)
+	if err != nil {
+		t.Fatalf("resume import: %v", err)
+	}
+	if second.Imported != 0 || second.Skipped != 3 {
+		t.Errorf("second run: got %+v", second)
+	}
+
+	progress, err := service.GetImportProgress(ctx, username, first.JobID)
+	if err != nil {
+		t.Fatalf("get progress: %v", err)
+	}
+	if progress.Skipped != 3 || progress.Status != models.ImportStatusDone {
+		t.Errorf("got progress %+v", progress)
+	}
+
+	other := createTestUser(t, conn, "import", "Import1!")
+	if _, err := service.GetImportProgress(ctx, other, first.JobID); err != services.ErrImportJobNotFound {
+		t.Errorf("got %v, want %v", err, services.ErrImportJobNotFound)
+	}
+}
+
+func TestParseAllergenMap(t *testing.T) {
+	csvInput := "Ingredient,Allergen\n Mleko ,Produkty mleczne(dairy)\nmleko,Soja\nMąka,Gluten(Zboże),\nWoda\n"
+	jsonInput := `{"Mleko": ["Produkty mleczne(dairy)", "Soja"], "mąka": ["Gluten(Zboże)"], "woda": []}`
+
+	for name, input := range map[string]string{"csv": csvInput, "json": jsonInput} {
+		mapping, err := services.ParseAllergenMap(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", name, err)
+		}
+		if len(mapping) != 3 {
+			t.Fatalf("%s: got %+v, want three ingredients", name, mapping)
+		}
+		if mapping[0].Ingredient != "mleko" || !slices.Equal(mapping[0].Allergens, []string{"Produkty mleczne(dairy)", "Soja"}) {
+			t.Errorf("%s: got %+v for mleko", name, mapping[0])
+		}
+		if mapping[1].Ingredient != "mąka" || len(mapping[1].Allergens) != 1 {
+			t.Errorf("%s: got %+v for mąka", name, mapping[1])
+		}
+		if mapping[2].Ingredient != "woda" || mapping[2].Allergens == nil || len(mapping[2].Allergens) != 0 {
+			t.Errorf("%s: got %+v for woda, want no allergens", name, mapping[2])
+		}
+	}
+
+	for _, bad := range []string{`{"mleko": "soja"}`, ",Soja\n", strings.Repeat("x", 101) + ",Soja\n"} {
+		if _, err := services.ParseAllergenMap(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestResolveAllergens(t *testing.T) {
+	tags := []repository.ListAllergenTagsRow{{ID: 1, Name: "Soja"}, {ID: 2, Name: "Gluten(Zboże)"}}
+	mapping := []models.AllergenMapping{
+		{Ingredient: "mąka", Allergens: []string{"gluten(zboże)"}},
+		{Ingredient: "tofu", Allergens: []string{"Soja", "Sojka"}},
+		{Ingredient: "woda", Allergens: []string{}},
+	}
+
+	resolved, unknown := services.ResolveAllergens(mapping, tags)
+	if !slices.Equal(resolved["mąka"], []int32{2}) {
+		t.Errorf("mąka: got %v, want [2]", resolved["mąka"])
+	}
+	if _, ok := resolved["tofu"]; ok {
+		t.Error("tofu has an unknown allergen and should be left unchanged")
+	}
+	if ids, ok := resolved["woda"]; !ok || len(ids) != 0 {
+		t.Errorf("woda: got %v, %v, want an empty allergen list", ids, ok)
+	}
+	if !slices.Equal(unknown, []string{"Sojka"}) {
+		t.Errorf("unknown allergens: got %v", unknown)
+	}
+}
+
+func TestImportAllergenMapIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseImportService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "allergen", "Import1!")
+
+	suffix := time.Now().UnixNano() % 1e9
+	milk := fmt.Sprintf("Mleko%d", suffix)
+	recipes := importBatch(fmt.Sprintf("allergen%d", suffix), 2)
+	recipes[0].Ingredients = models.IngredientsJson{Ingredients: ingredients(milk, "Cukier")}
+	recipes[1].Ingredients = models.IngredientsJson{Ingredients: ingredients("Cukier")}
+	if _, err := service.ImportRecipes(ctx, username, &models.ImportRequest{Recipes: recipes}); err != nil {
+		t.Fatalf("import recipes: %v", err)
+	}
+
+	unknown := fmt.Sprintf("nieznany%d", suffix)
+	input := fmt.Sprintf("ingredient,allergen\n%s,Produkty mleczne(dairy)\n%s,Soja\n", milk, unknown)
+	result, err := service.ImportAllergenMap(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("import allergen map: %v", err)
+	}
+	if result.Updated != 1 || !slices.Equal(result.UnknownIngredients, []string{unknown}) {
+		t.Errorf("got %+v, want one update and %s reported unknown", result, unknown)
+	}
+
+	var tag string
+	if err := conn.QueryRow(ctx, `SELECT t.name FROM ingredient_allergens ia JOIN tags t ON t.id = ia.tag_id
+		WHERE ia.ingredient = $1`, strings.ToLower(milk)).Scan(&tag); err != nil {
+		t.Fatalf("read ingredient allergens: %v", err)
+	}
+	if tag != "Produkty mleczne(dairy)" {
+		t.Errorf("got allergen %q", tag)
+	}
+
+	for i, want := range []bool{true, false} {
+		var dirty bool
+		if err := conn.QueryRow(ctx, "SELECT allergens_dirty FROM recipes WHERE source_id = $1",
+			recipes[i].SourceID).Scan(&dirty); err != nil {
+			t.Fatalf("read recipe: %v", err)
+		}
+		if dirty != want {
+			t.Errorf("recipe %s: dirty %v, want %v", recipes[i].SourceID, dirty, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/auth"
+)
+
+func TestKeyStoreConcurrentReload(t *testing.T) {
+	a := auth.Key{ID: "a", Secret: []byte("secret-a")}
+	b := auth.Key{ID: "b", Secret: []byte("secret-b")}
+	// Each set still verifies the other's signing key, as after a rotation.
+	sets := []auth.KeySet{{Signing: a, Verifying: []auth.Key{b}}, {Signing: b, Verifying: []auth.Key{a}}}
+	store := auth.NewKeyStore(sets[0])
+	done := make(chan struct{})
+
+	var rotations sync.WaitGroup
+	rotations.Add(1)
+	go func() {
+		defer rotations.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			store.Reload(func() (auth.KeySet, error) { return sets[i%2], nil })
+		}
+	}()
+
+	var workers sync.WaitGroup
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := 0; i < 500; i++ {
+				token, err := store.Sign(jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Minute).Unix()})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err := store.Verify(token); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	close(done)
+	rotations.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("sign or verify failed during reload: %v", err)
+	}
+}
+
+func TestKeyStoreSignsWithReloadedKey(t *testing.T) {
+	old := auth.Key{ID: "old", Secret: []byte("old-secret")}
+	store := auth.NewKeyStore(auth.KeySet{Signing: old})
+	before, _ := store.Sign(jwt.MapClaims{"sub": "user"})
+
+	err := store.Reload(func() (auth.KeySet, error) {
+		return auth.ParseKeySet(strings.NewReader("new new-secret\nold old-secret\n"))
+	})
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	after, _ := store.Sign(jwt.MapClaims{"sub": "user"})
+	parsed, _, err := jwt.NewParser().ParseUnverified(after, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != "new" {
+		t.Fatalf("token after reload has kid %v, want new", parsed.Header["kid"])
+	}
+	if _, err := auth.NewKeyStore(auth.KeySet{Signing: old}).Verify(after); err == nil {
+		t.Error("token after reload verified with the old key alone")
+	}
+	if _, err := store.Verify(before); err != nil {
+		t.Errorf("token from before the reload rejected: %v", err)
+	}
+
+	if err := store.Reload(func() (auth.KeySet, error) { return auth.KeySet{}, fmt.Errorf("unreadable") }); err == nil {
+		t.Error("failed reload returned no error")
+	}
+	if store.Current().Signing.ID != "new" {
+		t.Error("failed reload replaced the keys")
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	set, err := auth.ParseKeySet(strings.NewReader("# rotated 2026-10\n\nb secret-b\na  secret-a\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if set.Signing.ID != "b" || len(set.Verifying) != 1 || string(set.Verifying[0].Secret) != "secret-a" {
+		t.Errorf("got %+v", set)
+	}
+
+	for name, file := range map[string]string{
+		"Empty":     "# nothing\n",
+		"No secret": "a\n",
+		"Duplicate": "a one\na two\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := auth.ParseKeySet(strings.NewReader(file)); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestKeyStoreLegacyTokens(t *testing.T) {
+	store := auth.NewKeyStore(auth.KeySet{Signing: auth.Key{ID: "k1", Secret: key}})
+	if _, err := store.Verify(createTestToken(false)); err != nil {
+		t.Errorf("token without a kid rejected: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestListQueryOperators(t *testing.T) {
+	created := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Query     string
+		Condition models.Condition
+		SQL       string
+		Args      []any
+	}{
+		{"difficulty=3", models.Condition{Field: "difficulty", Op: models.OpEq, Values: []any{int32(3)}},
+			"r.difficulty = $1", []any{int32(3)}},
+		{"time[eq]=20", models.Condition{Field: "time", Op: models.OpEq, Values: []any{int32(20)}},
+			"r.time = $1", []any{int32(20)}},
+		{"calories[gt]=400", models.Condition{Field: "calories", Op: models.OpGt, Values: []any{int32(400)}},
+			"r.calories > $1", []any{int32(400)}},
+		{"created_at[lt]=2025-03-01T00:00:00Z", models.Condition{Field: "created_at", Op: models.OpLt, Values: []any{created}},
+			"r.created_at < $1", []any{created}},
+		{"source[in]=user,import", models.Condition{Field: "source", Op: models.OpIn, Values: []any{"user", "import"}},
+			"r.source IN ($1, $2)", []any{"user", "import"}},
+		{"name[like]=50%25_off", models.Condition{Field: "name", Op: models.OpLike, Values: []any{"50%_off"}},
+			`r.name ILIKE '%' || $1 || '%' ESCAPE '\'`, []any{`50\%\_off`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Query, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.Query)
+			query, err := models.RecipeListSpec.Parse(values)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(query.Conditions, []models.Condition{tt.Condition}) {
+				t.Errorf("conditions: got %+v, want %+v", query.Conditions, tt.Condition)
+			}
+
+			sql, args, err := repository.BuildListing("WHERE TRUE", repository.RecipeListColumns, "r.id", query)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if !strings.Contains(sql, "AND "+tt.SQL+"\n") {
+				t.Errorf("sql %q is missing %q", sql, tt.SQL)
+			}
+			// Values only ever go as parameters, followed by the page.
+			want := append(tt.Args, models.RecipeListSpec.DefaultLimit, int32(0))
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("args: got %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+func TestListQuerySortAndPage(t *testing.T) {
+	values, _ := url.ParseQuery("sort=-created_at,name&limit=20&offset=40&time[lt]=30&time[gt]=10")
+	query, err := models.RecipeListSpec.Parse(values)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	sql, args, err := repository.BuildListing("WHERE TRUE", repository.RecipeListColumns, "r.id", query)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	wantSQL := "WHERE TRUE\n  AND r.time > $1\n  AND r.time < $2\nORDER BY r.created_at DESC, r.name ASC, r.id\nLIMIT $3 OFFSET $4"
+	if sql != wantSQL {
+		t.Errorf("sql: got %q, want %q", sql, wantSQL)
+	}
+	if want := []any{int32(10), int32(30), int32(20), int32(40)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+}
+
+func TestListQueryRejects(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":           "passwdhash=x",
+		"injection in field name": "name%29+OR+%281%3D1=x",
+		"unknown operator":        "time[ne]=5",
+		"operator not for type":   "time[like]=5",
+		"operator narrowed":       "source[like]=user",
+		"bad integer":             "time[gt]=abc",
+		"bad time":                "created_at[gt]=yesterday",
+		"empty text":              "name=",
+		"unsortable field":        "sort=servings",
+		"unknown sort field":      "sort=-passwdhash",
+		"limit over max":          "limit=5000",
+		"negative offset":         "offset=-1",
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			values, _ := url.ParseQuery(raw)
+			_, err := models.RecipeListSpec.Parse(values)
+			var queryErr *models.ListQueryError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("got %v, want a ListQueryError", err)
+			}
+		})
+	}
+}
+
+func TestListSpecsHaveColumns(t *testing.T) {
+	specs := []struct {
+		Name    string
+		Spec    models.ListSpec
+		Columns map[string]string
+	}{
+		{"recipes", models.RecipeListSpec, repository.RecipeListColumns},
+		{"users", models.UserListSpec, repository.UserListColumns},
+	}
+	for _, spec := range specs {
+		for field := range spec.Spec.Fields {
+			if _, ok := spec.Columns[field]; !ok {
+				t.Errorf("%s field %q has no column", spec.Name, field)
+			}
+		}
+	}
+}
+
+func TestListRecipesRejectsBadQuery(t *testing.T) {
+	handler := handlers.FinderHandler{
+		FinderService: &services.MockFinderService{},
+	}
+
+	for query, want := range map[string]int{
+		"/recipes?time[lt]=30&sort=-time": http.StatusOK,
+		"/recipes?username=admin":         http.StatusBadRequest,
+		"/recipes?time[regex]=.*":         http.StatusBadRequest,
+	} {
+		res := httptest.NewRecorder()
+		handler.ListRecipes(res, httptest.NewRequest(http.MethodGet, query, nil))
+		if res.Code != want {
+			t.Errorf("%s: got status %d, want %d", query, res.Code, want)
+		}
+	}
+}
+
+func TestListRecipesIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+
+	values, _ := url.ParseQuery("time[lt]=60&difficulty[in]=1,2,3&sort=-time&limit=50")
+	query, err := models.RecipeListSpec.Parse(values)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	recipes, err := finder.ListRecipes(ctx, query)
+	if err != nil {
+		t.Fatalf("list recipes: %v", err)
+	}
+	for i, recipe := range recipes {
+		if recipe.Time >= 60 || recipe.Difficulty < 1 || recipe.Difficulty > 3 {
+			t.Errorf("recipe %d (time %d, difficulty %d) doesn't match the filters", recipe.ID, recipe.Time, recipe.Difficulty)
+		}
+		if i > 0 && recipes[i-1].Time < recipe.Time {
+			t.Errorf("recipe %d sorted after a quicker one", recipe.ID)
+		}
+	}
+}
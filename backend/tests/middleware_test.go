@@ -1,14 +1,21 @@
 package tests
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/miloszbo/meals-finder/internal/middlewares"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
 )
 
 var key []byte = []byte(os.Getenv("APP_JWT_KEY"))
@@ -64,3 +71,417 @@ func TestAuthentication(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireRole(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		Name   string
+		Claims jwt.MapClaims
+		Want   int
+	}{
+		{"No claims", nil, http.StatusUnauthorized},
+		{"No role claim", jwt.MapClaims{"sub": "user"}, http.StatusForbidden},
+		{"User role", jwt.MapClaims{"sub": "user", "role": "user"}, http.StatusForbidden},
+		{"Admin role", jwt.MapClaims{"sub": "root", "role": "admin"}, http.StatusOK},
+	}
+
+	handlerTest := middlewares.RequireRole("admin")(handler)
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/users", nil)
+			if tt.Claims != nil {
+				req = req.WithContext(context.WithValue(req.Context(), "claims", tt.Claims))
+			}
+			resp := httptest.NewRecorder()
+			handlerTest.ServeHTTP(resp, req)
+			if resp.Code != tt.Want {
+				t.Errorf("got %v, want %v", resp.Code, tt.Want)
+			}
+		})
+	}
+}
+
+func TestTokenClaimsModes(t *testing.T) {
+	full, err := services.TokenClaims("root", "admin", "", false)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if full["role"] != "admin" {
+		t.Errorf("expected role claim, got %v", full["role"])
+	}
+
+	minimal, err := services.TokenClaims("root", "admin", models.ClientMobile, true)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, ok := minimal["role"]; ok {
+		t.Error("minimal claims shouldn't carry a role")
+	}
+	for _, claim := range []string{"sub", "exp", "iat", "jti", "client"} {
+		if _, ok := minimal[claim]; !ok {
+			t.Errorf("missing %s claim", claim)
+		}
+	}
+	if minimal["jti"] == full["jti"] {
+		t.Error("expected a unique jti per token")
+	}
+	if full["client"] != models.ClientWeb || minimal["client"] != models.ClientMobile {
+		t.Errorf("got clients %v and %v, want web and mobile", full["client"], minimal["client"])
+	}
+}
+
+func TestSessionTTLByClient(t *testing.T) {
+	tests := map[string]time.Duration{
+		models.ClientWeb:    services.WebSessionTTL,
+		models.ClientMobile: services.MobileSessionTTL,
+		models.ClientAPI:    services.APISessionTTL,
+		"":                  services.WebSessionTTL,
+	}
+	for client, want := range tests {
+		claims, err := services.TokenClaims("root", "user", client, true)
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		exp, _ := claims["exp"].(int64)
+		iat, _ := claims["iat"].(int64)
+		if got := time.Duration(exp-iat) * time.Second; got != want {
+			t.Errorf("client %q: got ttl %v, want %v", client, got, want)
+		}
+	}
+}
+
+func TestResolveRoleRevokedAdmin(t *testing.T) {
+	roles := map[string]string{"root": "admin"}
+	lookups := 0
+	cache := services.NewRoleCache(func(ctx context.Context, username string) (string, error) {
+		lookups++
+		return roles[username], nil
+	}, time.Hour)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handlerTest := middlewares.ResolveRole(cache.Role)(middlewares.RequireRole("admin")(handler))
+
+	call := func(claims jwt.MapClaims) int {
+		req := httptest.NewRequest("GET", "/admin/users", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "claims", claims))
+		resp := httptest.NewRecorder()
+		handlerTest.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if got := call(jwt.MapClaims{"sub": "root"}); got != http.StatusOK {
+		t.Fatalf("got %v, want %v", got, http.StatusOK)
+	}
+	call(jwt.MapClaims{"sub": "root"})
+	if lookups != 1 {
+		t.Errorf("expected cached role, got %d lookups", lookups)
+	}
+
+	// Revoking the role invalidates the cache, as BaseAdminService.SetUserRole does.
+	roles["root"] = "user"
+	cache.Invalidate("root")
+
+	// A stale role claim in the token is ignored in favor of the database.
+	if got := call(jwt.MapClaims{"sub": "root", "role": "admin"}); got != http.StatusForbidden {
+		t.Errorf("got %v, want %v", got, http.StatusForbidden)
+	}
+}
+
+func TestResolveRoleLookupFailure(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handlerTest := middlewares.ResolveRole(func(ctx context.Context, username string) (string, error) {
+		return "", errors.New("no such user")
+	})(handler)
+
+	req := httptest.NewRequest("GET", "/profile", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "ghost"}))
+	resp := httptest.NewRecorder()
+	handlerTest.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("got %v, want %v", resp.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestResolveSubjectByID(t *testing.T) {
+	const userID = "0b6f8a52-3c1e-4d7a-9f21-6e4c2b8d1a90"
+	usernames := map[string]string{userID: "karol"}
+	resolve := func(ctx context.Context, id string) (string, error) {
+		username, ok := usernames[id]
+		if !ok {
+			return "", errors.New("no such user")
+		}
+		return username, nil
+	}
+
+	var seen jwt.MapClaims
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Context().Value("claims").(jwt.MapClaims)
+		w.WriteHeader(http.StatusOK)
+	})
+	handlerTest := middlewares.ResolveSubject(resolve, true)(handler)
+
+	call := func(claims jwt.MapClaims) int {
+		req := httptest.NewRequest("GET", "/profile", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "claims", claims))
+		resp := httptest.NewRecorder()
+		handlerTest.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if got := call(jwt.MapClaims{"sub": userID}); got != http.StatusOK {
+		t.Fatalf("got %v, want %v", got, http.StatusOK)
+	}
+	if seen["sub"] != "karol" || seen["uid"] != userID {
+		t.Errorf("got sub %v uid %v, want karol %s", seen["sub"], seen["uid"], userID)
+	}
+
+	// The same token keeps working after a rename and maps to the new name.
+	usernames[userID] = "karol2"
+	if got := call(jwt.MapClaims{"sub": userID}); got != http.StatusOK {
+		t.Fatalf("after rename: got %v, want %v", got, http.StatusOK)
+	}
+	if seen["sub"] != "karol2" {
+		t.Errorf("after rename: got sub %v, want karol2", seen["sub"])
+	}
+
+	// Deleted or unknown ids are rejected.
+	delete(usernames, userID)
+	if got := call(jwt.MapClaims{"sub": userID}); got != http.StatusUnauthorized {
+		t.Errorf("unknown id: got %v, want %v", got, http.StatusUnauthorized)
+	}
+}
+
+func TestResolveSubjectUsernameTransition(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	resolve := func(ctx context.Context, id string) (string, error) {
+		t.Errorf("username subject %q shouldn't be looked up", id)
+		return "", nil
+	}
+
+	for _, tc := range []struct {
+		accept bool
+		want   int
+	}{
+		{true, http.StatusOK},
+		{false, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/profile", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "karol"}))
+		resp := httptest.NewRecorder()
+		middlewares.ResolveSubject(resolve, tc.accept)(handler).ServeHTTP(resp, req)
+		if resp.Code != tc.want {
+			t.Errorf("accept=%v: got %v, want %v", tc.accept, resp.Code, tc.want)
+		}
+	}
+}
+
+func TestRejectRevoked(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	isRevoked := func(ctx context.Context, username string, claims jwt.MapClaims) (bool, error) {
+		if username != "karol" {
+			t.Errorf("looked up %q, want karol", username)
+		}
+		switch claims["jti"] {
+		case "signed-out":
+			return true, nil
+		case "broken":
+			return false, errors.New("connection lost")
+		}
+		return false, nil
+	}
+
+	for name, tc := range map[string]struct {
+		claims jwt.MapClaims
+		want   int
+	}{
+		"Live":          {jwt.MapClaims{"sub": "karol", "jti": "live"}, http.StatusOK},
+		"Revoked":       {jwt.MapClaims{"sub": "karol", "jti": "signed-out"}, http.StatusUnauthorized},
+		"Lookup failed": {jwt.MapClaims{"sub": "karol", "jti": "broken"}, http.StatusUnauthorized},
+		"API key":       {jwt.MapClaims{"sub": "0b6f8a52", "api_key": "k1"}, http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/profile", nil)
+			req = req.WithContext(context.WithValue(req.Context(), "claims", tc.claims))
+			resp := httptest.NewRecorder()
+			middlewares.RejectRevoked(isRevoked)(handler).ServeHTTP(resp, req)
+			if resp.Code != tc.want {
+				t.Errorf("got %v, want %v", resp.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterSheds(t *testing.T) {
+	const limit = 3
+	limiter := middlewares.NewConcurrencyLimiter(limit, 2*time.Second, "/health")
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan int, limit)
+	for range limit {
+		go func() {
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("GET", "/slow", nil))
+			done <- resp.Code
+		}()
+		<-entered
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/browser", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the cap: got %d, want 503", resp.Code)
+	}
+	if got := resp.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After: got %q, want 2", got)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/health", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("health check while saturated: got %d, want 200", resp.Code)
+	}
+
+	if m := limiter.Metrics(); m.Limit != limit || m.Inflight != limit || m.Shed != 1 {
+		t.Errorf("metrics while saturated: got %+v", m)
+	}
+
+	close(release)
+	for range limit {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("admitted request: got %d, want 200", code)
+		}
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/browser", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("after draining: got %d, want 200", resp.Code)
+	}
+	if m := limiter.Metrics(); m.Inflight != 0 {
+		t.Errorf("inflight after draining: got %d, want 0", m.Inflight)
+	}
+}
+
+func TestRecoverPanickingHandler(t *testing.T) {
+	handler := middlewares.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var claims jwt.MapClaims
+		claims["sub"] = "nobody"
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "abc-123")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want %d", resp.Code, http.StatusInternalServerError)
+	}
+	if got := resp.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got content type %q, want application/json", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not json: %q", resp.Body.String())
+	}
+	want := map[string]string{"error": "internal failure", "request_id": "abc-123"}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("got body %v, want %v", body, want)
+	}
+}
+
+func TestRecoverAfterResponseStarted(t *testing.T) {
+	handler := middlewares.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("midway")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/browser", nil))
+
+	if resp.Code != http.StatusOK || resp.Body.String() != "partial" {
+		t.Errorf("started response was changed: %d %q", resp.Code, resp.Body.String())
+	}
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	jsonHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	htmlHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html><body>Email verified</body></html>"))
+	})
+	headers := middlewares.NewSecurityHeaders()
+
+	resp := httptest.NewRecorder()
+	headers.Middleware(jsonHandler).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/tags", nil))
+	want := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	}
+	for name, value := range want {
+		if got := resp.Header().Get(name); got != value {
+			t.Errorf("%s: got %q, want %q", name, got, value)
+		}
+	}
+	for _, name := range []string{"Strict-Transport-Security", "Content-Security-Policy"} {
+		if got := resp.Header().Get(name); got != "" {
+			t.Errorf("plain HTTP JSON response got %s: %q", name, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/verify-email", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	resp = httptest.NewRecorder()
+	headers.Middleware(htmlHandler).ServeHTTP(resp, req)
+	if got := resp.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("HTTPS response got HSTS %q", got)
+	}
+	if got := resp.Header().Get("Content-Security-Policy"); !strings.HasPrefix(got, "default-src 'none'") {
+		t.Errorf("HTML response got CSP %q", got)
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	headers := middlewares.NewSecurityHeaders()
+	headers.FrameOptions = ""
+	headers.StrictTransport = ""
+
+	req := httptest.NewRequest(http.MethodGet, "/tags", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	resp := httptest.NewRecorder()
+	headers.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(resp, req)
+
+	if _, ok := resp.Header()["X-Frame-Options"]; ok {
+		t.Error("disabled X-Frame-Options was sent")
+	}
+	if _, ok := resp.Header()["Strict-Transport-Security"]; ok {
+		t.Error("disabled HSTS was sent")
+	}
+	if resp.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("other headers should still be sent")
+	}
+}
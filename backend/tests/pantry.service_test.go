@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestNormalizeQuantity(t *testing.T) {
+	cases := []struct {
+		amount     int32
+		unit       string
+		wantAmount int64
+		wantUnit   string
+	}{
+		{2, "kg", 2000, "g"},
+		{150, "gr", 150, "g"},
+		{1, "l", 1000, "ml"},
+		{3, "SZT", 3, "szt"},
+		{2, "łyżka", 2, "łyżka"},
+	}
+	for _, c := range cases {
+		amount, unit := services.NormalizeQuantity(c.amount, c.unit)
+		if amount != c.wantAmount || unit != c.wantUnit {
+			t.Errorf("NormalizeQuantity(%d, %q) = %d %q, want %d %q", c.amount, c.unit, amount, unit, c.wantAmount, c.wantUnit)
+		}
+	}
+}
+
+func TestPantryGapPartialCoverage(t *testing.T) {
+	needed := []models.Ingredient{
+		{Name: "Mąka", Amount: 1, Unit: "kg"},
+		{Name: "Mleko", Amount: 500, Unit: "ml"},
+		{Name: "Jajka", Amount: 3, Unit: "szt"},
+		{Name: "Sól", Amount: 5, Unit: "gr"},
+		{Name: "Cukier", Amount: 50, Unit: "gr"},
+	}
+	pantry := []repository.ListPantryItemsRow{
+		{Name: "mąka", Amount: 400, Unit: "g"},
+		{Name: "Mleko", Amount: 1, Unit: "l"},
+		{Name: "Jajka", Amount: 2, Unit: "szt"},
+		{Name: "Sól", Amount: 1, Unit: "kg"},
+		// Pieces don't convert to grams, so this doesn't cover the recipe.
+		{Name: "Cukier", Amount: 2, Unit: "szt"},
+	}
+
+	got := services.PantryGap(needed, pantry)
+	want := []models.MissingIngredient{
+		{Name: "Mąka", Amount: 600, Unit: "g"},
+		{Name: "Jajka", Amount: 1, Unit: "szt"},
+		{Name: "Cukier", Amount: 50, Unit: "g"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPantryGapSharedStock(t *testing.T) {
+	needed := []models.Ingredient{
+		{Name: "Masło", Amount: 100, Unit: "gr"},
+		{Name: "Masło", Amount: 50, Unit: "gr"},
+	}
+	pantry := []repository.ListPantryItemsRow{{Name: "Masło", Amount: 120, Unit: "gr"}}
+
+	got := services.PantryGap(needed, pantry)
+	want := []models.MissingIngredient{{Name: "Masło", Amount: 30, Unit: "g"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPantryGapFullyCookable(t *testing.T) {
+	needed := []models.Ingredient{{Name: "Woda", Amount: 400, Unit: "ml"}}
+	pantry := []repository.ListPantryItemsRow{{Name: "Woda", Amount: 2, Unit: "l"}}
+
+	got := services.PantryGap(needed, pantry)
+	if got == nil || len(got) != 0 {
+		t.Errorf("got %+v, want an empty list", got)
+	}
+}
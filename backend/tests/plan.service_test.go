@@ -0,0 +1,306 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// planCandidates mixes carb-heavy and protein-heavy meals of similar calories,
+// so only the macro targets decide which ones get picked.
+var planCandidates = []models.PlanMeal{
+	{ID: 1, Name: "Pasta", Calories: 700, Protein: 20, Carbs: 130, Fat: 10},
+	{ID: 2, Name: "Racuchy", Calories: 650, Protein: 15, Carbs: 120, Fat: 12},
+	{ID: 3, Name: "Ryż z owocami", Calories: 600, Protein: 10, Carbs: 125, Fat: 6},
+	{ID: 4, Name: "Pierś z kurczaka", Calories: 650, Protein: 80, Carbs: 20, Fat: 28},
+	{ID: 5, Name: "Twaróg z jajkami", Calories: 600, Protein: 70, Carbs: 15, Fat: 28},
+	{ID: 6, Name: "Stek", Calories: 700, Protein: 75, Carbs: 10, Fat: 40},
+}
+
+func TestPlanMealsFollowsProteinTarget(t *testing.T) {
+	high := services.PlanMeals(planCandidates, models.MealPlanRequest{
+		Calories: 2000, Meals: 3, ProteinPercent: 40, CarbsPercent: 20, FatPercent: 40,
+	})
+	low := services.PlanMeals(planCandidates, models.MealPlanRequest{
+		Calories: 2000, Meals: 3, ProteinPercent: 10, CarbsPercent: 75, FatPercent: 15,
+	})
+
+	if len(high.Meals) != 3 || len(low.Meals) != 3 {
+		t.Fatalf("expected 3 meals, got %d and %d", len(high.Meals), len(low.Meals))
+	}
+	if high.Protein <= low.Protein {
+		t.Errorf("expected high-protein plan to have more protein, got %d vs %d", high.Protein, low.Protein)
+	}
+	if high.Split.ProteinPercent <= low.Split.ProteinPercent {
+		t.Errorf("expected higher protein split, got %.1f vs %.1f", high.Split.ProteinPercent, low.Split.ProteinPercent)
+	}
+}
+
+func TestPlanMealsCaloriesOnly(t *testing.T) {
+	plan := services.PlanMeals(planCandidates, models.MealPlanRequest{Calories: 1800, Meals: 3})
+	if plan.Calories < 1800 || plan.Calories > 1900 {
+		t.Errorf("expected calories close to 1800, got %d", plan.Calories)
+	}
+
+	seen := map[int32]bool{}
+	for _, m := range plan.Meals {
+		if seen[m.ID] {
+			t.Errorf("meal %d picked twice", m.ID)
+		}
+		seen[m.ID] = true
+	}
+}
+
+func TestPlanMealsFewCandidates(t *testing.T) {
+	plan := services.PlanMeals(planCandidates[:2], models.MealPlanRequest{Calories: 2000, Meals: 3})
+	if len(plan.Meals) != 2 {
+		t.Errorf("expected 2 meals, got %d", len(plan.Meals))
+	}
+}
+
+func TestMealPlanRequestMacroTargets(t *testing.T) {
+	req := models.MealPlanRequest{Calories: 2000, Protein: 150, CarbsPercent: 40, FatPercent: 30}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if req.Meals != models.DefaultPlanMeals {
+		t.Errorf("expected default meals, got %d", req.Meals)
+	}
+	protein, carbs, fat := req.MacroTargets()
+	if protein != 150 || carbs != 200 || int(fat) != 66 {
+		t.Errorf("unexpected targets %v %v %v", protein, carbs, fat)
+	}
+
+	bad := models.MealPlanRequest{Calories: 2000, ProteinPercent: 60, CarbsPercent: 60}
+	if bad.Validate() == nil {
+		t.Error("expected percentages above 100 to fail")
+	}
+}
+
+func TestPlanWeekProgress(t *testing.T) {
+	req := models.WeeklyPlanRequest{
+		MealPlanRequest: models.MealPlanRequest{Calories: 1300, Meals: 2},
+		Days:            3,
+	}
+	progress := make(chan models.PlanProgress, 3)
+
+	plan, err := services.PlanWeek(context.Background(), planCandidates, req, progress)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	close(progress)
+
+	var days []int32
+	for event := range progress {
+		if event.Total != 3 {
+			t.Errorf("got total %d, want 3", event.Total)
+		}
+		days = append(days, event.Day)
+	}
+	if !slices.Equal(days, []int32{1, 2, 3}) {
+		t.Errorf("got progress for days %v, want [1 2 3]", days)
+	}
+	if len(plan.Days) != 3 {
+		t.Fatalf("got %d days, want 3", len(plan.Days))
+	}
+
+	// Six candidates cover three days of two meals without repeats.
+	seen := map[int32]bool{}
+	for _, day := range plan.Days {
+		for _, meal := range day.Meals {
+			if seen[meal.ID] {
+				t.Errorf("meal %d repeated within the week", meal.ID)
+			}
+			seen[meal.ID] = true
+		}
+	}
+}
+
+func TestPlanNutritionSummary(t *testing.T) {
+	req := models.WeeklyPlanRequest{
+		MealPlanRequest: models.MealPlanRequest{Calories: 1300, Meals: 2},
+		Days:            3,
+	}
+	plan, err := services.PlanWeek(context.Background(), planCandidates, req, nil)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(plan.Daily) != len(plan.Days) {
+		t.Fatalf("got %d daily summaries for %d days", len(plan.Daily), len(plan.Days))
+	}
+
+	var total models.NutritionSummary
+	for i, day := range plan.Days {
+		var daily models.NutritionSummary
+		for _, meal := range day.Meals {
+			daily.Calories += meal.Calories
+			daily.Protein += meal.Protein
+			daily.Carbs += meal.Carbs
+			daily.Fat += meal.Fat
+		}
+		if plan.Daily[i] != daily {
+			t.Errorf("day %d: got %+v, want the sum of its meals %+v", i+1, plan.Daily[i], daily)
+		}
+		total = services.SumNutrition(total, daily)
+	}
+	if plan.Total != total || plan.Total.PartiallyEstimated {
+		t.Errorf("got total %+v, want %+v", plan.Total, total)
+	}
+}
+
+func TestMealsNutritionServingsAndUnknowns(t *testing.T) {
+	meals := []models.PlanMeal{
+		{ID: 1, Calories: 500, Protein: 30, Carbs: 50, Fat: 20, Servings: 2},
+		{ID: 2, Calories: 300, Protein: 10, Carbs: 40, Fat: 10},
+	}
+	want := models.NutritionSummary{Calories: 1300, Protein: 70, Carbs: 140, Fat: 50}
+	if got := services.MealsNutrition(meals); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	meals = append(meals, models.PlanMeal{ID: 3, Name: "Zupa dnia", NutritionUnknown: true})
+	want.PartiallyEstimated = true
+	if got := services.MealsNutrition(meals); got != want {
+		t.Errorf("with an unknown meal: got %+v, want %+v", got, want)
+	}
+
+	week := services.SumNutrition(want, models.NutritionSummary{Calories: 100})
+	if !week.PartiallyEstimated || week.Calories != 1400 {
+		t.Errorf("an estimated day should flag the total: %+v", week)
+	}
+}
+
+func TestPlanWeekCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := make(chan models.PlanProgress)
+	req := models.WeeklyPlanRequest{
+		MealPlanRequest: models.MealPlanRequest{Calories: 2000, Meals: 3},
+		Days:            7,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := services.PlanWeek(ctx, planCandidates, req, progress)
+		done <- err
+	}()
+
+	<-progress
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("generation didn't stop after cancel")
+	}
+}
+
+// fakeWeeklyPlanner emits one progress event per day without touching a database.
+type fakeWeeklyPlanner struct{}
+
+func (f *fakeWeeklyPlanner) GenerateMealPlan(ctx context.Context, username string, req models.MealPlanRequest) (models.MealPlan, error) {
+	return models.MealPlan{}, nil
+}
+
+func (f *fakeWeeklyPlanner) GenerateWeeklyPlan(ctx context.Context, username string, req models.WeeklyPlanRequest, progress chan<- models.PlanProgress) (models.WeeklyPlan, error) {
+	return services.PlanWeek(ctx, planCandidates, req, progress)
+}
+
+func (f *fakeWeeklyPlanner) RecommendCalorieTarget(ctx context.Context, username string, goal string) (int, error) {
+	return 2000, nil
+}
+
+func TestGenerateWeeklyPlanHandler(t *testing.T) {
+	handler := handlers.MealPlanHandler{MealPlanService: &fakeWeeklyPlanner{}}
+	body := `{"calories": 1300, "meals": 2, "days": 2}`
+
+	newRequest := func(accept string) *http.Request {
+		req := httptest.NewRequest("POST", "/plan/weekly", strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		return req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "karol"}))
+	}
+
+	resp := httptest.NewRecorder()
+	handler.GenerateWeeklyPlan(resp, newRequest("text/event-stream"))
+	if ct := resp.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got content type %q", ct)
+	}
+	stream := resp.Body.String()
+	if got := strings.Count(stream, "event: progress\n"); got != 2 {
+		t.Errorf("got %d progress events, want 2:\n%s", got, stream)
+	}
+	if !strings.Contains(stream, "event: plan\n") {
+		t.Errorf("missing final plan event:\n%s", stream)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.GenerateWeeklyPlan(resp, newRequest("application/json"))
+	var plan models.WeeklyPlan
+	if err := json.Unmarshal(resp.Body.Bytes(), &plan); err != nil || len(plan.Days) != 2 {
+		t.Errorf("sync response: got %d days, error %v", len(plan.Days), err)
+	}
+}
+
+func TestBMR(t *testing.T) {
+	// 10*80 + 6.25*180 - 5*30 + 5 = 1780
+	if bmr, err := services.BMR(80, 180, 30, "Mężczyzna"); err != nil || bmr != 1780 {
+		t.Errorf("male: got %v, %v want 1780", bmr, err)
+	}
+	// 10*60 + 6.25*165 - 5*25 - 161 = 1345.25
+	if bmr, err := services.BMR(60, 165, 25, "Kobieta"); err != nil || bmr != 1345.25 {
+		t.Errorf("female: got %v, %v want 1345.25", bmr, err)
+	}
+}
+
+func TestCalorieTarget(t *testing.T) {
+	cases := []struct {
+		goal string
+		want int
+	}{
+		// 1780 * 1.375 = 2447.5
+		{"", 2450},
+		{services.GoalMaintain, 2450},
+		{services.GoalLose, 1950},
+		{services.GoalGain, 2750},
+	}
+	for _, c := range cases {
+		got, err := services.CalorieTarget(80, 180, 30, "male", c.goal)
+		if err != nil || got != c.want {
+			t.Errorf("goal %q: got %d, %v want %d", c.goal, got, err, c.want)
+		}
+	}
+
+	if _, err := services.CalorieTarget(80, 180, 30, "male", "bulk"); !errors.Is(err, services.ErrValidation) {
+		t.Errorf("unknown goal: got %v", err)
+	}
+}
+
+func TestCalorieTargetIncompleteProfile(t *testing.T) {
+	profiles := []struct {
+		weight, height, age int32
+		sex                 string
+	}{
+		{0, 180, 30, "male"},
+		{80, 0, 30, "male"},
+		{80, 180, 0, "male"},
+		{80, 180, 30, "Nie chcę podawać"},
+	}
+	for _, p := range profiles {
+		if _, err := services.CalorieTarget(p.weight, p.height, p.age, p.sex, services.GoalMaintain); !errors.Is(err, services.ErrIncompleteProfile) {
+			t.Errorf("%+v: got %v, want ErrIncompleteProfile", p, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestRecipeCacheInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cache := services.NewRecipeCache(time.Hour)
+	cache.Put(ctx, repository.Recipe{ID: 7, Name: "Bigos"})
+
+	if recipe, ok := cache.Get(ctx, 7); !ok || recipe.Name != "Bigos" {
+		t.Fatalf("got %+v %v, want cached recipe", recipe, ok)
+	}
+
+	invalidator := services.LocalInvalidator{Cache: cache}
+	if err := invalidator.InvalidateRecipe(ctx, 7); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, ok := cache.Get(ctx, 7); ok {
+		t.Error("recipe still cached after invalidation")
+	}
+}
+
+func TestRecipeCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	cache := services.NewRecipeCache(0)
+	cache.Put(ctx, repository.Recipe{ID: 7})
+	if _, ok := cache.Get(ctx, 7); ok {
+		t.Error("expected nothing cached with a zero ttl")
+	}
+}
+
+func TestRecipeCacheSharedStore(t *testing.T) {
+	ctx := context.Background()
+	shared := services.NewMemoryCache()
+	// Two instances on one shared cache.
+	a, b := services.NewRecipeCache(time.Hour), services.NewRecipeCache(time.Hour)
+	a.Store, b.Store = shared.Store("recipes"), shared.Store("recipes")
+
+	a.Put(ctx, repository.Recipe{ID: 7, Name: "Bigos"})
+	if recipe, ok := b.Get(ctx, 7); !ok || recipe.Name != "Bigos" {
+		t.Fatalf("other instance got %+v %v, want the cached recipe", recipe, ok)
+	}
+	b.Invalidate(7)
+	if _, ok := a.Get(ctx, 7); ok {
+		t.Error("recipe still cached after the other instance invalidated it")
+	}
+}
+
+// secondTestConnection opens a connection of its own to the test database,
+// standing in for another instance.
+func secondTestConnection(t *testing.T) *pgx.Conn {
+	t.Helper()
+	testConnection(t)
+	conn, err := pgx.Connect(context.Background(), fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
+		os.Getenv("TEST_DB_USERNAME"),
+		os.Getenv("TEST_DB_PASSWORD"),
+		os.Getenv("TEST_DB_HOST"),
+		os.Getenv("TEST_DB_PORT"),
+		os.Getenv("TEST_DB_DATABASE"),
+	))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	return conn
+}
+
+// listenConnects hands ListenRecipeInvalidations its connections: first
+// each of conns, then new ones to the test database. Every connection handed
+// out is also sent on the returned channel.
+func listenConnects(conns ...*pgx.Conn) (func(ctx context.Context) (*pgx.Conn, error), <-chan *pgx.Conn) {
+	handed := make(chan *pgx.Conn, 8)
+	var mu sync.Mutex
+	return func(ctx context.Context) (*pgx.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var conn *pgx.Conn
+		if len(conns) > 0 {
+			conn, conns = conns[0], conns[1:]
+		} else {
+			var err error
+			if conn, err = pgx.Connect(ctx, server.TestDatabaseURL()); err != nil {
+				return nil, err
+			}
+		}
+		handed <- conn
+		return conn, nil
+	}, handed
+}
+
+// waitInvalidated waits for recipe id to drop out of cache.
+func waitInvalidated(t *testing.T, cache *services.RecipeCache, id int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := cache.Get(context.Background(), id); !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recipe %d wasn't invalidated", id)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRecipeInvalidationBroadcastIntegration(t *testing.T) {
+	conn := testConnection(t)
+	listenConn := secondTestConnection(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The other instance caches recipe 1 and listens for invalidations.
+	other := services.NewBaseFinderService(listenConn)
+	other.Cache = services.NewRecipeCache(time.Hour)
+	if _, err := other.GetRecipe(ctx, 1, "", 0); err != nil {
+		t.Fatalf("get recipe: %v", err)
+	}
+	if _, ok := other.Cache.Get(ctx, 1); !ok {
+		t.Fatal("recipe wasn't cached")
+	}
+
+	connect, _ := listenConnects(listenConn)
+	listening := make(chan struct{})
+	go func() {
+		services.ListenRecipeInvalidations(ctx, connect, other.Cache)
+		close(listening)
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	// This instance updates the recipe and broadcasts the change.
+	if _, err := conn.Exec(ctx, "UPDATE recipes SET name = name WHERE id = 1"); err != nil {
+		t.Fatalf("update recipe: %v", err)
+	}
+	invalidator := services.NotifyInvalidator{Repo: repository.New(conn)}
+	if err := invalidator.InvalidateRecipe(ctx, 1); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	waitInvalidated(t, other.Cache, 1)
+
+	cancel()
+	select {
+	case <-listening:
+	case <-time.After(5 * time.Second):
+		t.Error("listener didn't stop with its context")
+	}
+}
+
+func TestRecipeInvalidationListenerReconnectsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func(backoff time.Duration) { services.RecipeListenBackoff = backoff }(services.RecipeListenBackoff)
+	services.RecipeListenBackoff = 10 * time.Millisecond
+
+	cache := services.NewRecipeCache(time.Hour)
+	connect, handed := listenConnects()
+	go services.ListenRecipeInvalidations(ctx, connect, cache)
+	first := <-handed
+
+	// Whatever changed while the connection was down was missed, so nothing
+	// cached before it dropped survives the reconnect.
+	cache.Put(ctx, repository.Recipe{ID: 1, Name: "Bigos"})
+	cache.Put(ctx, repository.Recipe{ID: 2, Name: "Pierogi"})
+	if _, err := conn.Exec(ctx, "SELECT pg_terminate_backend($1)", first.PgConn().PID()); err != nil {
+		t.Fatalf("drop listener connection: %v", err)
+	}
+	second := <-handed
+	t.Cleanup(func() { second.Close(context.Background()) })
+	waitInvalidated(t, cache, 2)
+	if _, ok := cache.Get(ctx, 1); ok {
+		t.Error("cache wasn't cleared on reconnect")
+	}
+
+	// Invalidations arrive on the new connection, listening before the clear.
+	cache.Put(ctx, repository.Recipe{ID: 1, Name: "Bigos"})
+	invalidator := services.NotifyInvalidator{Repo: repository.New(conn)}
+	if err := invalidator.InvalidateRecipe(ctx, 1); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	waitInvalidated(t, cache, 1)
+}
+
+func TestRecipeInvalidationListenerRetriesConnect(t *testing.T) {
+	defer func(backoff time.Duration) { services.RecipeListenBackoff = backoff }(services.RecipeListenBackoff)
+	services.RecipeListenBackoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := make(chan struct{}, 16)
+	connect := func(ctx context.Context) (*pgx.Conn, error) {
+		attempts <- struct{}{}
+		return nil, errors.New("database down")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		services.ListenRecipeInvalidations(ctx, connect, services.NewRecipeCache(time.Hour))
+		close(stopped)
+	}()
+
+	for range 3 {
+		select {
+		case <-attempts:
+		case <-time.After(time.Second):
+			t.Fatal("listener stopped retrying")
+		}
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("listener didn't stop with its context")
+	}
+}
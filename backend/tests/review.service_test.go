@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestSortReviews(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	reviews := func() []repository.ListRecipeReviewsRow {
+		return []repository.ListRecipeReviewsRow{
+			{ID: 1, ReviewScore: 2, CreatedAt: day(1), Helpfulness: 3},
+			{ID: 2, ReviewScore: 5, CreatedAt: day(2), Helpfulness: 1},
+			{ID: 3, ReviewScore: 4, CreatedAt: day(3), Helpfulness: 3},
+			{ID: 4, ReviewScore: 1, CreatedAt: day(4), Helpfulness: -2},
+		}
+	}
+
+	cases := []struct {
+		tiebreak string
+		want     []int32
+	}{
+		{"newest", []int32{3, 1, 2, 4}},
+		{"oldest", []int32{1, 3, 2, 4}},
+		{"score", []int32{3, 1, 2, 4}},
+		{"unknown", []int32{3, 1, 2, 4}},
+	}
+	for _, c := range cases {
+		got := reviews()
+		services.SortReviews(got, c.tiebreak)
+		for i, id := range c.want {
+			if got[i].ID != id {
+				t.Errorf("%s: position %d got review %d, want %d", c.tiebreak, i, got[i].ID, id)
+			}
+		}
+	}
+}
+
+func TestVoteReviewIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseReviewService(conn)
+	ctx := context.Background()
+	author := createTestUser(t, conn, "reviewer", "Review1!")
+	voter := createTestUser(t, conn, "voter", "Review1!")
+
+	reviewID, err := service.AddReview(ctx, author, 1, &models.ReviewRequest{Score: 4, Comment: "good"})
+	if err != nil {
+		t.Fatalf("add review: %v", err)
+	}
+
+	votes := func() (int32, int32) {
+		t.Helper()
+		reviews, err := service.ListMealReviews(ctx, 1)
+		if err != nil {
+			t.Fatalf("list reviews: %v", err)
+		}
+		for _, review := range reviews {
+			if review.ID == reviewID {
+				return review.Upvotes, review.Downvotes
+			}
+		}
+		t.Fatalf("review %d not listed", reviewID)
+		return 0, 0
+	}
+
+	// Voting twice in the same direction still counts once.
+	for range 2 {
+		if err := service.VoteReview(ctx, voter, int64(reviewID), true); err != nil {
+			t.Fatalf("upvote: %v", err)
+		}
+	}
+	if up, down := votes(); up != 1 || down != 0 {
+		t.Errorf("after upvotes: got %d/%d, want 1/0", up, down)
+	}
+
+	// Changing the vote replaces it.
+	if err := service.VoteReview(ctx, voter, int64(reviewID), false); err != nil {
+		t.Fatalf("downvote: %v", err)
+	}
+	if up, down := votes(); up != 0 || down != 1 {
+		t.Errorf("after toggle: got %d/%d, want 0/1", up, down)
+	}
+
+	if err := service.VoteReview(ctx, author, int64(reviewID), true); err != services.ErrValidation {
+		t.Errorf("self vote: got %v, want %v", err, services.ErrValidation)
+	}
+	if err := service.VoteReview(ctx, voter, 1<<40, true); err != services.ErrValidation {
+		t.Errorf("out of range id: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestCommentAllowed(t *testing.T) {
+	blocked := services.ParseBlockedWords(" Spam, ,scam ")
+	if len(blocked) != 2 {
+		t.Fatalf("parsed %q, want two words", blocked)
+	}
+
+	cases := []struct {
+		comment string
+		want    bool
+	}{
+		{"Tasty and quick", true},
+		{"total SPAM, avoid", false},
+		{"scam!", false},
+		{"spammy but fine", true},
+		{"", true},
+	}
+	for _, c := range cases {
+		if got := services.CommentAllowed(c.comment, blocked); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.comment, got, c.want)
+		}
+	}
+	if !services.CommentAllowed("spam", nil) {
+		t.Error("nothing should be blocked without a word list")
+	}
+}
+
+func TestEditMealReviewIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseReviewService(conn)
+	service.BlockedWords = []string{"spam"}
+	ctx := context.Background()
+	author := createTestUser(t, conn, "editor", "Review1!")
+	other := createTestUser(t, conn, "intruder", "Review1!")
+
+	reviewID, err := service.AddReview(ctx, author, 1, &models.ReviewRequest{Score: 4, Comment: "first take"})
+	if err != nil {
+		t.Fatalf("add review: %v", err)
+	}
+
+	listed := func() repository.ListRecipeReviewsRow {
+		t.Helper()
+		reviews, err := service.ListMealReviews(ctx, 1)
+		if err != nil {
+			t.Fatalf("list reviews: %v", err)
+		}
+		for _, review := range reviews {
+			if review.ID == reviewID {
+				return review
+			}
+		}
+		t.Fatalf("review %d not listed", reviewID)
+		return repository.ListRecipeReviewsRow{}
+	}
+	if listed().EditedAt.Valid {
+		t.Error("new review marked as edited")
+	}
+
+	if err := service.EditMealReview(ctx, other, int64(reviewID), "hijacked"); err != services.ErrForbidden {
+		t.Errorf("edit by another user: got %v, want %v", err, services.ErrForbidden)
+	}
+	if err := service.EditMealReview(ctx, author, int64(reviewID), "now it's spam"); err != services.ErrValidation {
+		t.Errorf("blocked word: got %v, want %v", err, services.ErrValidation)
+	}
+	if err := service.EditMealReview(ctx, author, 1<<30, "missing"); err != services.ErrReviewNotFound {
+		t.Errorf("missing review: got %v, want %v", err, services.ErrReviewNotFound)
+	}
+
+	for _, body := range []string{"second take", "third take"} {
+		if err := service.EditMealReview(ctx, author, int64(reviewID), body); err != nil {
+			t.Fatalf("edit to %q: %v", body, err)
+		}
+	}
+
+	review := listed()
+	if review.Comment != "third take" || !review.EditedAt.Valid {
+		t.Errorf("after edits: comment %q, edited %v", review.Comment, review.EditedAt.Valid)
+	}
+
+	edits, err := service.ListReviewEdits(ctx, int64(reviewID))
+	if err != nil {
+		t.Fatalf("list edits: %v", err)
+	}
+	if len(edits) != 2 || edits[0].Comment != "first take" || edits[1].Comment != "second take" {
+		t.Fatalf("edits: got %+v, want the first and second take", edits)
+	}
+	if edits[0].WrittenAt.After(edits[1].WrittenAt) {
+		t.Errorf("first take written after the second: %v > %v", edits[0].WrittenAt, edits[1].WrittenAt)
+	}
+}
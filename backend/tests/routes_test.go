@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// getAs sends GET path with token as a Bearer token through handler and
+// returns the status.
+func getAs(t *testing.T, handler http.Handler, path string, token string) int {
+	t.Helper()
+	return sendAs(t, handler, http.MethodGet, path, "", token).Code
+}
+
+// sendAs sends body to path with token, if any, as a Bearer token through
+// handler.
+func sendAs(t *testing.T, handler http.Handler, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRoutesCreateRecipeIntegration(t *testing.T) {
+	conn := testConnection(t)
+	routes := server.SetupRoutes()
+	username := createTestUser(t, conn, "routerecipe", "RouteRecipe1!")
+	token := clientToken(t, username, models.ClientWeb)
+	body := `{"name":"` + username + ` pierogi","recipe":"-","time":30,"difficulty":2,"force":true}`
+
+	if rec := sendAs(t, routes, http.MethodPost, "/recipe", body, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec := sendAs(t, routes, http.MethodPost, "/recipe", body, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signed in: got %d %q, want %d", rec.Code, rec.Body.String(), http.StatusCreated)
+	}
+	var count int
+	if err := conn.QueryRow(context.Background(), "SELECT count(*) FROM recipes WHERE username = $1", username).Scan(&count); err != nil {
+		t.Fatalf("count recipes: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d recipes by the user, want 1", count)
+	}
+}
+
+func TestRoutesRejectRevokedSessionIntegration(t *testing.T) {
+	conn := testConnection(t)
+	routes := server.SetupRoutes()
+	users := services.NewBaseUserService(conn)
+	tokens := services.NewBaseTokenService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "routesess", "RouteSess1!")
+
+	login := func(client string) string {
+		token, err := users.LoginUser(ctx, &models.LoginUserRequest{
+			Login:    username,
+			Password: "RouteSess1!",
+			Client:   client,
+		})
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		return token
+	}
+	laptop := login(models.ClientWeb)
+	phone := login(models.ClientMobile)
+
+	if got := getAs(t, routes, "/profile", phone); got != http.StatusOK {
+		t.Fatalf("phone before revoke: got %d, want %d", got, http.StatusOK)
+	}
+	if err := tokens.RevokeSession(ctx, username, sessionID(t, phone)); err != nil {
+		t.Fatalf("revoke phone: %v", err)
+	}
+
+	if got := getAs(t, routes, "/profile", phone); got != http.StatusUnauthorized {
+		t.Errorf("revoked phone session: got %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := getAs(t, routes, "/profile", laptop); got != http.StatusOK {
+		t.Errorf("laptop session: got %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestRoutesRejectRevokedClientIntegration(t *testing.T) {
+	conn := testConnection(t)
+	routes := server.SetupRoutes()
+	tokens := services.NewBaseTokenService(conn)
+	tokens.Keys = testKeys()
+	ctx := context.Background()
+	username := createTestUser(t, conn, "routeclient", "RouteClient1!")
+
+	web := clientToken(t, username, models.ClientWeb)
+	otherWeb := clientToken(t, username, models.ClientWeb)
+	mobile := clientToken(t, username, models.ClientMobile)
+
+	if err := tokens.RevokeAllSessions(ctx, username, models.ClientMobile); err != nil {
+		t.Fatalf("revoke mobile: %v", err)
+	}
+	if got := getAs(t, routes, "/profile", mobile); got != http.StatusUnauthorized {
+		t.Errorf("revoked mobile token: got %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := getAs(t, routes, "/profile", web); got != http.StatusOK {
+		t.Errorf("web token after mobile revoke: got %d, want %d", got, http.StatusOK)
+	}
+
+	// Signing out puts the token on the denylist.
+	if err := tokens.RevokeToken(ctx, web); err != nil {
+		t.Fatalf("sign out web: %v", err)
+	}
+	if got := getAs(t, routes, "/profile", web); got != http.StatusUnauthorized {
+		t.Errorf("signed out web token: got %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := getAs(t, routes, "/profile", otherWeb); got != http.StatusOK {
+		t.Errorf("other web token after sign out: got %d, want %d", got, http.StatusOK)
+	}
+
+	// Changing the password revokes every client's tokens.
+	if err := tokens.RevokeAllSessions(ctx, username, ""); err != nil {
+		t.Fatalf("revoke all: %v", err)
+	}
+	if got := getAs(t, routes, "/profile", otherWeb); got != http.StatusUnauthorized {
+		t.Errorf("web token after revoking all: got %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestRoutesRejectDeletedUserIntegration(t *testing.T) {
+	conn := testConnection(t)
+	routes := server.SetupRoutes()
+	users := services.NewBaseUserService(conn)
+	username := createTestUser(t, conn, "routedeleted", "RouteDeleted1!")
+
+	claims, err := services.TokenClaims(username, "user", models.ClientWeb, false)
+	if err != nil {
+		t.Fatalf("claims: %v", err)
+	}
+	// Issued before the username subject was replaced with the user id.
+	claims["sub"] = username
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	current := clientToken(t, username, models.ClientWeb)
+
+	if got := getAs(t, routes, "/profile", legacy); got != http.StatusOK {
+		t.Fatalf("username subject before deletion: got %d, want %d", got, http.StatusOK)
+	}
+	if err := users.DeleteAccount(context.Background(), username); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	for name, token := range map[string]string{"username subject": legacy, "user id subject": current} {
+		if got := getAs(t, routes, "/profile", token); got != http.StatusUnauthorized {
+			t.Errorf("%s after deletion: got %d, want %d", name, got, http.StatusUnauthorized)
+		}
+	}
+}
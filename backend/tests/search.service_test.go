@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestNewSearchMatches(t *testing.T) {
+	checked := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	search := repository.SavedSearch{
+		ID:            1,
+		Params:        models.MealSearchRequest{Diet: []string{"Wegańska"}, Allergies: []string{"Orzechy"}, MaxTime: 30},
+		LastCheckedAt: checked,
+	}
+	type searchTag struct {
+		typeID int32
+		name   string
+	}
+	recipe := func(id int32, added time.Duration, minutes int32, tags ...searchTag) repository.ListRecipesCreatedBetweenRow {
+		row := repository.ListRecipesCreatedBetweenRow{ID: id, Time: minutes, Difficulty: 1, CreatedAt: checked.Add(added)}
+		for _, tag := range tags {
+			row.TagTypeIds = append(row.TagTypeIds, tag.typeID)
+			row.TagNames = append(row.TagNames, tag.name)
+		}
+		return row
+	}
+	vegan := searchTag{1, "Wegańska"}
+	nuts := searchTag{4, "Orzechy"}
+
+	recipes := []repository.ListRecipesCreatedBetweenRow{
+		recipe(1, time.Hour, 20, vegan),
+		recipe(2, time.Hour, 45, vegan),
+		recipe(3, time.Hour, 20),
+		recipe(4, time.Hour, 20, vegan, nuts),
+		recipe(5, -time.Hour, 20, vegan),
+		recipe(6, 2*time.Hour, 30, searchTag{2, "Polska"}, vegan),
+	}
+
+	got := services.NewSearchMatches(search, recipes)
+	if want := []int32{1, 6}; !slices.Equal(got, want) {
+		t.Errorf("got matches %v, want %v", got, want)
+	}
+}
+
+func TestSearchMatchesTagTypes(t *testing.T) {
+	// A diet tag named like the searched region doesn't count as the region.
+	recipe := repository.ListRecipesCreatedBetweenRow{
+		TagTypeIds: []int32{1},
+		TagNames:   []string{"Polska"},
+	}
+	if services.SearchMatches(&models.MealSearchRequest{Region: []string{"Polska"}}, recipe) {
+		t.Error("diet tag matched a region filter")
+	}
+	if !services.SearchMatches(&models.MealSearchRequest{}, recipe) {
+		t.Error("empty search should match every recipe")
+	}
+}
+
+func TestSaveSearchRequestValidate(t *testing.T) {
+	cases := []struct {
+		Name string
+		Req  models.SaveSearchRequest
+		OK   bool
+	}{
+		{"valid", models.SaveSearchRequest{Name: "Szybkie obiady", Search: models.MealSearchRequest{MaxTime: 30}}, true},
+		{"blank name", models.SaveSearchRequest{Name: "  "}, false},
+		{"min above max", models.SaveSearchRequest{Name: "x", Search: models.MealSearchRequest{MinTime: 40, MaxTime: 30}}, false},
+		{"negative bound", models.SaveSearchRequest{Name: "x", Search: models.MealSearchRequest{MinDifficulty: -1}}, false},
+	}
+	for _, c := range cases {
+		if err := c.Req.Validate(); (err == nil) != c.OK {
+			t.Errorf("%s: got error %v", c.Name, err)
+		}
+	}
+}
+
+func TestSearchAlertIntegration(t *testing.T) {
+	conn := testConnection(t)
+	searches := services.NewBaseSavedSearchService(conn)
+	job := services.NewSearchAlertJob(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "alert", "Alert1!")
+
+	searchID, err := searches.SaveSearch(ctx, username, &models.MealSearchRequest{MinTime: 777, MaxTime: 777}, "Długie gotowanie")
+	if err != nil {
+		t.Fatalf("save search: %v", err)
+	}
+
+	newRecipe := func(name string, minutes int32) int32 {
+		id, err := job.Repo.CreateRecipe(ctx, repository.CreateRecipeParams{
+			Name: name, Recipe: "-", Time: minutes, Difficulty: 1, Username: username, Servings: 1,
+		})
+		if err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+		return id
+	}
+	matching := newRecipe(username+" slow", 777)
+	other := newRecipe(username+" quick", 5)
+
+	if _, err := job.CheckSavedSearches(ctx); err != nil {
+		t.Fatalf("check saved searches: %v", err)
+	}
+
+	var alerted []int32
+	if err := conn.QueryRow(ctx, "SELECT COALESCE(array_agg(recipe_id), '{}')::int[] FROM search_alerts WHERE saved_search_id = $1", searchID).Scan(&alerted); err != nil {
+		t.Fatalf("read alerts: %v", err)
+	}
+	if !slices.Contains(alerted, matching) {
+		t.Errorf("no alert for matching recipe %d, got %v", matching, alerted)
+	}
+	if slices.Contains(alerted, other) {
+		t.Errorf("alert for non-matching recipe %d", other)
+	}
+
+	saved, err := searches.ListSavedSearches(ctx, username)
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("list saved searches: %v, %d searches", err, len(saved))
+	}
+	if saved[0].Params.MaxTime != 777 {
+		t.Errorf("saved params not kept: %+v", saved[0].Params)
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/server"
+)
+
+func secureSettings() server.SecuritySettings {
+	return server.SecuritySettings{
+		JWTKeys:         auth.KeySet{Signing: auth.Key{Secret: []byte(strings.Repeat("k", 32))}},
+		MinJWTKeyLength: 32,
+		BcryptCost:      12,
+		MinBcryptCost:   10,
+		DatabaseURL:     "postgres://app:secret@db:5432/meals?sslmode=verify-full",
+		CORSOrigin:      "https://meals.example.com",
+		CORSCredentials: true,
+	}
+}
+
+func TestCheckSecurity(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	cases := map[string]func(s *server.SecuritySettings){
+		"Short JWT key": func(s *server.SecuritySettings) { s.JWTKeys.Signing.Secret = []byte("short") },
+		"Short verifying key": func(s *server.SecuritySettings) {
+			s.JWTKeys.Verifying = []auth.Key{{ID: "old", Secret: []byte("short")}}
+		},
+		"Low bcrypt cost": func(s *server.SecuritySettings) { s.BcryptCost = 4 },
+		"Database sslmode": func(s *server.SecuritySettings) {
+			s.DatabaseURL = "postgres://app:secret@db:5432/meals?sslmode=disable"
+		},
+		"Wildcard CORS": func(s *server.SecuritySettings) { s.CORSOrigin = "*" },
+		"Unknown CAPTCHA provider": func(s *server.SecuritySettings) {
+			s.CaptchaEnabled, s.CaptchaProvider, s.CaptchaSecret = true, "hcatpcha", "secret"
+		},
+		"Empty CAPTCHA secret": func(s *server.SecuritySettings) {
+			s.CaptchaEnabled, s.CaptchaProvider = true, "recaptcha"
+		},
+	}
+	for name, misconfigure := range cases {
+		t.Run(name, func(t *testing.T) {
+			settings := secureSettings()
+			misconfigure(&settings)
+
+			settings.Production = true
+			if err := server.CheckSecurity(settings); err == nil {
+				t.Error("production started")
+			}
+
+			logs.Reset()
+			settings.Production = false
+			if err := server.CheckSecurity(settings); err != nil {
+				t.Errorf("development refused: %v", err)
+			}
+			if !strings.Contains(logs.String(), "security warning") {
+				t.Errorf("development logged %q, want a warning", logs.String())
+			}
+		})
+	}
+
+	settings := secureSettings()
+	settings.Production = true
+	if err := server.CheckSecurity(settings); err != nil {
+		t.Errorf("secure production refused: %v", err)
+	}
+	// Any origin is fine without credentials.
+	settings.CORSOrigin, settings.CORSCredentials = "*", false
+	if problems := server.SecurityProblems(settings); len(problems) != 0 {
+		t.Errorf("got %v for CORS without credentials", problems)
+	}
+	// A provider without a secret is fine while CAPTCHA is off.
+	settings.CaptchaProvider = "unknown"
+	if problems := server.SecurityProblems(settings); len(problems) != 0 {
+		t.Errorf("got %v with CAPTCHA off", problems)
+	}
+	settings.CaptchaEnabled, settings.CaptchaProvider, settings.CaptchaSecret = true, "hcaptcha", "secret"
+	if problems := server.SecurityProblems(settings); len(problems) != 0 {
+		t.Errorf("got %v for a configured CAPTCHA", problems)
+	}
+}
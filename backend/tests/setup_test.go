@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// testConnection returns the test database connection or skips the test
+// when no test database is configured.
+func testConnection(t *testing.T) *pgx.Conn {
+	t.Helper()
+	if os.Getenv("TEST_DB_HOST") == "" {
+		t.Skip("TEST_DB_HOST not set, skipping integration test")
+	}
+	return server.NewConnectionTest()
+}
+
+// createTestUser registers a user with a unique username and returns it.
+func createTestUser(t *testing.T, conn *pgx.Conn, prefix string, password string) string {
+	t.Helper()
+	username := fmt.Sprintf("%s%d", prefix, time.Now().UnixNano()%1e9)
+	service := services.NewBaseUserService(conn)
+
+	err := service.CreateUser(context.Background(), &models.CreateUserRequest{
+		Username:     username,
+		Passwdhash:   password,
+		Email:        username + "@example.com",
+		PhoneNumber:  "123456789",
+		Age:          30,
+		Sex:          "male",
+		TermsVersion: services.TermsVersion,
+	})
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+
+	return username
+}
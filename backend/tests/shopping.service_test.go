@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+func TestDisplayQuantity(t *testing.T) {
+	cases := []struct {
+		amount     int64
+		unit       string
+		wantAmount string
+		wantUnit   string
+	}{
+		{3, "g", "3", "g"},
+		{0, "g", "1", "g"},
+		{42, "g", "40", "g"},
+		{430, "g", "450", "g"},
+		{990, "g", "1", "kg"},
+		{1100, "g", "1", "kg"},
+		{1240, "g", "1.25", "kg"},
+		{473, "ml", "450", "ml"},
+		{1750, "ml", "1.75", "l"},
+		{97, "ml", "100", "ml"},
+		{3, "szt", "3", "szt"},
+		{2, "łyżka", "2", "łyżka"},
+	}
+	for _, c := range cases {
+		amount, unit := services.DisplayQuantity(c.amount, c.unit)
+		if amount != c.wantAmount || unit != c.wantUnit {
+			t.Errorf("DisplayQuantity(%d, %q) = %q %q, want %q %q", c.amount, c.unit, amount, unit, c.wantAmount, c.wantUnit)
+		}
+	}
+}
+
+func TestAggregateIngredients(t *testing.T) {
+	list := []models.Ingredient{
+		{Name: "Mąka", Amount: 1, Unit: "kg"},
+		{Name: "Mleko", Amount: 500, Unit: "ml"},
+		{Name: "mąka", Amount: 240, Unit: "gr"},
+		{Name: "Mleko", Amount: 1, Unit: "l"},
+		{Name: "Jajka", Amount: 3, Unit: "szt"},
+		{Name: "Sól", Amount: 0, Unit: "gr"},
+	}
+
+	want := []models.ShoppingItem{
+		{Name: "Jajka", Amount: 3, Unit: "szt", DisplayAmount: "3", DisplayUnit: "szt"},
+		{Name: "Mleko", Amount: 1500, Unit: "ml", DisplayAmount: "1.5", DisplayUnit: "l"},
+		{Name: "Mąka", Amount: 1240, Unit: "g", DisplayAmount: "1.25", DisplayUnit: "kg"},
+	}
+	if got := services.AggregateIngredients(list); !reflect.DeepEqual(got, want) {
+		t.Errorf("AggregateIngredients() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGroupByAisle(t *testing.T) {
+	// Three meals of one week; the onions and butter of each add up.
+	week := [][]models.Ingredient{
+		{{Name: "Cebula", Amount: 200, Unit: "g"}, {Name: "Masło", Amount: 50, Unit: "g"}, {Name: "Sól", Amount: 5, Unit: "g"}},
+		{{Name: "cebula ", Amount: 1, Unit: "kg"}, {Name: "Mleko", Amount: 500, Unit: "ml"}},
+		{{Name: "Masło", Amount: 100, Unit: "g"}, {Name: "Kasza jaglana", Amount: 200, Unit: "g"}},
+	}
+	var ingredients []models.Ingredient
+	for _, meal := range week {
+		ingredients = append(ingredients, meal...)
+	}
+
+	got := services.GroupByAisle(services.AggregateIngredients(ingredients), services.IngredientCategories)
+	want := []models.ShoppingAisle{
+		{Category: models.ShoppingCategoryProduce, Items: []models.ShoppingItem{
+			{Name: "Cebula", Amount: 1200, Unit: "g", DisplayAmount: "1.25", DisplayUnit: "kg"},
+		}},
+		{Category: models.ShoppingCategoryDairy, Items: []models.ShoppingItem{
+			{Name: "Masło", Amount: 150, Unit: "g", DisplayAmount: "150", DisplayUnit: "g"},
+			{Name: "Mleko", Amount: 500, Unit: "ml", DisplayAmount: "500", DisplayUnit: "ml"},
+		}},
+		{Category: models.ShoppingCategorySpices, Items: []models.ShoppingItem{
+			{Name: "Sól", Amount: 5, Unit: "g", DisplayAmount: "5", DisplayUnit: "g"},
+		}},
+		{Category: models.ShoppingCategoryOther, Items: []models.ShoppingItem{
+			{Name: "Kasza jaglana", Amount: 200, Unit: "g", DisplayAmount: "200", DisplayUnit: "g"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupByAisle() = %+v, want %+v", got, want)
+	}
+
+	// Aisles outside the known ones are shopped with the rest.
+	odd := services.GroupByAisle(want[0].Items, map[string]string{"cebula": "garden"})
+	if len(odd) != 1 || odd[0].Category != models.ShoppingCategoryOther {
+		t.Errorf("unknown aisle: got %+v", odd)
+	}
+}
+
+func TestPlannedServings(t *testing.T) {
+	household := int32(3)
+	cases := []struct {
+		meal      models.PlanMeal
+		household *int32
+		want      int32
+	}{
+		{models.PlanMeal{}, nil, 1},
+		{models.PlanMeal{Servings: 2}, nil, 2},
+		{models.PlanMeal{Servings: 2}, &household, 6},
+	}
+	for _, c := range cases {
+		if got := services.PlannedServings(c.meal, c.household); got != c.want {
+			t.Errorf("PlannedServings(%+v) = %d, want %d", c.meal, got, c.want)
+		}
+	}
+}
+
+func TestGenerateWeeklyShoppingListValidation(t *testing.T) {
+	shopping := services.NewBaseShoppingListService(nil)
+	plans := map[string]models.WeeklyPlan{
+		"Empty":        {},
+		"No meals":     {Days: []models.MealPlan{{}, {}}},
+		"Bad meal id":  {Days: []models.MealPlan{{Meals: []models.PlanMeal{{ID: 0}}}}},
+		"Bad servings": {Days: []models.MealPlan{{Meals: []models.PlanMeal{{ID: 1, Servings: -1}}}}},
+	}
+	for name, plan := range plans {
+		t.Run(name, func(t *testing.T) {
+			if _, err := shopping.GenerateWeeklyShoppingList(context.Background(), "user", plan); err != services.ErrValidation {
+				t.Errorf("got %v, want %v", err, services.ErrValidation)
+			}
+		})
+	}
+}
+
+func TestGenerateWeeklyShoppingListIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	shopping := services.NewBaseShoppingListService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "weekly", "Weekly1!")
+
+	createMeal := func(name string, ingredients ...models.Ingredient) int32 {
+		name = fmt.Sprintf("%s %d", name, time.Now().UnixNano()%1e9)
+		recipe := models.RecipeAdd{Name: name, Recipe: "-", Time: 20, Difficulty: 1, Servings: 2, Force: true,
+			Ingredients: models.IngredientsJson{Ingredients: ingredients}}
+		if err := finder.CreateRecipe(ctx, &recipe, username); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		var id int32
+		if err := conn.QueryRow(ctx, "SELECT id FROM recipes WHERE name = $1", name).Scan(&id); err != nil {
+			t.Fatalf("find %s: %v", name, err)
+		}
+		return id
+	}
+	soup := createMeal("Zupa cebulowa", models.Ingredient{Name: "Cebula", Amount: 400, Unit: "g"}, models.Ingredient{Name: "Masło", Amount: 40, Unit: "g"})
+	omelette := createMeal("Omlet", models.Ingredient{Name: "Jajko", Amount: 4, Unit: "szt"}, models.Ingredient{Name: "Masło", Amount: 20, Unit: "g"})
+
+	// Soup twice for one, an omelette for two; recipes are for two.
+	plan := models.WeeklyPlan{Days: []models.MealPlan{
+		{Meals: []models.PlanMeal{{ID: soup, Servings: 1}, {ID: omelette, Servings: 2}}},
+		{Meals: []models.PlanMeal{{ID: soup, Servings: 1}}},
+	}}
+	list, err := shopping.GenerateWeeklyShoppingList(ctx, username, plan)
+	if err != nil {
+		t.Fatalf("weekly list: %v", err)
+	}
+
+	totals := map[string]int64{}
+	aisles := map[string]string{}
+	for _, aisle := range list.Aisles {
+		for _, item := range aisle.Items {
+			totals[item.Name] = item.Amount
+			aisles[item.Name] = aisle.Category
+		}
+	}
+	wantTotals := map[string]int64{"Cebula": 400, "Masło": 60, "Jajko": 4}
+	if !reflect.DeepEqual(totals, wantTotals) {
+		t.Errorf("got totals %v, want %v", totals, wantTotals)
+	}
+	if aisles["Cebula"] != models.ShoppingCategoryProduce || aisles["Jajko"] != models.ShoppingCategoryDairy {
+		t.Errorf("got aisles %v", aisles)
+	}
+
+	missing := models.WeeklyPlan{Days: []models.MealPlan{{Meals: []models.PlanMeal{{ID: math.MaxInt32}}}}}
+	if _, err := shopping.GenerateWeeklyShoppingList(ctx, username, missing); err != services.ErrNoRecipesFound {
+		t.Errorf("missing meal: got %v, want %v", err, services.ErrNoRecipesFound)
+	}
+}
@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/server"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// fakeStreamer yields count meals, stopping early when yield fails.
+func fakeStreamer(count int) services.RecipesStreamer {
+	return func(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams, yield func(repository.FilterRecipesByTagNamesAndParamsRow) error) error {
+		for i := range count {
+			if err := yield(repository.FilterRecipesByTagNamesAndParamsRow{ID: int32(i + 1), Name: "meal"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// cancellingWriter cancels its context once it's written after lines.
+type cancellingWriter struct {
+	bytes.Buffer
+	after  int
+	lines  int
+	cancel context.CancelFunc
+}
+
+func (w *cancellingWriter) Write(p []byte) (int, error) {
+	w.lines++
+	if w.lines == w.after {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+// readNDJSON parses every line of body as a meal.
+func readNDJSON(t *testing.T, body string) []repository.FilterRecipesByTagNamesAndParamsRow {
+	t.Helper()
+	var meals []repository.FilterRecipesByTagNamesAndParamsRow
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var meal repository.FilterRecipesByTagNamesAndParamsRow
+		if err := json.Unmarshal(scanner.Bytes(), &meal); err != nil {
+			t.Fatalf("line %d isn't JSON: %q: %v", len(meals)+1, scanner.Text(), err)
+		}
+		meals = append(meals, meal)
+	}
+	return meals
+}
+
+func TestStreamRecipesWritesNDJSON(t *testing.T) {
+	var out bytes.Buffer
+	written, err := services.StreamRecipes(context.Background(), repository.FilterRecipesByTagNamesAndParamsParams{}, fakeStreamer(5), &out)
+	if err != nil || written != 5 {
+		t.Fatalf("got %d meals, error %v; want 5", written, err)
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("output %q doesn't end with a newline", out.String())
+	}
+	meals := readNDJSON(t, out.String())
+	if len(meals) != 5 {
+		t.Fatalf("got %d lines, want 5", len(meals))
+	}
+	for i, meal := range meals {
+		if meal.ID != int32(i+1) {
+			t.Errorf("line %d: got meal %d", i+1, meal.ID)
+		}
+	}
+}
+
+func TestStreamRecipesStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancellingWriter{after: 2, cancel: cancel}
+
+	written, err := services.StreamRecipes(ctx, repository.FilterRecipesByTagNamesAndParamsParams{}, fakeStreamer(100), out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if written != 2 {
+		t.Errorf("wrote %d meals, want 2", written)
+	}
+	// What was written before the cancel is still whole lines.
+	if meals := readNDJSON(t, out.String()); len(meals) != 2 {
+		t.Errorf("got %d lines, want 2", len(meals))
+	}
+}
+
+func TestStreamRecipesTimeoutBeforeFirstMeal(t *testing.T) {
+	// slowStreamer yields first meals right away, then waits for ctx.
+	slowStreamer := func(first int) services.RecipesStreamer {
+		return func(ctx context.Context, params repository.FilterRecipesByTagNamesAndParamsParams, yield func(repository.FilterRecipesByTagNamesAndParamsRow) error) error {
+			for i := range first {
+				if err := yield(repository.FilterRecipesByTagNamesAndParamsRow{ID: int32(i + 1)}); err != nil {
+					return err
+				}
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+	params := repository.FilterRecipesByTagNamesAndParamsParams{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if written, err := services.StreamRecipes(ctx, params, slowStreamer(0), &bytes.Buffer{}); err != services.ErrSearchTimeout || written != 0 {
+		t.Errorf("before the first meal: got %d meals, error %v; want %v", written, err, services.ErrSearchTimeout)
+	}
+	if got := handlers.StatusFromError(services.ErrSearchTimeout); got != http.StatusGatewayTimeout {
+		t.Errorf("got status %d, want %d", got, http.StatusGatewayTimeout)
+	}
+
+	// After it the stream just ends, keeping what was written.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if written, err := services.StreamRecipes(ctx, params, slowStreamer(1), &bytes.Buffer{}); !errors.Is(err, context.DeadlineExceeded) || written != 1 {
+		t.Errorf("after the first meal: got %d meals, error %v", written, err)
+	}
+}
+
+func TestSearchMealsStreamRejectsAvailability(t *testing.T) {
+	finder := services.NewBaseFinderService(nil)
+	params := models.RecipesFinderParams{Limit: 10, RankByAvailability: true}
+	if _, err := finder.SearchMealsStream(context.Background(), params, &bytes.Buffer{}); err != services.ErrValidation {
+		t.Errorf("got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestSearchMealsStreamIntegration(t *testing.T) {
+	conn := testConnection(t)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "stream", "Stream1!")
+
+	params := models.RecipesFinderParams{Username: username, Limit: 20}
+	recipes, err := finder.FindRecipe(ctx, params)
+	if err != nil {
+		t.Fatalf("find recipes: %v", err)
+	}
+
+	var out bytes.Buffer
+	written, err := finder.SearchMealsStream(ctx, params, &out)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	meals := readNDJSON(t, out.String())
+	if written != len(recipes) || len(meals) != len(recipes) {
+		t.Fatalf("streamed %d meals (%d lines), want %d", written, len(meals), len(recipes))
+	}
+	for i := range meals {
+		if meals[i].ID != recipes[i].ID {
+			t.Errorf("meal %d: got %d, want %d", i, meals[i].ID, recipes[i].ID)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	partial := &cancellingWriter{after: 1, cancel: cancel}
+	if len(recipes) > 1 {
+		written, err = finder.SearchMealsStream(ctx, params, partial)
+		if !errors.Is(err, context.Canceled) || written != 1 {
+			t.Errorf("cancelled stream: got %d meals, error %v", written, err)
+		}
+	}
+}
+
+func TestSearchMealsStreamOnOwnConnectionIntegration(t *testing.T) {
+	conn := testConnection(t)
+	ctx := context.Background()
+	streamConn, err := pgx.Connect(ctx, server.TestDatabaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	finder := services.NewBaseFinderService(conn)
+	finder.StreamPool = services.NewQueriesPool([]*pgx.Conn{streamConn})
+	finder.StreamPool.Connect = func(ctx context.Context) (*pgx.Conn, error) {
+		return pgx.Connect(ctx, server.TestDatabaseURL())
+	}
+	username := createTestUser(t, conn, "streamconn", "Stream1!")
+	params := models.RecipesFinderParams{Username: username, Limit: 20}
+
+	recipes, err := finder.FindRecipe(ctx, params)
+	if err != nil {
+		t.Fatalf("find recipes: %v", err)
+	}
+	if len(recipes) < 2 {
+		t.Skip("needs at least two recipes to cancel a stream midway")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	defer cancel()
+	partial := &cancellingWriter{after: 1, cancel: cancel}
+	if written, err := finder.SearchMealsStream(cancelled, params, partial); !errors.Is(err, context.Canceled) || written != 1 {
+		t.Fatalf("cancelled stream: got %d meals, error %v", written, err)
+	}
+
+	// Neither the request connection nor the next stream is left broken.
+	if _, err := finder.FindRecipe(ctx, params); err != nil {
+		t.Errorf("search on the request connection: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := finder.SearchMealsStream(ctx, params, &out); err != nil {
+		t.Errorf("stream after a cancelled one: %v", err)
+	}
+}
+
+func TestFindRecipesStreamsWithNDJSONAccept(t *testing.T) {
+	handler := handlers.FinderHandler{FinderService: &services.MockFinderService{}}
+	req := httptest.NewRequest(http.MethodGet, "/browser", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "user"}))
+	req.Header.Set("Accept", "application/x-ndjson")
+	res := httptest.NewRecorder()
+
+	handler.FindRecipes(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.Code, http.StatusOK)
+	}
+	if got := res.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("got content type %q", got)
+	}
+}
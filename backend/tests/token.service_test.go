@@ -0,0 +1,353 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/auth"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// testKeys holds only the key createTestToken signs with.
+func testKeys() *auth.KeyStore {
+	return auth.NewKeyStore(auth.KeySet{Signing: auth.Key{Secret: key}})
+}
+
+func TestIntrospectInvalidTokens(t *testing.T) {
+	service := services.BaseTokenService{Keys: testKeys()}
+	tokens := map[string]string{
+		"Expired":         createTestToken(true),
+		"Wrong signature": createTestToken(false) + "R",
+		"Garbage":         "not-a-token",
+	}
+
+	for name, token := range tokens {
+		t.Run(name, func(t *testing.T) {
+			got, err := service.Introspect(context.Background(), token)
+			if err != nil || got != (models.Introspection{}) {
+				t.Errorf("got %+v, %v, want inactive without error", got, err)
+			}
+		})
+	}
+}
+
+func TestIntrospectUsernameSubjectWhenRefused(t *testing.T) {
+	// Refused before anything's looked up, so no database is needed.
+	service := services.BaseTokenService{Keys: testKeys(), AcceptUsernameSubject: false}
+	token := createTestToken(false)
+
+	got, err := service.Introspect(context.Background(), token)
+	if err != nil || got != (models.Introspection{}) {
+		t.Errorf("got %+v, %v, want inactive without error", got, err)
+	}
+}
+
+func TestIntrospectUsernameSubjectIntegration(t *testing.T) {
+	conn := testConnection(t)
+	tokens := services.NewBaseTokenService(conn)
+	tokens.Keys = testKeys()
+	ctx := context.Background()
+	username := createTestUser(t, conn, "introsub", "IntroSub1!")
+
+	claims, err := services.TokenClaims(username, "user", models.ClientWeb, false)
+	if err != nil {
+		t.Fatalf("claims: %v", err)
+	}
+	claims["sub"] = username
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	for _, accept := range []bool{true, false} {
+		tokens.AcceptUsernameSubject = accept
+		got, err := tokens.Introspect(ctx, token)
+		if err != nil || got.Active != accept {
+			t.Errorf("accepting username subjects %v: got %+v, %v", accept, got, err)
+		}
+	}
+}
+
+// fakeIntrospector reports every token as active for user karol.
+type fakeIntrospector struct{}
+
+func (f *fakeIntrospector) Introspect(ctx context.Context, token string) (models.Introspection, error) {
+	return models.Introspection{Active: true, Sub: "karol", Typ: services.AccessTokenType}, nil
+}
+
+func (f *fakeIntrospector) RevokeToken(ctx context.Context, token string) error {
+	return nil
+}
+
+func (f *fakeIntrospector) RevokeAllSessions(ctx context.Context, username string, client string) error {
+	return nil
+}
+
+func (f *fakeIntrospector) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	return nil, nil
+}
+
+func (f *fakeIntrospector) RevokeSession(ctx context.Context, username string, sessionID string) error {
+	return nil
+}
+
+func TestIntrospectHandlerRequiresClient(t *testing.T) {
+	handler := handlers.TokenHandler{TokenService: &fakeIntrospector{}, ClientID: "planner", ClientSecret: "s3cret"}
+
+	introspect := func(id, secret string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {"abc"}}
+		req := httptest.NewRequest("POST", "/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if id != "" {
+			req.SetBasicAuth(id, secret)
+		}
+		resp := httptest.NewRecorder()
+		handler.Introspect(resp, req)
+		return resp
+	}
+
+	if resp := introspect("", ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("no credentials: got %d, want 401", resp.Code)
+	}
+	if resp := introspect("planner", "wrong"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: got %d, want 401", resp.Code)
+	}
+
+	resp := introspect("planner", "s3cret")
+	var got models.Introspection
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil || resp.Code != http.StatusOK || !got.Active {
+		t.Errorf("valid client: got %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestIntrospectIntegration(t *testing.T) {
+	conn := testConnection(t)
+	users := services.NewBaseUserService(conn)
+	tokens := services.NewBaseTokenService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "intro", "Introspect1!")
+
+	token, err := users.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Introspect1!"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	got, err := tokens.Introspect(ctx, token)
+	if err != nil || !got.Active || got.Role != "user" || got.Typ != services.AccessTokenType || got.Exp == 0 {
+		t.Fatalf("fresh token: got %+v, %v", got, err)
+	}
+
+	if err := tokens.RevokeToken(ctx, token); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if got, err := tokens.Introspect(ctx, token); err != nil || got.Active {
+		t.Errorf("revoked token: got %+v, %v, want inactive", got, err)
+	}
+}
+
+// clientToken signs a token for username issued to client a minute ago, so a
+// revocation made now always postdates it.
+func clientToken(t *testing.T, username string, client string) string {
+	claims, err := services.TokenClaims(username, "user", client, false)
+	if err != nil {
+		t.Fatalf("claims: %v", err)
+	}
+	if client == "" {
+		delete(claims, "client")
+	}
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func TestRevokeClientSessionsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	tokens := services.NewBaseTokenService(conn)
+	tokens.Keys = testKeys()
+	ctx := context.Background()
+	username := createTestUser(t, conn, "client", "ClientSess1!")
+
+	web := clientToken(t, username, models.ClientWeb)
+	mobile := clientToken(t, username, models.ClientMobile)
+	legacy := clientToken(t, username, "")
+
+	if err := tokens.RevokeAllSessions(ctx, username, "tv"); err != services.ErrValidation {
+		t.Errorf("unknown client: got %v, want %v", err, services.ErrValidation)
+	}
+
+	if err := tokens.RevokeAllSessions(ctx, username, models.ClientMobile); err != nil {
+		t.Fatalf("revoke mobile: %v", err)
+	}
+	if got, err := tokens.Introspect(ctx, mobile); err != nil || got.Active {
+		t.Errorf("mobile token: got %+v, %v, want inactive", got, err)
+	}
+	for name, token := range map[string]string{"web": web, "legacy": legacy} {
+		got, err := tokens.Introspect(ctx, token)
+		if err != nil || !got.Active || got.Client != models.ClientWeb {
+			t.Errorf("%s token: got %+v, %v, want active web token", name, got, err)
+		}
+	}
+
+	if err := tokens.RevokeAllSessions(ctx, username, ""); err != nil {
+		t.Fatalf("revoke all: %v", err)
+	}
+	if got, err := tokens.Introspect(ctx, web); err != nil || got.Active {
+		t.Errorf("web token after revoking all: got %+v, %v, want inactive", got, err)
+	}
+
+	// Rounding to the second could land after now and revoke the next
+	// second's tokens too; truncating never does.
+	var whole, past bool
+	if err := conn.QueryRow(ctx,
+		"SELECT tokens_revoked_at = date_trunc('second', tokens_revoked_at), tokens_revoked_at <= CURRENT_TIMESTAMP FROM users WHERE username = $1",
+		username).Scan(&whole, &past); err != nil {
+		t.Fatalf("read revocation time: %v", err)
+	}
+	if !whole || !past {
+		t.Errorf("revocation time: whole second %v, not in the future %v; want both", whole, past)
+	}
+}
+
+func sessionID(t *testing.T, token string) string {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	jti, _ := claims["jti"].(string)
+	return jti
+}
+
+func TestSessionsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	users := services.NewBaseUserService(conn)
+	tokens := services.NewBaseTokenService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "sess", "Sessions1!")
+	other := createTestUser(t, conn, "sessother", "Sessions1!")
+
+	login := func(login string, client string, userAgent string) string {
+		token, err := users.LoginUser(ctx, &models.LoginUserRequest{
+			Login:     login,
+			Password:  "Sessions1!",
+			Client:    client,
+			RemoteIP:  "203.0.113.7",
+			UserAgent: userAgent,
+		})
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		return token
+	}
+	laptop := login(username, models.ClientWeb, "Firefox on Linux")
+	phone := login(username, models.ClientMobile, "MealsFinder/2.1 Android")
+	login(other, models.ClientWeb, "Safari")
+
+	sessions, err := tokens.ListSessions(ctx, username)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("got sessions %+v, %v, want 2", sessions, err)
+	}
+	devices := map[string]string{}
+	for _, session := range sessions {
+		devices[session.ID] = session.Device
+		if session.IP != "203.0.113.7" || session.CreatedAt.IsZero() || session.LastUsedAt.IsZero() || !session.ExpiresAt.After(session.CreatedAt) {
+			t.Errorf("got session %+v", session)
+		}
+	}
+	if devices[sessionID(t, laptop)] != "Firefox on Linux" || devices[sessionID(t, phone)] != "MealsFinder/2.1 Android" {
+		t.Errorf("got devices %v", devices)
+	}
+
+	// Another user can't revoke the session, or tell it exists.
+	if err := tokens.RevokeSession(ctx, other, sessionID(t, phone)); err != services.ErrSessionNotFound {
+		t.Errorf("revoke as other user: got %v, want %v", err, services.ErrSessionNotFound)
+	}
+	if got, _ := tokens.Introspect(ctx, phone); !got.Active {
+		t.Error("phone token inactive after another user's revoke")
+	}
+
+	if err := tokens.RevokeSession(ctx, username, sessionID(t, phone)); err != nil {
+		t.Fatalf("revoke phone: %v", err)
+	}
+	if got, err := tokens.Introspect(ctx, phone); err != nil || got.Active {
+		t.Errorf("phone token: got %+v, %v, want inactive", got, err)
+	}
+	if got, err := tokens.Introspect(ctx, laptop); err != nil || !got.Active {
+		t.Errorf("laptop token: got %+v, %v, want active", got, err)
+	}
+	sessions, err = tokens.ListSessions(ctx, username)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != sessionID(t, laptop) {
+		t.Errorf("after revoke got %+v, %v, want only the laptop", sessions, err)
+	}
+	if err := tokens.RevokeSession(ctx, username, sessionID(t, phone)); err != services.ErrSessionNotFound {
+		t.Errorf("revoke twice: got %v, want %v", err, services.ErrSessionNotFound)
+	}
+
+	if err := tokens.TouchSession(ctx, sessionID(t, laptop)); err != nil {
+		t.Errorf("touch: %v", err)
+	}
+}
+
+// fakeSessions serves karol's sessions; revoking any other user's session
+// fails as a missing one.
+type fakeSessions struct {
+	fakeIntrospector
+	revoked []string
+}
+
+func (f *fakeSessions) ListSessions(ctx context.Context, username string) ([]models.Session, error) {
+	return []models.Session{{ID: "a1"}, {ID: "b2"}}, nil
+}
+
+func (f *fakeSessions) RevokeSession(ctx context.Context, username string, sessionID string) error {
+	if username != "karol" {
+		return services.ErrSessionNotFound
+	}
+	f.revoked = append(f.revoked, sessionID)
+	return nil
+}
+
+func TestSessionHandlers(t *testing.T) {
+	sessions := &fakeSessions{}
+	handler := handlers.UserHandler{UserService: &services.MockUserService{}, TokenService: sessions}
+	withClaims := func(req *http.Request, sub string) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": sub, "jti": "b2"}))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ListSessions(rec, withClaims(httptest.NewRequest(http.MethodGet, "/user/sessions", nil), "karol"))
+	var listed []models.Session
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed) != 2 {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if listed[0].Current || !listed[1].Current {
+		t.Errorf("got %+v, want only b2 current", listed)
+	}
+
+	revoke := func(sub string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/a1", nil)
+		req.SetPathValue("id", "a1")
+		rec := httptest.NewRecorder()
+		handler.RevokeSession(rec, withClaims(req, sub))
+		return rec.Code
+	}
+	if code := revoke("mallory"); code != http.StatusNotFound {
+		t.Errorf("other user got %d, want %d", code, http.StatusNotFound)
+	}
+	if code := revoke("karol"); code != http.StatusNoContent || len(sessions.revoked) != 1 {
+		t.Errorf("owner got %d, revoked %v", code, sessions.revoked)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/miloszbo/meals-finder/internal/middlewares"
+	"github.com/miloszbo/meals-finder/internal/server"
+)
+
+func TestSlowQueryTracer(t *testing.T) {
+	var logged bytes.Buffer
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracer := &server.SlowQueryTracer{
+		Threshold: 200 * time.Millisecond,
+		Logger:    log.New(&logged, "", 0),
+		Now:       func() time.Time { return now },
+	}
+
+	// The request id comes from the request, as CorrelationID puts it in ctx.
+	var ctx context.Context
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "req-42")
+	middlewares.CorrelationID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	query := pgx.TraceQueryStartData{
+		SQL:  "-- name: GetUserSettings :one\nSELECT email FROM users WHERE username = $1",
+		Args: []any{"alice@example.com"},
+	}
+	run := func(took time.Duration) string {
+		logged.Reset()
+		queryCtx := tracer.TraceQueryStart(ctx, nil, query)
+		now = now.Add(took)
+		tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{})
+		return logged.String()
+	}
+
+	if out := run(50 * time.Millisecond); out != "" {
+		t.Errorf("fast query logged %q", out)
+	}
+
+	out := run(350 * time.Millisecond)
+	for _, want := range []string{"WARN", "GetUserSettings", "350ms", "req-42"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("slow query log %q is missing %q", out, want)
+		}
+	}
+	for _, secret := range []string{"alice@example.com", "SELECT"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("slow query log %q leaks %q", out, secret)
+		}
+	}
+
+	tracer.Threshold = 0
+	if out := run(time.Hour); out != "" {
+		t.Errorf("disabled tracer logged %q", out)
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+)
+
+// fakeObjectStore serves images from memory; other URLs are missing.
+type fakeObjectStore map[string][]byte
+
+func (s fakeObjectStore) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	data, ok := s[url]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func strPtr(v string) *string { return &v }
+
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	entries := make(map[string][]byte)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		entries[file.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	return entries
+}
+
+func TestWriteUserArchive(t *testing.T) {
+	store := fakeObjectStore{
+		"https://cdn.example.com/meals/1.JPG": []byte("jpeg bytes"),
+		"https://cdn.example.com/meals/3":     []byte("bytes without extension"),
+		"https://cdn.example.com/meals/4.png": bytes.Repeat([]byte{1}, 100),
+	}
+	export := services.UserExport{
+		Account: repository.GetUserDataRow{Username: "karol"},
+		Recipes: []repository.Recipe{
+			{ID: 1, Name: "Zupa", ImageUrl: strPtr("https://cdn.example.com/meals/1.JPG")},
+			{ID: 2, Name: "Bez zdjęcia"},
+			{ID: 3, Name: "Sałatka", ImageUrl: strPtr("https://cdn.example.com/meals/3")},
+			{ID: 4, Name: "Za duże", ImageUrl: strPtr("https://cdn.example.com/meals/4.png")},
+			{ID: 5, Name: "Zgubione", ImageUrl: strPtr("https://cdn.example.com/meals/5.png")},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := services.WriteUserArchive(context.Background(), &out, export, store, 50); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	entries := readArchive(t, out.Bytes())
+
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	want := []string{"export.json", "images/missing.txt", "images/recipe-1.jpg", "images/recipe-3"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("got entries %v, want %v", names, want)
+	}
+
+	var decoded services.UserExport
+	if err := json.Unmarshal(entries["export.json"], &decoded); err != nil {
+		t.Fatalf("decode export.json: %v", err)
+	}
+	if decoded.Account.Username != "karol" || len(decoded.Recipes) != 5 {
+		t.Errorf("got export %+v", decoded)
+	}
+	if string(entries["images/recipe-1.jpg"]) != "jpeg bytes" {
+		t.Errorf("got image %q", entries["images/recipe-1.jpg"])
+	}
+
+	missing := string(entries["images/missing.txt"])
+	if !strings.Contains(missing, "recipe 4") || !strings.Contains(missing, "recipe 5") || strings.Contains(missing, "recipe 2") {
+		t.Errorf("got missing note %q", missing)
+	}
+}
+
+func TestWriteUserArchiveWithoutImages(t *testing.T) {
+	var out bytes.Buffer
+	export := services.UserExport{Account: repository.GetUserDataRow{Username: "karol"}}
+	if err := services.WriteUserArchive(context.Background(), &out, export, fakeObjectStore{}, 50); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	if entries := readArchive(t, out.Bytes()); len(entries) != 1 || entries["export.json"] == nil {
+		t.Errorf("got entries %v, want only export.json", entries)
+	}
+}
+
+func TestWriteUserArchiveSkipsInternalImages(t *testing.T) {
+	hits := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, "secret")
+	}))
+	defer internal.Close()
+	// Even a storage URL configured on an internal address isn't fetched.
+	images := &services.HTTPImageSource{
+		Client:  services.NewImageClient(time.Second),
+		Allowed: services.ParseImageStorageURLs("https://cdn.example.com/meals/," + internal.URL + "/meals/"),
+	}
+	export := services.UserExport{
+		Account: repository.GetUserDataRow{Username: "karol"},
+		Recipes: []repository.Recipe{
+			{ID: 1, Name: "Metadane", ImageUrl: strPtr("http://169.254.169.254/latest/meta-data/")},
+			{ID: 2, Name: "Wewnętrzne", ImageUrl: strPtr(internal.URL + "/meals/2.png")},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := services.WriteUserArchive(context.Background(), &out, export, images, 50); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	entries := readArchive(t, out.Bytes())
+
+	if len(entries) != 2 || entries["images/missing.txt"] == nil {
+		t.Fatalf("got entries %v, want export.json and images/missing.txt", entries)
+	}
+	missing := string(entries["images/missing.txt"])
+	if !strings.Contains(missing, "recipe 1") || !strings.Contains(missing, "recipe 2") {
+		t.Errorf("got missing note %q", missing)
+	}
+	if hits != 0 {
+		t.Errorf("internal server got %d requests, want none", hits)
+	}
+}
+
+func TestExportArchiveHandler(t *testing.T) {
+	handler := handlers.UserHandler{UserService: &services.MockUserService{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/export/me", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "user"}))
+	rec := httptest.NewRecorder()
+	handler.ExportArchive(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if entries := readArchive(t, rec.Body.Bytes()); entries["export.json"] == nil {
+		t.Errorf("archive has no export.json")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ExportArchive(rec, httptest.NewRequest(http.MethodGet, "/export/me", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without claims got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
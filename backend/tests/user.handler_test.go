@@ -2,14 +2,16 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
 	repository "github.com/miloszbo/meals-finder/internal/repositories"
-	"github.com/miloszbo/meals-finder/internal/server"
 	"github.com/miloszbo/meals-finder/internal/services"
 )
 
@@ -56,6 +58,76 @@ func TestLoginUserMock(t *testing.T) {
 	}
 }
 
+func TestLoginUserClientHeader(t *testing.T) {
+	tests := []struct {
+		Client string
+		Want   int
+		MaxAge int
+	}{
+		{"", http.StatusOK, int(services.WebSessionTTL.Seconds())},
+		{models.ClientMobile, http.StatusOK, int(services.MobileSessionTTL.Seconds())},
+		{models.ClientAPI, http.StatusOK, int(services.APISessionTTL.Seconds())},
+		{"tv", http.StatusBadRequest, 0},
+	}
+
+	handler := handlers.UserHandler{
+		UserService: &services.MockUserService{},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Client, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBufferString(`{"login":"tomas", "password":"DSA43fFDD"}`))
+			if tt.Client != "" {
+				req.Header.Set(handlers.ClientHeader, tt.Client)
+			}
+			resp := httptest.NewRecorder()
+			handler.LoginUser(resp, req)
+
+			if resp.Code != tt.Want {
+				t.Fatalf("got %v, want %v", resp.Code, tt.Want)
+			}
+			cookies := resp.Result().Cookies()
+			if tt.Want == http.StatusOK && (len(cookies) != 1 || cookies[0].MaxAge != tt.MaxAge) {
+				t.Errorf("got cookies %v, want max age %d", cookies, tt.MaxAge)
+			}
+		})
+	}
+}
+
+// failingLogin rejects every login the way BaseUserService would.
+type failingLogin struct {
+	services.MockUserService
+	reason   error
+	detailed bool
+}
+
+func (f *failingLogin) LoginUser(ctx context.Context, loginData *models.LoginUserRequest) (string, error) {
+	return "", services.LoginFailure(f.reason, f.detailed)
+}
+
+func TestLoginUserGenericResponse(t *testing.T) {
+	want := services.ErrUnauthorizedUser.Error() + "\n"
+	for _, detailed := range []bool{false, true} {
+		for _, reason := range []error{services.ErrUserNotFound, services.ErrWrongPassword} {
+			t.Run(fmt.Sprintf("detailed=%v/%v", detailed, reason), func(t *testing.T) {
+				handler := handlers.UserHandler{
+					UserService: &failingLogin{reason: reason, detailed: detailed},
+				}
+				req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBufferString(`{"login":"tomas", "password":"DSA43fFDD"}`))
+				resp := httptest.NewRecorder()
+				handler.LoginUser(resp, req)
+
+				if resp.Code != http.StatusUnauthorized {
+					t.Errorf("got %v, want %v", resp.Code, http.StatusUnauthorized)
+				}
+				if resp.Body.String() != want {
+					t.Errorf("got body %q, want %q", resp.Body.String(), want)
+				}
+			})
+		}
+	}
+}
+
 func TestLoginUserIntegration(t *testing.T) {
 	var tests []LoginTestStruct = []LoginTestStruct{
 		{"No json pass", "", http.StatusBadRequest},
@@ -67,10 +139,11 @@ func TestLoginUserIntegration(t *testing.T) {
 		{"Pass login and empty password", `{"login":"eminem","password":""}`, http.StatusBadRequest},
 	}
 
+	conn := testConnection(t)
 	handler := handlers.UserHandler{
 		UserService: &services.BaseUserService{
-			DbConn: server.NewConnectionTest(),
-			Repo:   repository.New(server.NewConnectionTest()),
+			DbConn: conn,
+			Repo:   repository.New(conn),
 		},
 	}
 
@@ -95,3 +168,35 @@ func TestLoginUserIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUserSettingsRejectsImmutableFields(t *testing.T) {
+	tests := []struct {
+		Name string
+		Body string
+		Want int
+	}{
+		{"Mutable only", `{"name":"Tomas","age":-1,"weight":-1,"height":-1,"bmi":-1}`, http.StatusOK},
+		{"Role", `{"name":"Tomas","role":"admin"}`, http.StatusBadRequest},
+		{"Verified", `{"verified":true}`, http.StatusBadRequest},
+		{"Email verified", `{"email_verified":true}`, http.StatusBadRequest},
+		{"Username", `{"username":"root"}`, http.StatusBadRequest},
+		{"Differently cased", `{"Role":"admin"}`, http.StatusBadRequest},
+	}
+
+	handler := handlers.UserHandler{
+		UserService: &services.MockUserService{},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/user/settings", bytes.NewBufferString(tt.Body))
+			req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": "tomas"}))
+			resp := httptest.NewRecorder()
+			handler.UpdateUserSettings(resp, req)
+
+			if resp.Code != tt.Want {
+				t.Errorf("got %v, want %v: %s", resp.Code, tt.Want, resp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,1093 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miloszbo/meals-finder/internal/handlers"
+	"github.com/miloszbo/meals-finder/internal/models"
+	repository "github.com/miloszbo/meals-finder/internal/repositories"
+	"github.com/miloszbo/meals-finder/internal/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordInHistory(t *testing.T) {
+	previous, _ := bcrypt.GenerateFromPassword([]byte("Previous1!"), bcrypt.MinCost)
+	older, _ := bcrypt.GenerateFromPassword([]byte("Older1!"), bcrypt.MinCost)
+	history := []string{string(previous), string(older)}
+
+	if !services.PasswordInHistory(history, "Previous1!") {
+		t.Errorf("previous password should be found in history")
+	}
+	if !services.PasswordInHistory(history, "Older1!") {
+		t.Errorf("older password should be found in history")
+	}
+	if services.PasswordInHistory(history, "Fresh1!") {
+		t.Errorf("fresh password should not be found in history")
+	}
+}
+
+func TestChangePasswordIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "pwd", "First1!")
+
+	if err := service.ChangePassword(ctx, username, &models.ChangePasswordRequest{OldPassword: "First1!", NewPassword: "Second1!"}); err != nil {
+		t.Fatalf("change to fresh password: got %v, want nil", err)
+	}
+
+	err := service.ChangePassword(ctx, username, &models.ChangePasswordRequest{OldPassword: "Second1!", NewPassword: "First1!"})
+	if err != services.ErrPasswordReused {
+		t.Errorf("reuse previous password: got %v, want %v", err, services.ErrPasswordReused)
+	}
+
+	if err := service.ChangePassword(ctx, username, &models.ChangePasswordRequest{OldPassword: "Second1!", NewPassword: "Third1!"}); err != nil {
+		t.Errorf("change to fresh password: got %v, want nil", err)
+	}
+}
+
+func TestUpdateUserSettingsValidate(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Input   models.UpdateUserSettingsRequest
+		WantErr bool
+	}{
+		{"No timezone and locale", models.UpdateUserSettingsRequest{}, false},
+		{"Valid timezone and locale", models.UpdateUserSettingsRequest{Timezone: "Europe/Warsaw", Locale: "pl-PL"}, false},
+		{"Invalid timezone", models.UpdateUserSettingsRequest{Timezone: "Mars/Olympus"}, true},
+		{"Local timezone", models.UpdateUserSettingsRequest{Timezone: "Local"}, true},
+		{"Invalid locale", models.UpdateUserSettingsRequest{Locale: "not a locale"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if err := tt.Input.Validate(); (err != nil) != tt.WantErr {
+				t.Errorf("got %v, want error %v", err, tt.WantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateUserSettingsImmutableFields(t *testing.T) {
+	for _, field := range models.ImmutableSettingsFields {
+		var parsed models.UpdateUserSettingsRequest
+		if err := json.Unmarshal([]byte(`{"name":"Tomas","`+field+`":true}`), &parsed); err != nil {
+			t.Fatalf("%s: unmarshal: %v", field, err)
+		}
+		if parsed.Name != "Tomas" {
+			t.Errorf("%s: got name %q, want the mutable fields still read", field, parsed.Name)
+		}
+		if err := parsed.Validate(); err == nil {
+			t.Errorf("%s: got no error", field)
+		}
+		users := services.NewBaseUserService(nil)
+		if err := users.UpdateUserSettings(context.Background(), &parsed, "tomas"); err != services.ErrValidation {
+			t.Errorf("%s: service got %v, want %v", field, err, services.ErrValidation)
+		}
+	}
+
+	var req models.UpdateUserSettingsRequest
+	if err := json.Unmarshal([]byte(`{"name":"Tomas","timezone":"Europe/Warsaw"}`), &req); err != nil || req.Validate() != nil {
+		t.Errorf("mutable fields only: got %v, %v", err, req.Validate())
+	}
+}
+
+func TestPatchedBMI(t *testing.T) {
+	unchanged := models.UpdateUserSettingsRequest{Age: -1, Weight: -1, Height: -1, Bmi: -1}
+	tests := []struct {
+		Name         string
+		Weight       int32
+		Height       int32
+		Bmi          int32
+		StoredWeight int32
+		StoredHeight int32
+		Want         int32
+	}{
+		{"Only weight uses stored height", 90, -1, -1, 80, 180, 28},
+		{"Only height uses stored weight", -1, 160, -1, 64, 180, 25},
+		{"Both patched", 80, 180, -1, 0, 0, 25},
+		{"Recomputed over sent bmi", 90, -1, 40, 80, 180, 28},
+		{"No stored height", 90, -1, -1, 80, 0, -1},
+		{"No measurement change keeps sent bmi", -1, -1, 22, 80, 180, 22},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := unchanged
+			req.Weight, req.Height, req.Bmi = tt.Weight, tt.Height, tt.Bmi
+			if got := services.PatchedBMI(&req, tt.StoredWeight, tt.StoredHeight); got != tt.Want {
+				t.Errorf("got %d, want %d", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestPatchWeightRecomputesBMIIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "bmi", "Bmi1!")
+
+	patch := func(weight, height int32) {
+		t.Helper()
+		req := models.UpdateUserSettingsRequest{Age: -1, Weight: weight, Height: height, Bmi: -1}
+		if err := service.UpdateUserSettings(ctx, &req, username); err != nil {
+			t.Fatalf("update settings: %v", err)
+		}
+	}
+
+	patch(90, -1)
+	if user, _ := service.GetUser(ctx, username); user.Bmi != 0 {
+		t.Errorf("bmi without a stored height: got %d, want 0", user.Bmi)
+	}
+
+	patch(80, 180)
+	patch(90, -1)
+	user, err := service.GetUser(ctx, username)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.Height != 180 || user.Weight != 90 || user.Bmi != 28 {
+		t.Errorf("got weight %d, height %d, bmi %d; want 90, 180, 28", user.Weight, user.Height, user.Bmi)
+	}
+}
+
+func TestGetUsersRowsContactFields(t *testing.T) {
+	contactFields := []string{"Email", "PhoneNumber"}
+
+	lean := reflect.TypeOf(repository.GetUsersRow{})
+	detailed := reflect.TypeOf(repository.GetUsersDetailedRow{})
+
+	for _, field := range contactFields {
+		if _, ok := lean.FieldByName(field); ok {
+			t.Errorf("GetUsersRow must not contain %s", field)
+		}
+		if _, ok := detailed.FieldByName(field); !ok {
+			t.Errorf("GetUsersDetailedRow should contain %s", field)
+		}
+	}
+}
+
+func TestChangeCooldownRemaining(t *testing.T) {
+	cooldown := 7 * 24 * time.Hour
+	changed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := services.ChangeCooldownRemaining(time.Time{}, changed, cooldown); got != 0 {
+		t.Errorf("never changed: got %v, want 0", got)
+	}
+	if got := services.ChangeCooldownRemaining(changed, changed.Add(24*time.Hour), cooldown); got != 6*24*time.Hour {
+		t.Errorf("within window: got %v, want %v", got, 6*24*time.Hour)
+	}
+	if got := services.ChangeCooldownRemaining(changed, changed.Add(cooldown+time.Minute), cooldown); got != 0 {
+		t.Errorf("after window: got %v, want 0", got)
+	}
+}
+
+func TestChangeTooSoonError(t *testing.T) {
+	var err error = &services.ChangeTooSoonError{Remaining: 90 * time.Minute}
+	if !errors.Is(err, services.ErrChangeTooSoon) {
+		t.Errorf("expected error to wrap ErrChangeTooSoon")
+	}
+	if got := handlers.StatusFromError(err); got != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", got, http.StatusTooManyRequests)
+	}
+}
+
+func TestEmailChangeCooldownIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	admin := services.NewBaseAdminService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "email", "Email1!")
+
+	change := func(email string) error {
+		return service.UpdateUserSettings(ctx, &models.UpdateUserSettingsRequest{
+			Email: email, Age: -1, Weight: -1, Height: -1, Bmi: -1,
+		}, username)
+	}
+
+	if err := change(username + "@first.example.com"); err != nil {
+		t.Fatalf("first change: %v", err)
+	}
+	err := change(username + "@second.example.com")
+	var tooSoon *services.ChangeTooSoonError
+	if !errors.As(err, &tooSoon) || tooSoon.Remaining <= 0 {
+		t.Fatalf("second change: got %v, want ChangeTooSoonError", err)
+	}
+
+	// Resubmitting the current email isn't a change.
+	if err := change(username + "@first.example.com"); err != nil {
+		t.Errorf("unchanged email: got %v", err)
+	}
+
+	// Once the window has passed the user can change it again.
+	if _, err := conn.Exec(ctx, "UPDATE users SET email_changed_at = email_changed_at - make_interval(secs => $1) WHERE username = $2",
+		services.EmailChangeCooldown.Seconds(), username); err != nil {
+		t.Fatalf("rewind change time: %v", err)
+	}
+	if err := change(username + "@third.example.com"); err != nil {
+		t.Errorf("change after window: %v", err)
+	}
+
+	if err := admin.SetUserEmail(ctx, "root", username, &models.SetEmailRequest{Email: username + "@admin.example.com"}); err != nil {
+		t.Errorf("admin change within window: %v", err)
+	}
+}
+
+func TestPurgeDeletedUsersIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	admin := services.NewBaseAdminService(conn)
+	ctx := context.Background()
+
+	expired := createTestUser(t, conn, "purgeold", "Purge1!")
+	recent := createTestUser(t, conn, "purgenew", "Purge1!")
+	restored := createTestUser(t, conn, "purgerest", "Purge1!")
+
+	for _, username := range []string{expired, recent, restored} {
+		if err := service.DeleteAccount(ctx, username); err != nil {
+			t.Fatalf("delete %s: %v", username, err)
+		}
+	}
+	if _, err := conn.Exec(ctx, "UPDATE users SET deleted_at = deleted_at - interval '40 days' WHERE username = ANY($1)",
+		[]string{expired, restored}); err != nil {
+		t.Fatalf("backdate deleted_at: %v", err)
+	}
+	if err := admin.RestoreUser(ctx, "root", restored); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	// A batch size of one makes the job loop over several statements.
+	job := services.NewUserPurgeJob(conn)
+	job.Retention = 30 * 24 * time.Hour
+	job.BatchSize = 1
+	purged, err := job.PurgeDeletedUsers(ctx)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged < 1 {
+		t.Errorf("purged %d users, want at least 1", purged)
+	}
+
+	exists := func(username string) bool {
+		var found bool
+		if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", username).Scan(&found); err != nil {
+			t.Fatalf("lookup %s: %v", username, err)
+		}
+		return found
+	}
+	if exists(expired) {
+		t.Errorf("user past the retention window wasn't purged")
+	}
+	if !exists(recent) {
+		t.Errorf("user within the retention window was purged")
+	}
+	if !exists(restored) {
+		t.Errorf("restored user was purged")
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	if err := services.LoginFailure(services.ErrUserNotFound, false); err != services.ErrUnauthorizedUser {
+		t.Errorf("generic mode returned %v, want ErrUnauthorizedUser itself", err)
+	}
+
+	err := services.LoginFailure(services.ErrWrongPassword, true)
+	if !errors.Is(err, services.ErrUnauthorizedUser) || !errors.Is(err, services.ErrWrongPassword) {
+		t.Errorf("detailed error %v should wrap ErrUnauthorizedUser and ErrWrongPassword", err)
+	}
+	if errors.Is(err, services.ErrUserNotFound) {
+		t.Errorf("wrong password error should not wrap ErrUserNotFound")
+	}
+	if err.Error() != services.ErrUnauthorizedUser.Error() {
+		t.Errorf("detailed error message %q leaks the reason", err.Error())
+	}
+	if got := handlers.StatusFromError(err); got != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginDetailedErrorsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "logindetail", "Detail1!")
+
+	for _, detailed := range []bool{false, true} {
+		service.DetailedLoginErrors = detailed
+
+		_, unknown := service.LoginUser(ctx, &models.LoginUserRequest{Login: username + "_missing", Password: "Detail1!"})
+		_, wrong := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Wrong1!"})
+		for _, err := range []error{unknown, wrong} {
+			if !errors.Is(err, services.ErrUnauthorizedUser) {
+				t.Errorf("detailed=%v: got %v, want ErrUnauthorizedUser", detailed, err)
+			}
+		}
+
+		if got := errors.Is(unknown, services.ErrUserNotFound); got != detailed {
+			t.Errorf("detailed=%v: unknown user wraps ErrUserNotFound = %v", detailed, got)
+		}
+		if got := errors.Is(wrong, services.ErrWrongPassword); got != detailed {
+			t.Errorf("detailed=%v: wrong password wraps ErrWrongPassword = %v", detailed, got)
+		}
+	}
+}
+
+func TestLoginTokenSubjectIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "subject", "Subject1!")
+
+	tokenString, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Subject1!"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	subject, _ := token.Claims.(jwt.MapClaims)["sub"].(string)
+	if !models.LooksLikeUUID(subject) {
+		t.Fatalf("got subject %q, want a user id", subject)
+	}
+
+	resolved, err := repository.New(conn).GetUsernameByUserID(ctx, subject)
+	if err != nil {
+		t.Fatalf("resolve subject: %v", err)
+	}
+	if resolved != username {
+		t.Errorf("subject resolved to %q, want %q", resolved, username)
+	}
+}
+
+func TestDiffSettingsSnapshots(t *testing.T) {
+	first := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	snapshots := []repository.ListSettingsSnapshotsRow{
+		{Snapshot: []byte(`{"weight":"80","height":"180","locale":"pl"}`), CreatedAt: first.Add(-time.Hour)},
+		{Snapshot: []byte(`{"weight":"78","height":"180","locale":"pl"}`), CreatedAt: first},
+		{Snapshot: []byte(`{"weight":"78","height":"181","locale":"en"}`), CreatedAt: second},
+	}
+
+	got, err := services.DiffSettingsSnapshots(snapshots)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := []models.FieldChange{
+		{Field: "weight", Old: "80", New: "78", ChangedAt: first},
+		{Field: "height", Old: "180", New: "181", ChangedAt: second},
+		{Field: "locale", Old: "pl", New: "en", ChangedAt: second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got, _ := services.DiffSettingsSnapshots(snapshots[:1]); len(got) != 0 {
+		t.Errorf("single snapshot: got %+v, want no changes", got)
+	}
+}
+
+func TestSettingsChangeLogIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "changelog", "Change1!")
+
+	update := func(req models.UpdateUserSettingsRequest) {
+		t.Helper()
+		if err := service.UpdateUserSettings(ctx, &req, username); err != nil {
+			t.Fatalf("update settings: %v", err)
+		}
+	}
+	update(models.UpdateUserSettingsRequest{Age: -1, Weight: 80, Height: -1, Bmi: -1})
+	update(models.UpdateUserSettingsRequest{Name: "Karol", Age: -1, Weight: 78, Height: -1, Bmi: -1})
+
+	changes, err := service.GetSettingsChangeLog(ctx, username)
+	if err != nil {
+		t.Fatalf("change log: %v", err)
+	}
+
+	got := make([][3]string, len(changes))
+	for i, change := range changes {
+		got[i] = [3]string{change.Field, change.Old, change.New}
+	}
+	want := [][3]string{
+		{"weight", "0", "80"},
+		{"name", "", "Karol"},
+		{"weight", "80", "78"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestValidateTagOrder(t *testing.T) {
+	current := []string{"Wegańska", "Azjatycka", "Orzechy"}
+	tests := []struct {
+		Name    string
+		Ordered []string
+		WantErr bool
+	}{
+		{"Same tags reordered", []string{"Orzechy", "Wegańska", "Azjatycka"}, false},
+		{"Unknown tag", []string{"Orzechy", "Wegańska", "Włoska"}, true},
+		{"Missing tag", []string{"Orzechy", "Wegańska"}, true},
+		{"Duplicate tag", []string{"Orzechy", "Orzechy", "Wegańska"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if err := services.ValidateTagOrder(current, tt.Ordered); (err != nil) != tt.WantErr {
+				t.Errorf("got %v, want error %v", err, tt.WantErr)
+			}
+		})
+	}
+}
+
+func TestReorderUserTagsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	finder := services.NewBaseFinderService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "order", "Reorder1!")
+
+	tags, err := finder.GetTags(ctx)
+	if err != nil || len(tags) < 3 {
+		t.Fatalf("get tags: got %d tags, error %v", len(tags), err)
+	}
+	var names []string
+	for _, tag := range tags[:3] {
+		if err := service.AddUserTag(ctx, username, &models.UserTag{Name: tag.TagName, TagType: tag.TypeName}); err != nil {
+			t.Fatalf("add tag %s: %v", tag.TagName, err)
+		}
+		names = append(names, tag.TagName)
+	}
+
+	reversed := []string{names[2], names[1], names[0]}
+	if err := service.ReorderUserTags(ctx, username, reversed); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+
+	displayed, err := service.DisplayUserTag(ctx, username)
+	if err != nil {
+		t.Fatalf("display tags: %v", err)
+	}
+	var got []string
+	for _, tag := range displayed {
+		got = append(got, tag.Value)
+	}
+	if !slices.Equal(got, reversed) {
+		t.Errorf("got order %v, want %v", got, reversed)
+	}
+
+	if err := service.ReorderUserTags(ctx, username, []string{names[0], names[1], "nie ma takiego tagu"}); !errors.Is(err, services.ErrValidation) {
+		t.Errorf("unknown tag: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestNilRequestArgs(t *testing.T) {
+	ctx := context.Background()
+	users := services.BaseUserService{}
+	finder := services.BaseFinderService{}
+	admin := services.BaseAdminService{}
+	collections := services.BaseCollectionService{}
+	imports := services.BaseImportService{}
+	pantry := services.BasePantryService{}
+	reviews := services.BaseReviewService{}
+	searches := services.BaseSavedSearchService{}
+
+	calls := map[string]func() error{
+		"LoginUser": func() error {
+			_, err := users.LoginUser(ctx, nil)
+			return err
+		},
+		"CreateUser":            func() error { return users.CreateUser(ctx, nil) },
+		"UpdateUserSettings":    func() error { return users.UpdateUserSettings(ctx, nil, "user") },
+		"AddUserTag":            func() error { return users.AddUserTag(ctx, "user", nil) },
+		"SetUserTagWeight":      func() error { return users.SetUserTagWeight(ctx, "user", "tag", nil) },
+		"ChangePassword":        func() error { return users.ChangePassword(ctx, "user", nil) },
+		"AddExcludedIngredient": func() error { return users.AddExcludedIngredient(ctx, "user", nil) },
+		"CreateRecipe":          func() error { return finder.CreateRecipe(ctx, nil, "user") },
+		"SetUserRole":           func() error { return admin.SetUserRole(ctx, "admin", "user", nil) },
+		"SetUserEmail":          func() error { return admin.SetUserEmail(ctx, "admin", "user", nil) },
+		"MergeGuestAccount":     func() error { return users.MergeGuestAccount(ctx, "user", nil) },
+		"MergeAccounts":         func() error { return admin.MergeAccounts(ctx, "admin", "user", nil) },
+		"MergeIntoSelf":         func() error { return users.MergeAccounts(ctx, "user", "user") },
+		"AdminMergeIntoSelf": func() error {
+			return admin.MergeAccounts(ctx, "admin", "user", &models.MergeIntoRequest{Into: "user"})
+		},
+		"CreateCollection": func() error {
+			_, err := collections.CreateCollection(ctx, "user", nil)
+			return err
+		},
+		"ImportRecipes": func() error {
+			_, err := imports.ImportRecipes(ctx, "user", nil)
+			return err
+		},
+		"SetPantryItem": func() error { return pantry.SetPantryItem(ctx, "user", nil) },
+		"AddReview": func() error {
+			_, err := reviews.AddReview(ctx, "user", 1, nil)
+			return err
+		},
+		"SaveSearch": func() error {
+			_, err := searches.SaveSearch(ctx, "user", nil, "name")
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); err != services.ErrValidation {
+				t.Errorf("got %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestTagConflicts(t *testing.T) {
+	matrix := services.ParseTagConflicts(services.TagConflictPairs)
+
+	got := matrix.Conflicts([]string{"Keto", "Polska", "wegańska"})
+	want := []models.TagConflict{{Tags: [2]string{"Keto", "wegańska"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := matrix.Conflicts([]string{"Wegetariańska", "Włoska", "Keto"}); len(got) != 0 {
+		t.Errorf("compatible tags reported as conflicting: %v", got)
+	}
+}
+
+func TestParseTagConflicts(t *testing.T) {
+	matrix := services.ParseTagConflicts("Paleo | Wegańska, broken, A|A, ,Keto|")
+	if got := matrix.Conflicts([]string{"wegańska", "paleo"}); len(got) != 1 {
+		t.Errorf("configured pair not reported: %v", got)
+	}
+	if len(matrix) != 2 {
+		t.Errorf("malformed pairs were kept: %v", matrix)
+	}
+}
+
+func TestDetectTagConflictsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "conflict", "Conflict1!")
+
+	for _, tag := range []models.UserTag{{Name: "Wegańska", TagType: "Dieta"}, {Name: "Polska", TagType: "Region"}, {Name: "Keto", TagType: "Dieta"}} {
+		if err := service.AddUserTag(ctx, username, &tag); err != nil {
+			t.Fatalf("add tag %s: %v", tag.Name, err)
+		}
+	}
+
+	conflicts, err := service.DetectTagConflicts(ctx, username)
+	if err != nil {
+		t.Fatalf("detect conflicts: %v", err)
+	}
+	want := []models.TagConflict{{Tags: [2]string{"Wegańska", "Keto"}}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("got %v, want %v", conflicts, want)
+	}
+}
+
+func TestSignupCheckFormat(t *testing.T) {
+	valid := models.CreateUserRequest{
+		Username:     "karol.k",
+		Passwdhash:   "Gotowanie1",
+		Email:        "karol@example.com",
+		PhoneNumber:  "123456789",
+		Age:          30,
+		Sex:          "male",
+		TermsVersion: "1",
+	}
+	if fields := valid.CheckFormat(); len(fields) != 0 {
+		t.Fatalf("valid form: got %v", fields)
+	}
+
+	tests := map[string]struct {
+		Change func(*models.CreateUserRequest)
+		Field  string
+	}{
+		"short username":  {func(r *models.CreateUserRequest) { r.Username = "kk" }, "username"},
+		"username spaces": {func(r *models.CreateUserRequest) { r.Username = "karol k" }, "username"},
+		"uuid username":   {func(r *models.CreateUserRequest) { r.Username = "0b5e2a34-8e6a-4c1f-9d1e-5f3b2a1c4d6e" }, "username"},
+		"bad email":       {func(r *models.CreateUserRequest) { r.Email = "karol@" }, "email"},
+		"named email":     {func(r *models.CreateUserRequest) { r.Email = "Karol <karol@example.com>" }, "email"},
+		"short password":  {func(r *models.CreateUserRequest) { r.Passwdhash = "Ab1" }, "passwd"},
+		"no digit":        {func(r *models.CreateUserRequest) { r.Passwdhash = "Gotowanie" }, "passwd"},
+		"no uppercase":    {func(r *models.CreateUserRequest) { r.Passwdhash = "gotowanie1" }, "passwd"},
+		"long phone":      {func(r *models.CreateUserRequest) { r.PhoneNumber = "+48123456789000" }, "phone_number"},
+		"missing age":     {func(r *models.CreateUserRequest) { r.Age = 0 }, "age"},
+		"missing sex":     {func(r *models.CreateUserRequest) { r.Sex = "" }, "sex"},
+		"no consent":      {func(r *models.CreateUserRequest) { r.TermsVersion = "" }, "terms_version"},
+		"polish username": {func(r *models.CreateUserRequest) { r.Username = "łukasz" }, ""},
+		"polish password": {func(r *models.CreateUserRequest) { r.Passwdhash = "Żółć12345" }, ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := valid
+			tt.Change(&req)
+			fields := req.CheckFormat()
+			if tt.Field == "" {
+				if len(fields) != 0 {
+					t.Errorf("got %v, want valid", fields)
+				}
+				return
+			}
+			if _, ok := fields[tt.Field]; !ok || len(fields) != 1 {
+				t.Errorf("got %v, want only %s", fields, tt.Field)
+			}
+		})
+	}
+}
+
+func TestValidateSignupIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	taken := createTestUser(t, conn, "signup", "Signup123!")
+
+	result, err := service.ValidateSignup(ctx, &models.CreateUserRequest{
+		Username:    taken,
+		Passwdhash:  "weak",
+		Email:       strings.ToUpper(taken) + "@example.com",
+		PhoneNumber: "123456789",
+		Age:         30,
+		Sex:         "female",
+	})
+	if err != nil {
+		t.Fatalf("validate signup: %v", err)
+	}
+	if result.Valid {
+		t.Error("form with a taken username and weak password reported valid")
+	}
+	for _, field := range []string{"username", "passwd", "email"} {
+		if _, ok := result.Fields[field]; !ok {
+			t.Errorf("missing %s in %v", field, result.Fields)
+		}
+	}
+	if result.Fields["username"] != "is already taken" {
+		t.Errorf("username: got %q", result.Fields["username"])
+	}
+
+	result, err = service.ValidateSignup(ctx, &models.CreateUserRequest{
+		Username:     taken + "x",
+		Passwdhash:   "Signup123!",
+		Email:        taken + "x@example.com",
+		PhoneNumber:  "123456789",
+		Age:          30,
+		Sex:          "female",
+		TermsVersion: services.TermsVersion,
+	})
+	if err != nil || !result.Valid {
+		t.Errorf("free form: got %+v, %v", result, err)
+	}
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", taken+"x").Scan(&exists); err != nil || exists {
+		t.Errorf("validation created the user: %v, %v", exists, err)
+	}
+}
+
+// fakeVerifier accepts only the token "solved" and counts its calls.
+type fakeVerifier struct {
+	calls int
+}
+
+func (f *fakeVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	f.calls++
+	return token == "solved", nil
+}
+
+func TestLoginFailuresWindow(t *testing.T) {
+	failures := services.NewLoginFailures(time.Minute)
+	now := time.Now()
+
+	failures.Fail("Bob", now.Add(-2*time.Minute))
+	failures.Fail("bob", now.Add(-30*time.Second))
+	failures.Fail("bob", now)
+	if got := failures.Count("BOB", now); got != 2 {
+		t.Errorf("got %d failures in the window, want 2", got)
+	}
+
+	failures.Reset("bob")
+	if got := failures.Count("bob", now); got != 0 {
+		t.Errorf("got %d failures after reset, want 0", got)
+	}
+}
+
+func TestLoginFailuresSweepsExpiredLogins(t *testing.T) {
+	failures := services.NewLoginFailures(time.Minute)
+	now := time.Now()
+
+	for i := range 100 {
+		failures.Fail(fmt.Sprintf("user%d", i), now)
+	}
+	failures.Fail("recent", now.Add(50*time.Second))
+	if got := failures.Len(); got != 101 {
+		t.Fatalf("got %d logins kept, want 101", got)
+	}
+
+	// The next failure after a window sweeps out the logins that went quiet.
+	failures.Fail("late", now.Add(90*time.Second))
+	if got := failures.Len(); got != 2 {
+		t.Errorf("got %d logins kept after the window, want recent and late", got)
+	}
+	if got := failures.Count("recent", now.Add(90*time.Second)); got != 1 {
+		t.Errorf("got %d failures for a login still in the window, want 1", got)
+	}
+
+	failures.Sweep(now.Add(time.Hour))
+	if got := failures.Len(); got != 0 {
+		t.Errorf("got %d logins kept after sweeping, want 0", got)
+	}
+}
+
+func TestLoginThrottleSweepsExpiredIPs(t *testing.T) {
+	throttle := &services.LoginThrottle{
+		PerUserIP:    services.NewLoginFailures(time.Minute),
+		PerIP:        services.NewLoginFailures(time.Minute),
+		MaxPerUserIP: 3,
+		MaxPerIP:     100,
+	}
+	now := time.Now()
+
+	for i := range 50 {
+		throttle.Fail("victim", fmt.Sprintf("6.6.6.%d", i), now)
+	}
+	throttle.Fail("victim", "10.0.0.1", now.Add(2*time.Minute))
+	if got := throttle.PerUserIP.Len(); got != 1 {
+		t.Errorf("got %d login and IP pairs kept, want 1", got)
+	}
+	if got := throttle.PerIP.Len(); got != 1 {
+		t.Errorf("got %d IPs kept, want 1", got)
+	}
+}
+
+func TestLoginThrottlePerUserIP(t *testing.T) {
+	throttle := &services.LoginThrottle{
+		PerUserIP:    services.NewLoginFailures(time.Hour),
+		PerIP:        services.NewLoginFailures(time.Hour),
+		MaxPerUserIP: 3,
+		MaxPerIP:     100,
+	}
+	now := time.Now()
+
+	for range 3 {
+		if err := throttle.Check("victim", "6.6.6.6", now); err != nil {
+			t.Fatalf("before the limit: %v", err)
+		}
+		throttle.Fail("victim", "6.6.6.6", now)
+	}
+	if err := throttle.Check("Victim", "6.6.6.6", now); err != services.ErrLoginThrottled {
+		t.Errorf("attacker after the limit: got %v, want ErrLoginThrottled", err)
+	}
+	// The real user, from their own IP, isn't locked out.
+	if err := throttle.Check("victim", "10.0.0.1", now); err != nil {
+		t.Errorf("victim from another IP: %v", err)
+	}
+	if err := throttle.Check("victim", "6.6.6.6", now.Add(2*time.Hour)); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+
+	throttle.Succeed("victim", "6.6.6.6")
+	if err := throttle.Check("victim", "6.6.6.6", now); err != nil {
+		t.Errorf("after a successful login: %v", err)
+	}
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	throttle := &services.LoginThrottle{
+		PerUserIP:    services.NewLoginFailures(time.Hour),
+		PerIP:        services.NewLoginFailures(time.Hour),
+		MaxPerUserIP: 3,
+		MaxPerIP:     5,
+	}
+	now := time.Now()
+
+	// One guess at each of many accounts stays under the per-login limit but
+	// not the IP's.
+	for i := range 5 {
+		login := fmt.Sprintf("user%d", i)
+		if err := throttle.Check(login, "6.6.6.6", now); err != nil {
+			t.Fatalf("guess %d: %v", i, err)
+		}
+		throttle.Fail(login, "6.6.6.6", now)
+		// Logging in to an account of their own doesn't reset the IP's count.
+		throttle.Succeed("attacker", "6.6.6.6")
+	}
+	if err := throttle.Check("user99", "6.6.6.6", now); err != services.ErrLoginThrottled {
+		t.Errorf("new account from the same IP: got %v, want ErrLoginThrottled", err)
+	}
+	if err := throttle.Check("user99", "10.0.0.1", now); err != nil {
+		t.Errorf("other IP: %v", err)
+	}
+
+	throttle.MaxPerIP = 0
+	if err := throttle.Check("user99", "6.6.6.6", now); err != nil {
+		t.Errorf("with the IP limit off: %v", err)
+	}
+	if got := handlers.StatusFromError(services.ErrLoginThrottled); got != http.StatusTooManyRequests {
+		t.Errorf("got status %d for a throttled login", got)
+	}
+}
+
+func TestLoginThrottleIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	service.Throttle.MaxPerUserIP = 2
+	ctx := context.Background()
+	username := createTestUser(t, conn, "throttle", "Throttle1!")
+
+	attacker := models.LoginUserRequest{Login: username, Password: "Wrong1!", RemoteIP: "6.6.6.6"}
+	for range 2 {
+		if _, err := service.LoginUser(ctx, &attacker); !errors.Is(err, services.ErrUnauthorizedUser) {
+			t.Fatalf("wrong password: got %v", err)
+		}
+	}
+	attacker.Password = "Throttle1!"
+	if _, err := service.LoginUser(ctx, &attacker); err != services.ErrLoginThrottled {
+		t.Errorf("right password after the limit: got %v, want ErrLoginThrottled", err)
+	}
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Throttle1!", RemoteIP: "10.0.0.1"}); err != nil {
+		t.Errorf("owner from their own IP: %v", err)
+	}
+}
+
+func TestCaptchaRequiredAfterLoginFailures(t *testing.T) {
+	verifier := &fakeVerifier{}
+	service := services.BaseUserService{
+		Captcha:              verifier,
+		LoginFailures:        services.NewLoginFailures(time.Hour),
+		CaptchaAfterFailures: 2,
+		TermsVersion:         "1",
+	}
+	ctx := context.Background()
+	for range 2 {
+		service.LoginFailures.Fail(services.LoginFailureKey("bob", ""), time.Now())
+	}
+
+	_, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: "bob", Password: "Secret1!"})
+	if err != services.ErrCaptchaRequired {
+		t.Errorf("no token: got %v, want %v", err, services.ErrCaptchaRequired)
+	}
+	_, err = service.LoginUser(ctx, &models.LoginUserRequest{Login: "bob", Password: "Secret1!", CaptchaToken: "bot"})
+	if err != services.ErrCaptchaFailed {
+		t.Errorf("bad token: got %v, want %v", err, services.ErrCaptchaFailed)
+	}
+	if verifier.calls != 1 {
+		t.Errorf("verifier called %d times, want 1", verifier.calls)
+	}
+
+	err = service.CreateUser(ctx, &models.CreateUserRequest{
+		Username: "bob", Passwdhash: "Secret1!", Email: "bob@example.com",
+		PhoneNumber: "123456789", Age: 30, Sex: "M", TermsVersion: "1", CaptchaToken: "bot",
+	})
+	if err != services.ErrCaptchaFailed {
+		t.Errorf("signup with bad token: got %v, want %v", err, services.ErrCaptchaFailed)
+	}
+
+	if got := handlers.StatusFromError(services.ErrCaptchaRequired); got != http.StatusPreconditionRequired {
+		t.Errorf("got status %d for a missing captcha", got)
+	}
+}
+
+func TestMergeGuestAccountThrottled(t *testing.T) {
+	service := services.BaseUserService{
+		Captcha:              &fakeVerifier{},
+		LoginFailures:        services.NewLoginFailures(time.Hour),
+		CaptchaAfterFailures: 2,
+		Throttle: &services.LoginThrottle{
+			PerUserIP:    services.NewLoginFailures(time.Hour),
+			PerIP:        services.NewLoginFailures(time.Hour),
+			MaxPerUserIP: 3,
+			MaxPerIP:     100,
+		},
+	}
+	ctx := context.Background()
+	req := &models.MergeAccountRequest{Login: "guest", Password: "Guess1!", RemoteIP: "6.6.6.6"}
+
+	// Failed merges and logins count the same, so neither is a way around the
+	// other's limits.
+	for range 2 {
+		service.LoginFailures.Fail(services.LoginFailureKey("guest", "6.6.6.6"), time.Now())
+	}
+	if err := service.MergeGuestAccount(ctx, "user", req); err != services.ErrCaptchaRequired {
+		t.Errorf("after failures: got %v, want %v", err, services.ErrCaptchaRequired)
+	}
+
+	for range 3 {
+		service.Throttle.Fail("guest", "6.6.6.6", time.Now())
+	}
+	req.CaptchaToken = "solved"
+	if err := service.MergeGuestAccount(ctx, "user", req); err != services.ErrLoginThrottled {
+		t.Errorf("over the limit: got %v, want %v", err, services.ErrLoginThrottled)
+	}
+}
+
+func TestCaptchaAfterLoginFailuresIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	service.Captcha = &fakeVerifier{}
+	service.CaptchaAfterFailures = 2
+	ctx := context.Background()
+	username := createTestUser(t, conn, "captcha", "Captcha1!")
+
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Captcha1!"}); err != nil {
+		t.Fatalf("first login needs no captcha: %v", err)
+	}
+	for range 2 {
+		if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Wrong1!"}); !errors.Is(err, services.ErrUnauthorizedUser) {
+			t.Fatalf("wrong password: got %v", err)
+		}
+	}
+
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Captcha1!"}); err != services.ErrCaptchaRequired {
+		t.Errorf("after failures: got %v, want %v", err, services.ErrCaptchaRequired)
+	}
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Captcha1!", CaptchaToken: "solved"}); err != nil {
+		t.Errorf("with a solved captcha: %v", err)
+	}
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: username, Password: "Captcha1!"}); err != nil {
+		t.Errorf("success resets the failures: %v", err)
+	}
+}
+
+func TestSignupRequiresTermsConsent(t *testing.T) {
+	service := services.BaseUserService{TermsVersion: "2"}
+	signup := models.CreateUserRequest{
+		Username: "ania", Passwdhash: "Gotowanie1", Email: "ania@example.com",
+		PhoneNumber: "123456789", Age: 30, Sex: "female",
+	}
+
+	if err := signup.Validate(); err == nil {
+		t.Error("signup without consent passed validation")
+	}
+	if err := service.CreateUser(context.Background(), &signup); err == nil {
+		t.Error("signup without consent accepted")
+	}
+	signup.TermsVersion = "1"
+	if err := service.CreateUser(context.Background(), &signup); err != services.ErrValidation {
+		t.Errorf("outdated terms: got %v, want %v", err, services.ErrValidation)
+	}
+	if err := service.RecordConsent(context.Background(), "ania", "1"); err != services.ErrValidation {
+		t.Errorf("consent to outdated terms: got %v, want %v", err, services.ErrValidation)
+	}
+}
+
+func TestTermsReconsentIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	ctx := context.Background()
+	username := createTestUser(t, conn, "terms", "Terms123!")
+
+	if ok, err := service.HasAcceptedCurrentTerms(ctx, username); err != nil || !ok {
+		t.Fatalf("terms accepted at signup: got %v, %v", ok, err)
+	}
+
+	service.TermsVersion = services.TermsVersion + ".1"
+	if ok, err := service.HasAcceptedCurrentTerms(ctx, username); err != nil || ok {
+		t.Errorf("after a version bump: got %v, %v, want not accepted", ok, err)
+	}
+
+	if err := service.RecordConsent(ctx, username, service.TermsVersion); err != nil {
+		t.Fatalf("record consent: %v", err)
+	}
+	status, err := service.GetTermsStatus(ctx, username)
+	if err != nil || !status.Accepted || status.AcceptedVersion != service.TermsVersion || status.AcceptedAt == nil {
+		t.Errorf("after consent: got %+v, %v", status, err)
+	}
+}
+
+func TestMergeAccountsIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	finder := services.NewBaseFinderService(conn)
+	favorites := services.NewBaseFavoriteService(conn)
+	ctx := context.Background()
+
+	source := createTestUser(t, conn, "mergefrom", "Merge1!")
+	target := createTestUser(t, conn, "mergeinto", "Merge1!")
+
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: source, Limit: 2})
+	if err != nil || len(recipes) < 2 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+	unique, shared := recipes[0].ID, recipes[1].ID
+	for _, favorite := range []struct {
+		username string
+		recipeID int32
+	}{{source, unique}, {source, shared}, {target, shared}} {
+		if err := favorites.AddFavorite(ctx, favorite.username, favorite.recipeID); err != nil {
+			t.Fatalf("add favorite: %v", err)
+		}
+	}
+
+	if err := service.MergeGuestAccount(ctx, target, &models.MergeAccountRequest{Login: source, Password: "Wrong1!"}); err != services.ErrUnauthorizedUser {
+		t.Fatalf("merge with wrong password: got %v, want ErrUnauthorizedUser", err)
+	}
+	if err := service.MergeGuestAccount(ctx, target, &models.MergeAccountRequest{Login: source, Password: "Merge1!"}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	merged, err := favorites.ListFavorites(ctx, target)
+	if err != nil {
+		t.Fatalf("list favorites: %v", err)
+	}
+	count := map[int32]int{}
+	for _, favorite := range merged {
+		count[favorite.ID]++
+	}
+	if len(merged) != 2 || count[unique] != 1 || count[shared] != 1 {
+		t.Errorf("target favorites %v, want %d and %d once each", count, unique, shared)
+	}
+
+	if _, err := service.LoginUser(ctx, &models.LoginUserRequest{Login: source, Password: "Merge1!"}); err == nil {
+		t.Error("merged account can still log in")
+	}
+	if err := service.MergeAccounts(ctx, source, target); err != services.ErrUserNotFound {
+		t.Errorf("merge again: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestMergeAccountsFavoritesLimitIntegration(t *testing.T) {
+	conn := testConnection(t)
+	service := services.NewBaseUserService(conn)
+	service.FavoritesLimit = 1
+	finder := services.NewBaseFinderService(conn)
+	favorites := services.NewBaseFavoriteService(conn)
+	ctx := context.Background()
+
+	source := createTestUser(t, conn, "mergelimfrom", "Merge1!")
+	target := createTestUser(t, conn, "mergelimto", "Merge1!")
+	recipes, err := finder.FindRecipe(ctx, models.RecipesFinderParams{Username: source, Limit: 2})
+	if err != nil || len(recipes) < 2 {
+		t.Fatalf("find recipes: got %d recipes, error %v", len(recipes), err)
+	}
+	if err := favorites.AddFavorite(ctx, target, recipes[0].ID); err != nil {
+		t.Fatalf("add favorite: %v", err)
+	}
+	if err := favorites.AddFavorite(ctx, source, recipes[1].ID); err != nil {
+		t.Fatalf("add favorite: %v", err)
+	}
+
+	if err := service.MergeAccounts(ctx, source, target); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	kept, err := favorites.ListFavorites(ctx, target)
+	if err != nil || len(kept) != 1 {
+		t.Errorf("got favorites %v, %v, want 1", kept, err)
+	}
+	archived, err := favorites.ListArchivedFavorites(ctx, target)
+	if err != nil || len(archived) != 1 {
+		t.Errorf("got archived favorites %v, %v, want the one over the limit", archived, err)
+	}
+}